@@ -89,7 +89,7 @@ func main() {
 					) @function
 				`),
 				api.WithQuery("comments", `
-					(comment) @comment
+					((comment)+ @comment . (_) @documented)
 				`),
 			)
 
@@ -98,13 +98,19 @@ func main() {
 				context.Background(),
 				func(results api.QueryResults) (any, error) {
 					var allFunctions []FunctionInfo
-					fileComments := make(map[string][]tree_sitter.Capture)
+					// comment nodes by file and by the row of the node they document
+					fileComments := make(map[string]map[uint32][]tree_sitter.CaptureNode)
 
 					// First, collect all comments to match with functions
 					for fileName, fileResults := range results {
 						if commentResults, ok := fileResults["comments"]; ok {
+							fileComments[fileName] = make(map[uint32][]tree_sitter.CaptureNode)
 							for _, match := range commentResults.Matches {
-								fileComments[fileName] = append(fileComments[fileName], match["comment"])
+								documented := match["documented"]
+								if documented.Type == "comment" {
+									continue
+								}
+								fileComments[fileName][documented.StartPoint.Row] = match["comment"].TrailingNodes()
 							}
 						}
 					}
@@ -166,28 +172,27 @@ func main() {
 						return params
 					}
 
-					// Helper to find the nearest comment above a function
+					// Helper to find the comment above a function
 					findDocComment := func(fileName string, fnStartRow uint32) string {
-						var nearestComment tree_sitter.Capture
-						nearestDistance := uint32(10) // Only look for comments within 10 lines
-
-						for _, comment := range fileComments[fileName] {
-							if comment.EndPoint.Row < fnStartRow &&
-								fnStartRow-comment.EndPoint.Row <= nearestDistance {
-								nearestDistance = fnStartRow - comment.EndPoint.Row
-								nearestComment = comment
-							}
+						nodes := fileComments[fileName][fnStartRow]
+						if len(nodes) == 0 {
+							return ""
 						}
 
-						if nearestDistance <= 3 { // Only use comments within 3 lines
-							// Clean the comment text
-							text := nearestComment.Text
-							text = strings.TrimSpace(text)
-
-							// Remove comment markers
-							text = strings.TrimPrefix(text, "//")
-							text = strings.TrimPrefix(text, "/*")
-							text = strings.TrimSuffix(text, "*/")
+						if fnStartRow-nodes[len(nodes)-1].EndPoint.Row <= 3 { // Only use comments within 3 lines
+							// Clean the text of each comment, so that consecutive
+							// line comments form a single docstring
+							texts := make([]string, 0, len(nodes))
+							for _, node := range nodes {
+								text := strings.TrimSpace(node.Text)
+
+								// Remove comment markers
+								text = strings.TrimPrefix(text, "//")
+								text = strings.TrimPrefix(text, "/*")
+								text = strings.TrimSuffix(text, "*/")
+								texts = append(texts, text)
+							}
+							text := strings.Join(texts, "\n")
 
 							// Process JSDoc style comments
 							lines := strings.Split(text, "\n")
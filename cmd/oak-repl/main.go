@@ -12,6 +12,7 @@ import (
 	"github.com/go-go-golems/bobatea/pkg/repl"
 	"github.com/go-go-golems/oak/pkg/api"
 	pm "github.com/go-go-golems/oak/pkg/patternmatcher"
+	"github.com/go-go-golems/oak/pkg/playground"
 )
 
 type PatternEvaluator struct {
@@ -19,6 +20,17 @@ type PatternEvaluator struct {
 	currentLanguage string
 	content         []byte
 	lispAST         pm.Expression
+	// session is the parsed current file, created by the first /query on it
+	session *playground.Session
+}
+
+// closeSession releases the session of the current file, when the file or
+// its language change.
+func (e *PatternEvaluator) closeSession() {
+	if e.session != nil {
+		e.session.Close()
+		e.session = nil
+	}
 }
 
 func (e *PatternEvaluator) EvaluateStream(ctx context.Context, code string, emit func(repl.Event)) error {
@@ -49,6 +61,7 @@ func (e *PatternEvaluator) evaluateCommand(ctx context.Context, code string) (st
 			return "usage: /lang <language>", fmt.Errorf("invalid usage")
 		}
 		e.currentLanguage = args[0]
+		e.closeSession()
 		return "language set", nil
 	case "load":
 		if len(args) != 1 {
@@ -58,6 +71,7 @@ func (e *PatternEvaluator) evaluateCommand(ctx context.Context, code string) (st
 		if err != nil {
 			return err.Error(), err
 		}
+		e.closeSession()
 		e.currentFile = args[0]
 		e.content = b
 		return fmt.Sprintf("loaded %s (%d bytes)", args[0], len(b)), nil
@@ -93,6 +107,26 @@ func (e *PatternEvaluator) evaluateCommand(ctx context.Context, code string) (st
 			out += fmt.Sprintf("%d) %s\n", i+1, b.String())
 		}
 		return out, nil
+	case "query":
+		if e.currentFile == "" {
+			return "usage: /load <file> then /query <query>", fmt.Errorf("missing context")
+		}
+		if e.session == nil {
+			s, err := playground.NewSession(ctx, e.currentFile, e.content, e.currentLanguage)
+			if err != nil {
+				return err.Error(), err
+			}
+			e.session = s
+		}
+		ev := e.session.Run(rawArgs)
+		if ev.Err != nil {
+			return ev.Summary(), ev.Err
+		}
+		out := ev.Summary() + "\n"
+		for _, h := range ev.Highlights {
+			out += h.String() + "\n"
+		}
+		return out, nil
 	default:
 		return "", nil
 	}
@@ -117,7 +151,9 @@ func main() {
 	model := repl.NewModel(evaluator, config, bus.Publisher)
 
 	p := tea.NewProgram(model, tea.WithAltScreen())
-	if _, err := p.Run(); err != nil {
+	_, err = p.Run()
+	evaluator.closeSession()
+	if err != nil {
 		log.Println(err)
 		os.Exit(1)
 	}
@@ -23,10 +23,6 @@ var ASTCmd = &cobra.Command{
 		format, _ := cmd.Flags().GetString("format")
 		includeAnonymous, _ := cmd.Flags().GetBool("include-anonymous")
 
-		if language == "" {
-			cobra.CheckErr(fmt.Errorf("--language is required"))
-		}
-
 		// Normalize format
 		switch format {
 		case "lisp", "verbose", "text", "json", "yaml", "xml":
@@ -34,15 +30,6 @@ var ASTCmd = &cobra.Command{
 			cobra.CheckErr(fmt.Errorf("invalid --format: %s", format))
 		}
 
-		// Prepare parser if needed
-		var lang *sitter.Language
-		var err error
-		if format != "lisp" {
-			lang, err = pkg.LanguageNameToSitterLanguage(language)
-			cobra.CheckErr(err)
-		}
-
-		qb := api.NewQueryBuilder(api.WithLanguage(language))
 		ctx := context.Background()
 
 		for _, f := range args {
@@ -51,6 +38,23 @@ var ASTCmd = &cobra.Command{
 			content, err := os.ReadFile(filePath)
 			cobra.CheckErr(err)
 
+			// detect the language of each file if none was given
+			languageName := language
+			if languageName == "" {
+				rl, err := pkg.DetectLanguage(ctx, filePath, content)
+				cobra.CheckErr(err)
+				languageName = rl.Name
+			}
+
+			// Prepare parser if needed
+			var lang *sitter.Language
+			if format != "lisp" {
+				lang, err = pkg.LanguageNameToSitterLanguage(languageName)
+				cobra.CheckErr(err)
+			}
+
+			qb := api.NewQueryBuilder(api.WithLanguage(languageName))
+
 			fmt.Printf("=== %s (%s) ===\n", filePath, format)
 
 			switch format {
@@ -91,7 +95,7 @@ var ASTCmd = &cobra.Command{
 }
 
 func init() {
-	ASTCmd.Flags().String("language", "", "Language of the source files (required)")
+	ASTCmd.Flags().String("language", "", "Language of the source files (detected from each file if not set)")
 	ASTCmd.Flags().String("format", "lisp", "Output format: lisp|verbose|text|json|yaml|xml")
 	ASTCmd.Flags().Bool("include-anonymous", false, "Include anonymous nodes in lisp output")
 }
@@ -0,0 +1,58 @@
+package commands
+
+import (
+	"fmt"
+
+	tree_sitter "github.com/go-go-golems/oak/pkg/tree-sitter"
+	"github.com/spf13/cobra"
+)
+
+// CacheCmd groups the commands managing the query results cache used by --cache
+var CacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage the query results cache",
+}
+
+var cacheStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Print the number of entries and the size of the query results cache",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cache := newResultCacheFromFlags(cmd)
+
+		stats, err := cache.Stats()
+		cobra.CheckErr(err)
+
+		fmt.Printf("Directory: %s\n", stats.Dir)
+		fmt.Printf("Entries:   %d\n", stats.Entries)
+		fmt.Printf("Size:      %d bytes\n", stats.Bytes)
+	},
+}
+
+var cacheClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Remove all the entries of the query results cache",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cache := newResultCacheFromFlags(cmd)
+
+		stats, err := cache.Stats()
+		cobra.CheckErr(err)
+		cobra.CheckErr(cache.Clear())
+
+		fmt.Printf("Removed %d entries from %s\n", stats.Entries, stats.Dir)
+	},
+}
+
+func newResultCacheFromFlags(cmd *cobra.Command) *tree_sitter.ResultCache {
+	cacheDir, _ := cmd.Flags().GetString("cache-dir")
+	cache, err := tree_sitter.NewResultCache(cacheDir)
+	cobra.CheckErr(err)
+	return cache
+}
+
+func init() {
+	CacheCmd.PersistentFlags().String("cache-dir", "", "Directory of the query results cache (default $HOME/.oak/cache)")
+	CacheCmd.AddCommand(cacheStatsCmd)
+	CacheCmd.AddCommand(cacheClearCmd)
+}
@@ -0,0 +1,178 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/go-go-golems/glazed/pkg/cli"
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/fields"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/settings"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/go-go-golems/oak/pkg"
+	"github.com/go-go-golems/oak/pkg/callgraph"
+	cmds2 "github.com/go-go-golems/oak/pkg/cmds"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// NewCallGraphCmd returns the command printing the call graph of sources.
+func NewCallGraphCmd() (*cobra.Command, error) {
+	c, err := NewCallGraphCommand()
+	if err != nil {
+		return nil, err
+	}
+	return cli.BuildCobraCommand(c)
+}
+
+type CallGraphCommand struct {
+	*cmds.CommandDescription
+}
+
+var _ cmds.GlazeCommand = (*CallGraphCommand)(nil)
+
+type CallGraphSettings struct {
+	Format   string   `glazed:"format"`
+	External bool     `glazed:"external"`
+	Glob     []string `glazed:"glob"`
+	Workers  int      `glazed:"workers"`
+	Sources  []string `glazed:"sources"`
+}
+
+func NewCallGraphCommand() (*CallGraphCommand, error) {
+	glazeSection, err := settings.NewGlazedSchema()
+	if err != nil {
+		return nil, err
+	}
+
+	return &CallGraphCommand{
+		CommandDescription: cmds.NewCommandDescription(
+			"callgraph",
+			cmds.WithShort("Print the functions called by each function of the Go and TypeScript files of sources"),
+			cmds.WithLong("Print the functions called by each function of the Go and TypeScript files of sources, "+
+				"recursing into directories. Calls are resolved on a best-effort basis using receiver types and import aliases. "+
+				"The rows format outputs one row per caller and callee through the glaze flags, "+
+				"the others print the whole graph."),
+			cmds.WithFlags(
+				fields.New(
+					"format",
+					fields.TypeChoice,
+					fields.WithHelp("Output format"),
+					fields.WithChoices("rows", "dot", "mermaid", "json"),
+					fields.WithDefault("rows"),
+				),
+				fields.New(
+					"external",
+					fields.TypeBool,
+					fields.WithHelp("Keep the calls to functions that are not defined in sources, such as those of imported packages"),
+					fields.WithDefault(false),
+				),
+				fields.New(
+					"glob",
+					fields.TypeStringList,
+					fields.WithHelp("Glob patterns of the files to analyze in directories (default: all Go and TypeScript files)"),
+				),
+				fields.New(
+					"workers",
+					fields.TypeInteger,
+					fields.WithHelp("Number of files to parse in parallel"),
+					fields.WithDefault(4),
+				),
+			),
+			cmds.WithFlags(cmds2.NewSourceFilterFlags()...),
+			cmds.WithArguments(
+				fields.New(
+					"sources",
+					fields.TypeStringList,
+					fields.WithHelp("Files and directories to analyze"),
+					fields.WithDefault([]string{"."}),
+				),
+			),
+			cmds.WithSections(glazeSection),
+		),
+	}, nil
+}
+
+func (c *CallGraphCommand) RunIntoGlazeProcessor(
+	ctx context.Context,
+	parsedValues *values.Values,
+	gp middlewares.Processor,
+) error {
+	s := &CallGraphSettings{}
+	err := parsedValues.DecodeSectionInto(values.DefaultSlug, s)
+	if err != nil {
+		return err
+	}
+	sf := &cmds2.SourceFilterSettings{}
+	err = parsedValues.DecodeSectionInto(values.DefaultSlug, sf)
+	if err != nil {
+		return err
+	}
+
+	glob := s.Glob
+	if len(glob) == 0 {
+		for _, name := range callgraph.Languages() {
+			globs, err := pkg.DefaultLanguageRegistry.Globs(name)
+			if err != nil {
+				return err
+			}
+			glob = append(glob, globs...)
+		}
+	}
+	sources, err := cmds2.CollectSources(s.Sources, glob, sf.CollectorOptions(nil)...)
+	if err != nil {
+		return err
+	}
+
+	g, err := callgraph.Build(ctx, sources,
+		callgraph.WithExternal(s.External), callgraph.WithWorkers(s.Workers),
+		callgraph.WithFileErrors(printFileError))
+	if err != nil {
+		return err
+	}
+
+	switch s.Format {
+	case "dot":
+		err = g.WriteDOT(os.Stdout)
+	case "mermaid":
+		err = g.WriteMermaid(os.Stdout)
+	case "json":
+		err = g.WriteJSON(os.Stdout)
+	case "rows":
+		return addCallGraphRows(ctx, gp, g)
+	default:
+		return errors.Errorf("unknown format %s", s.Format)
+	}
+	if err != nil {
+		return err
+	}
+	return &cmds.ExitWithoutGlazeError{}
+}
+
+// printFileError warns on stderr about a file left out of a graph, since the
+// graph itself can be written to stdout.
+func printFileError(fileName string, err error) {
+	_, _ = fmt.Fprintf(os.Stderr, "warning: could not process %s: %v\n", fileName, err)
+}
+
+func addCallGraphRows(ctx context.Context, gp middlewares.Processor, g *callgraph.Graph) error {
+	for _, e := range g.Edges {
+		row := types.NewRow(
+			types.MRP("caller", e.Caller),
+			types.MRP("callee", e.Callee),
+			types.MRP("calleeKind", g.Node(e.Callee).Kind),
+			types.MRP("count", e.Count),
+			types.MRP("file", e.File),
+			types.MRP("row", e.Row),
+			types.MRP("column", e.Column),
+		)
+		err := gp.AddRow(ctx, row)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package commands
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/go-go-golems/glazed/pkg/cli"
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/fields"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/settings"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/go-go-golems/oak/pkg"
+	cmds2 "github.com/go-go-golems/oak/pkg/cmds"
+	"github.com/go-go-golems/oak/pkg/deps"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// NewDepsCmd returns the command printing the module dependency graph of
+// sources.
+func NewDepsCmd() (*cobra.Command, error) {
+	c, err := NewDepsCommand()
+	if err != nil {
+		return nil, err
+	}
+	return cli.BuildCobraCommand(c)
+}
+
+type DepsCommand struct {
+	*cmds.CommandDescription
+}
+
+var _ cmds.GlazeCommand = (*DepsCommand)(nil)
+
+type DepsSettings struct {
+	Format      string   `glazed:"format"`
+	External    bool     `glazed:"external"`
+	FailOnCycle bool     `glazed:"fail-on-cycle"`
+	Glob        []string `glazed:"glob"`
+	Workers     int      `glazed:"workers"`
+	Sources     []string `glazed:"sources"`
+}
+
+func NewDepsCommand() (*DepsCommand, error) {
+	glazeSection, err := settings.NewGlazedSchema()
+	if err != nil {
+		return nil, err
+	}
+
+	return &DepsCommand{
+		CommandDescription: cmds.NewCommandDescription(
+			"deps",
+			cmds.WithShort("Print the module dependency graph of sources from their import statements"),
+			cmds.WithLong("Print the module dependency graph of the Go, TypeScript, JavaScript, Python, PHP, Rust and Java files "+
+				"of sources, recursing into directories, with import cycles and fan-in/fan-out metrics. "+
+				"Go modules are package directories, and the modules of the other languages are files. "+
+				"The rows format outputs one row per module through the glaze flags, the others print the whole graph."),
+			cmds.WithFlags(
+				fields.New(
+					"format",
+					fields.TypeChoice,
+					fields.WithHelp("Output format"),
+					fields.WithChoices("rows", "dot", "json"),
+					fields.WithDefault("rows"),
+				),
+				fields.New(
+					"external",
+					fields.TypeBool,
+					fields.WithHelp("Keep the imports of modules that are not part of sources, such as standard library or third-party packages"),
+					fields.WithDefault(false),
+				),
+				fields.New(
+					"fail-on-cycle",
+					fields.TypeBool,
+					fields.WithHelp("Exit with an error after the output if sources contain import cycles"),
+					fields.WithDefault(false),
+				),
+				fields.New(
+					"glob",
+					fields.TypeStringList,
+					fields.WithHelp("Glob patterns of the files to analyze in directories (default: all the files of the supported languages)"),
+				),
+				fields.New(
+					"workers",
+					fields.TypeInteger,
+					fields.WithHelp("Number of files to parse in parallel"),
+					fields.WithDefault(4),
+				),
+			),
+			cmds.WithFlags(cmds2.NewSourceFilterFlags()...),
+			cmds.WithArguments(
+				fields.New(
+					"sources",
+					fields.TypeStringList,
+					fields.WithHelp("Files and directories to analyze"),
+					fields.WithDefault([]string{"."}),
+				),
+			),
+			cmds.WithSections(glazeSection),
+		),
+	}, nil
+}
+
+func (c *DepsCommand) RunIntoGlazeProcessor(
+	ctx context.Context,
+	parsedValues *values.Values,
+	gp middlewares.Processor,
+) error {
+	s := &DepsSettings{}
+	err := parsedValues.DecodeSectionInto(values.DefaultSlug, s)
+	if err != nil {
+		return err
+	}
+	sf := &cmds2.SourceFilterSettings{}
+	err = parsedValues.DecodeSectionInto(values.DefaultSlug, sf)
+	if err != nil {
+		return err
+	}
+
+	glob := s.Glob
+	if len(glob) == 0 {
+		for _, name := range deps.Languages() {
+			globs, err := pkg.DefaultLanguageRegistry.Globs(name)
+			if err != nil {
+				return err
+			}
+			glob = append(glob, globs...)
+		}
+	}
+	sources, err := cmds2.CollectSources(s.Sources, glob, sf.CollectorOptions(nil)...)
+	if err != nil {
+		return err
+	}
+
+	g, err := deps.Build(ctx, sources,
+		deps.WithExternal(s.External), deps.WithWorkers(s.Workers), deps.WithFileErrors(printFileError))
+	if err != nil {
+		return err
+	}
+
+	switch s.Format {
+	case "dot":
+		err = g.WriteDOT(os.Stdout)
+	case "json":
+		err = g.WriteJSON(os.Stdout)
+	case "rows":
+		err = addDepsRows(ctx, gp, g)
+		if err != nil || !s.FailOnCycle || len(g.Cycles) == 0 {
+			return err
+		}
+		return cmds2.CloseAndFail(ctx, gp, cyclesError(g))
+	default:
+		return errors.Errorf("unknown format %s", s.Format)
+	}
+	if err != nil {
+		return err
+	}
+	if s.FailOnCycle && len(g.Cycles) > 0 {
+		return cyclesError(g)
+	}
+	return &cmds.ExitWithoutGlazeError{}
+}
+
+func addDepsRows(ctx context.Context, gp middlewares.Processor, g *deps.Graph) error {
+	for _, n := range g.Nodes {
+		row := types.NewRow(
+			types.MRP("module", n.ID),
+			types.MRP("language", n.Language),
+			types.MRP("external", n.External),
+			types.MRP("fanIn", n.FanIn),
+			types.MRP("fanOut", n.FanOut),
+			types.MRP("instability", n.Instability),
+			types.MRP("inCycle", n.InCycle),
+			types.MRP("imports", g.Imports(n.ID)),
+		)
+		err := gp.AddRow(ctx, row)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func cyclesError(g *deps.Graph) error {
+	cycles := make([]string, 0, len(g.Cycles))
+	for _, cycle := range g.Cycles {
+		cycles = append(cycles, strings.Join(cycle, ", "))
+	}
+	return errors.Errorf("found %d import cycles:\n  %s", len(g.Cycles), strings.Join(cycles, "\n  "))
+}
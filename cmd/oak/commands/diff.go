@@ -0,0 +1,245 @@
+package commands
+
+import (
+	"context"
+	"os"
+
+	"github.com/go-go-golems/glazed/pkg/cli"
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/fields"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/settings"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/go-go-golems/oak/pkg"
+	cmds2 "github.com/go-go-golems/oak/pkg/cmds"
+	"github.com/go-go-golems/oak/pkg/diff"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// NewDiffCmd returns the command comparing the named nodes of two versions
+// of a file.
+func NewDiffCmd() (*cobra.Command, error) {
+	c, err := NewDiffCommand()
+	if err != nil {
+		return nil, err
+	}
+	return cli.BuildCobraCommand(c)
+}
+
+type DiffCommand struct {
+	*cmds.CommandDescription
+}
+
+var _ cmds.GlazeCommand = (*DiffCommand)(nil)
+
+type DiffSettings struct {
+	Language     string `glazed:"language"`
+	KeyQuery     string `glazed:"key-query"`
+	KeyQueryFile string `glazed:"key-query-file"`
+	Format       string `glazed:"format"`
+	Show         string `glazed:"show"`
+	Context      int    `glazed:"context"`
+	Old          string `glazed:"old"`
+	New          string `glazed:"new"`
+}
+
+func NewDiffCommand() (*DiffCommand, error) {
+	glazeSection, err := settings.NewGlazedSchema()
+	if err != nil {
+		return nil, err
+	}
+
+	return &DiffCommand{
+		CommandDescription: cmds.NewCommandDescription(
+			"diff",
+			cmds.WithShort("Compare the functions, types and members of two versions of a file"),
+			cmds.WithLong("Compare the parse trees of two versions of a file, and report the named nodes, "+
+				"such as functions, methods, structs and class members, that were added, removed, modified or moved. "+
+				"Nodes are matched across versions by the key found by a key query, and formatting changes are ignored. "+
+				"The rows format outputs one row per change through the glaze flags, the text format prints a summary."),
+			cmds.WithFlags(
+				fields.New(
+					"language",
+					fields.TypeString,
+					fields.WithHelp("Language of the files (detected from the old file if not set)"),
+				),
+				fields.New(
+					"key-query",
+					fields.TypeString,
+					fields.WithHelp("Key query capturing the compared nodes as @definition.<kind> and their key parts (default: the built-in query of the language)"),
+				),
+				fields.New(
+					"key-query-file",
+					fields.TypeString,
+					fields.WithHelp("File containing the key query"),
+				),
+				fields.New(
+					"format",
+					fields.TypeChoice,
+					fields.WithHelp("Output format"),
+					fields.WithChoices("rows", "text"),
+					fields.WithDefault("rows"),
+				),
+				fields.New(
+					"show",
+					fields.TypeChoice,
+					fields.WithHelp("Diff printed below modified nodes in the text format: none, the source text, or the syntax tree"),
+					fields.WithChoices("none", "text", "ast"),
+					fields.WithDefault("none"),
+				),
+				fields.New(
+					"context",
+					fields.TypeInteger,
+					fields.WithHelp("Number of context lines of the diffs of modified nodes"),
+					fields.WithDefault(3),
+				),
+			),
+			cmds.WithArguments(
+				fields.New(
+					"old",
+					fields.TypeString,
+					fields.WithHelp("Old version of the file"),
+					fields.WithRequired(true),
+				),
+				fields.New(
+					"new",
+					fields.TypeString,
+					fields.WithHelp("New version of the file"),
+					fields.WithRequired(true),
+				),
+			),
+			cmds.WithSections(glazeSection),
+		),
+	}, nil
+}
+
+func (c *DiffCommand) RunIntoGlazeProcessor(
+	ctx context.Context,
+	parsedValues *values.Values,
+	gp middlewares.Processor,
+) error {
+	s := &DiffSettings{}
+	err := parsedValues.DecodeSectionInto(values.DefaultSlug, s)
+	if err != nil {
+		return err
+	}
+
+	oldSource, err := os.ReadFile(s.Old)
+	if err != nil {
+		return err
+	}
+	newSource, err := os.ReadFile(s.New)
+	if err != nil {
+		return err
+	}
+
+	language := s.Language
+	if language == "" {
+		rl, err := pkg.DetectLanguage(ctx, s.Old, oldSource)
+		if err != nil {
+			return err
+		}
+		language = rl.Name
+	}
+
+	keyQuery := s.KeyQuery
+	switch {
+	case s.KeyQuery != "" && s.KeyQueryFile != "":
+		return errors.New("--key-query and --key-query-file are mutually exclusive")
+	case s.KeyQueryFile != "":
+		content, err := os.ReadFile(s.KeyQueryFile)
+		if err != nil {
+			return err
+		}
+		keyQuery = string(content)
+	case keyQuery == "":
+		var ok bool
+		keyQuery, ok = diff.KeyQuery(language)
+		if !ok {
+			return errors.Errorf("there is no key query for language %s, use --key-query", language)
+		}
+	}
+
+	oc := &cmds2.OakCommand{Language: language}
+	lang, err := oc.GetLanguage()
+	if err != nil {
+		return err
+	}
+	items := func(source []byte) ([]*diff.Item, error) {
+		tree, err := oc.Parse(ctx, nil, source)
+		if err != nil {
+			return nil, err
+		}
+		return diff.Items(lang, tree, source, keyQuery)
+	}
+	oldItems, err := items(oldSource)
+	if err != nil {
+		return errors.Wrapf(err, "could not parse %s", s.Old)
+	}
+	newItems, err := items(newSource)
+	if err != nil {
+		return errors.Wrapf(err, "could not parse %s", s.New)
+	}
+	changes := diff.Structural(oldItems, newItems)
+
+	switch s.Format {
+	case "text":
+		err = diff.WriteSummary(os.Stdout, s.Old, s.New, changes)
+		if err != nil {
+			return err
+		}
+		if s.Show != "none" {
+			for _, change := range changes {
+				if change.Type != diff.ChangeModified {
+					continue
+				}
+				var d string
+				oldName := s.Old + ":" + change.Key
+				newName := s.New + ":" + change.Key
+				if s.Show == "ast" {
+					d = diff.Unified(oldName, newName,
+						[]byte(change.Old.Lisp(oldSource)), []byte(change.New.Lisp(newSource)), s.Context)
+				} else {
+					d = diff.Unified(oldName, newName, []byte(change.Old.Text+"\n"), []byte(change.New.Text+"\n"), s.Context)
+				}
+				_, err = os.Stdout.WriteString("\n" + d)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return &cmds.ExitWithoutGlazeError{}
+	case "rows":
+		return addDiffRows(ctx, gp, changes)
+	default:
+		return errors.Errorf("unknown format %s", s.Format)
+	}
+}
+
+func addDiffRows(ctx context.Context, gp middlewares.Processor, changes []diff.Change) error {
+	for _, change := range changes {
+		row := types.NewRow(
+			types.MRP("change", change.Type),
+			types.MRP("kind", change.Kind),
+			types.MRP("key", change.Key),
+			types.MRP("moved", change.Moved),
+		)
+		if change.Old != nil {
+			row.Set("oldRow", change.Old.StartPoint.Row)
+		} else {
+			row.Set("oldRow", nil)
+		}
+		if change.New != nil {
+			row.Set("newRow", change.New.StartPoint.Row)
+		} else {
+			row.Set("newRow", nil)
+		}
+		err := gp.AddRow(ctx, row)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,287 @@
+package commands
+
+import (
+	"context"
+
+	"github.com/go-go-golems/glazed/pkg/cli"
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/fields"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/settings"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/go-go-golems/oak/pkg"
+	cmds2 "github.com/go-go-golems/oak/pkg/cmds"
+	"github.com/go-go-golems/oak/pkg/index"
+	tree_sitter "github.com/go-go-golems/oak/pkg/tree-sitter"
+	"github.com/spf13/cobra"
+)
+
+// NewIndexCmd returns the command group managing the symbol index built from
+// the tags queries of the languages.
+func NewIndexCmd() (*cobra.Command, error) {
+	indexCmd := &cobra.Command{
+		Use:   "index",
+		Short: "Build and search an index of the definitions and references of a repository",
+	}
+
+	buildCmd, err := NewIndexBuildCommand()
+	if err != nil {
+		return nil, err
+	}
+	findDefCmd, err := NewIndexFindCommand("find-def", index.RoleDefinition,
+		"Print the definitions of a symbol")
+	if err != nil {
+		return nil, err
+	}
+	refsCmd, err := NewIndexFindCommand("refs", index.RoleReference,
+		"Print the references to a symbol")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range []cmds.Command{buildCmd, findDefCmd, refsCmd} {
+		cobraCmd, err := cli.BuildCobraCommand(c)
+		if err != nil {
+			return nil, err
+		}
+		indexCmd.AddCommand(cobraCmd)
+	}
+
+	return indexCmd, nil
+}
+
+func newIndexFlag() *fields.Definition {
+	return fields.New(
+		"index",
+		fields.TypeString,
+		fields.WithHelp("Path of the index"),
+		fields.WithDefault(index.DefaultPath),
+	)
+}
+
+type IndexBuildCommand struct {
+	*cmds.CommandDescription
+}
+
+var _ cmds.GlazeCommand = (*IndexBuildCommand)(nil)
+
+type IndexBuildSettings struct {
+	Index   string   `glazed:"index"`
+	Glob    []string `glazed:"glob"`
+	Workers int      `glazed:"workers"`
+	Sources []string `glazed:"sources"`
+}
+
+func NewIndexBuildCommand() (*IndexBuildCommand, error) {
+	glazeSection, err := settings.NewGlazedSchema()
+	if err != nil {
+		return nil, err
+	}
+
+	return &IndexBuildCommand{
+		CommandDescription: cmds.NewCommandDescription(
+			"build",
+			cmds.WithShort("Index the definitions and references of the files of sources"),
+			cmds.WithLong("Index the definitions and references of the files of sources, "+
+				"recursing into directories. Only the files that changed since the last build are parsed again."),
+			cmds.WithFlags(
+				newIndexFlag(),
+				fields.New(
+					"glob",
+					fields.TypeStringList,
+					fields.WithHelp("Glob patterns of the files to index in directories (default: the files of all the languages with a tags query)"),
+				),
+				fields.New(
+					"workers",
+					fields.TypeInteger,
+					fields.WithHelp("Number of files to parse in parallel"),
+					fields.WithDefault(4),
+				),
+			),
+			cmds.WithFlags(cmds2.NewSourceFilterFlags()...),
+			cmds.WithArguments(
+				fields.New(
+					"sources",
+					fields.TypeStringList,
+					fields.WithHelp("Files and directories to index"),
+					fields.WithDefault([]string{"."}),
+				),
+			),
+			cmds.WithSections(glazeSection),
+		),
+	}, nil
+}
+
+func (c *IndexBuildCommand) RunIntoGlazeProcessor(
+	ctx context.Context,
+	parsedValues *values.Values,
+	gp middlewares.Processor,
+) error {
+	s := &IndexBuildSettings{}
+	err := parsedValues.DecodeSectionInto(values.DefaultSlug, s)
+	if err != nil {
+		return err
+	}
+	sf := &cmds2.SourceFilterSettings{}
+	err = parsedValues.DecodeSectionInto(values.DefaultSlug, sf)
+	if err != nil {
+		return err
+	}
+
+	glob := s.Glob
+	if len(glob) == 0 {
+		for _, name := range tree_sitter.TagsLanguages() {
+			globs, err := pkg.DefaultLanguageRegistry.Globs(name)
+			if err != nil {
+				continue
+			}
+			glob = append(glob, globs...)
+		}
+	}
+	sources, err := cmds2.CollectSources(s.Sources, glob, sf.CollectorOptions(nil)...)
+	if err != nil {
+		return err
+	}
+
+	ix, err := index.Open(s.Index)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = ix.Close()
+	}()
+
+	stats, err := ix.Build(ctx, sources, index.WithWorkers(s.Workers))
+	if err != nil {
+		return err
+	}
+
+	return gp.AddRow(ctx, types.NewRow(
+		types.MRP("index", s.Index),
+		types.MRP("files", stats.Files),
+		types.MRP("indexed", stats.Indexed),
+		types.MRP("unchanged", stats.Unchanged),
+		types.MRP("skipped", stats.Skipped),
+		types.MRP("removed", stats.Removed),
+		types.MRP("symbols", stats.Symbols),
+	))
+}
+
+// IndexFindCommand prints the symbols of a name with a given role.
+type IndexFindCommand struct {
+	*cmds.CommandDescription
+	role index.Role
+}
+
+var _ cmds.GlazeCommand = (*IndexFindCommand)(nil)
+
+type IndexFindSettings struct {
+	Index      string   `glazed:"index"`
+	Kind       []string `glazed:"kind"`
+	WithSource bool     `glazed:"with-source"`
+	Name       string   `glazed:"name"`
+}
+
+func NewIndexFindCommand(name string, role index.Role, short string) (*IndexFindCommand, error) {
+	glazeSection, err := settings.NewGlazedSchema()
+	if err != nil {
+		return nil, err
+	}
+
+	return &IndexFindCommand{
+		CommandDescription: cmds.NewCommandDescription(
+			name,
+			cmds.WithShort(short),
+			cmds.WithFlags(
+				newIndexFlag(),
+				fields.New(
+					"kind",
+					fields.TypeStringList,
+					fields.WithHelp("Only print symbols of these kinds, such as function, method or call"),
+				),
+				fields.New(
+					"with-source",
+					fields.TypeBool,
+					fields.WithHelp("Add the code of each "+string(role)+" as the source column"),
+					fields.WithDefault(false),
+				),
+			),
+			cmds.WithArguments(
+				fields.New(
+					"name",
+					fields.TypeString,
+					fields.WithHelp("Name of the symbol"),
+					fields.WithRequired(true),
+				),
+			),
+			cmds.WithSections(glazeSection),
+		),
+		role: role,
+	}, nil
+}
+
+func (c *IndexFindCommand) RunIntoGlazeProcessor(
+	ctx context.Context,
+	parsedValues *values.Values,
+	gp middlewares.Processor,
+) error {
+	s := &IndexFindSettings{}
+	err := parsedValues.DecodeSectionInto(values.DefaultSlug, s)
+	if err != nil {
+		return err
+	}
+
+	ix, err := index.Open(s.Index)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = ix.Close()
+	}()
+
+	symbols, err := ix.Find(s.Name, c.role)
+	if err != nil {
+		return err
+	}
+
+	kinds := map[string]bool{}
+	for _, kind := range s.Kind {
+		kinds[kind] = true
+	}
+
+	for _, symbol := range symbols {
+		if len(kinds) > 0 && !kinds[symbol.Kind] {
+			continue
+		}
+		row := types.NewRow(
+			types.MRP("name", symbol.Name),
+			types.MRP("kind", symbol.Kind),
+			types.MRP("file", symbol.File),
+			types.MRP("language", symbol.Language),
+
+			types.MRP("startRow", symbol.StartPoint.Row),
+			types.MRP("startColumn", symbol.StartPoint.Column),
+			types.MRP("endRow", symbol.EndPoint.Row),
+			types.MRP("endColumn", symbol.EndPoint.Column),
+
+			types.MRP("nodeStartRow", symbol.NodeStartPoint.Row),
+			types.MRP("nodeEndRow", symbol.NodeEndPoint.Row),
+			types.MRP("nodeStartByte", symbol.NodeStartByte),
+			types.MRP("nodeEndByte", symbol.NodeEndByte),
+		)
+		if s.WithSource {
+			source, err := ix.Source(symbol)
+			if err != nil {
+				return err
+			}
+			row.Set("source", source)
+		}
+		err := gp.AddRow(ctx, row)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -32,14 +32,11 @@ func RegisterLegacyCommands(rootCmd *cobra.Command) {
 			cobra.CheckErr(err)
 
 			for _, inputFile := range args {
-				var lang *sitter.Language
-				if language != "" {
-					lang, err = pkg.LanguageNameToSitterLanguage(language)
-					cobra.CheckErr(err)
-				} else {
-					lang, err = pkg.FileNameToSitterLanguage(inputFile)
-					cobra.CheckErr(err)
-				}
+				sourceCode, err := readFileOrStdin(inputFile)
+				cobra.CheckErr(err)
+
+				lang, err := sitterLanguageForSource(language, inputFile, sourceCode)
+				cobra.CheckErr(err)
 
 				if queryName == "" {
 					queryName = "main"
@@ -55,9 +52,6 @@ func RegisterLegacyCommands(rootCmd *cobra.Command) {
 					cmds2.WithSitterLanguage(lang),
 					cmds2.WithTemplate(templateFile))
 
-				sourceCode, err := readFileOrStdin(inputFile)
-				cobra.CheckErr(err)
-
 				ctx := context.Background()
 				tree, err := oak.Parse(ctx, nil, sourceCode)
 				cobra.CheckErr(err)
@@ -98,7 +92,7 @@ func RegisterLegacyCommands(rootCmd *cobra.Command) {
 	cobra.CheckErr(err)
 
 	queryCmd.Flags().String("query-name", "", "SitterQuery name")
-	queryCmd.Flags().String("language", "", "Language name")
+	queryCmd.Flags().String("language", "", "Language name (detected from each file if not set)")
 
 	queryCmd.Flags().StringVarP(&templateFile, "template", "t", "", "Template file path")
 
@@ -122,14 +116,11 @@ func RegisterLegacyCommands(rootCmd *cobra.Command) {
 			cobra.CheckErr(err)
 
 			for _, inputFile := range args {
-				var lang *sitter.Language
-				if language != "" {
-					lang, err = pkg.LanguageNameToSitterLanguage(language)
-					cobra.CheckErr(err)
-				} else {
-					lang, err = pkg.FileNameToSitterLanguage(inputFile)
-					cobra.CheckErr(err)
-				}
+				sourceCode, err := readFileOrStdin(inputFile)
+				cobra.CheckErr(err)
+
+				lang, err := sitterLanguageForSource(language, inputFile, sourceCode)
+				cobra.CheckErr(err)
 
 				description := glazed_cmds.NewCommandDescription("parse")
 
@@ -138,9 +129,6 @@ func RegisterLegacyCommands(rootCmd *cobra.Command) {
 					cmds2.WithSitterLanguage(lang),
 					cmds2.WithTemplate(templateFile))
 
-				sourceCode, err := readFileOrStdin(inputFile)
-				cobra.CheckErr(err)
-
 				ctx := context.Background()
 				tree, err := oak.Parse(ctx, nil, sourceCode)
 				cobra.CheckErr(err)
@@ -178,7 +166,7 @@ func RegisterLegacyCommands(rootCmd *cobra.Command) {
 		},
 	}
 
-	parseCmd.Flags().String("language", "", "Language name")
+	parseCmd.Flags().String("language", "", "Language name (detected from each file if not set)")
 	// Add dump format flags
 	parseCmd.Flags().String("dump-format", "", "Output format for the tree dump (text, xml, json, yaml)")
 	parseCmd.Flags().Bool("show-bytes", false, "Show byte offsets in the tree dump")
@@ -189,3 +177,16 @@ func RegisterLegacyCommands(rootCmd *cobra.Command) {
 	rootCmd.AddCommand(parseCmd)
 	rootCmd.AddCommand(queryCmd)
 }
+
+// sitterLanguageForSource returns the grammar for language if set, and else
+// detects the language of inputFile from its name and content.
+func sitterLanguageForSource(language string, inputFile string, sourceCode []byte) (*sitter.Language, error) {
+	if language != "" {
+		return pkg.LanguageNameToSitterLanguage(language)
+	}
+	rl, err := pkg.DetectLanguage(context.Background(), inputFile, sourceCode)
+	if err != nil {
+		return nil, err
+	}
+	return rl.Language, nil
+}
@@ -0,0 +1,214 @@
+package commands
+
+import (
+	"context"
+	"os"
+
+	"github.com/go-go-golems/glazed/pkg/cli"
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/fields"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/settings"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/go-go-golems/oak/pkg"
+	cmds2 "github.com/go-go-golems/oak/pkg/cmds"
+	tree_sitter "github.com/go-go-golems/oak/pkg/tree-sitter"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// NewLintSyntaxCmd returns the command listing the syntax errors of sources.
+func NewLintSyntaxCmd() (*cobra.Command, error) {
+	c, err := NewLintSyntaxCommand()
+	if err != nil {
+		return nil, err
+	}
+	return cli.BuildCobraCommand(c)
+}
+
+type LintSyntaxCommand struct {
+	*cmds.CommandDescription
+}
+
+var _ cmds.GlazeCommand = (*LintSyntaxCommand)(nil)
+
+type LintSyntaxSettings struct {
+	Recurse  bool     `glazed:"recurse"`
+	Glob     []string `glazed:"glob"`
+	Language string   `glazed:"language"`
+	Workers  int      `glazed:"workers"`
+	Sources  []string `glazed:"sources"`
+}
+
+func NewLintSyntaxCommand() (*LintSyntaxCommand, error) {
+	glazeSection, err := settings.NewGlazedSchema()
+	if err != nil {
+		return nil, err
+	}
+
+	return &LintSyntaxCommand{
+		CommandDescription: cmds.NewCommandDescription(
+			"lint-syntax",
+			cmds.WithShort("List the syntax errors of sources, and fail if there are any"),
+			cmds.WithLong("Parse sources and output a row for each ERROR and MISSING node of their trees, "+
+				"with its 1-based line and column. Tree-sitter recovers from syntax errors, so queries run on "+
+				"broken files silently miss the code around the errors. "+
+				"The command exits with an error after the output if any file failed to parse cleanly."),
+			cmds.WithFlags(
+				fields.New(
+					"recurse",
+					fields.TypeBool,
+					fields.WithHelp("Recurse into the directories of sources"),
+					fields.WithDefault(false),
+				),
+				fields.New(
+					"glob",
+					fields.TypeStringList,
+					fields.WithHelp("Glob patterns of the files to check in directories (default: the files of all the languages, or of --language)"),
+				),
+				fields.New(
+					"language",
+					fields.TypeString,
+					fields.WithHelp("Language to parse the files with (default: detected from each file)"),
+				),
+				fields.New(
+					"workers",
+					fields.TypeInteger,
+					fields.WithHelp("Number of files to parse in parallel"),
+					fields.WithDefault(4),
+				),
+			),
+			cmds.WithFlags(cmds2.NewSourceFilterFlags()...),
+			cmds.WithArguments(
+				fields.New(
+					"sources",
+					fields.TypeStringList,
+					fields.WithHelp("Files (or directories if recursing) to check"),
+					fields.WithDefault([]string{"."}),
+				),
+			),
+			cmds.WithSections(glazeSection),
+		),
+	}, nil
+}
+
+func (c *LintSyntaxCommand) RunIntoGlazeProcessor(
+	ctx context.Context,
+	parsedValues *values.Values,
+	gp middlewares.Processor,
+) error {
+	s := &LintSyntaxSettings{}
+	err := parsedValues.DecodeSectionInto(values.DefaultSlug, s)
+	if err != nil {
+		return err
+	}
+	sf := &cmds2.SourceFilterSettings{}
+	err = parsedValues.DecodeSectionInto(values.DefaultSlug, sf)
+	if err != nil {
+		return err
+	}
+
+	var language *pkg.RegisteredLanguage
+	if s.Language != "" {
+		language, err = pkg.DefaultLanguageRegistry.Lookup(s.Language)
+		if err != nil {
+			return err
+		}
+	}
+
+	glob := s.Glob
+	if s.Recurse && len(glob) == 0 {
+		names := pkg.DefaultLanguageRegistry.Names()
+		if language != nil {
+			names = []string{language.Name}
+		}
+		for _, name := range names {
+			globs, err := pkg.DefaultLanguageRegistry.Globs(name)
+			if err != nil {
+				return err
+			}
+			glob = append(glob, globs...)
+		}
+	}
+	sources, err := cmds2.CollectSources(s.Sources, glob, sf.CollectorOptions(nil)...)
+	if err != nil {
+		return err
+	}
+
+	jobs := make([]tree_sitter.FileJob, 0, len(sources))
+	for _, fileName := range sources {
+		rl := language
+		if rl == nil {
+			rl, err = detectFileLanguage(ctx, fileName)
+			if err != nil {
+				return err
+			}
+		}
+		jobs = append(jobs, tree_sitter.FileJob{
+			FileName:     fileName,
+			LanguageName: rl.Name,
+			Language:     rl.Language,
+		})
+	}
+
+	errorCount, fileCount := 0, 0
+	err = tree_sitter.ProcessFiles(ctx, jobs, s.Workers,
+		func(result tree_sitter.FileResult) error {
+			if result.Err != nil {
+				return result.Err
+			}
+			if !result.Health.HasError {
+				return nil
+			}
+			fileCount++
+			errorCount += len(result.Health.Errors)
+			return addSyntaxErrorRows(ctx, gp, result)
+		})
+	if err != nil {
+		return err
+	}
+	if errorCount == 0 {
+		return nil
+	}
+
+	return cmds2.CloseAndFail(ctx, gp, errors.Errorf("found %d syntax errors in %d files", errorCount, fileCount))
+}
+
+// detectFileLanguage returns the language of fileName from its name, reading
+// it only if its name matches several languages or none.
+func detectFileLanguage(ctx context.Context, fileName string) (*pkg.RegisteredLanguage, error) {
+	candidates, err := pkg.DefaultLanguageRegistry.LookupFileName(fileName)
+	if err == nil && len(candidates) == 1 {
+		return candidates[0], nil
+	}
+	source, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not read file %s", fileName)
+	}
+	rl, err := pkg.DetectLanguage(ctx, fileName, source)
+	if err != nil {
+		return nil, errors.Wrap(err, "use --language to set it")
+	}
+	return rl, nil
+}
+
+func addSyntaxErrorRows(ctx context.Context, gp middlewares.Processor, result tree_sitter.FileResult) error {
+	for _, e := range result.Health.Errors {
+		row := types.NewRow(
+			types.MRP("file", result.FileName),
+			types.MRP("language", result.LanguageName),
+			types.MRP("line", e.StartPoint.Row+1),
+			types.MRP("column", e.StartPoint.Column+1),
+			types.MRP("endLine", e.EndPoint.Row+1),
+			types.MRP("endColumn", e.EndPoint.Column+1),
+			types.MRP("kind", e.Kind()),
+			types.MRP("message", e.Message()),
+		)
+		err := gp.AddRow(ctx, row)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/go-go-golems/glazed/pkg/cli"
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/fields"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	"github.com/go-go-golems/oak/pkg/playground"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// NewPlaygroundCmd returns the command editing tree-sitter queries
+// interactively on a source file.
+func NewPlaygroundCmd() (*cobra.Command, error) {
+	c, err := NewPlaygroundCommand()
+	if err != nil {
+		return nil, err
+	}
+	return cli.BuildCobraCommand(c)
+}
+
+type PlaygroundCommand struct {
+	*cmds.CommandDescription
+}
+
+var _ cmds.BareCommand = (*PlaygroundCommand)(nil)
+
+type PlaygroundSettings struct {
+	Language  string `glazed:"language"`
+	Query     string `glazed:"query"`
+	QueryFile string `glazed:"query-file"`
+	File      string `glazed:"file"`
+}
+
+func NewPlaygroundCommand() (*PlaygroundCommand, error) {
+	return &PlaygroundCommand{
+		CommandDescription: cmds.NewCommandDescription(
+			"playground",
+			cmds.WithShort("Edit a tree-sitter query interactively on a source file"),
+			cmds.WithLong("Open a terminal UI with the source file, a query editor, the captures of the query and "+
+				"the AST of the node under the cursor. The query is run as it is typed, its captures are "+
+				"highlighted in the source and its syntax errors are shown under the editor. The final query "+
+				"is printed when leaving the playground."),
+			cmds.WithFlags(
+				fields.New(
+					"language",
+					fields.TypeString,
+					fields.WithHelp("Language of the file (detected from the file if not set)"),
+				),
+				fields.New(
+					"query",
+					fields.TypeString,
+					fields.WithHelp("Initial query"),
+				),
+				fields.New(
+					"query-file",
+					fields.TypeString,
+					fields.WithHelp("File with the initial query"),
+				),
+			),
+			cmds.WithArguments(
+				fields.New(
+					"file",
+					fields.TypeString,
+					fields.WithHelp("Source file to run the query on"),
+					fields.WithRequired(true),
+				),
+			),
+		),
+	}, nil
+}
+
+func (c *PlaygroundCommand) Run(ctx context.Context, parsedValues *values.Values) error {
+	s := &PlaygroundSettings{}
+	err := parsedValues.DecodeSectionInto(values.DefaultSlug, s)
+	if err != nil {
+		return err
+	}
+
+	query := s.Query
+	if s.QueryFile != "" {
+		if query != "" {
+			return errors.New("--query and --query-file are mutually exclusive")
+		}
+		b, err := os.ReadFile(s.QueryFile)
+		if err != nil {
+			return errors.Wrapf(err, "could not read query file %s", s.QueryFile)
+		}
+		query = string(b)
+	}
+
+	session, err := playground.LoadSession(ctx, s.File, s.Language)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	// the UI is drawn on stderr, so that the query printed on stdout can be
+	// redirected
+	lipgloss.SetColorProfile(lipgloss.NewRenderer(os.Stderr).ColorProfile())
+	p := tea.NewProgram(playground.NewModel(session, query),
+		tea.WithAltScreen(), tea.WithContext(ctx), tea.WithOutput(os.Stderr))
+	m, err := p.Run()
+	if err != nil {
+		return err
+	}
+
+	if query := m.(playground.Model).Query(); query != "" {
+		fmt.Println(query)
+	}
+	return nil
+}
@@ -45,6 +45,56 @@ func InitRootCmd(docFS embed.FS) (*help.HelpSystem, error) {
 	RootCmd.AddCommand(RunCommandCmd)
 	RootCmd.AddCommand(ASTCmd)
 	RootCmd.AddCommand(PatternCmd)
+	RootCmd.AddCommand(CacheCmd)
+
+	indexCmd, err := NewIndexCmd()
+	if err != nil {
+		return nil, err
+	}
+	RootCmd.AddCommand(indexCmd)
+
+	callGraphCmd, err := NewCallGraphCmd()
+	if err != nil {
+		return nil, err
+	}
+	RootCmd.AddCommand(callGraphCmd)
+
+	depsCmd, err := NewDepsCmd()
+	if err != nil {
+		return nil, err
+	}
+	RootCmd.AddCommand(depsCmd)
+
+	diffCmd, err := NewDiffCmd()
+	if err != nil {
+		return nil, err
+	}
+	RootCmd.AddCommand(diffCmd)
+
+	lintSyntaxCmd, err := NewLintSyntaxCmd()
+	if err != nil {
+		return nil, err
+	}
+	RootCmd.AddCommand(lintSyntaxCmd)
+
+	validateCmd, err := NewValidateCmd()
+	if err != nil {
+		return nil, err
+	}
+	RootCmd.AddCommand(validateCmd)
+
+	testCmd, err := NewTestCmd()
+	if err != nil {
+		return nil, err
+	}
+	RootCmd.AddCommand(testCmd)
+
+	playgroundCmd, err := NewPlaygroundCmd()
+	if err != nil {
+		return nil, err
+	}
+	RootCmd.AddCommand(playgroundCmd)
+
 	return helpSystem, nil
 }
 
@@ -89,6 +139,25 @@ func InitAllCommands(helpSystem *help.HelpSystem, queriesFS embed.FS) error {
 		return err
 	}
 
+	watchCmd := &cobra.Command{
+		Use:   "watch",
+		Short: "Run commands and re-render their output every time a source changes",
+	}
+	RootCmd.AddCommand(watchCmd)
+
+	oakWatchLoader := &cmds2.OakWatchCommandLoader{}
+	repositories_ = createRepositories(repositoryPaths, oakWatchLoader, queriesFS)
+
+	_, err = repositories.LoadRepositories(
+		helpSystem,
+		watchCmd,
+		repositories_,
+		cli.WithCobraShortHelpSections(schema.DefaultSlug, cmds2.OakSlug, cmds2.WatchSlug),
+	)
+	if err != nil {
+		return err
+	}
+
 	// Create and add the unified command management group
 	commandManagementCmd, err := clay_commandmeta.NewCommandManagementCommandGroup(
 		allCommands,
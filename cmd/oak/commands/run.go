@@ -63,7 +63,8 @@ var RunCommandCmd = &cobra.Command{
 				})
 			}
 
-			results, err := tree_sitter.ExecuteQueries(lang, tree.RootNode(), oak.Queries, sourceCode)
+			results, err := tree_sitter.ExecuteQueries(lang, tree.RootNode(), oak.Queries, sourceCode,
+				tree_sitter.WithLanguageName(oak.Language))
 			cobra.CheckErr(err)
 
 			s, err := oak.Render(results)
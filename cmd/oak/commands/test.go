@@ -0,0 +1,128 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/go-go-golems/glazed/pkg/cli"
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/fields"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	cmds2 "github.com/go-go-golems/oak/pkg/cmds"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// NewTestCmd returns the command running the golden file tests of oak
+// command files.
+func NewTestCmd() (*cobra.Command, error) {
+	c, err := NewTestCommand()
+	if err != nil {
+		return nil, err
+	}
+	return cli.BuildCobraCommand(c)
+}
+
+type TestCommand struct {
+	*cmds.CommandDescription
+}
+
+var _ cmds.WriterCommand = (*TestCommand)(nil)
+
+type TestSettings struct {
+	Update   bool     `glazed:"update"`
+	Commands []string `glazed:"commands"`
+}
+
+func NewTestCommand() (*TestCommand, error) {
+	return &TestCommand{
+		CommandDescription: cmds.NewCommandDescription(
+			"test",
+			cmds.WithShort("Run the golden file tests of oak command files"),
+			cmds.WithLong("Run oak command files, or the YAML files of directories, on the input files of their "+
+				"fixture directory (definitions.test for definitions.yaml), once for each test of their tests "+
+				"section, and compare the output to the expected files of the fixture directory: expected.txt for "+
+				"the text output and expected.json for the rows of the glaze output, or expected.NAME.txt and "+
+				"expected.NAME.json for the test NAME. The differences are printed as unified diffs, and the "+
+				"command exits with an error if any test failed. Commands without fixture directory are skipped."),
+			cmds.WithFlags(
+				fields.New(
+					"update",
+					fields.TypeBool,
+					fields.WithHelp("Overwrite the expected files with the actual output, and create expected.txt for tests without expected file"),
+					fields.WithDefault(false),
+				),
+			),
+			cmds.WithArguments(
+				fields.New(
+					"commands",
+					fields.TypeStringList,
+					fields.WithHelp("Command files, or directories of command files"),
+					fields.WithRequired(true),
+				),
+			),
+		),
+	}, nil
+}
+
+func (c *TestCommand) RunIntoWriter(
+	ctx context.Context,
+	parsedValues *values.Values,
+	w io.Writer,
+) error {
+	s := &TestSettings{}
+	err := parsedValues.DecodeSectionInto(values.DefaultSlug, s)
+	if err != nil {
+		return err
+	}
+
+	fileNames, err := commandFiles(s.Commands)
+	if err != nil {
+		return err
+	}
+
+	testCount, failCount := 0, 0
+	for _, fileName := range fileNames {
+		results, err := cmds2.RunCommandTests(ctx, fileName, s.Update)
+		if err != nil {
+			return errors.Wrapf(err, "could not run the tests of %s", fileName)
+		}
+		for _, result := range results {
+			testCount++
+			if result.Status == cmds2.TestFailed {
+				failCount++
+			}
+			err = printTestResult(w, result)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if failCount > 0 {
+		return errors.Errorf("%d of %d tests failed", failCount, testCount)
+	}
+	_, err = fmt.Fprintf(w, "%d tests passed\n", testCount)
+	return err
+}
+
+// printTestResult prints a line with the status of result, followed by the
+// error or the diff of a failed test.
+func printTestResult(w io.Writer, result cmds2.CommandTestResult) error {
+	name := result.File
+	if result.Test != "" {
+		name += " " + result.Test
+	}
+	_, err := fmt.Fprintf(w, "%-8s %s (%s)\n", result.Status, name, result.Expected)
+	if err != nil {
+		return err
+	}
+	switch {
+	case result.Err != nil:
+		_, err = fmt.Fprintf(w, "    %s\n", result.Err)
+	case result.Diff != "":
+		_, err = io.WriteString(w, result.Diff)
+	}
+	return err
+}
@@ -0,0 +1,178 @@
+package commands
+
+import (
+	"context"
+	"io/fs"
+	"path/filepath"
+
+	"github.com/go-go-golems/glazed/pkg/cli"
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/alias"
+	"github.com/go-go-golems/glazed/pkg/cmds/fields"
+	"github.com/go-go-golems/glazed/pkg/cmds/loaders"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/settings"
+	"github.com/go-go-golems/glazed/pkg/types"
+	cmds2 "github.com/go-go-golems/oak/pkg/cmds"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// NewValidateCmd returns the command checking oak command files.
+func NewValidateCmd() (*cobra.Command, error) {
+	c, err := NewValidateCommand()
+	if err != nil {
+		return nil, err
+	}
+	return cli.BuildCobraCommand(c)
+}
+
+type ValidateCommand struct {
+	*cmds.CommandDescription
+}
+
+var _ cmds.GlazeCommand = (*ValidateCommand)(nil)
+
+type ValidateSettings struct {
+	Commands []string `glazed:"commands"`
+}
+
+func NewValidateCommand() (*ValidateCommand, error) {
+	glazeSection, err := settings.NewGlazedSchema()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ValidateCommand{
+		CommandDescription: cmds.NewCommandDescription(
+			"validate",
+			cmds.WithShort("Check the queries and template of oak command files without running them"),
+			cmds.WithLong("Load oak command files, or the YAML files of directories, render their queries with the "+
+				"default values of their flags and compile them for the languages of the command, reporting syntax "+
+				"errors and unknown node types and field names. The template has to parse, and the queries and "+
+				"captures it refers to have to exist. A row is output for each issue, and the command exits with "+
+				"an error after the output if any issue was found."),
+			cmds.WithArguments(
+				fields.New(
+					"commands",
+					fields.TypeStringList,
+					fields.WithHelp("Command files, or directories of command files"),
+					fields.WithRequired(true),
+				),
+			),
+			cmds.WithSections(glazeSection),
+		),
+	}, nil
+}
+
+func (c *ValidateCommand) RunIntoGlazeProcessor(
+	ctx context.Context,
+	parsedValues *values.Values,
+	gp middlewares.Processor,
+) error {
+	s := &ValidateSettings{}
+	err := parsedValues.DecodeSectionInto(values.DefaultSlug, s)
+	if err != nil {
+		return err
+	}
+
+	fileNames, err := commandFiles(s.Commands)
+	if err != nil {
+		return err
+	}
+
+	loader := &cmds2.OakCommandLoader{SkipValidation: true}
+	issueCount, fileCount := 0, 0
+	for _, fileName := range fileNames {
+		issues, err := validateCommandFile(loader, fileName)
+		if err != nil {
+			// files that can't be loaded at all, for example because of
+			// invalid YAML, are reported like the other issues
+			issues = []cmds2.ValidationIssue{{
+				Severity: cmds2.SeverityError,
+				Source:   "file",
+				Message:  err.Error(),
+			}}
+		}
+		if len(issues) > 0 {
+			fileCount++
+			issueCount += len(issues)
+		}
+		for _, issue := range issues {
+			row := types.NewRow(
+				types.MRP("file", fileName),
+				types.MRP("severity", issue.Severity),
+				types.MRP("source", issue.Source),
+				types.MRP("query", issue.Query),
+				types.MRP("language", issue.Language),
+				types.MRP("line", issue.Line),
+				types.MRP("column", issue.Column),
+				types.MRP("message", issue.Message),
+			)
+			err = gp.AddRow(ctx, row)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if issueCount == 0 {
+		return nil
+	}
+
+	return cmds2.CloseAndFail(ctx, gp, errors.Errorf("found %d issues in %d command files", issueCount, fileCount))
+}
+
+// commandFiles returns the files of commands, with directories expanded to
+// the YAML files they contain.
+func commandFiles(commands []string) ([]string, error) {
+	ret := []string{}
+	loader := &cmds2.OakCommandLoader{}
+	for _, command := range commands {
+		err := filepath.WalkDir(command, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			// files named explicitly are validated whatever their name
+			if !d.IsDir() && (p == command || loader.IsFileSupported(nil, p)) {
+				ret = append(ret, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+// validateCommandFile loads the oak commands of fileName without validating
+// them, and returns the issues of Validate. Aliases are skipped.
+func validateCommandFile(loader *cmds2.OakCommandLoader, fileName string) ([]cmds2.ValidationIssue, error) {
+	absFileName, err := filepath.Abs(fileName)
+	if err != nil {
+		return nil, err
+	}
+	fs_, entryName, err := loaders.FileNameToFsFilePath(absFileName)
+	if err != nil {
+		return nil, err
+	}
+	commands, err := loader.LoadCommands(fs_, entryName, []cmds.CommandDescriptionOption{}, []alias.Option{})
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []cmds2.ValidationIssue{}
+	for _, command := range commands {
+		oc, ok := command.(*cmds2.OakWriterCommand)
+		if !ok {
+			continue
+		}
+		issues, err := oc.Validate()
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not validate %s", oc.Name)
+		}
+		ret = append(ret, issues...)
+	}
+	return ret, nil
+}
@@ -0,0 +1,38 @@
+// Input of the golden file tests of oak, not part of the build.
+
+//go:build ignore
+
+package shapes
+
+import "math"
+
+// Shape is implemented by all the shapes.
+type Shape interface {
+	Area() float64
+}
+
+// Meters is a length in meters.
+type Meters float64
+
+// Circle is a circle around the origin.
+type Circle struct {
+	Radius Meters
+}
+
+type point struct {
+	x, y float64
+}
+
+// Area returns the area of the circle.
+func (c *Circle) Area() float64 {
+	return math.Pi * float64(c.Radius*c.Radius)
+}
+
+// NewCircle returns a circle of radius r.
+func NewCircle(r Meters) *Circle {
+	return &Circle{Radius: r}
+}
+
+func distance(a, b point) float64 {
+	return math.Hypot(a.x-b.x, a.y-b.y)
+}
@@ -0,0 +1,16 @@
+// Input of the golden file tests of oak, not part of the build.
+
+//go:build ignore
+
+package main
+
+import "fmt"
+
+func greet(name string) string {
+	return fmt.Sprintf("hello %s", name)
+}
+
+func main() {
+	fmt.Println(greet("oak"))
+	fmt.Println(greet("tree-sitter"))
+}
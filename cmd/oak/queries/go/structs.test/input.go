@@ -0,0 +1,23 @@
+// Input of the golden file tests of oak, not part of the build.
+
+//go:build ignore
+
+package shapes
+
+// Shape is anything with an area.
+type Shape interface {
+	Area() float64
+}
+
+type Named interface {
+	Name() string
+}
+
+// Rect is an axis aligned rectangle.
+type Rect struct {
+	Width, Height float64
+}
+
+type point struct {
+	x, y float64
+}
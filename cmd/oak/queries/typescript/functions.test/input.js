@@ -0,0 +1,3 @@
+export const double = (x) => {
+  return x * 2;
+};
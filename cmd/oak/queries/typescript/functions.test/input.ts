@@ -0,0 +1,13 @@
+// add returns the sum of a and b.
+function add(a: number, b: number): number {
+  return a + b;
+}
+
+// Greets someone.
+export const greet = (name: string) => {
+  return `hello ${name}`;
+};
+
+const helper = () => {
+  return 1;
+};
@@ -0,0 +1,14 @@
+import { add } from "./math";
+
+// adds two numbers
+test("adds", () => {
+  expect(add(1, 2)).toBe(3);
+});
+
+test("adds negative numbers", () => {
+  expect(add(-1, -2)).toBe(-3);
+});
+
+describe("math", () => {
+  it("is not a test call", () => {});
+});
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	cmds2 "github.com/go-go-golems/oak/pkg/cmds"
+)
+
+// TestEmbeddedQueries runs the golden file tests of the embedded queries, as
+// oak test queries would.
+func TestEmbeddedQueries(t *testing.T) {
+	loader := &cmds2.OakCommandLoader{}
+	err := filepath.WalkDir("queries", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !loader.IsFileSupported(nil, p) {
+			return err
+		}
+		results, err := cmds2.RunCommandTests(context.Background(), p, false)
+		if err != nil {
+			t.Errorf("could not run the tests of %s: %v", p, err)
+			return nil
+		}
+		for _, result := range results {
+			if result.Status == cmds2.TestPassed {
+				continue
+			}
+			if result.Err != nil {
+				t.Errorf("%s %s: %v", p, result.Test, result.Err)
+				continue
+			}
+			t.Errorf("%s %s:\n%s", p, result.Test, strings.TrimSpace(result.Diff))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,47 @@
+// Package testutil has the helpers shared by the tests of the oak packages.
+package testutil
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// WriteFiles writes files, keyed by their slash-separated path relative to
+// dir, and returns their paths, sorted so that the order of the inputs of a
+// test doesn't depend on the iteration order of files.
+func WriteFiles(t testing.TB, dir string, files map[string]string) []string {
+	t.Helper()
+	fileNames := make([]string, 0, len(files))
+	for name, content := range files {
+		fileName := filepath.Join(dir, filepath.FromSlash(name))
+		err := os.MkdirAll(filepath.Dir(fileName), 0755)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		err = os.WriteFile(fileName, []byte(content), 0644)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		fileNames = append(fileNames, fileName)
+	}
+	sort.Strings(fileNames)
+	return fileNames
+}
+
+// TrimDir returns id without the slash-separated dir prefix, for the IDs of
+// graphs built from files written by WriteFiles.
+func TrimDir(dir string, id string) string {
+	return strings.TrimPrefix(id, filepath.ToSlash(dir)+"/")
+}
+
+// AssertLines fails the test if actual is not expected, printing both one
+// item per line. what names the items in the message, such as "edges".
+func AssertLines(t testing.TB, what string, expected []string, actual []string) {
+	t.Helper()
+	if strings.Join(expected, "\n") != strings.Join(actual, "\n") {
+		t.Errorf("Expected %s:\n%s\ngot:\n%s", what, strings.Join(expected, "\n"), strings.Join(actual, "\n"))
+	}
+}
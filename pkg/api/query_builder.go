@@ -6,11 +6,11 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
-	"sync"
 	"text/template"
 
 	"github.com/go-go-golems/oak/pkg"
 	pm "github.com/go-go-golems/oak/pkg/patternmatcher"
+	"github.com/go-go-golems/oak/pkg/sources"
 	"github.com/go-go-golems/oak/pkg/tree-sitter"
 	"github.com/pkg/errors"
 	sitter "github.com/smacker/go-tree-sitter"
@@ -19,8 +19,15 @@ import (
 
 // QueryBuilder provides an API for building and running tree-sitter queries
 type QueryBuilder struct {
-	language string
-	queries  []Query
+	language   string
+	queries    []Query
+	predicates []predicate
+}
+
+// predicate is a custom predicate registered with WithPredicate
+type predicate struct {
+	name string
+	fn   tree_sitter.PredicateFunc
 }
 
 // Query represents a named tree-sitter query
@@ -57,6 +64,17 @@ func WithQuery(name, query string) QueryOption {
 	}
 }
 
+// WithPredicate registers a custom predicate backed by Go code, which the
+// queries can use as (#name? @capture "argument"). fn is called with the
+// captures of each match and the arguments of the predicate, with capture
+// arguments passed as "@name". Matches for which fn returns false are
+// dropped before they reach templates and processors.
+func WithPredicate(name string, fn tree_sitter.PredicateFunc) QueryOption {
+	return func(qb *QueryBuilder) {
+		qb.predicates = append(qb.predicates, predicate{name: name, fn: fn})
+	}
+}
+
 // WithQueryFromFile adds a query from a file to the builder
 func WithQueryFromFile(name, path string) QueryOption {
 	return func(qb *QueryBuilder) {
@@ -112,6 +130,23 @@ type RunConfig struct {
 	Directory  string
 	Recursive  bool
 	MaxWorkers int
+	CacheDir   string
+	UseCache   bool
+	// WithAncestors computes the Ancestors of each capture
+	WithAncestors bool
+	// WithLocals resolves each capture to its definition
+	WithLocals bool
+	// Exclude, NoIgnore, MaxFileSize and IncludeGenerated select the files
+	// of Directory, see sources.Collector
+	Exclude          []string
+	NoIgnore         bool
+	MaxFileSize      int64
+	IncludeGenerated bool
+	// OnParseHealth is called with the syntax errors of each processed file
+	OnParseHealth func(fileName string, health tree_sitter.ParseHealth)
+	// OnFileError is called with the error of each file that couldn't be
+	// read or parsed, instead of printing it
+	OnFileError func(fileName string, err error)
 }
 
 // RunOption is a functional option for configuring query execution
@@ -152,6 +187,77 @@ func WithMaxWorkers(n int) RunOption {
 	}
 }
 
+// WithCacheDir reuses the results of unchanged files from a cache in dir.
+// An empty dir uses the default cache directory $HOME/.oak/cache.
+func WithCacheDir(dir string) RunOption {
+	return func(rc *RunConfig) {
+		rc.CacheDir = dir
+		rc.UseCache = true
+	}
+}
+
+// WithAncestors computes the enclosing nodes of each capture, see
+// tree_sitter.Capture.Ancestors.
+func WithAncestors() RunOption {
+	return func(rc *RunConfig) {
+		rc.WithAncestors = true
+	}
+}
+
+// WithLocals resolves each capture to its definition, using the locals
+// query of the language, see tree_sitter.Capture.Definition.
+func WithLocals() RunOption {
+	return func(rc *RunConfig) {
+		rc.WithLocals = true
+	}
+}
+
+// WithExclude skips the files of the directory matching patterns, in
+// .gitignore syntax.
+func WithExclude(patterns ...string) RunOption {
+	return func(rc *RunConfig) {
+		rc.Exclude = append(rc.Exclude, patterns...)
+	}
+}
+
+// WithNoIgnore doesn't skip the files of the directory listed in .gitignore
+// and .oakignore files.
+func WithNoIgnore() RunOption {
+	return func(rc *RunConfig) {
+		rc.NoIgnore = true
+	}
+}
+
+// WithMaxFileSize skips the files of the directory larger than size bytes.
+func WithMaxFileSize(size int64) RunOption {
+	return func(rc *RunConfig) {
+		rc.MaxFileSize = size
+	}
+}
+
+// WithIncludeGenerated doesn't skip the generated files of the directory.
+func WithIncludeGenerated() RunOption {
+	return func(rc *RunConfig) {
+		rc.IncludeGenerated = true
+	}
+}
+
+// WithParseHealth calls fn with the syntax errors of each processed file,
+// whose broken code the queries can't match.
+func WithParseHealth(fn func(fileName string, health tree_sitter.ParseHealth)) RunOption {
+	return func(rc *RunConfig) {
+		rc.OnParseHealth = fn
+	}
+}
+
+// WithFileErrors calls fn with the error of each file that couldn't be read
+// or parsed, instead of printing it on stdout. The file is skipped.
+func WithFileErrors(fn func(fileName string, err error)) RunOption {
+	return func(rc *RunConfig) {
+		rc.OnFileError = fn
+	}
+}
+
 // QueryResults represents the raw query results by file
 type QueryResults map[string]map[string]*tree_sitter.Result
 
@@ -176,15 +282,6 @@ func (qb *QueryBuilder) Run(
 		option(config)
 	}
 
-	files, err := qb.resolveFiles(config)
-	if err != nil {
-		return nil, err
-	}
-
-	if len(files) == 0 {
-		return nil, errors.New("no files found to process")
-	}
-
 	// Convert our queries to tree-sitter format
 	sitterQueries := make([]tree_sitter.SitterQuery, len(qb.queries))
 	for i, q := range qb.queries {
@@ -200,53 +297,75 @@ func (qb *QueryBuilder) Run(
 		return nil, err
 	}
 
-	// Process files in parallel
-	results := make(QueryResults)
-	mutex := &sync.Mutex{}
-	wg := &sync.WaitGroup{}
+	var executeOptions []tree_sitter.ExecuteOption
+	for _, p := range qb.predicates {
+		if tree_sitter.IsBuiltinPredicate(p.name) {
+			return nil, errors.Errorf("predicate %s is built-in and can't be replaced", p.name)
+		}
+		executeOptions = append(executeOptions, tree_sitter.WithPredicate(p.name, p.fn))
+	}
+	if config.WithAncestors {
+		executeOptions = append(executeOptions, tree_sitter.WithAncestors())
+	}
+	if config.WithLocals {
+		executeOptions = append(executeOptions, tree_sitter.WithLocals())
+	}
 
-	// Create a semaphore to limit concurrency
-	sem := make(chan struct{}, config.MaxWorkers)
+	// Compile the queries once, so that errors are reported before reading any file
+	err = tree_sitter.DefaultQueryCache.Compile(lang, sitterQueries, executeOptions...)
+	if err != nil {
+		return nil, err
+	}
 
-	for _, file := range files {
-		wg.Add(1)
-		go func(file string) {
-			defer wg.Done()
-
-			// Acquire semaphore
-			sem <- struct{}{}
-			defer func() { <-sem }()
-
-			content, err := os.ReadFile(file)
-			if err != nil {
-				fmt.Printf("Error reading file %s: %s\n", file, err)
-				return
-			}
+	files, err := qb.resolveFiles(config)
+	if err != nil {
+		return nil, err
+	}
 
-			// Create parser and parse the file
-			parser := sitter.NewParser()
-			parser.SetLanguage(lang)
-			tree, err := parser.ParseCtx(ctx, nil, content)
-			if err != nil {
-				fmt.Printf("Error parsing file %s: %s\n", file, err)
-				return
-			}
-			defer tree.Close()
+	if len(files) == 0 {
+		return nil, errors.New("no files found to process")
+	}
 
-			// Execute queries
-			fileResults, err := tree_sitter.ExecuteQueries(lang, tree.RootNode(), sitterQueries, content)
-			if err != nil {
-				fmt.Printf("Error executing queries on file %s: %s\n", file, err)
-				return
-			}
+	var processOptions []tree_sitter.ProcessOption
+	if config.UseCache {
+		cache, err := tree_sitter.NewResultCache(config.CacheDir)
+		if err != nil {
+			return nil, err
+		}
+		processOptions = append(processOptions, tree_sitter.WithResultCache(cache))
+	}
+	if len(executeOptions) > 0 {
+		processOptions = append(processOptions, tree_sitter.WithExecuteOptions(executeOptions...))
+	}
 
-			mutex.Lock()
-			results[file] = fileResults
-			mutex.Unlock()
-		}(file)
+	// Process files in parallel
+	results := make(QueryResults)
+	// the canonical name of the language is used to find its locals query
+	languageName := qb.language
+	if l, err := pkg.DefaultLanguageRegistry.Lookup(qb.language); err == nil {
+		languageName = l.Name
+	}
+	jobs := tree_sitter.NewFileJobs(files, languageName, lang, sitterQueries)
+	err = tree_sitter.ProcessFiles(ctx, jobs, config.MaxWorkers,
+		func(result tree_sitter.FileResult) error {
+			if result.Err != nil {
+				if config.OnFileError != nil {
+					config.OnFileError(result.FileName, result.Err)
+					return nil
+				}
+				fmt.Printf("Error processing file %s: %s\n", result.FileName, result.Err)
+				return nil
+			}
+			results[result.FileName] = result.Results
+			if config.OnParseHealth != nil {
+				config.OnParseHealth(result.FileName, result.Health)
+			}
+			return nil
+		}, processOptions...)
+	if err != nil {
+		return nil, err
 	}
 
-	wg.Wait()
 	return results, nil
 }
 
@@ -309,7 +428,7 @@ func (qb *QueryBuilder) resolveFiles(config *RunConfig) ([]string, error) {
 
 	// Directory scanning
 	if config.Directory != "" {
-		dirFiles, err := qb.scanDirectory(config.Directory, config.Recursive)
+		dirFiles, err := qb.scanDirectory(config)
 		if err != nil {
 			return nil, err
 		}
@@ -330,29 +449,31 @@ func (qb *QueryBuilder) resolveFiles(config *RunConfig) ([]string, error) {
 	return result, nil
 }
 
-// scanDirectory scans a directory for files
-func (qb *QueryBuilder) scanDirectory(dir string, recursive bool) ([]string, error) {
-	var files []string
-
-	walkFn := func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+// scanDirectory returns the files of the language in the directory of
+// config, skipping ignored, binary and generated files
+func (qb *QueryBuilder) scanDirectory(config *RunConfig) ([]string, error) {
+	// languages without globs get all the files
+	globs := []string{"*"}
+	rl, err := pkg.DefaultLanguageRegistry.Lookup(qb.language)
+	if err == nil && len(rl.Globs) > 0 {
+		globs = rl.Globs
+	}
+	if config.Recursive {
+		recursive := make([]string, 0, len(globs))
+		for _, glob := range globs {
+			recursive = append(recursive, "**/"+glob)
 		}
-
-		if info.IsDir() {
-			if path != dir && !recursive {
-				return filepath.SkipDir
-			}
-			return nil
-		}
-
-		// TODO: Filter by language-specific extensions
-		files = append(files, path)
-		return nil
+		globs = recursive
 	}
 
-	err := filepath.Walk(dir, walkFn)
-	return files, err
+	collector := sources.NewCollector(
+		sources.WithGlobs(globs...),
+		sources.WithExcludes(config.Exclude...),
+		sources.WithIgnoreFiles(!config.NoIgnore),
+		sources.WithMaxFileSize(config.MaxFileSize),
+		sources.WithSkipGenerated(!config.IncludeGenerated),
+	)
+	return collector.Collect([]string{config.Directory})
 }
 
 // TemplatedResults is the data structure passed to templates
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	tree_sitter "github.com/go-go-golems/oak/pkg/tree-sitter"
+)
+
+func TestWithPredicate(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "main.go")
+	source := "package main\n\nfunc OldRun() {}\n\nfunc Run() {}\n\nfunc main() {\n\tOldRun()\n\tRun()\n}\n"
+	err := os.WriteFile(file, []byte(source), 0644)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	deprecated := map[string]bool{"OldRun": true}
+	qb := NewQueryBuilder(
+		WithLanguage("go"),
+		WithQuery("calls", `((call_expression function: (identifier) @call) (#calls-deprecated? @call))`),
+		WithPredicate("calls-deprecated?", func(captures tree_sitter.Match, args []string) bool {
+			return deprecated[captures[strings.TrimPrefix(args[0], "@")].Text]
+		}),
+	)
+
+	output, err := qb.RunWithTemplate(context.Background(), `
+{{- range $file, $results := .ResultsByFile }}{{ len $results.calls.Matches }}:
+{{- range $results.calls.Matches }} {{ .call.Text }}{{ end }}{{ end }}`, WithFiles([]string{file}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if output != "1: OldRun" {
+		t.Errorf("Expected only the deprecated call, got %q", output)
+	}
+}
+
+func TestWithPredicateRejectsBuiltins(t *testing.T) {
+	qb := NewQueryBuilder(
+		WithLanguage("go"),
+		WithQuery("identifiers", `(identifier) @name`),
+		WithPredicate("eq?", func(tree_sitter.Match, []string) bool { return true }),
+	)
+	_, err := qb.Run(context.Background(), WithFiles([]string{"main.go"}))
+	if err == nil {
+		t.Fatalf("Expected an error when replacing a built-in predicate")
+	}
+}
+
+func TestWithDirectory(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		".gitignore":      "ignored/\n",
+		"main.go":         "package main\n",
+		"README.md":       "# main\n",
+		"main_gen.go":     "// Code generated by a tool. DO NOT EDIT.\n\npackage main\n",
+		"sub/sub.go":      "package sub\n",
+		"sub/sub_test.go": "package sub\n",
+		"ignored/x.go":    "package ignored\n",
+	} {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		err := os.MkdirAll(filepath.Dir(p), 0755)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		err = os.WriteFile(p, []byte(content), 0644)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	qb := NewQueryBuilder(WithLanguage("go"), WithQuery("packages", `(package_identifier) @name`))
+	for _, test := range []struct {
+		options  []RunOption
+		expected []string
+	}{
+		{[]RunOption{WithDirectory(dir)}, []string{"main.go"}},
+		{[]RunOption{WithDirectory(dir), WithRecursive(true), WithExclude("*_test.go")}, []string{"main.go", "sub/sub.go"}},
+		{[]RunOption{WithDirectory(dir), WithRecursive(true), WithNoIgnore(), WithIncludeGenerated()},
+			[]string{"ignored/x.go", "main.go", "main_gen.go", "sub/sub.go", "sub/sub_test.go"}},
+	} {
+		results, err := qb.Run(context.Background(), test.options...)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		actual := []string{}
+		for file := range results {
+			rel, err := filepath.Rel(dir, file)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			actual = append(actual, filepath.ToSlash(rel))
+		}
+		sort.Strings(actual)
+		if strings.Join(test.expected, ",") != strings.Join(actual, ",") {
+			t.Errorf("Expected %v, got %v", test.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,369 @@
+// Package callgraph extracts a caller to callee graph from source files, using
+// built-in queries for the function, method and call expressions of each
+// language.
+//
+// Calls are resolved on a best-effort basis, from the syntax alone: a method
+// call is resolved when the type of its receiver is known from a receiver,
+// a parameter or a variable declaration, and a call through an import alias
+// is resolved to the imported package or module. Calls that can't be
+// resolved are dropped.
+package callgraph
+
+import (
+	"context"
+	"sort"
+
+	"github.com/go-go-golems/oak/pkg"
+	"github.com/go-go-golems/oak/pkg/api"
+	tree_sitter "github.com/go-go-golems/oak/pkg/tree-sitter"
+	"github.com/pkg/errors"
+)
+
+// Kinds of nodes.
+const (
+	KindFunction = "function"
+	KindMethod   = "method"
+	// KindModule nodes are the callers of the calls made outside any
+	// function, such as in the initializer of a package variable
+	KindModule = "module"
+	// KindExternal nodes are functions that are not defined in the sources,
+	// such as the functions of imported packages
+	KindExternal = "external"
+)
+
+// Node is a function of the graph.
+type Node struct {
+	// ID is the qualified name of the function, such as "pkg/index.Build"
+	// or "src/shapes.Square.area"
+	ID string `json:"id"`
+	// Name is the name of the function in its module, such as "Build" or
+	// "Square.area"
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+	// Module is the Go package or TypeScript module of the function: the
+	// directory of the package, or the file without its extension
+	Module string `json:"module"`
+	File   string `json:"file,omitempty"`
+	Row    uint32 `json:"row"`
+}
+
+// Edge is a call from Caller to Callee. Calls between the same functions are
+// merged, File, Row and Column being the position of the first one.
+type Edge struct {
+	Caller string `json:"caller"`
+	Callee string `json:"callee"`
+	Count  int    `json:"count"`
+	File   string `json:"file"`
+	Row    uint32 `json:"row"`
+	Column uint32 `json:"column"`
+}
+
+// Graph is a call graph. Nodes are sorted by ID, and edges by caller and
+// callee.
+type Graph struct {
+	Nodes []*Node `json:"nodes"`
+	Edges []*Edge `json:"edges"`
+}
+
+// Node returns the node with the given ID, or nil.
+func (g *Graph) Node(id string) *Node {
+	i := sort.Search(len(g.Nodes), func(i int) bool {
+		return g.Nodes[i].ID >= id
+	})
+	if i < len(g.Nodes) && g.Nodes[i].ID == id {
+		return g.Nodes[i]
+	}
+	return nil
+}
+
+// Option configures Build.
+type Option func(*config)
+
+type config struct {
+	external bool
+	workers  int
+	// onFileError is called with the files that couldn't be read or parsed
+	onFileError func(fileName string, err error)
+}
+
+// WithExternal keeps the calls to functions that are not defined in the
+// sources, such as the functions of imported packages, as KindExternal
+// nodes.
+func WithExternal(external bool) Option {
+	return func(c *config) {
+		c.external = external
+	}
+}
+
+// WithFileErrors calls fn with the error of each file that couldn't be read
+// or parsed. These files are left out of the graph, and their errors are
+// logged if fn is not set.
+func WithFileErrors(fn func(fileName string, err error)) Option {
+	return func(c *config) {
+		c.onFileError = fn
+	}
+}
+
+// WithWorkers sets the number of files parsed in parallel.
+func WithWorkers(workers int) Option {
+	return func(c *config) {
+		c.workers = workers
+	}
+}
+
+// fileError reports the error of a file left out of the graph.
+func (c *config) fileError(fileName string, err error) {
+	if c.onFileError != nil {
+		c.onFileError(fileName, err)
+		return
+	}
+	zlog.Warn().Err(err).Str("file", fileName).Msg("could not process file")
+}
+
+// language extracts the call graph of the files of a language, in two
+// passes: define adds the functions of each file, so that calls can then be
+// resolved across files by addCalls.
+type language struct {
+	queries  []api.Query
+	define   func(b *builder, fileName string, results map[string]*tree_sitter.Result)
+	addCalls func(b *builder, fileName string, results map[string]*tree_sitter.Result)
+}
+
+var languages = map[string]language{
+	"go":         goLanguage,
+	"typescript": typescriptLanguage,
+	"tsx":        typescriptLanguage,
+}
+
+// Languages returns the names of the languages supported by Build.
+func Languages() []string {
+	ret := make([]string, 0, len(languages))
+	for name := range languages {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Build returns the call graph of fileNames. Files of languages that are not
+// supported are ignored, and files that can't be read or parsed are reported
+// with WithFileErrors.
+func Build(ctx context.Context, fileNames []string, options ...Option) (*Graph, error) {
+	c := &config{workers: 4}
+	for _, option := range options {
+		option(c)
+	}
+
+	filesByLanguage := map[string][]string{}
+	for _, fileName := range fileNames {
+		candidates, err := pkg.DefaultLanguageRegistry.LookupFileName(fileName)
+		if err != nil {
+			continue
+		}
+		for _, candidate := range candidates {
+			if _, ok := languages[candidate.Name]; ok {
+				filesByLanguage[candidate.Name] = append(filesByLanguage[candidate.Name], fileName)
+				break
+			}
+		}
+	}
+
+	b := newBuilder(c.external)
+	type languageResults struct {
+		language language
+		results  api.QueryResults
+	}
+	all := []languageResults{}
+	for _, name := range Languages() {
+		files := filesByLanguage[name]
+		if len(files) == 0 {
+			continue
+		}
+		l := languages[name]
+		options := []api.QueryOption{api.WithLanguage(name)}
+		for _, q := range l.queries {
+			options = append(options, api.WithQuery(q.Name, q.Query))
+		}
+		results, err := api.NewQueryBuilder(options...).Run(ctx,
+			api.WithFiles(files), api.WithMaxWorkers(c.workers), api.WithFileErrors(c.fileError))
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not run the %s call graph queries", name)
+		}
+		all = append(all, languageResults{language: l, results: results})
+	}
+
+	for _, lr := range all {
+		for _, fileName := range sortedFiles(lr.results) {
+			lr.language.define(b, fileName, lr.results[fileName])
+		}
+	}
+	for _, lr := range all {
+		for _, fileName := range sortedFiles(lr.results) {
+			lr.language.addCalls(b, fileName, lr.results[fileName])
+		}
+	}
+
+	return b.graph(), nil
+}
+
+func sortedFiles(results api.QueryResults) []string {
+	ret := make([]string, 0, len(results))
+	for fileName := range results {
+		ret = append(ret, fileName)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// definition is a function defined in a file, with the range of its node to
+// find the caller of the calls it contains.
+type definition struct {
+	node      *Node
+	startByte uint32
+	endByte   uint32
+	// class is the class or the receiver type of a method
+	class string
+}
+
+type edgeKey struct {
+	caller string
+	callee string
+}
+
+type builder struct {
+	external    bool
+	nodes       map[string]*Node
+	edges       map[edgeKey]*Edge
+	definitions map[string][]*definition
+	// modules are the modules of the functions defined in the sources
+	modules map[string]bool
+}
+
+func newBuilder(external bool) *builder {
+	return &builder{
+		external:    external,
+		nodes:       map[string]*Node{},
+		edges:       map[edgeKey]*Edge{},
+		definitions: map[string][]*definition{},
+		modules:     map[string]bool{},
+	}
+}
+
+// define adds a function or a method defined by the node captured as c.
+func (b *builder) define(module string, name string, kind string, class string, fileName string, c tree_sitter.Capture) {
+	b.modules[module] = true
+	id := module + "." + name
+	n, ok := b.nodes[id]
+	if !ok {
+		n = &Node{
+			ID:     id,
+			Name:   name,
+			Kind:   kind,
+			Module: module,
+			File:   fileName,
+			Row:    c.StartPoint.Row,
+		}
+		b.nodes[id] = n
+	}
+	b.definitions[fileName] = append(b.definitions[fileName], &definition{
+		node:      n,
+		startByte: c.StartByte,
+		endByte:   c.EndByte,
+		class:     class,
+	})
+}
+
+// enclosing returns the innermost definition of fileName containing the
+// byte at offset, or nil.
+func (b *builder) enclosing(fileName string, offset uint32) *definition {
+	var ret *definition
+	for _, d := range b.definitions[fileName] {
+		if d.startByte <= offset && offset < d.endByte {
+			if ret == nil || d.endByte-d.startByte < ret.endByte-ret.startByte {
+				ret = d
+			}
+		}
+	}
+	return ret
+}
+
+// caller returns the node of the function of fileName containing call, or
+// the module node if the call is outside any function. Module nodes are only
+// added to the graph with their first call.
+func (b *builder) caller(fileName string, module string, call tree_sitter.Capture) *Node {
+	if d := b.enclosing(fileName, call.StartByte); d != nil {
+		return d.node
+	}
+	if n, ok := b.nodes[module]; ok {
+		return n
+	}
+	return &Node{ID: module, Name: module, Kind: KindModule, Module: module, File: fileName}
+}
+
+// addCall adds a call from caller to the function id, if it is defined in
+// the sources. Otherwise, the call is only added when keeping external
+// calls, to an external node called name in module.
+func (b *builder) addCall(caller *Node, id string, module string, name string, fileName string, call tree_sitter.Capture) {
+	if _, ok := b.nodes[id]; !ok {
+		if !b.external || name == "" {
+			return
+		}
+		b.nodes[id] = &Node{ID: id, Name: name, Kind: KindExternal, Module: module}
+	}
+
+	if _, ok := b.nodes[caller.ID]; !ok {
+		b.nodes[caller.ID] = caller
+	}
+
+	key := edgeKey{caller: caller.ID, callee: id}
+	e, ok := b.edges[key]
+	if !ok {
+		e = &Edge{
+			Caller: caller.ID,
+			Callee: id,
+			File:   fileName,
+			Row:    call.StartPoint.Row,
+			Column: call.StartPoint.Column,
+		}
+		b.edges[key] = e
+	}
+	e.Count++
+}
+
+// has returns true if the function id is defined in the sources.
+func (b *builder) has(id string) bool {
+	n, ok := b.nodes[id]
+	return ok && n.Kind != KindExternal && n.Kind != KindModule
+}
+
+func (b *builder) graph() *Graph {
+	g := &Graph{
+		Nodes: make([]*Node, 0, len(b.nodes)),
+		Edges: make([]*Edge, 0, len(b.edges)),
+	}
+	for _, n := range b.nodes {
+		g.Nodes = append(g.Nodes, n)
+	}
+	sort.Slice(g.Nodes, func(i, j int) bool {
+		return g.Nodes[i].ID < g.Nodes[j].ID
+	})
+	for _, e := range b.edges {
+		g.Edges = append(g.Edges, e)
+	}
+	sort.Slice(g.Edges, func(i, j int) bool {
+		if g.Edges[i].Caller != g.Edges[j].Caller {
+			return g.Edges[i].Caller < g.Edges[j].Caller
+		}
+		return g.Edges[i].Callee < g.Edges[j].Callee
+	})
+	return g
+}
+
+// matches returns the matches of the query name, or nil.
+func matches(results map[string]*tree_sitter.Result, name string) []tree_sitter.Match {
+	r, ok := results[name]
+	if !ok {
+		return nil
+	}
+	return r.Matches
+}
@@ -0,0 +1,202 @@
+package callgraph
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-go-golems/oak/internal/testutil"
+)
+
+// edgesOf returns the edges of g as "caller -> callee", with the directory of
+// the files removed from the IDs.
+func edgesOf(g *Graph, dir string) []string {
+	ret := []string{}
+	for _, e := range g.Edges {
+		ret = append(ret, testutil.TrimDir(dir, e.Caller)+" -> "+testutil.TrimDir(dir, e.Callee))
+	}
+	return ret
+}
+
+func TestGoCallGraph(t *testing.T) {
+	dir := t.TempDir()
+	fileNames := testutil.WriteFiles(t, dir, map[string]string{
+		"app/main.go": `package main
+
+import (
+	"fmt"
+
+	util "example.com/project/lib"
+)
+
+type Server struct{}
+
+func (s *Server) Start() {
+	s.listen()
+	fmt.Println(len("started"))
+}
+
+func (s *Server) listen() {}
+
+func run(srv *Server) {
+	srv.Start()
+}
+
+func main() {
+	s := &Server{}
+	s.Start()
+	run(s)
+	util.Helper()
+}
+`,
+		"lib/lib.go": `package lib
+
+func Helper() {
+	helper()
+}
+
+func helper() {}
+`,
+	})
+
+	g, err := Build(context.Background(), fileNames)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	testutil.AssertLines(t, "edges", []string{
+		"app.Server.Start -> app.Server.listen",
+		"app.main -> app.Server.Start",
+		"app.main -> app.run",
+		"app.main -> lib.Helper",
+		"app.run -> app.Server.Start",
+		"lib.Helper -> lib.helper",
+	}, edgesOf(g, dir))
+
+	n := g.Node(filepath.ToSlash(dir) + "/app.Server.Start")
+	if n == nil || n.Kind != KindMethod || n.Name != "Server.Start" || n.Row != 10 {
+		t.Errorf("Unexpected node %+v", n)
+	}
+
+	g, err = Build(context.Background(), fileNames, WithExternal(true))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	external := g.Node("fmt.Println")
+	if external == nil || external.Kind != KindExternal || external.Module != "fmt" {
+		t.Errorf("Expected fmt.Println as external node, got %+v", external)
+	}
+	if g.Node("app.len") != nil {
+		t.Errorf("Expected builtins to be skipped")
+	}
+}
+
+func TestTypeScriptCallGraph(t *testing.T) {
+	dir := t.TempDir()
+	fileNames := testutil.WriteFiles(t, dir, map[string]string{
+		"src/shapes.ts": `export function area(size: number) { return square(size) }
+
+const square = (x: number) => x * x
+
+export class Square {
+  static unit() { return new Square() }
+  describe() { return this.name() + area(1) }
+  name() { return "square" }
+}
+`,
+		"src/main.ts": `import { area as computeArea, Square } from './shapes'
+import * as shapes from "./shapes"
+
+function main() {
+  computeArea(2)
+  shapes.area(3)
+  Square.unit()
+  console.log("done")
+}
+
+main()
+`,
+	})
+
+	g, err := Build(context.Background(), fileNames)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	testutil.AssertLines(t, "edges", []string{
+		"src/main -> src/main.main",
+		"src/main.main -> src/shapes.Square.unit",
+		"src/main.main -> src/shapes.area",
+		"src/shapes.Square.describe -> src/shapes.Square.name",
+		"src/shapes.Square.describe -> src/shapes.area",
+		"src/shapes.area -> src/shapes.square",
+	}, edgesOf(g, dir))
+
+	for _, e := range g.Edges {
+		if strings.HasSuffix(e.Caller, "main.main") && strings.HasSuffix(e.Callee, "shapes.area") && e.Count != 2 {
+			t.Errorf("Expected both calls to area to be merged, got %d", e.Count)
+		}
+	}
+}
+
+func TestOutputFormats(t *testing.T) {
+	g := &Graph{
+		Nodes: []*Node{
+			{ID: "fmt.Println", Name: "Println", Kind: KindExternal, Module: "fmt"},
+			{ID: "main.main", Name: "main", Kind: KindFunction, Module: "main"},
+		},
+		Edges: []*Edge{{Caller: "main.main", Callee: "fmt.Println", Count: 1}},
+	}
+
+	var dot bytes.Buffer
+	err := g.WriteDOT(&dot)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, expected := range []string{
+		`label="fmt";`,
+		`"fmt.Println" [label="Println", style=dashed];`,
+		`"main.main" -> "fmt.Println";`,
+	} {
+		if !strings.Contains(dot.String(), expected) {
+			t.Errorf("Expected %s in:\n%s", expected, dot.String())
+		}
+	}
+
+	var mermaid bytes.Buffer
+	err = g.WriteMermaid(&mermaid)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := `flowchart LR
+  subgraph m0["fmt"]
+    n0(["Println"])
+  end
+  subgraph m1["main"]
+    n1["main"]
+  end
+  n1 --> n0
+`
+	if mermaid.String() != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, mermaid.String())
+	}
+}
+
+func TestCallGraphFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	fileNames := testutil.WriteFiles(t, dir, map[string]string{
+		"app/main.go": "package main\n\nfunc main() { run() }\n\nfunc run() {}\n",
+	})
+	missing := filepath.Join(dir, "app", "missing.go")
+
+	failed := []string{}
+	g, err := Build(context.Background(), append(fileNames, missing),
+		WithFileErrors(func(fileName string, err error) {
+			failed = append(failed, fileName)
+		}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	testutil.AssertLines(t, "failed files", []string{missing}, failed)
+	testutil.AssertLines(t, "edges", []string{"app.main -> app.run"}, edgesOf(g, dir))
+}
@@ -0,0 +1,245 @@
+package callgraph
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/go-go-golems/oak/pkg/api"
+	tree_sitter "github.com/go-go-golems/oak/pkg/tree-sitter"
+)
+
+// The functions and methods queries are those of the function_finder
+// experiment, capturing the whole declaration and the receiver type.
+var goLanguage = language{
+	queries: []api.Query{
+		{Name: "package", Query: `(package_clause (package_identifier) @package)`},
+		{Name: "imports", Query: `
+			(import_spec
+			 name: (package_identifier)? @alias
+			 path: (interpreted_string_literal) @path)
+		`},
+		{Name: "functions", Query: `
+			(function_declaration
+			 name: (identifier) @functionName
+			 parameters: (parameter_list) @parameters
+			 body: (block)? @body) @function
+		`},
+		{Name: "methods", Query: `
+			(method_declaration
+			 receiver: (parameter_list
+			   (parameter_declaration
+			    name: (identifier)? @receiverName
+			    type: [
+			      (type_identifier) @receiverType
+			      (pointer_type (type_identifier) @receiverType)
+			      (generic_type type: (type_identifier) @receiverType)
+			      (pointer_type (generic_type type: (type_identifier) @receiverType))
+			    ])) @receiver
+			 name: (field_identifier) @methodName
+			 parameters: (parameter_list) @parameters
+			 body: (block)? @body) @method
+		`},
+		{Name: "variables", Query: `
+			(parameter_declaration
+			 name: (identifier) @name
+			 type: [(type_identifier) @type (pointer_type (type_identifier) @type)])
+			(var_spec
+			 name: (identifier) @name
+			 type: [(type_identifier) @type (pointer_type (type_identifier) @type)])
+			(short_var_declaration
+			 left: (expression_list . (identifier) @name)
+			 right: (expression_list . [
+			   (composite_literal type: (type_identifier) @type)
+			   (unary_expression operand: (composite_literal type: (type_identifier) @type))
+			 ]))
+		`},
+		{Name: "calls", Query: `
+			(call_expression
+			 function: [
+			   (identifier) @callee
+			   (selector_expression operand: (_) @operand field: (field_identifier) @callee)
+			 ]) @call
+		`},
+	},
+	define:   defineGo,
+	addCalls: addGoCalls,
+}
+
+// goBuiltins are never added as external functions.
+var goBuiltins = map[string]bool{
+	"append": true, "cap": true, "clear": true, "close": true, "complex": true,
+	"copy": true, "delete": true, "imag": true, "len": true, "make": true,
+	"max": true, "min": true, "new": true, "panic": true, "print": true,
+	"println": true, "real": true, "recover": true,
+}
+
+// goModule returns the module of a Go file: the directory of its package,
+// or the name of the package for files in the current directory.
+func goModule(fileName string, results map[string]*tree_sitter.Result) string {
+	dir := filepath.ToSlash(filepath.Dir(fileName))
+	if dir != "." {
+		return dir
+	}
+	for _, m := range matches(results, "package") {
+		return m["package"].Text
+	}
+	return dir
+}
+
+func defineGo(b *builder, fileName string, results map[string]*tree_sitter.Result) {
+	module := goModule(fileName, results)
+	for _, m := range matches(results, "functions") {
+		b.define(module, m["functionName"].Text, KindFunction, "", fileName, m["function"])
+	}
+	for _, m := range matches(results, "methods") {
+		receiverType := m["receiverType"].Text
+		b.define(module, receiverType+"."+m["methodName"].Text, KindMethod, receiverType, fileName, m["method"])
+	}
+}
+
+// goVariable is a variable whose type is known, visible from startByte to
+// the end of the function declaring it.
+type goVariable struct {
+	name      string
+	typeName  string
+	startByte uint32
+	scope     *definition
+}
+
+func addGoCalls(b *builder, fileName string, results map[string]*tree_sitter.Result) {
+	module := goModule(fileName, results)
+
+	imports := map[string]string{}
+	for _, m := range matches(results, "imports") {
+		importPath := strings.Trim(m["path"].Text, "\"`")
+		alias := goImportName(importPath)
+		if a, ok := m["alias"]; ok {
+			alias = a.Text
+		}
+		imports[alias] = importPath
+	}
+
+	variables := []goVariable{}
+	for _, m := range matches(results, "methods") {
+		if name, ok := m["receiverName"]; ok {
+			variables = append(variables, goVariable{
+				name:      name.Text,
+				typeName:  m["receiverType"].Text,
+				startByte: name.StartByte,
+				scope:     b.enclosing(fileName, name.StartByte),
+			})
+		}
+	}
+	for _, m := range matches(results, "variables") {
+		name := m["name"]
+		scope := b.enclosing(fileName, name.StartByte)
+		if scope == nil {
+			// package variables are only resolved through their package
+			continue
+		}
+		variables = append(variables, goVariable{
+			name:      name.Text,
+			typeName:  m["type"].Text,
+			startByte: name.StartByte,
+			scope:     scope,
+		})
+	}
+
+	for _, m := range matches(results, "calls") {
+		call := m["call"]
+		caller := b.caller(fileName, module, call)
+		callee := m["callee"].Text
+
+		operand, ok := m["operand"]
+		if !ok {
+			if goBuiltins[callee] {
+				continue
+			}
+			// functions of other packages are only called through a selector,
+			// and other identifiers can be function variables or conversions
+			b.addCall(caller, module+"."+callee, module, "", fileName, call)
+			continue
+		}
+		if operand.Type != "identifier" {
+			continue
+		}
+
+		if v := findGoVariable(variables, operand.Text, call.StartByte); v != nil {
+			if id := module + "." + v.typeName + "." + callee; b.has(id) {
+				b.addCall(caller, id, module, "", fileName, call)
+			}
+			continue
+		}
+		if importPath, ok := imports[operand.Text]; ok {
+			calleeModule := b.moduleOfImport(importPath, callee)
+			b.addCall(caller, calleeModule+"."+callee, calleeModule, callee, fileName, call)
+		}
+	}
+}
+
+// findGoVariable returns the closest declaration of name before offset in the
+// functions enclosing offset.
+func findGoVariable(variables []goVariable, name string, offset uint32) *goVariable {
+	var ret *goVariable
+	for i := range variables {
+		v := &variables[i]
+		if v.name != name || v.startByte > offset || v.scope == nil {
+			continue
+		}
+		if offset < v.scope.startByte || offset >= v.scope.endByte {
+			continue
+		}
+		if ret == nil || v.startByte > ret.startByte {
+			ret = v
+		}
+	}
+	return ret
+}
+
+var (
+	goMajorVersionRegexp  = regexp.MustCompile(`^v[0-9]+$`)
+	goVersionSuffixRegexp = regexp.MustCompile(`\.v[0-9]+$`)
+)
+
+// goImportName guesses the name of the package imported as importPath, which
+// is usually the last element of the path, without a major version suffix
+// such as /v2 or .v3, and without a go- prefix.
+func goImportName(importPath string) string {
+	elements := strings.Split(importPath, "/")
+	name := elements[len(elements)-1]
+	if len(elements) > 1 && goMajorVersionRegexp.MatchString(name) {
+		name = elements[len(elements)-2]
+	}
+	name = goVersionSuffixRegexp.ReplaceAllString(name, "")
+	if i := strings.LastIndex(name, "-"); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
+
+// moduleOfImport returns the module of the sources that defines the function
+// name and whose directory ends like importPath, preferring the modules
+// with the most path elements in common. It returns importPath itself for
+// packages outside the sources.
+func (b *builder) moduleOfImport(importPath string, name string) string {
+	ret := importPath
+	longest := 0
+	importElements := strings.Split(importPath, "/")
+	for module := range b.modules {
+		if !b.has(module + "." + name) {
+			continue
+		}
+		moduleElements := strings.Split(module, "/")
+		common := 0
+		for common < len(importElements) && common < len(moduleElements) &&
+			importElements[len(importElements)-1-common] == moduleElements[len(moduleElements)-1-common] {
+			common++
+		}
+		if common > longest || (common == longest && common > 0 && module < ret) {
+			ret = module
+			longest = common
+		}
+	}
+	return ret
+}
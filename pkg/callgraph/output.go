@@ -0,0 +1,95 @@
+package callgraph
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// modules returns the nodes of g grouped by module, in the order of g.Nodes.
+func (g *Graph) modules() ([]string, map[string][]*Node) {
+	names := []string{}
+	nodes := map[string][]*Node{}
+	for _, n := range g.Nodes {
+		if _, ok := nodes[n.Module]; !ok {
+			names = append(names, n.Module)
+		}
+		nodes[n.Module] = append(nodes[n.Module], n)
+	}
+	return names, nodes
+}
+
+// WriteDOT writes g in the DOT language of graphviz, with a cluster for each
+// module. External functions are dashed.
+func (g *Graph) WriteDOT(w io.Writer) error {
+	var sb strings.Builder
+	sb.WriteString("digraph callgraph {\n")
+	sb.WriteString("  rankdir=LR;\n")
+	sb.WriteString("  node [shape=box];\n")
+
+	names, nodes := g.modules()
+	for i, module := range names {
+		fmt.Fprintf(&sb, "  subgraph cluster_%d {\n", i)
+		fmt.Fprintf(&sb, "    label=%s;\n", strconv.Quote(module))
+		for _, n := range nodes[module] {
+			style := ""
+			if n.Kind == KindExternal {
+				style = ", style=dashed"
+			}
+			fmt.Fprintf(&sb, "    %s [label=%s%s];\n", strconv.Quote(n.ID), strconv.Quote(n.Name), style)
+		}
+		sb.WriteString("  }\n")
+	}
+
+	for _, e := range g.Edges {
+		fmt.Fprintf(&sb, "  %s -> %s;\n", strconv.Quote(e.Caller), strconv.Quote(e.Callee))
+	}
+	sb.WriteString("}\n")
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// WriteMermaid writes g as a mermaid flowchart, with a subgraph for each
+// module.
+func (g *Graph) WriteMermaid(w io.Writer) error {
+	var sb strings.Builder
+	sb.WriteString("flowchart LR\n")
+
+	// mermaid IDs can't contain most punctuation
+	ids := map[string]string{}
+	names, nodes := g.modules()
+	for i, module := range names {
+		fmt.Fprintf(&sb, "  subgraph m%d[\"%s\"]\n", i, mermaidEscape(module))
+		for _, n := range nodes[module] {
+			id := fmt.Sprintf("n%d", len(ids))
+			ids[n.ID] = id
+			if n.Kind == KindExternal {
+				fmt.Fprintf(&sb, "    %s([\"%s\"])\n", id, mermaidEscape(n.Name))
+			} else {
+				fmt.Fprintf(&sb, "    %s[\"%s\"]\n", id, mermaidEscape(n.Name))
+			}
+		}
+		sb.WriteString("  end\n")
+	}
+
+	for _, e := range g.Edges {
+		fmt.Fprintf(&sb, "  %s --> %s\n", ids[e.Caller], ids[e.Callee])
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func mermaidEscape(s string) string {
+	return strings.ReplaceAll(s, "\"", "#quot;")
+}
+
+// WriteJSON writes g as a JSON object with the nodes and edges arrays.
+func (g *Graph) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(g)
+}
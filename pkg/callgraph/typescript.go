@@ -0,0 +1,165 @@
+package callgraph
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-go-golems/oak/pkg/api"
+	tree_sitter "github.com/go-go-golems/oak/pkg/tree-sitter"
+)
+
+var typescriptLanguage = language{
+	queries: []api.Query{
+		{Name: "imports", Query: `
+			(import_statement
+			 (import_clause
+			   (named_imports (import_specifier name: (identifier) @name alias: (identifier)? @alias)))
+			 source: (string) @source)
+			(import_statement
+			 (import_clause (namespace_import (identifier) @namespace))
+			 source: (string) @source)
+			(import_statement
+			 (import_clause . (identifier) @default)
+			 source: (string) @source)
+		`},
+		{Name: "functions", Query: `
+			(function_declaration name: (identifier) @functionName) @function
+			(generator_function_declaration name: (identifier) @functionName) @function
+			(variable_declarator
+			 name: (identifier) @functionName
+			 value: [(arrow_function) (function)]) @function
+		`},
+		{Name: "methods", Query: `
+			([(class_declaration name: (type_identifier) @className body: (class_body (method_definition name: (property_identifier) @methodName) @method))
+			  (abstract_class_declaration name: (type_identifier) @className body: (class_body (method_definition name: (property_identifier) @methodName) @method))])
+		`},
+		{Name: "calls", Query: `
+			(call_expression
+			 function: [
+			   (identifier) @callee
+			   (member_expression object: (_) @operand property: (property_identifier) @callee)
+			 ]) @call
+		`},
+	},
+	define:   defineTypeScript,
+	addCalls: addTypeScriptCalls,
+}
+
+// typescriptModule returns the module of a file, which is its path without
+// extension.
+func typescriptModule(fileName string) string {
+	fileName = filepath.ToSlash(fileName)
+	return strings.TrimSuffix(fileName, path.Ext(fileName))
+}
+
+func defineTypeScript(b *builder, fileName string, results map[string]*tree_sitter.Result) {
+	module := typescriptModule(fileName)
+	for _, m := range matches(results, "functions") {
+		b.define(module, m["functionName"].Text, KindFunction, "", fileName, m["function"])
+	}
+	for _, m := range matches(results, "methods") {
+		className := m["className"].Text
+		b.define(module, className+"."+m["methodName"].Text, KindMethod, className, fileName, m["method"])
+	}
+}
+
+// typescriptImport is a name bound by an import statement.
+type typescriptImport struct {
+	module string
+	// name is the imported name, "*" for namespace imports
+	name string
+}
+
+func addTypeScriptCalls(b *builder, fileName string, results map[string]*tree_sitter.Result) {
+	module := typescriptModule(fileName)
+
+	imports := map[string]typescriptImport{}
+	for _, m := range matches(results, "imports") {
+		source := strings.Trim(m["source"].Text, "\"'`")
+		importedModule := b.resolveTypeScriptImport(module, source)
+		switch {
+		case m["namespace"].Text != "":
+			imports[m["namespace"].Text] = typescriptImport{module: importedModule, name: "*"}
+		case m["default"].Text != "":
+			imports[m["default"].Text] = typescriptImport{module: importedModule, name: "default"}
+		default:
+			local := m["name"].Text
+			if alias, ok := m["alias"]; ok {
+				local = alias.Text
+			}
+			imports[local] = typescriptImport{module: importedModule, name: m["name"].Text}
+		}
+	}
+
+	for _, m := range matches(results, "calls") {
+		call := m["call"]
+		caller := b.caller(fileName, module, call)
+		callee := m["callee"].Text
+
+		operand, ok := m["operand"]
+		if !ok {
+			if i, ok := imports[callee]; ok && i.name != "*" {
+				b.addCall(caller, i.module+"."+i.name, i.module, i.name, fileName, call)
+				continue
+			}
+			b.addCall(caller, module+"."+callee, module, "", fileName, call)
+			continue
+		}
+
+		switch {
+		case operand.Type == "this":
+			if d := b.enclosingMethod(fileName, call.StartByte); d != nil {
+				b.addCall(caller, module+"."+d.class+"."+callee, module, "", fileName, call)
+			}
+		case operand.Type == "identifier":
+			if i, ok := imports[operand.Text]; ok {
+				if i.name == "*" {
+					b.addCall(caller, i.module+"."+callee, i.module, callee, fileName, call)
+				} else {
+					// static method of an imported class
+					b.addCall(caller, i.module+"."+i.name+"."+callee, i.module, i.name+"."+callee, fileName, call)
+				}
+				continue
+			}
+			// static method of a class of the module
+			b.addCall(caller, module+"."+operand.Text+"."+callee, module, "", fileName, call)
+		}
+	}
+}
+
+// enclosingMethod returns the innermost method containing offset, skipping
+// the functions nested in it, or nil.
+func (b *builder) enclosingMethod(fileName string, offset uint32) *definition {
+	var ret *definition
+	for _, d := range b.definitions[fileName] {
+		if d.class == "" || offset < d.startByte || offset >= d.endByte {
+			continue
+		}
+		if ret == nil || d.endByte-d.startByte < ret.endByte-ret.startByte {
+			ret = d
+		}
+	}
+	return ret
+}
+
+// resolveTypeScriptImport returns the module imported as source from module.
+// Relative imports are resolved to the modules of the sources, either the
+// file itself or its index file. Other imports are packages, and keep their
+// name.
+func (b *builder) resolveTypeScriptImport(module string, source string) string {
+	if !strings.HasPrefix(source, ".") {
+		return source
+	}
+	resolved := path.Join(path.Dir(module), source)
+	switch path.Ext(resolved) {
+	case ".ts", ".tsx", ".js", ".jsx", ".mjs":
+		resolved = strings.TrimSuffix(resolved, path.Ext(resolved))
+	}
+	for _, candidate := range []string{resolved, resolved + "/index"} {
+		if b.modules[candidate] {
+			return candidate
+		}
+	}
+	return resolved
+}
@@ -8,13 +8,11 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
-	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
 	"text/template"
 
-	"github.com/bmatcuk/doublestar/v4"
 	"github.com/go-go-golems/glazed/pkg/cmds"
 	"github.com/go-go-golems/glazed/pkg/cmds/alias"
 	"github.com/go-go-golems/glazed/pkg/cmds/fields"
@@ -22,9 +20,9 @@ import (
 	"github.com/go-go-golems/glazed/pkg/cmds/loaders"
 	"github.com/go-go-golems/glazed/pkg/cmds/schema"
 	"github.com/go-go-golems/glazed/pkg/cmds/values"
-	"github.com/go-go-golems/glazed/pkg/helpers/compare"
 	"github.com/go-go-golems/glazed/pkg/helpers/templating"
 	"github.com/go-go-golems/oak/pkg"
+	"github.com/go-go-golems/oak/pkg/sources"
 	tree_sitter "github.com/go-go-golems/oak/pkg/tree-sitter"
 	"github.com/pkg/errors"
 	sitter "github.com/smacker/go-tree-sitter"
@@ -41,9 +39,20 @@ type OakParameterLayer struct {
 const OakSlug = "oak"
 
 type OakSettings struct {
-	Recurse      bool     `glazed:"recurse"`
-	PrintQueries bool     `glazed:"print-queries"`
-	Glob         []string `glazed:"glob"`
+	Recurse            bool     `glazed:"recurse"`
+	PrintQueries       bool     `glazed:"print-queries"`
+	Glob               []string `glazed:"glob"`
+	GitChanged         string   `glazed:"git-changed"`
+	GitRev             string   `glazed:"git-rev"`
+	Staged             bool     `glazed:"staged"`
+	Write              bool     `glazed:"write"`
+	FailOnDroppedEdits bool     `glazed:"fail-on-dropped-edits"`
+	Workers            int      `glazed:"workers"`
+	Cache              bool     `glazed:"cache"`
+	CacheDir           string   `glazed:"cache-dir"`
+	WithAncestors      bool     `glazed:"with-ancestors"`
+	WithLocals         bool     `glazed:"with-locals"`
+	WarnSyntaxErrors   bool     `glazed:"warn-syntax-errors"`
 }
 
 func NewOakParameterLayer() (*OakParameterLayer, error) {
@@ -51,22 +60,56 @@ func NewOakParameterLayer() (*OakParameterLayer, error) {
 	if err != nil {
 		return nil, err
 	}
+	section.AddFields(NewSourceFilterFlags()...)
 	return &OakParameterLayer{SectionImpl: section}, nil
 }
 
 type OakCommand struct {
-	Language string                    `yaml:"language,omitempty"`
-	Queries  []tree_sitter.SitterQuery `yaml:"queries"`
-	Template string                    `yaml:"template"`
+	Language   string                     `yaml:"language,omitempty"`
+	Queries    []tree_sitter.SitterQuery  `yaml:"queries"`
+	Template   string                     `yaml:"template"`
+	Rewrites   []Rewrite                  `yaml:"rewrites,omitempty"`
+	OnConflict tree_sitter.ConflictPolicy `yaml:"on-conflict,omitempty"`
+	Languages  []LanguageQueries          `yaml:"languages,omitempty"`
+	Injections []tree_sitter.Injection    `yaml:"injections,omitempty"`
+	Tests      []CommandTest              `yaml:"tests,omitempty"`
 
 	SitterLanguage *sitter.Language
 	*cmds.CommandDescription
+
+	// sourceDir is the directory the file names in the output are relative
+	// to, the fixture directory when running golden file tests. Sources are
+	// read from their full path.
+	sourceDir string
+}
+
+// displayFileName returns fileName as it is shown in the output of the
+// command, see sourceDir.
+func (oc *OakCommand) displayFileName(fileName string) string {
+	if oc.sourceDir == "" {
+		return fileName
+	}
+	return strings.TrimPrefix(fileName, oc.sourceDir+string(filepath.Separator))
+}
+
+// sourceFileName returns the path of the file shown as fileName in the
+// output of the command.
+func (oc *OakCommand) sourceFileName(fileName string) string {
+	if oc.sourceDir == "" || filepath.IsAbs(fileName) {
+		return fileName
+	}
+	return filepath.Join(oc.sourceDir, fileName)
 }
 
 type OakCommandDescription struct {
-	Language string                    `yaml:"language,omitempty"`
-	Queries  []tree_sitter.SitterQuery `yaml:"queries"`
-	Template string                    `yaml:"template,omitempty"`
+	Language   string                    `yaml:"language,omitempty"`
+	Queries    []tree_sitter.SitterQuery `yaml:"queries"`
+	Template   string                    `yaml:"template,omitempty"`
+	Rewrites   []Rewrite                 `yaml:"rewrites,omitempty"`
+	OnConflict string                    `yaml:"on-conflict,omitempty"`
+	Languages  []LanguageQueries         `yaml:"languages,omitempty"`
+	Injections []tree_sitter.Injection   `yaml:"injections,omitempty"`
+	Tests      []CommandTest             `yaml:"tests,omitempty"`
 
 	Name   string               `yaml:"name"`
 	Short  string               `yaml:"short"`
@@ -80,9 +123,15 @@ type OakCommandDescription struct {
 }
 
 type OakCommandLoader struct {
+	// SkipValidation loads commands without validating their queries and
+	// template, see OakCommand.Validate.
+	SkipValidation bool
 }
 
 func (o *OakCommandLoader) IsFileSupported(f fs.FS, fileName string) bool {
+	if isFixtureFile(fileName) {
+		return false
+	}
 	return strings.HasSuffix(fileName, ".yaml") || strings.HasSuffix(fileName, ".yml")
 }
 
@@ -118,6 +167,29 @@ func (o *OakCommandLoader) loadCommandFromReader(
 		return nil, err
 	}
 
+	err = validateLanguages(ocd.Language, ocd.Languages)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid languages in command %s", ocd.Name)
+	}
+
+	err = validateInjections(ocd.Injections, ocd.Queries)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid injections in command %s", ocd.Name)
+	}
+
+	err = validateRewrites(ocd.Rewrites, ocd.Queries)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid rewrites in command %s", ocd.Name)
+	}
+	err = validateTests(ocd.Tests)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid tests in command %s", ocd.Name)
+	}
+	onConflict, err := tree_sitter.ParseConflictPolicy(ocd.OnConflict)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid on-conflict in command %s", ocd.Name)
+	}
+
 	oakLayer, err := NewOakParameterLayer()
 	if err != nil {
 		return nil, err
@@ -149,9 +221,21 @@ func (o *OakCommandLoader) loadCommandFromReader(
 		cmds.NewCommandDescription(ocd.Name, options_...),
 		WithQueries(ocd.Queries...),
 		WithTemplate(ocd.Template),
+		WithRewrites(ocd.Rewrites...),
+		WithConflictPolicy(onConflict),
 		WithLanguage(ocd.Language),
+		WithLanguages(ocd.Languages...),
+		WithInjections(ocd.Injections...),
+		WithTests(ocd.Tests...),
 	)
 
+	if !o.SkipValidation {
+		err = checkCommand(oakCommand.OakCommand)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return []cmds.Command{oakCommand}, nil
 }
 
@@ -335,73 +419,72 @@ func printNode(n *sitter.Node, depth int, name string) {
 // NOTE(manuel, 2023-06-19) This is not a great API, but it will do for now.
 func (oc *OakCommand) RenderQueries(parsedValues *values.Values) error {
 	ps := parsedValues.GetDataMap()
-	for idx, query := range oc.Queries {
+
+	err := renderQueries(oc.Queries, ps)
+	if err != nil {
+		return err
+	}
+	oc.Queries = removeEmptyQueries(oc.Queries)
+
+	// empty queries are kept in the overrides, so that they can disable a
+	// query for a language
+	for _, l := range oc.Languages {
+		err := renderQueries(l.Queries, ps)
+		if err != nil {
+			return errors.Wrapf(err, "failed to render queries for language %s", l.Name)
+		}
+	}
+
+	return nil
+}
+
+// renderQueries renders the queries in place.
+func renderQueries(queries_ []tree_sitter.SitterQuery, ps map[string]interface{}) error {
+	for idx, query := range queries_ {
 		// we're ignoring the query because we want the index only, since we are not dealing with pointers
 		_ = query
-		if oc.Queries[idx].Rendered {
-			return errors.Errorf("query %s has already been rendered", oc.Queries[idx].Name)
+		if queries_[idx].Rendered {
+			return errors.Errorf("query %s has already been rendered", queries_[idx].Name)
 		}
-		tmpl, err := templating.CreateTemplate("oak").Parse(oc.Queries[idx].Query)
+		tmpl, err := templating.CreateTemplate("oak").Parse(queries_[idx].Query)
 		if err != nil {
-			return errors.Wrapf(err, "failed to parse query %s", oc.Queries[idx].Name)
+			return errors.Wrapf(err, "failed to parse query %s", queries_[idx].Name)
 		}
 		var buf bytes.Buffer
 		err = tmpl.Execute(&buf, ps)
 		if err != nil {
-			return errors.Wrapf(err, "failed to render query %s", oc.Queries[idx].Name)
+			return errors.Wrapf(err, "failed to render query %s", queries_[idx].Name)
 		}
 
 		query := buf.String()
 
-		oc.Queries[idx].Query = query
-		oc.Queries[idx].Rendered = true
+		queries_[idx].Query = query
+		queries_[idx].Rendered = true
 	}
 
-	// remove queries that only consists of whitespace
+	return nil
+}
+
+// removeEmptyQueries removes queries that only consists of whitespace.
+func removeEmptyQueries(queries_ []tree_sitter.SitterQuery) []tree_sitter.SitterQuery {
 	queries := []tree_sitter.SitterQuery{}
-	for _, query := range oc.Queries {
+	for _, query := range queries_ {
 		if strings.TrimSpace(query.Query) != "" {
 			queries = append(queries, query)
 		}
 	}
-
-	oc.Queries = queries
-
-	return nil
+	return queries
 }
 
-func collectSources(sources []string, globs []string) ([]string, error) {
-	ret := []string{}
+// CollectSources returns the files of sources_, sorted and without
+// duplicates. Files are returned as is, directories are expanded to the
+// files matching globs, relative to the directory, and ignored if globs is
+// empty. Files listed in .gitignore and .oakignore files, binary and
+// generated files are skipped, unless options change it.
+func CollectSources(sources_ []string, globs []string, options ...sources.Option) ([]string, error) {
 	// globs not empty implies recursion, if the glob patterns are recursive
-	for _, source := range sources {
-		source = strings.TrimSuffix(source, "/")
-		// check if source is a directory
-		fi, err := os.Stat(source)
-		if err != nil {
-			return nil, err
-		}
-		if !fi.IsDir() {
-			ret = append(ret, source)
-		} else {
-			if len(globs) > 0 {
-				for _, glob := range globs {
-					files, err := doublestar.Glob(os.DirFS(source), glob, doublestar.WithFilesOnly())
-					if err != nil {
-						return nil, err
-					}
-					for _, file := range files {
-						ret = append(ret, filepath.Join(source, file))
-					}
-				}
-			}
-		}
-
-	}
-
-	// remove duplicates
-	ret = compare.RemoveDuplicates(ret)
-
-	return ret, nil
+	options = append([]sources.Option{sources.WithGlobs(globs...)}, options...)
+	return sources.NewCollector(options...).Collect(sources_)
 }
 
 // indentLines is a helper function that will prepend the given prefix in front of each line
@@ -424,38 +507,100 @@ func (oc *OakCommand) PrintQueries(w io.Writer) error {
 	return nil
 }
 
+// ProcessFiles parses the given fileNames and runs the queries of the command
+// on them, using up to workers goroutines. onResult is called with the results
+// and the syntax errors of each file in the order of fileNames, as soon as
+// they are available. The file names passed to onResult and set in the
+// results are the ones shown in the output, see sourceDir.
+//
+// For commands with several languages, the language of each file is picked
+// from its name, see LanguageForFile.
+func (oc *OakCommand) ProcessFiles(
+	ctx context.Context,
+	fileNames []string,
+	workers int,
+	onResult func(fileName string, results tree_sitter.QueryResults, health tree_sitter.ParseHealth) error,
+	options ...tree_sitter.ProcessOption,
+) error {
+	jobs, err := oc.FileJobs(fileNames)
+	if err != nil {
+		return errors.Wrapf(err, "could not get languages for oak command")
+	}
+
+	return tree_sitter.ProcessFiles(ctx, jobs, workers,
+		func(result tree_sitter.FileResult) error {
+			if result.Err != nil {
+				return result.Err
+			}
+			fileName := oc.displayFileName(result.FileName)
+			if fileName != result.FileName {
+				result.Results.SetFileName(fileName)
+			}
+			return onResult(fileName, result.Results, result.Health)
+		}, options...)
+}
+
+// ProcessOptions returns the options for ProcessFiles corresponding to the
+// oak flags, for example the result cache.
+func (oc *OakCommand) ProcessOptions(ss *OakSettings) ([]tree_sitter.ProcessOption, error) {
+	options := []tree_sitter.ProcessOption{}
+	if ss.Cache || ss.CacheDir != "" {
+		cache, err := tree_sitter.NewResultCache(ss.CacheDir)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, tree_sitter.WithResultCache(cache))
+	}
+	options = append(options, tree_sitter.WithExecuteOptions(ExecuteOptions(ss)...))
+	return options, nil
+}
+
+// ExecuteOptions returns the options to run queries with, as set by the oak
+// flags.
+func ExecuteOptions(ss *OakSettings) []tree_sitter.ExecuteOption {
+	options := []tree_sitter.ExecuteOption{}
+	if ss.WithAncestors {
+		options = append(options, tree_sitter.WithAncestors())
+	}
+	if ss.WithLocals {
+		options = append(options, tree_sitter.WithLocals())
+	}
+	return options
+}
+
 // GetResultsByFile is a helper function that parses the given fileNames and
-// returns a map of results by fileName.
+// returns a map of results by fileName, and a map of their syntax errors.
 func (oc *OakCommand) GetResultsByFile(
 	ctx context.Context,
 	fileNames []string,
+	workers int,
+	options ...tree_sitter.ProcessOption,
 ) (
-	map[string]tree_sitter.QueryResults, error) {
+	map[string]tree_sitter.QueryResults, map[string]tree_sitter.ParseHealth, error) {
 	resultsByFile := map[string]tree_sitter.QueryResults{}
-
-	lang, err := oc.GetLanguage()
+	healthByFile := map[string]tree_sitter.ParseHealth{}
+
+	err := oc.ProcessFiles(ctx, fileNames, workers,
+		func(fileName string, results tree_sitter.QueryResults, health tree_sitter.ParseHealth) error {
+			resultsByFile[fileName] = results
+			healthByFile[fileName] = health
+			return nil
+		}, options...)
 	if err != nil {
-		return nil, errors.Wrapf(err, "could not get language for oak command")
+		return nil, nil, err
 	}
 
-	for _, fileName := range fileNames {
-		source, err := os.ReadFile(fileName)
-		if err != nil {
-			return nil, errors.Wrapf(err, "could not read file %s", fileName)
-		}
-
-		tree, err := oc.Parse(ctx, nil, []byte(source))
-		if err != nil {
-			return nil, errors.Wrapf(err, "could not parse file %s", fileName)
-		}
+	return resultsByFile, healthByFile, nil
+}
 
-		results, err := tree_sitter.ExecuteQueries(lang, tree.RootNode(), oc.Queries, source)
+// PrintSyntaxErrors prints a warning for each syntax error of fileName, as
+// file:line:column, and returns the number of errors.
+func PrintSyntaxErrors(w io.Writer, fileName string, health tree_sitter.ParseHealth) (int, error) {
+	for _, e := range health.Errors {
+		_, err := fmt.Fprintf(w, "warning: %s:%s\n", fileName, e.String())
 		if err != nil {
-			return nil, errors.Wrapf(err, "could not execute queries for file %s", fileName)
+			return 0, err
 		}
-
-		resultsByFile[fileName] = results
 	}
-
-	return resultsByFile, nil
+	return len(health.Errors), nil
 }
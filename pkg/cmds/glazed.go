@@ -4,9 +4,11 @@ import (
 	"context"
 	"io"
 	"io/fs"
+	"os"
+	"sort"
 	"strings"
 
-	"github.com/go-go-golems/oak/pkg"
+	tree_sitter "github.com/go-go-golems/oak/pkg/tree-sitter"
 	"gopkg.in/yaml.v3"
 
 	"github.com/go-go-golems/glazed/pkg/cmds"
@@ -18,6 +20,7 @@ import (
 	"github.com/go-go-golems/glazed/pkg/middlewares"
 	"github.com/go-go-golems/glazed/pkg/settings"
 	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/pkg/errors"
 )
 
 type OakGlazeCommand struct {
@@ -66,48 +69,128 @@ func (oc *OakGlazeCommand) RunIntoGlazeProcessor(
 		return nil
 	}
 
-	glob_ := ss.Glob
-	if ss.Recurse && len(glob_) == 0 {
-		// use standard globs for the language of the command
-		glob_, err = pkg.GetLanguageGlobs(oc.Language)
-		if err != nil {
-			return err
-		}
+	sf := &SourceFilterSettings{}
+	err = parsedValues.DecodeSectionInto(OakSlug, sf)
+	if err != nil {
+		return err
 	}
-	sources_, err := collectSources(s.Sources, glob_)
+	sources_, err := oc.CollectOakSources(ctx, s.Sources, ss, sf)
 	if err != nil {
 		return err
 	}
+	defer func() {
+		_ = sources_.Close()
+	}()
 
-	resultsByFile, err := oc.GetResultsByFile(ctx, sources_)
+	options, err := oc.ProcessOptions(ss)
 	if err != nil {
 		return err
 	}
+	options = append(options, sources_.ProcessOptions(ctx)...)
 
-	for fileName, fileResults := range resultsByFile {
-		for _, result := range fileResults {
-			for _, match := range result.Matches {
-				for _, capture := range match {
-					row := types.NewRow(
-						types.MRP("file", fileName),
-						types.MRP("query", result.QueryName),
-						types.MRP("capture", capture.Name),
-
-						types.MRP("startRow", capture.StartPoint.Row),
-						types.MRP("startColumn", capture.StartPoint.Column),
-						types.MRP("endRow", capture.EndPoint.Row),
-						types.MRP("endColumn", capture.EndPoint.Column),
-
-						types.MRP("startByte", capture.StartByte),
-						types.MRP("endByte", capture.EndByte),
-
-						types.MRP("type", capture.Type),
-						types.MRP("text", capture.Text),
-					)
-					err = gp.AddRow(ctx, row)
-					if err != nil {
-						return err
-					}
+	// rows are streamed as soon as a file is done, in the order of the sources
+	return oc.ProcessFiles(ctx, sources_.FileNames, ss.Workers,
+		func(fileName string, fileResults tree_sitter.QueryResults, health tree_sitter.ParseHealth) error {
+			if ss.WarnSyntaxErrors {
+				_, err := PrintSyntaxErrors(os.Stderr, fileName, health)
+				if err != nil {
+					return err
+				}
+			}
+			return oc.addResultRows(ctx, gp, fileName, sources_.Revision, fileResults, health)
+		}, options...)
+}
+
+// addResultRows adds a row for each capture in fileResults. Results are
+// output in the order of the queries of the command, and the captures of a
+// match in the order of their position in the file. Commands with several
+// languages or with queries for embedded languages get an additional language
+// column, files read from a git revision an additional revision column, and
+// files with syntax errors an additional parseErrors column with their number
+// of ERROR and MISSING nodes.
+func (oc *OakGlazeCommand) addResultRows(
+	ctx context.Context,
+	gp middlewares.Processor,
+	fileName string,
+	revision string,
+	fileResults tree_sitter.QueryResults,
+	health tree_sitter.ParseHealth,
+) error {
+	language, err := oc.LanguageForFile(fileName)
+	if err != nil {
+		return err
+	}
+
+	queries := oc.QueriesForLanguage(language)
+	withLanguage := len(oc.Languages) > 0
+	for _, query := range queries {
+		withLanguage = withLanguage || query.Language != ""
+	}
+
+	for _, query := range queries {
+		result, ok := fileResults[query.Name]
+		if !ok {
+			continue
+		}
+		for _, match := range result.Matches {
+			captures := make([]tree_sitter.Capture, 0, len(match))
+			for _, capture := range match {
+				captures = append(captures, capture)
+			}
+			sort.Slice(captures, func(i, j int) bool {
+				if captures[i].StartByte != captures[j].StartByte {
+					return captures[i].StartByte < captures[j].StartByte
+				}
+				return captures[i].Name < captures[j].Name
+			})
+
+			for _, capture := range captures {
+				row := types.NewRow(
+					types.MRP("file", fileName),
+					types.MRP("query", result.QueryName),
+					types.MRP("capture", capture.Name),
+
+					types.MRP("startRow", capture.StartPoint.Row),
+					types.MRP("startColumn", capture.StartPoint.Column),
+					types.MRP("endRow", capture.EndPoint.Row),
+					types.MRP("endColumn", capture.EndPoint.Column),
+
+					types.MRP("startByte", capture.StartByte),
+					types.MRP("endByte", capture.EndByte),
+
+					types.MRP("type", capture.Type),
+					types.MRP("text", capture.Text),
+
+					types.MRP("pattern", capture.PatternIndex),
+					types.MRP("field", capture.FieldName),
+					types.MRP("named", capture.IsNamed),
+					types.MRP("isError", capture.IsError),
+					types.MRP("isMissing", capture.IsMissing),
+					types.MRP("hasError", capture.HasError),
+				)
+				if capture.Ancestors != nil {
+					row.Set("ancestors", capture.AncestorPath())
+				}
+				if capture.Definition != nil {
+					row.Set("definition", capture.Definition.Kind)
+					row.Set("definitionRow", capture.Definition.StartPoint.Row)
+					row.Set("definitionColumn", capture.Definition.StartPoint.Column)
+				}
+				if capture.Properties != nil {
+					row.Set("properties", capture.Properties)
+				}
+				if withLanguage {
+					row.Set("language", result.Language)
+				}
+				if revision != "" {
+					row.Set("revision", revision)
+				}
+				if health.HasError {
+					row.Set("parseErrors", len(health.Errors))
+				}
+				err := gp.AddRow(ctx, row)
+				if err != nil {
+					return err
 				}
 			}
 		}
@@ -128,9 +211,16 @@ func NewOakGlazedCommand(d *cmds.CommandDescription, options ...OakCommandOption
 	return &cmd
 }
 
-type OakGlazedCommandLoader struct{}
+type OakGlazedCommandLoader struct {
+	// SkipValidation loads commands without validating their queries and
+	// template, see OakCommand.Validate.
+	SkipValidation bool
+}
 
 func (o *OakGlazedCommandLoader) IsFileSupported(f fs.FS, fileName string) bool {
+	if isFixtureFile(fileName) {
+		return false
+	}
 	return strings.HasSuffix(fileName, ".yaml") || strings.HasSuffix(fileName, ".yml")
 }
 
@@ -167,6 +257,21 @@ func (o *OakGlazedCommandLoader) loadCommandFromReader(
 		return nil, err
 	}
 
+	err = validateLanguages(ocd.Language, ocd.Languages)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid languages in command %s", ocd.Name)
+	}
+
+	err = validateInjections(ocd.Injections, ocd.Queries)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid injections in command %s", ocd.Name)
+	}
+
+	err = validateTests(ocd.Tests)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid tests in command %s", ocd.Name)
+	}
+
 	oakLayer, err := NewOakParameterLayer()
 	if err != nil {
 		return nil, err
@@ -203,8 +308,18 @@ func (o *OakGlazedCommandLoader) loadCommandFromReader(
 		WithQueries(ocd.Queries...),
 		WithTemplate(ocd.Template),
 		WithLanguage(ocd.Language),
+		WithLanguages(ocd.Languages...),
+		WithInjections(ocd.Injections...),
+		WithTests(ocd.Tests...),
 	)
 
+	if !o.SkipValidation {
+		err = checkCommand(oakCommand.OakCommand)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return []cmds.Command{oakCommand}, nil
 }
 
@@ -214,3 +329,17 @@ func (o *OakGlazedCommandLoader) LoadCommandAliasFromYAML(
 ) ([]*alias.CommandAlias, error) {
 	return loaders.LoadCommandAliasFromYAML(s, options...)
 }
+
+// CloseAndFail closes gp and returns err, for glaze commands that report
+// their rows and then fail, such as linters exiting with a non-zero status
+// when they find issues. The glazed runner only closes the processor, which
+// outputs the rows, when the command succeeds, so the rows would be lost
+// otherwise. The error of closing gp is returned instead of err if there is
+// one.
+func CloseAndFail(ctx context.Context, gp middlewares.Processor, err error) error {
+	closeErr := gp.Close(ctx)
+	if closeErr != nil {
+		return closeErr
+	}
+	return err
+}
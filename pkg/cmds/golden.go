@@ -0,0 +1,364 @@
+package cmds
+
+import (
+	"bytes"
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/alias"
+	"github.com/go-go-golems/glazed/pkg/cmds/loaders"
+	"github.com/go-go-golems/glazed/pkg/cmds/runner"
+	"github.com/go-go-golems/glazed/pkg/cmds/schema"
+	"github.com/go-go-golems/glazed/pkg/settings"
+	"github.com/go-go-golems/oak/pkg/diff"
+	"github.com/pkg/errors"
+)
+
+// CommandTest is a golden file test of a command, declared in the tests
+// section of its YAML file. The command is run with Flags on the input files
+// of its fixture directory, see FixtureDir, and its output is compared to the
+// expected files of the test.
+//
+// Sources restricts the input files to run the command on, relative to the
+// fixture directory. The output of the command as text is compared to
+// expected.NAME.txt, the rows of its glaze version as JSON to
+// expected.NAME.json. A test without a name uses expected.txt and
+// expected.json.
+type CommandTest struct {
+	Name    string                 `yaml:"name,omitempty"`
+	Flags   map[string]interface{} `yaml:"flags,omitempty"`
+	Sources []string               `yaml:"sources,omitempty"`
+}
+
+func WithTests(tests ...CommandTest) OakCommandOption {
+	return func(cmd *OakCommand) {
+		cmd.Tests = append(cmd.Tests, tests...)
+	}
+}
+
+// validateTests checks that the names of the tests are unique and can be used
+// in file names, and that they don't rewrite their input files.
+func validateTests(tests []CommandTest) error {
+	names := map[string]bool{}
+	for _, test := range tests {
+		if names[test.Name] {
+			if test.Name == "" {
+				return errors.New("only one test can have no name")
+			}
+			return errors.Errorf("duplicate test %s", test.Name)
+		}
+		names[test.Name] = true
+		if strings.ContainsAny(test.Name, `/\`) {
+			return errors.Errorf("test name %s can't contain path separators", test.Name)
+		}
+		if _, ok := test.Flags["write"]; ok {
+			return errors.Errorf("test %s can't set the write flag", test.Name)
+		}
+	}
+	return nil
+}
+
+const fixtureDirSuffix = ".test"
+
+// FixtureDir returns the directory of the input and expected files of the
+// tests of the command file fileName: definitions.test for definitions.yaml.
+func FixtureDir(fileName string) string {
+	return strings.TrimSuffix(fileName, filepath.Ext(fileName)) + fixtureDirSuffix
+}
+
+// isFixtureFile returns true if fileName is in the fixture directory of a
+// command, so that the loaders don't load YAML input files as commands.
+func isFixtureFile(fileName string) bool {
+	dir := filepath.Dir(filepath.ToSlash(fileName))
+	for _, part := range strings.Split(dir, "/") {
+		if strings.HasSuffix(part, fixtureDirSuffix) {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	TestPassed  = "ok"
+	TestFailed  = "fail"
+	TestUpdated = "updated"
+)
+
+// CommandTestResult is the result of comparing the output of a test to one of
+// its expected files.
+type CommandTestResult struct {
+	// File is the command file, Command the name of the command.
+	File    string
+	Command string
+	Test    string
+	// Expected is the expected file, relative to the working directory.
+	Expected string
+	Status   string
+	// Diff is the unified diff from the expected to the actual output of a
+	// failed test.
+	Diff string
+	// Err is set if the test could not run, or has no expected file.
+	Err error
+}
+
+// RunCommandTests runs the tests of the command file fileName, or a single
+// test without flags if it doesn't declare any, and compares their output to
+// the expected files in its fixture directory. Commands without tests and
+// without fixture directory return no results.
+//
+// If update is set, the expected files are overwritten with the actual
+// output, and expected.NAME.txt is created for tests without expected file.
+//
+// The file names in the output of the commands are relative to the fixture
+// directory, so that they don't depend on where the tests are run from. The
+// working directory of the process is left alone.
+func RunCommandTests(ctx context.Context, fileName string, update bool) ([]CommandTestResult, error) {
+	command, err := loadTestCommand(&OakCommandLoader{}, fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	fixtureDir := FixtureDir(fileName)
+	fi, err := os.Stat(fixtureDir)
+	if err != nil || !fi.IsDir() {
+		if len(command.Tests) == 0 {
+			return nil, nil
+		}
+		return nil, errors.Errorf("command %s has tests but no fixture directory %s", command.Name, fixtureDir)
+	}
+
+	tests := command.Tests
+	if len(tests) == 0 {
+		tests = []CommandTest{{}}
+	}
+
+	inputs, err := fixtureInputs(fixtureDir)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []CommandTestResult{}
+	for _, test := range tests {
+		prefix := "expected"
+		if test.Name != "" {
+			prefix += "." + test.Name
+		}
+		expectedFiles := []string{}
+		for _, ext := range []string{".txt", ".json"} {
+			expected := filepath.Join(fixtureDir, prefix+ext)
+			if _, err := os.Stat(expected); err == nil {
+				expectedFiles = append(expectedFiles, expected)
+			}
+		}
+		if len(expectedFiles) == 0 {
+			if !update {
+				ret = append(ret, CommandTestResult{
+					File:     fileName,
+					Command:  command.Name,
+					Test:     test.Name,
+					Expected: filepath.Join(fixtureDir, prefix+".txt"),
+					Status:   TestFailed,
+					Err:      errors.New("no expected file, run with --update to create it"),
+				})
+				continue
+			}
+			expectedFiles = append(expectedFiles, filepath.Join(fixtureDir, prefix+".txt"))
+		}
+
+		sources_ := test.Sources
+		if len(sources_) == 0 {
+			sources_ = inputs
+		}
+
+		for _, expected := range expectedFiles {
+			result := CommandTestResult{
+				File:     fileName,
+				Command:  command.Name,
+				Test:     test.Name,
+				Expected: expected,
+			}
+			actual, err := runCommandTest(ctx, fileName, fixtureDir, test, sources_, filepath.Ext(expected) == ".json")
+			if err != nil {
+				result.Status = TestFailed
+				result.Err = err
+				ret = append(ret, result)
+				continue
+			}
+			result.Status, result.Diff, err = compareGoldenFile(expected, actual, update)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, result)
+		}
+	}
+
+	return ret, nil
+}
+
+// compareGoldenFile compares actual to the content of the expected file, and
+// overwrites it if update is set.
+func compareGoldenFile(expected string, actual []byte, update bool) (string, string, error) {
+	content, err := os.ReadFile(expected)
+	if err != nil && !os.IsNotExist(err) {
+		return "", "", err
+	}
+	if err == nil && bytes.Equal(content, actual) {
+		return TestPassed, "", nil
+	}
+	if update {
+		err = os.WriteFile(expected, actual, 0644)
+		if err != nil {
+			return "", "", err
+		}
+		return TestUpdated, "", nil
+	}
+	return TestFailed, diff.Unified(expected, "actual", content, actual, 3), nil
+}
+
+// fixtureInputs returns the files of the fixture directory dir, relative to
+// it, except for the expected files at its top.
+func fixtureInputs(dir string) ([]string, error) {
+	ret := []string{}
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(rel, "expected.") {
+			return nil
+		}
+		ret = append(ret, rel)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// runCommandTest runs a freshly loaded command of fileName on the sources_
+// of fixtureDir, since rendering its queries can only be done once. The
+// glaze version of the command is run with JSON output if asJSON is set.
+func runCommandTest(
+	ctx context.Context,
+	fileName string,
+	fixtureDir string,
+	test CommandTest,
+	sources_ []string,
+	asJSON bool,
+) ([]byte, error) {
+	var loader loaders.CommandLoader = &OakCommandLoader{}
+	if asJSON {
+		loader = &OakGlazedCommandLoader{}
+	}
+	command, err := loadTestCommand(loader, fileName)
+	if err != nil {
+		return nil, err
+	}
+	var c cmds.Command = &OakWriterCommand{OakCommand: command}
+	if asJSON {
+		c = &OakGlazeCommand{OakCommand: command}
+	}
+
+	valuesBySection, err := testValues(command.Schema, test.Flags)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid flags of test %s", test.Name)
+	}
+	// the inputs are shown relative to the fixture directory, so that the
+	// expected files don't depend on where the tests are run from
+	command.sourceDir = filepath.Clean(fixtureDir)
+	fileNames := make([]string, 0, len(sources_))
+	for _, source := range sources_ {
+		fileNames = append(fileNames, filepath.Join(command.sourceDir, source))
+	}
+	valuesBySection[schema.DefaultSlug]["sources"] = fileNames
+	if asJSON {
+		valuesBySection[settings.GlazedSlug]["output"] = "json"
+	}
+
+	parsedValues, err := runner.ParseCommandValues(c, runner.WithValuesForSections(valuesBySection))
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	err = runner.RunCommand(ctx, c, parsedValues, runner.WithWriter(&buf))
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// testValues assigns the flags of a test to the sections of schema_ that
+// define them. Flags of the glaze output are ignored when running the
+// command as text.
+func testValues(schema_ *schema.Schema, flags map[string]interface{}) (map[string]map[string]interface{}, error) {
+	ret := map[string]map[string]interface{}{
+		schema.DefaultSlug:  {},
+		settings.GlazedSlug: {},
+	}
+	glazedSchema, err := settings.NewGlazedSchema()
+	if err != nil {
+		return nil, err
+	}
+
+	for name, value := range flags {
+		found := false
+		schema_.ForEach(func(slug string, section schema.Section) {
+			if found {
+				return
+			}
+			if _, ok := section.GetDefinitions().Get(name); ok {
+				if _, ok := ret[slug]; !ok {
+					ret[slug] = map[string]interface{}{}
+				}
+				ret[slug][name] = value
+				found = true
+			}
+		})
+		if found {
+			continue
+		}
+		if _, ok := glazedSchema.GetDefinitions().Get(name); ok {
+			ret[settings.GlazedSlug][name] = value
+			continue
+		}
+		return nil, errors.Errorf("unknown flag %s", name)
+	}
+	return ret, nil
+}
+
+// loadTestCommand loads the oak command of fileName with loader.
+func loadTestCommand(loader loaders.CommandLoader, fileName string) (*OakCommand, error) {
+	absFileName, err := filepath.Abs(fileName)
+	if err != nil {
+		return nil, err
+	}
+	fs_, entryName, err := loaders.FileNameToFsFilePath(absFileName)
+	if err != nil {
+		return nil, err
+	}
+	commands, err := loader.LoadCommands(fs_, entryName, []cmds.CommandDescriptionOption{}, []alias.Option{})
+	if err != nil {
+		return nil, err
+	}
+	for _, command := range commands {
+		switch c := command.(type) {
+		case *OakWriterCommand:
+			return c.OakCommand, nil
+		case *OakGlazeCommand:
+			return c.OakCommand, nil
+		}
+	}
+	return nil, errors.Errorf("%s doesn't contain an oak command", fileName)
+}
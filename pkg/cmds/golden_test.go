@@ -0,0 +1,147 @@
+package cmds
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testCommandYAML = `name: functions
+short: List go functions
+flags:
+  - name: prefix
+    type: string
+    default: "-"
+language: go
+queries:
+  - name: functions
+    query: "(function_declaration name: (identifier) @name)"
+template: |
+  {{ range .Results.functions.Matches }}{{ $.prefix }} {{ .name.Text }}
+  {{ end }}
+tests:
+  - name: default
+  - name: star
+    flags:
+      prefix: "*"
+`
+
+func writeTestFile(t *testing.T, fileName string, content string) {
+	err := os.MkdirAll(filepath.Dir(fileName), 0755)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = os.WriteFile(fileName, []byte(content), 0644)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func testStatuses(t *testing.T, fileName string, update bool) []string {
+	results, err := RunCommandTests(context.Background(), fileName, update)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ret := []string{}
+	for _, result := range results {
+		ret = append(ret, result.Test+" "+filepath.Base(result.Expected)+" "+result.Status)
+	}
+	return ret
+}
+
+func TestRunCommandTests(t *testing.T) {
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "functions.yaml")
+	writeTestFile(t, fileName, testCommandYAML)
+	writeTestFile(t, filepath.Join(dir, "functions.test", "input.go"), "package main\n\nfunc foo() {}\n\nfunc bar() {}\n")
+	writeTestFile(t, filepath.Join(dir, "functions.test", "expected.star.json"), "")
+
+	actual := strings.Join(testStatuses(t, fileName, false), ",")
+	expected := "default expected.default.txt fail,star expected.star.json fail"
+	if actual != expected {
+		t.Fatalf("Expected %s, got %s", expected, actual)
+	}
+
+	actual = strings.Join(testStatuses(t, fileName, true), ",")
+	expected = "default expected.default.txt updated,star expected.star.json updated"
+	if actual != expected {
+		t.Fatalf("Expected %s, got %s", expected, actual)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "functions.test", "expected.default.txt"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(content) != "- foo\n- bar\n" {
+		t.Fatalf("Unexpected expected file %q", content)
+	}
+	content, err = os.ReadFile(filepath.Join(dir, "functions.test", "expected.star.json"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(string(content), `"file": "input.go"`) || !strings.Contains(string(content), `"text": "bar"`) {
+		t.Fatalf("Unexpected expected file %s", content)
+	}
+
+	actual = strings.Join(testStatuses(t, fileName, false), ",")
+	expected = "default expected.default.txt ok,star expected.star.json ok"
+	if actual != expected {
+		t.Fatalf("Expected %s, got %s", expected, actual)
+	}
+
+	writeTestFile(t, filepath.Join(dir, "functions.test", "input.go"), "package main\n\nfunc foo() {}\n")
+	results, err := RunCommandTests(context.Background(), fileName, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if results[0].Status != TestFailed || !strings.Contains(results[0].Diff, "\n-- bar\n") {
+		t.Fatalf("Expected a failed test with a diff, got %+v", results[0])
+	}
+}
+
+func TestRunCommandTestsWithoutFixtures(t *testing.T) {
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "functions.yaml")
+	writeTestFile(t, fileName, strings.Split(testCommandYAML, "tests:")[0])
+
+	results, err := RunCommandTests(context.Background(), fileName, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(results) != 0 {
+		t.Fatalf("Expected no results, got %+v", results)
+	}
+
+	writeTestFile(t, fileName, testCommandYAML)
+	_, err = RunCommandTests(context.Background(), fileName, false)
+	if err == nil {
+		t.Fatalf("Expected an error for tests without fixture directory")
+	}
+}
+
+func TestValidateTests(t *testing.T) {
+	for _, tests := range [][]CommandTest{
+		{{Name: "a"}, {Name: "a"}},
+		{{}, {}},
+		{{Name: "a/b"}},
+		{{Name: "a", Flags: map[string]interface{}{"write": true}}},
+	} {
+		if err := validateTests(tests); err == nil {
+			t.Errorf("Expected an error for %v", tests)
+		}
+	}
+	if err := validateTests([]CommandTest{{}, {Name: "a"}}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestIsFixtureFile(t *testing.T) {
+	loader := &OakCommandLoader{}
+	if !loader.IsFileSupported(nil, "go/definitions.yaml") {
+		t.Errorf("Expected command file to be supported")
+	}
+	if loader.IsFileSupported(nil, "go/definitions.test/input.yaml") {
+		t.Errorf("Expected fixture file not to be supported")
+	}
+}
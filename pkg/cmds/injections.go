@@ -0,0 +1,57 @@
+package cmds
+
+import (
+	"github.com/go-go-golems/oak/pkg"
+	tree_sitter "github.com/go-go-golems/oak/pkg/tree-sitter"
+	"github.com/pkg/errors"
+)
+
+func WithInjections(injections ...tree_sitter.Injection) OakCommandOption {
+	return func(cmd *OakCommand) {
+		cmd.Injections = append(cmd.Injections, injections...)
+	}
+}
+
+// validateInjections checks that the injections of a command and the embedded
+// languages of its queries are supported.
+func validateInjections(injections []tree_sitter.Injection, queries []tree_sitter.SitterQuery) error {
+	for _, injection := range injections {
+		if injection.Query == "" {
+			return errors.Errorf("injection of %s into %s is missing a query", injection.Language, injection.Host)
+		}
+		for _, name := range []string{injection.Host, injection.Language} {
+			if name == "" {
+				continue
+			}
+			_, err := pkg.LanguageNameToSitterLanguage(name)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for _, q := range queries {
+		if q.Language == "" {
+			continue
+		}
+		_, err := pkg.LanguageNameToSitterLanguage(q.Language)
+		if err != nil {
+			return errors.Wrapf(err, "invalid language of query %s", q.Name)
+		}
+	}
+	return nil
+}
+
+// injectionSet returns the injections used to run queries on a file of
+// language, or nil if none of the queries is for an embedded language. The
+// injections of the command replace the default ones for the same languages.
+func (oc *OakCommand) injectionSet(language string, queries []tree_sitter.SitterQuery) *tree_sitter.InjectionSet {
+	for _, q := range queries {
+		if q.Language != "" && q.Language != language {
+			return tree_sitter.NewInjectionSet(
+				pkg.LanguageNameToSitterLanguage,
+				tree_sitter.MergeInjections(tree_sitter.DefaultInjections, oc.Injections)...,
+			)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package cmds
+
+import (
+	"github.com/go-go-golems/glazed/pkg/helpers/compare"
+	"github.com/go-go-golems/oak/pkg"
+	tree_sitter "github.com/go-go-golems/oak/pkg/tree-sitter"
+	"github.com/pkg/errors"
+	sitter "github.com/smacker/go-tree-sitter"
+)
+
+// LanguageQueries declares one of the languages of a command that supports
+// several languages. Its queries override the queries of the command with the
+// same name, or are added to them. An empty query disables the query of the
+// same name for that language.
+type LanguageQueries struct {
+	Name    string                    `yaml:"name"`
+	Queries []tree_sitter.SitterQuery `yaml:"queries,omitempty"`
+}
+
+func WithLanguages(languages ...LanguageQueries) OakCommandOption {
+	return func(cmd *OakCommand) {
+		cmd.Languages = append(cmd.Languages, languages...)
+	}
+}
+
+// validateLanguages checks that a command declares either a language or a
+// list of languages, and that they are all supported.
+func validateLanguages(language string, languages []LanguageQueries) error {
+	if language != "" && len(languages) > 0 {
+		return errors.New("a command can't declare both language and languages")
+	}
+	for _, l := range languages {
+		_, err := pkg.LanguageNameToSitterLanguage(l.Name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LanguageNames returns the names of the languages supported by the command.
+func (oc *OakCommand) LanguageNames() []string {
+	if len(oc.Languages) == 0 {
+		return []string{oc.Language}
+	}
+	ret := make([]string, 0, len(oc.Languages))
+	for _, l := range oc.Languages {
+		ret = append(ret, l.Name)
+	}
+	return ret
+}
+
+// LanguageGlobs returns the standard globs of all the languages of the command.
+func (oc *OakCommand) LanguageGlobs() ([]string, error) {
+	ret := []string{}
+	for _, name := range oc.LanguageNames() {
+		globs, err := pkg.GetLanguageGlobs(name)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, globs...)
+	}
+	return compare.RemoveDuplicates(ret), nil
+}
+
+// QueriesForLanguage returns the queries of the command, with the overrides
+// declared for language applied.
+func (oc *OakCommand) QueriesForLanguage(language string) []tree_sitter.SitterQuery {
+	var overrides []tree_sitter.SitterQuery
+	for _, l := range oc.Languages {
+		if l.Name == language {
+			overrides = l.Queries
+			break
+		}
+	}
+	if len(overrides) == 0 {
+		return oc.Queries
+	}
+
+	ret := make([]tree_sitter.SitterQuery, 0, len(oc.Queries)+len(overrides))
+	used := map[string]bool{}
+	for _, q := range oc.Queries {
+		for _, o := range overrides {
+			if o.Name == q.Name {
+				q = o
+				used[o.Name] = true
+				break
+			}
+		}
+		ret = append(ret, q)
+	}
+	for _, o := range overrides {
+		if !used[o.Name] {
+			ret = append(ret, o)
+		}
+	}
+
+	return removeEmptyQueries(ret)
+}
+
+// LanguageForFile returns the language of the command used to parse fileName.
+// Commands with a single language use it for all files. Otherwise, the first
+// language of the command matching the file name is used.
+func (oc *OakCommand) LanguageForFile(fileName string) (string, error) {
+	if len(oc.Languages) == 0 {
+		return oc.Language, nil
+	}
+
+	candidates, err := pkg.FileNameToLanguageNames(fileName)
+	if err != nil {
+		return "", err
+	}
+	for _, candidate := range candidates {
+		for _, l := range oc.Languages {
+			// commands can use aliases such as golang
+			rl, err := pkg.DefaultLanguageRegistry.Lookup(l.Name)
+			if err != nil {
+				return "", err
+			}
+			if rl.Name == candidate {
+				return l.Name, nil
+			}
+		}
+	}
+
+	return "", errors.Errorf("command %s does not support the language of file %s", oc.Name, fileName)
+}
+
+// FileJobs returns the jobs to run the queries of the command on fileNames,
+// with the language and queries picked for each file.
+func (oc *OakCommand) FileJobs(fileNames []string) ([]tree_sitter.FileJob, error) {
+	type languageQueries struct {
+		lang       *sitter.Language
+		queries    []tree_sitter.SitterQuery
+		injections *tree_sitter.InjectionSet
+	}
+	byLanguage := map[string]languageQueries{}
+
+	ret := make([]tree_sitter.FileJob, 0, len(fileNames))
+	for _, fileName := range fileNames {
+		name, err := oc.LanguageForFile(fileName)
+		if err != nil {
+			return nil, err
+		}
+
+		lq, ok := byLanguage[name]
+		if !ok {
+			lang, err := oc.sitterLanguage(name)
+			if err != nil {
+				return nil, err
+			}
+			queries := oc.QueriesForLanguage(name)
+			lq = languageQueries{
+				lang:       lang,
+				queries:    queries,
+				injections: oc.injectionSet(name, queries),
+			}
+			byLanguage[name] = lq
+		}
+
+		ret = append(ret, tree_sitter.FileJob{
+			FileName:     fileName,
+			LanguageName: name,
+			Language:     lq.lang,
+			Queries:      lq.queries,
+			Injections:   lq.injections,
+		})
+	}
+
+	return ret, nil
+}
+
+func (oc *OakCommand) sitterLanguage(name string) (*sitter.Language, error) {
+	if len(oc.Languages) == 0 {
+		return oc.GetLanguage()
+	}
+	return pkg.LanguageNameToSitterLanguage(name)
+}
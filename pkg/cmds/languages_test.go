@@ -0,0 +1,88 @@
+package cmds
+
+import (
+	"testing"
+
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	tree_sitter "github.com/go-go-golems/oak/pkg/tree-sitter"
+)
+
+func newMultiLanguageCommand() *OakCommand {
+	return NewOakGlazedCommand(
+		cmds.NewCommandDescription("functions"),
+		WithQueries(
+			tree_sitter.SitterQuery{Name: "functions", Query: "(function_declaration) @function"},
+			tree_sitter.SitterQuery{Name: "types", Query: "(type_alias_declaration) @type"},
+		),
+		WithLanguages(
+			LanguageQueries{Name: "typescript"},
+			LanguageQueries{Name: "tsx"},
+			LanguageQueries{Name: "javascript", Queries: []tree_sitter.SitterQuery{
+				{Name: "types", Query: ""},
+				{Name: "classes", Query: "(class_declaration) @class"},
+			}},
+		),
+	).OakCommand
+}
+
+func TestLanguageForFile(t *testing.T) {
+	oc := newMultiLanguageCommand()
+
+	for fileName, expected := range map[string]string{
+		"a.ts":     "typescript",
+		"dir/b.ts": "typescript",
+		"c.tsx":    "tsx",
+		"d.js":     "javascript",
+	} {
+		language, err := oc.LanguageForFile(fileName)
+		if err != nil {
+			t.Fatalf("Unexpected error for %s: %v", fileName, err)
+		}
+		if language != expected {
+			t.Errorf("Expected %s for %s, got %s", expected, fileName, language)
+		}
+	}
+
+	_, err := oc.LanguageForFile("e.go")
+	if err == nil {
+		t.Fatalf("Expected an error for a language the command doesn't support")
+	}
+}
+
+func TestQueriesForLanguage(t *testing.T) {
+	oc := newMultiLanguageCommand()
+
+	queries := oc.QueriesForLanguage("typescript")
+	if len(queries) != 2 {
+		t.Fatalf("Expected the queries of the command, got %v", queries)
+	}
+
+	queries = oc.QueriesForLanguage("javascript")
+	names := []string{}
+	for _, q := range queries {
+		names = append(names, q.Name)
+	}
+	if len(names) != 2 || names[0] != "functions" || names[1] != "classes" {
+		t.Fatalf("Expected functions and classes, got %v", names)
+	}
+}
+
+func TestFileJobsPicksLanguagePerFile(t *testing.T) {
+	oc := newMultiLanguageCommand()
+
+	jobs, err := oc.FileJobs([]string{"a.ts", "b.tsx", "c.js"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for i, expected := range []string{"typescript", "tsx", "javascript"} {
+		if jobs[i].LanguageName != expected {
+			t.Errorf("Expected %s for %s, got %s", expected, jobs[i].FileName, jobs[i].LanguageName)
+		}
+		if jobs[i].Language == nil {
+			t.Errorf("Expected a grammar for %s", jobs[i].FileName)
+		}
+	}
+	if len(jobs[2].Queries) != 2 {
+		t.Errorf("Expected the javascript queries for c.js, got %v", jobs[2].Queries)
+	}
+}
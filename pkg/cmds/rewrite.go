@@ -0,0 +1,256 @@
+package cmds
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/go-go-golems/glazed/pkg/helpers/templating"
+	"github.com/go-go-golems/oak/pkg/diff"
+	tree_sitter "github.com/go-go-golems/oak/pkg/tree-sitter"
+	"github.com/pkg/errors"
+)
+
+// Rewrite describes a source edit derived from the results of a query.
+// For every match of Query, the bytes covered by Capture are replaced with
+// the rendered Replacement template.
+//
+// The replacement template has access to the command flags, to the captures
+// of the match (both as top-level variables and as .Match) and to the name
+// of the file being rewritten as .File.
+type Rewrite struct {
+	Query       string `yaml:"query"`
+	Capture     string `yaml:"capture"`
+	Replacement string `yaml:"replacement"`
+}
+
+func WithRewrites(rewrites ...Rewrite) OakCommandOption {
+	return func(cmd *OakCommand) {
+		cmd.Rewrites = append(cmd.Rewrites, rewrites...)
+	}
+}
+
+func WithConflictPolicy(policy tree_sitter.ConflictPolicy) OakCommandOption {
+	return func(cmd *OakCommand) {
+		cmd.OnConflict = policy
+	}
+}
+
+// validateRewrites checks that every rewrite refers to a declared query.
+func validateRewrites(rewrites []Rewrite, queries []tree_sitter.SitterQuery) error {
+	for _, rw := range rewrites {
+		if rw.Capture == "" {
+			return errors.Errorf("rewrite for query %s is missing a capture", rw.Query)
+		}
+		found := false
+		for _, q := range queries {
+			if q.Name == rw.Query {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errors.Errorf("rewrite refers to unknown query %s", rw.Query)
+		}
+	}
+	return nil
+}
+
+// ComputeEdits renders the rewrites of the command against the results of a
+// single file, and returns the resulting edits.
+//
+// data is passed to the replacement templates, usually the parsed flag values.
+func (oc *OakCommand) ComputeEdits(
+	fileName string,
+	results tree_sitter.QueryResults,
+	data map[string]interface{},
+) ([]tree_sitter.Edit, error) {
+	templates, err := oc.parseReplacements()
+	if err != nil {
+		return nil, err
+	}
+	return oc.computeEdits(templates, fileName, results, data)
+}
+
+// parseReplacements parses the replacement template of each rewrite of the
+// command, so that they can be rendered for all the files being rewritten.
+func (oc *OakCommand) parseReplacements() ([]*template.Template, error) {
+	ret := make([]*template.Template, 0, len(oc.Rewrites))
+	for _, rw := range oc.Rewrites {
+		tmpl, err := templating.CreateTemplate("rewrite").Parse(rw.Replacement)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse replacement for query %s", rw.Query)
+		}
+		ret = append(ret, tmpl)
+	}
+	return ret, nil
+}
+
+// computeEdits is ComputeEdits with the templates of parseReplacements.
+func (oc *OakCommand) computeEdits(
+	templates []*template.Template,
+	fileName string,
+	results tree_sitter.QueryResults,
+	data map[string]interface{},
+) ([]tree_sitter.Edit, error) {
+	edits := []tree_sitter.Edit{}
+
+	for i, rw := range oc.Rewrites {
+		result, ok := results[rw.Query]
+		if !ok {
+			// the query might have been rendered away by its flags
+			continue
+		}
+
+		for _, match := range result.Matches {
+			capture, ok := match[rw.Capture]
+			if !ok {
+				continue
+			}
+
+			replacement, err := renderReplacement(templates[i], fileName, match, data)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to render replacement for query %s", rw.Query)
+			}
+
+			edits = append(edits, tree_sitter.Edit{
+				StartByte:   capture.StartByte,
+				EndByte:     capture.EndByte,
+				Replacement: replacement,
+				Origin:      rw.Query + "." + rw.Capture,
+			})
+		}
+	}
+
+	return edits, nil
+}
+
+func renderReplacement(
+	tmpl *template.Template,
+	fileName string,
+	match tree_sitter.Match,
+	data map[string]interface{},
+) (string, error) {
+	data_ := map[string]interface{}{}
+	for k, v := range data {
+		data_[k] = v
+	}
+	for k, v := range match {
+		data_[k] = v
+	}
+	data_["Match"] = match
+	data_["File"] = fileName
+
+	var buf bytes.Buffer
+	err := tmpl.Execute(&buf, data_)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// ApplyRewrites computes the edits for each file in resultsByFile, resolves
+// overlapping edits according to the OnConflict policy of the command, and
+// either writes the edited files back to disk (inPlace) or prints a unified
+// diff of the changes to w.
+//
+// The files are read from sources_, so that the edits apply to the same
+// content the queries ran on, even if it was read from a git revision. Files
+// are read from disk if sources_ is nil.
+//
+// It returns a report for each file that was edited, listing the edits that
+// were dropped while resolving conflicts.
+func (oc *OakCommand) ApplyRewrites(
+	ctx context.Context,
+	sources_ *Sources,
+	resultsByFile map[string]tree_sitter.QueryResults,
+	data map[string]interface{},
+	w io.Writer,
+	inPlace bool,
+) ([]*tree_sitter.EditReport, error) {
+	templates, err := oc.parseReplacements()
+	if err != nil {
+		return nil, err
+	}
+	editSet := tree_sitter.NewEditSet(oc.OnConflict)
+	for fileName, results := range resultsByFile {
+		edits, err := oc.computeEdits(templates, fileName, results, data)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not compute edits for file %s", fileName)
+		}
+		editSet.Add(fileName, edits...)
+	}
+
+	if sources_ == nil {
+		sources_ = &Sources{}
+	}
+	reports := []*tree_sitter.EditReport{}
+	for _, fileName := range editSet.Files() {
+		source, err := sources_.ReadFile(ctx, oc.sourceFileName(fileName))
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not read file %s", fileName)
+		}
+
+		rewritten, report, err := editSet.Apply(fileName, source)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+
+		if bytes.Equal(source, rewritten) {
+			continue
+		}
+
+		if inPlace {
+			fi, err := os.Stat(oc.sourceFileName(fileName))
+			if err != nil {
+				return nil, err
+			}
+			err = os.WriteFile(oc.sourceFileName(fileName), rewritten, fi.Mode().Perm())
+			if err != nil {
+				return nil, errors.Wrapf(err, "could not write file %s", fileName)
+			}
+			_, err = fmt.Fprintf(w, "Rewrote %s (%d edits)\n", fileName, len(report.Applied))
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		_, err = io.WriteString(w, diff.Unified(diffPath("a", fileName), diffPath("b", fileName), source, rewritten, 3))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return reports, nil
+}
+
+// PrintDroppedEdits prints the edits that were dropped while resolving
+// conflicts to w, and returns how many there were.
+func PrintDroppedEdits(w io.Writer, reports []*tree_sitter.EditReport) (int, error) {
+	count := 0
+	for _, report := range reports {
+		for _, d := range report.Dropped {
+			count++
+			_, err := fmt.Fprintf(w, "%s: dropped edit %s [%d-%d], overlapping edit %s [%d-%d]\n",
+				report.File,
+				d.Edit.Origin, d.Edit.StartByte, d.Edit.EndByte,
+				d.KeptBy.Origin, d.KeptBy.StartByte, d.KeptBy.EndByte)
+			if err != nil {
+				return count, err
+			}
+		}
+	}
+	return count, nil
+}
+
+// diffPath returns the path used for fileName in the headers of a unified diff.
+func diffPath(prefix string, fileName string) string {
+	return prefix + "/" + strings.TrimPrefix(filepath.ToSlash(fileName), "/")
+}
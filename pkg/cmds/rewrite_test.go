@@ -0,0 +1,107 @@
+package cmds
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	tree_sitter "github.com/go-go-golems/oak/pkg/tree-sitter"
+)
+
+// commitTestFile creates a git repository in dir with a commit adding
+// fileName with content.
+func commitTestFile(t *testing.T, dir string, fileName string, content string) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	writeTestFile(t, filepath.Join(dir, fileName), content)
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", fileName},
+		{"commit", "-q", "-m", "first"},
+	} {
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=oak", "GIT_AUTHOR_EMAIL=oak@example.com",
+			"GIT_COMMITTER_NAME=oak", "GIT_COMMITTER_EMAIL=oak@example.com",
+			"GIT_CONFIG_GLOBAL=/dev/null", "GIT_CONFIG_SYSTEM=/dev/null",
+		)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+}
+
+func TestApplyRewritesReadsGitRevision(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	commitTestFile(t, dir, "main.go", "package main\n\nfunc foo() {}\n")
+	// the working tree moves the function, so the offsets of the committed
+	// file point to other text
+	writeTestFile(t, filepath.Join(dir, "main.go"), "// Package main.\npackage main\n\nfunc foo() {}\n")
+	t.Chdir(dir)
+
+	oc := NewOakWriterCommand(
+		cmds.NewCommandDescription("rename"),
+		WithLanguage("go"),
+		WithQueries(tree_sitter.SitterQuery{
+			Name:  "functions",
+			Query: `(function_declaration name: (identifier) @name)`,
+		}),
+		WithRewrites(Rewrite{Query: "functions", Capture: "name", Replacement: "bar"}),
+	).OakCommand
+
+	sources_, err := oc.CollectOakSources(ctx, nil, &OakSettings{GitRev: "HEAD"}, &SourceFilterSettings{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer func() {
+		_ = sources_.Close()
+	}()
+	resultsByFile, _, err := oc.GetResultsByFile(ctx, sources_.FileNames, 1, sources_.ProcessOptions(ctx)...)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	_, err = oc.ApplyRewrites(ctx, sources_, resultsByFile, nil, &buf, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := " package main\n \n-func foo() {}\n+func bar() {}\n"
+	if !strings.Contains(buf.String(), expected) || strings.Contains(buf.String(), "Package main") {
+		t.Fatalf("Expected the diff of the committed file, got:\n%s", buf.String())
+	}
+}
+
+func TestApplyRewritesParsesReplacementsOnce(t *testing.T) {
+	oc := NewOakWriterCommand(
+		cmds.NewCommandDescription("rename"),
+		WithLanguage("go"),
+		WithQueries(tree_sitter.SitterQuery{
+			Name:  "functions",
+			Query: `(function_declaration name: (identifier) @name)`,
+		}),
+		WithRewrites(Rewrite{Query: "functions", Capture: "name", Replacement: "{{ .name"}),
+	).OakCommand
+
+	resultsByFile := map[string]tree_sitter.QueryResults{
+		"a.go": {},
+		"b.go": {},
+	}
+	var buf bytes.Buffer
+	_, err := oc.ApplyRewrites(context.Background(), nil, resultsByFile, nil, &buf, false)
+	if err == nil {
+		t.Fatalf("Expected an error for the invalid replacement")
+	}
+	// the error is reported for the command, not for each file
+	if !strings.HasPrefix(err.Error(), "failed to parse replacement for query functions") {
+		t.Fatalf("Unexpected error %q", err.Error())
+	}
+}
@@ -0,0 +1,214 @@
+package cmds
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/go-go-golems/glazed/pkg/cmds/fields"
+	"github.com/go-go-golems/oak/pkg/git"
+	"github.com/go-go-golems/oak/pkg/sources"
+	tree_sitter "github.com/go-go-golems/oak/pkg/tree-sitter"
+	"github.com/pkg/errors"
+)
+
+// IndexRevision is the revision of the files read from the git index, with
+// --staged.
+const IndexRevision = "index"
+
+// Sources are the files an oak command runs on, and where to read them from.
+type Sources struct {
+	FileNames []string
+	// Revision is the git revision the files are read from, IndexRevision
+	// for the staged files, and empty for the files of the working tree.
+	Revision string
+
+	repository *git.Repository
+}
+
+// SourceFilterSettings are the flags skipping files in the directories of
+// sources.
+type SourceFilterSettings struct {
+	Exclude          []string `glazed:"exclude"`
+	NoIgnore         bool     `glazed:"no-ignore"`
+	MaxFileSize      int      `glazed:"max-file-size"`
+	IncludeGenerated bool     `glazed:"include-generated"`
+}
+
+// NewSourceFilterFlags returns the flags of SourceFilterSettings, which are
+// part of the oak layer and of the builtin commands collecting sources.
+func NewSourceFilterFlags() []*fields.Definition {
+	return []*fields.Definition{
+		fields.New(
+			"exclude",
+			fields.TypeStringList,
+			fields.WithHelp("Patterns of the files and directories to skip in directories, in .gitignore syntax"),
+		),
+		fields.New(
+			"no-ignore",
+			fields.TypeBool,
+			fields.WithHelp("Don't skip the files listed in .gitignore and .oakignore files"),
+			fields.WithDefault(false),
+		),
+		fields.New(
+			"max-file-size",
+			fields.TypeInteger,
+			fields.WithHelp("Skip the files of directories larger than this number of bytes (0 for no limit)"),
+			fields.WithDefault(0),
+		),
+		fields.New(
+			"include-generated",
+			fields.TypeBool,
+			fields.WithHelp("Don't skip generated files, marked with a \"Code generated ... DO NOT EDIT.\" or @generated comment"),
+			fields.WithDefault(false),
+		),
+	}
+}
+
+// CollectorOptions returns the options of a collector of the files matching
+// globs, skipping files as set by the flags.
+func (sf *SourceFilterSettings) CollectorOptions(globs []string) []sources.Option {
+	return []sources.Option{
+		sources.WithGlobs(globs...),
+		sources.WithExcludes(sf.Exclude...),
+		sources.WithIgnoreFiles(!sf.NoIgnore),
+		sources.WithMaxFileSize(int64(sf.MaxFileSize)),
+		sources.WithSkipGenerated(!sf.IncludeGenerated),
+	}
+}
+
+// UsesGit returns true if the oak flags select the files of a git
+// repository instead of the files on disk.
+func (ss *OakSettings) UsesGit() bool {
+	return ss.GitChanged != "" || ss.GitRev != "" || ss.Staged
+}
+
+// CollectOakSources returns the files of sources_ selected by the oak flags.
+//
+// Without git flags, these are the files of CollectSources, with directories
+// expanded if --recurse or --glob is set. With git flags, these are the
+// files of the git repository of the current directory that are in sources_
+// (the current directory if empty), match the globs of the command (the
+// standard globs of its languages if --glob is not set) and are not
+// excluded with --exclude.
+func (oc *OakCommand) CollectOakSources(
+	ctx context.Context,
+	sources_ []string,
+	ss *OakSettings,
+	sf *SourceFilterSettings,
+) (*Sources, error) {
+	glob_ := ss.Glob
+	if (ss.Recurse || ss.UsesGit()) && len(glob_) == 0 {
+		// use standard globs for the languages of the command
+		var err error
+		glob_, err = oc.LanguageGlobs()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !ss.UsesGit() {
+		fileNames, err := CollectSources(sources_, glob_, sf.CollectorOptions(nil)...)
+		if err != nil {
+			return nil, err
+		}
+		return &Sources{FileNames: fileNames}, nil
+	}
+
+	if ss.Staged && (ss.GitRev != "" || ss.GitChanged != "") {
+		return nil, errors.New("--staged can't be used with --git-rev or --git-changed")
+	}
+	if ss.Write && (ss.Staged || ss.GitRev != "") {
+		return nil, errors.New("--write can't be used with files read from git")
+	}
+
+	repository, err := git.Open(ctx, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	ret := &Sources{Revision: ss.GitRev, repository: repository}
+	switch {
+	case ss.Staged:
+		ret.Revision = IndexRevision
+		files, err = repository.StagedFiles(ctx)
+	case ss.GitChanged != "":
+		files, err = repository.ChangedFiles(ctx, ss.GitChanged, ss.GitRev)
+	default:
+		_, err = repository.ResolveRevision(ctx, ss.GitRev)
+		if err == nil {
+			files, err = repository.Files(ctx, ss.GitRev)
+		}
+	}
+	if err != nil {
+		_ = repository.Close()
+		return nil, err
+	}
+
+	collector := sources.NewCollector(sf.CollectorOptions(glob_)...)
+	ret.FileNames, err = collector.Filter(relativeGitFiles(repository.Prefix(), files), sources_)
+	if err != nil {
+		_ = repository.Close()
+		return nil, err
+	}
+	return ret, nil
+}
+
+// relativeGitFiles returns the paths of the repository files relative to the
+// directory prefix of the repository.
+func relativeGitFiles(prefix string, files []string) []string {
+	ret := make([]string, 0, len(files))
+	for _, file := range files {
+		rel, err := filepath.Rel(filepath.FromSlash(prefix), filepath.FromSlash(file))
+		if err != nil {
+			continue
+		}
+		ret = append(ret, rel)
+	}
+	return ret
+}
+
+// ReadFile returns the content of fileName, from the revision of the sources.
+func (s *Sources) ReadFile(ctx context.Context, fileName string) ([]byte, error) {
+	if s.repository == nil || s.Revision == "" {
+		return os.ReadFile(fileName)
+	}
+	p := path.Join(s.repository.Prefix(), filepath.ToSlash(fileName))
+	revision := s.Revision
+	if revision == IndexRevision {
+		revision = git.Index
+	}
+	return s.repository.ReadFile(ctx, revision, p)
+}
+
+// ProcessOptions returns the options for ProcessFiles reading the files of
+// the sources.
+func (s *Sources) ProcessOptions(ctx context.Context) []tree_sitter.ProcessOption {
+	if s.repository == nil || s.Revision == "" {
+		return nil
+	}
+	return []tree_sitter.ProcessOption{
+		tree_sitter.WithReadFile(func(fileName string) ([]byte, error) {
+			return s.ReadFile(ctx, fileName)
+		}),
+	}
+}
+
+// RevisionByFile returns the revision of each file, for templates.
+func (s *Sources) RevisionByFile() map[string]string {
+	ret := map[string]string{}
+	for _, fileName := range s.FileNames {
+		ret[fileName] = s.Revision
+	}
+	return ret
+}
+
+// Close releases the git repository the files are read from, if any.
+func (s *Sources) Close() error {
+	if s.repository == nil {
+		return nil
+	}
+	return s.repository.Close()
+}
@@ -0,0 +1,14 @@
+package cmds
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRelativeGitFiles(t *testing.T) {
+	actual := relativeGitFiles("pkg", []string{"pkg/a.go", "pkg/sub/b.go", "cmd/main.go"})
+	expected := []string{"a.go", "sub/b.go", "../cmd/main.go"}
+	if strings.Join(expected, ",") != strings.Join(actual, ",") {
+		t.Errorf("Expected %v, got %v", expected, actual)
+	}
+}
@@ -0,0 +1,461 @@
+package cmds
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template/parse"
+
+	"github.com/go-go-golems/glazed/pkg/helpers/templating"
+	"github.com/go-go-golems/oak/pkg"
+	tree_sitter "github.com/go-go-golems/oak/pkg/tree-sitter"
+	"github.com/pkg/errors"
+	sitter "github.com/smacker/go-tree-sitter"
+)
+
+const (
+	// SeverityError marks the issues that make a command fail to load.
+	SeverityError = "error"
+	// SeverityWarning marks the references of the template to queries and
+	// captures that don't exist, which render as empty output.
+	SeverityWarning = "warning"
+)
+
+// ValidationIssue is a problem of a command found by Validate.
+type ValidationIssue struct {
+	Severity string
+	// Source is "query", "injection", "rewrite" or "template".
+	Source string
+	// Query is the name of the query the issue is about, if any, and
+	// Language the language it was compiled for.
+	Query    string
+	Language string
+	// Line and Column are the 1-based position of the issue in the query or
+	// the template, 0 if unknown.
+	Line    int
+	Column  int
+	Message string
+}
+
+func (vi ValidationIssue) String() string {
+	location := vi.Source
+	if vi.Query != "" {
+		location += " " + vi.Query
+	}
+	if vi.Language != "" {
+		location += " (" + vi.Language + ")"
+	}
+	if vi.Line > 0 {
+		location += fmt.Sprintf(":%d:%d", vi.Line, vi.Column)
+	}
+	return fmt.Sprintf("%s: %s: %s", vi.Severity, location, vi.Message)
+}
+
+// captureRegexp matches the captures in the text of a query, for the queries
+// that can't be compiled.
+var captureRegexp = regexp.MustCompile(`@([A-Za-z_][A-Za-z0-9_.-]*)`)
+
+// Validate checks the command without running it, and returns the issues it
+// found, sorted by severity.
+//
+// The queries are rendered with the default values of the flags and compiled
+// for the languages of the command, which reports syntax errors and unknown
+// node types and field names. Rewrites have to refer to the captures of their
+// query. The template has to parse, and the queries and captures it refers
+// to, as in .structDeclarations.Matches or .structName.Text, have to exist.
+func (oc *OakCommand) Validate() ([]ValidationIssue, error) {
+	issues := []ValidationIssue{}
+
+	// the names and captures of all the queries of the command, for any
+	// language
+	queryNames := map[string]bool{}
+	captures := map[string]map[string]bool{}
+	addCaptures := func(q tree_sitter.SitterQuery, names []string) {
+		queryNames[q.Name] = true
+		if captures[q.Name] == nil {
+			captures[q.Name] = map[string]bool{}
+		}
+		for _, name := range names {
+			captures[q.Name][name] = true
+		}
+	}
+	for _, q := range append(append([]tree_sitter.SitterQuery{}, oc.Queries...), languageQueries(oc.Languages)...) {
+		names := []string{}
+		for _, m := range captureRegexp.FindAllStringSubmatch(q.Query, -1) {
+			names = append(names, m[1])
+		}
+		addCaptures(q, names)
+	}
+
+	compileIssues, err := oc.compileQueries(addCaptures)
+	if err != nil {
+		return nil, err
+	}
+	issues = append(issues, compileIssues...)
+
+	for _, rw := range oc.Rewrites {
+		if queryNames[rw.Query] && !captures[rw.Query][rw.Capture] {
+			issues = append(issues, ValidationIssue{
+				Severity: SeverityError,
+				Source:   "rewrite",
+				Query:    rw.Query,
+				Message:  fmt.Sprintf("query %s has no capture %s", rw.Query, rw.Capture),
+			})
+		}
+	}
+
+	allCaptures := map[string]bool{}
+	for _, names := range captures {
+		for name := range names {
+			allCaptures[name] = true
+		}
+	}
+	issues = append(issues, validateTemplate(oc.Template, queryNames, allCaptures)...)
+
+	sort.SliceStable(issues, func(i, j int) bool {
+		return issues[i].Severity == SeverityError && issues[j].Severity != SeverityError
+	})
+	return issues, nil
+}
+
+// compileQueries renders the queries of the command with the default values
+// of the flags and compiles them for the languages of the command. The
+// captures of the queries are passed to addCaptures.
+func (oc *OakCommand) compileQueries(
+	addCaptures func(q tree_sitter.SitterQuery, names []string),
+) ([]ValidationIssue, error) {
+	issues := []ValidationIssue{}
+
+	queries, languages, err := oc.defaultRenderedQueries()
+	if err != nil {
+		return nil, err
+	}
+
+	compiled := map[string]bool{}
+	for _, language := range oc.LanguageNames() {
+		for _, q := range oc.queriesForLanguage(queries, languages, language) {
+			name := language
+			if q.Language != "" {
+				name = q.Language
+			}
+			key := name + "\x00" + q.Name + "\x00" + q.Query
+			if compiled[key] {
+				continue
+			}
+			compiled[key] = true
+
+			names, issue := oc.compileQuery(name, q)
+			if issue != nil {
+				issue.Source = "query"
+				issues = append(issues, *issue)
+				continue
+			}
+			addCaptures(q, names)
+		}
+
+		for i, injection := range oc.Injections {
+			host := injection.Host
+			if host == "" {
+				host = language
+			}
+			q := tree_sitter.SitterQuery{Name: fmt.Sprintf("%s in %s", injection.Language, host), Query: injection.Query}
+			key := fmt.Sprintf("%s\x00injection %d", host, i)
+			if compiled[key] {
+				continue
+			}
+			compiled[key] = true
+			if _, issue := oc.compileQuery(host, q); issue != nil {
+				issue.Source = "injection"
+				issues = append(issues, *issue)
+			}
+		}
+	}
+
+	return issues, nil
+}
+
+// checkCommand validates a command being loaded, see Validate. Errors prevent
+// the command from loading, and warnings are logged.
+//
+// The queries are compiled through DefaultQueryCache, so that the compiled
+// queries are reused when the command runs with the default values of its
+// flags. Loaders skip the validation with SkipValidation.
+func checkCommand(oc *OakCommand) error {
+	issues, err := oc.Validate()
+	if err != nil {
+		return errors.Wrapf(err, "could not validate command %s", oc.Name)
+	}
+	messages := []string{}
+	for _, issue := range issues {
+		if issue.Severity == SeverityError {
+			messages = append(messages, issue.String())
+			continue
+		}
+		zlog.Warn().Str("command", oc.Name).Str("source", oc.Source).Msg(issue.String())
+	}
+	if len(messages) > 0 {
+		return errors.Errorf("invalid command %s:\n  %s", oc.Name, strings.Join(messages, "\n  "))
+	}
+	return nil
+}
+
+// defaultRenderedQueries returns copies of the queries of the command and of
+// its languages, rendered with the default values of the flags unless the
+// command was already rendered.
+func (oc *OakCommand) defaultRenderedQueries() ([]tree_sitter.SitterQuery, []LanguageQueries, error) {
+	queries := append([]tree_sitter.SitterQuery{}, oc.Queries...)
+	languages := make([]LanguageQueries, 0, len(oc.Languages))
+	for _, l := range oc.Languages {
+		languages = append(languages, LanguageQueries{
+			Name:    l.Name,
+			Queries: append([]tree_sitter.SitterQuery{}, l.Queries...),
+		})
+	}
+	for _, q := range append(append([]tree_sitter.SitterQuery{}, queries...), languageQueries(languages)...) {
+		if q.Rendered {
+			return queries, languages, nil
+		}
+	}
+
+	data := map[string]interface{}{}
+	if oc.CommandDescription != nil && oc.Schema != nil {
+		parsedValues, err := oc.Schema.InitializeFromDefaults()
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "could not get the default values of the flags")
+		}
+		data = parsedValues.GetDataMap()
+	}
+	err := renderQueries(queries, data)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, l := range languages {
+		err = renderQueries(l.Queries, data)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "failed to render queries for language %s", l.Name)
+		}
+	}
+	return removeEmptyQueries(queries), languages, nil
+}
+
+// queriesForLanguage is QueriesForLanguage for rendered copies of the queries
+// of the command.
+func (oc *OakCommand) queriesForLanguage(
+	queries []tree_sitter.SitterQuery,
+	languages []LanguageQueries,
+	language string,
+) []tree_sitter.SitterQuery {
+	oc_ := &OakCommand{Queries: queries, Languages: languages}
+	return oc_.QueriesForLanguage(language)
+}
+
+// compileQuery compiles q for language, and returns the names of its captures.
+func (oc *OakCommand) compileQuery(language string, q tree_sitter.SitterQuery) ([]string, *ValidationIssue) {
+	issue := &ValidationIssue{Severity: SeverityError, Query: q.Name, Language: language}
+
+	var lang *sitter.Language
+	var err error
+	if len(oc.Languages) == 0 && language == oc.Language {
+		lang, err = oc.GetLanguage()
+	} else {
+		// a language of the command, or the language of a query for an
+		// embedded language
+		lang, err = pkg.LanguageNameToSitterLanguage(language)
+	}
+	if err != nil {
+		issue.Message = err.Error()
+		return nil, issue
+	}
+
+	err = tree_sitter.DefaultQueryCache.Compile(lang, []tree_sitter.SitterQuery{q})
+	if err != nil {
+		issue.Message = err.Error()
+		if qe, ok := tree_sitter.DescribeQueryError(q.Query, err); ok {
+			issue.Message, issue.Line, issue.Column = qe.Message, qe.Line, qe.Column
+		}
+		return nil, issue
+	}
+	compiled, err := tree_sitter.DefaultQueryCache.Get(lang, q)
+	if err != nil {
+		issue.Message = err.Error()
+		return nil, issue
+	}
+	names := make([]string, 0, compiled.CaptureCount())
+	for i := uint32(0); i < compiled.CaptureCount(); i++ {
+		names = append(names, compiled.CaptureNameForId(i))
+	}
+	return names, nil
+}
+
+func languageQueries(languages []LanguageQueries) []tree_sitter.SitterQuery {
+	ret := []tree_sitter.SitterQuery{}
+	for _, l := range languages {
+		ret = append(ret, l.Queries...)
+	}
+	return ret
+}
+
+// validateTemplate checks that template parses, and that the queries and
+// captures it refers to exist.
+func validateTemplate(template string, queryNames map[string]bool, captures map[string]bool) []ValidationIssue {
+	if template == "" {
+		return nil
+	}
+	tmpl, err := templating.CreateTemplate("oak").Parse(template)
+	if err != nil {
+		issue := ValidationIssue{Severity: SeverityError, Source: "template", Message: err.Error()}
+		// template: oak:3: unexpected "}" in operand
+		if m := regexp.MustCompile(`^template: [^:]*:(\d+):(?:(\d+):)? ?(.*)$`).FindStringSubmatch(err.Error()); m != nil {
+			issue.Line, _ = strconv.Atoi(m[1])
+			issue.Column, _ = strconv.Atoi(m[2])
+			issue.Message = m[3]
+		}
+		return []ValidationIssue{issue}
+	}
+
+	issues := []ValidationIssue{}
+	reported := map[string]bool{}
+	for _, t := range tmpl.Templates() {
+		if t.Tree == nil {
+			continue
+		}
+		for _, ref := range templateReferences(t.Tree.Root) {
+			var message string
+			switch {
+			case ref.query && !queryNames[ref.name]:
+				message = fmt.Sprintf("unknown query %s", ref.name)
+			case !ref.query && !captures[ref.name]:
+				message = fmt.Sprintf("unknown capture %s", ref.name)
+			default:
+				continue
+			}
+			if reported[message] {
+				continue
+			}
+			reported[message] = true
+
+			issue := ValidationIssue{Severity: SeverityWarning, Source: "template", Message: message}
+			// nodes are positioned at the last field of their chain, look for
+			// the referenced field before it
+			pos := int(ref.node.Position())
+			if pos < len(template) {
+				if i := strings.LastIndex(template[:pos+1], "."+ref.name); i >= 0 {
+					pos = i + 1
+				}
+			}
+			issue.Line, issue.Column = tree_sitter.LineColumn(template, pos)
+			issues = append(issues, issue)
+		}
+	}
+	return issues
+}
+
+// templateReference is a query or a capture used in a template.
+type templateReference struct {
+	name  string
+	query bool
+	node  parse.Node
+}
+
+// captureFields are the fields and methods of captures and query results,
+// which are not capture names.
+var captureFields = func() map[string]bool {
+	ret := map[string]bool{}
+	for _, t := range []reflect.Type{
+		reflect.TypeOf(tree_sitter.Capture{}),
+		reflect.TypeOf(tree_sitter.Result{}),
+		reflect.TypeOf(tree_sitter.CaptureNode{}),
+	} {
+		for i := 0; i < t.NumField(); i++ {
+			ret[t.Field(i).Name] = true
+		}
+		for _, t_ := range []reflect.Type{t, reflect.PointerTo(t)} {
+			for i := 0; i < t_.NumMethod(); i++ {
+				ret[t_.Method(i).Name] = true
+			}
+		}
+	}
+	return ret
+}()
+
+// templateReferences returns the queries and captures referenced by the
+// field chains of the template: the field before .Matches is a query, and
+// the field before a field of Capture, such as .Text, is a capture. Other
+// references, such as (index $match "name"), can't be checked.
+func templateReferences(node parse.Node) []templateReference {
+	ret := []templateReference{}
+	addChain := func(n parse.Node, idents []string) {
+		for i := 0; i+1 < len(idents); i++ {
+			name, next := idents[i], idents[i+1]
+			if captureFields[name] || strings.HasPrefix(name, "$") {
+				continue
+			}
+			switch {
+			case next == "Matches":
+				ret = append(ret, templateReference{name: name, query: true, node: n})
+			case captureFields[next]:
+				ret = append(ret, templateReference{name: name, node: n})
+			}
+		}
+	}
+
+	var visit func(n parse.Node)
+	visit = func(n parse.Node) {
+		switch n := n.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, child := range n.Nodes {
+				visit(child)
+			}
+		case *parse.ActionNode:
+			visit(n.Pipe)
+		case *parse.IfNode:
+			visit(n.Pipe)
+			visit(n.List)
+			visit(n.ElseList)
+		case *parse.RangeNode:
+			visit(n.Pipe)
+			visit(n.List)
+			visit(n.ElseList)
+		case *parse.WithNode:
+			visit(n.Pipe)
+			visit(n.List)
+			visit(n.ElseList)
+		case *parse.TemplateNode:
+			visit(n.Pipe)
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, cmd := range n.Cmds {
+				visit(cmd)
+			}
+		case *parse.CommandNode:
+			for _, arg := range n.Args {
+				visit(arg)
+			}
+		case *parse.FieldNode:
+			addChain(n, n.Ident)
+		case *parse.VariableNode:
+			addChain(n, n.Ident)
+		case *parse.ChainNode:
+			switch inner := n.Node.(type) {
+			case *parse.FieldNode:
+				addChain(n, append(append([]string{}, inner.Ident...), n.Field...))
+			case *parse.VariableNode:
+				addChain(n, append(append([]string{}, inner.Ident...), n.Field...))
+			default:
+				visit(n.Node)
+				addChain(n, n.Field)
+			}
+		}
+	}
+	visit(node)
+
+	return ret
+}
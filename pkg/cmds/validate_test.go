@@ -0,0 +1,116 @@
+package cmds
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/alias"
+	tree_sitter "github.com/go-go-golems/oak/pkg/tree-sitter"
+)
+
+func TestValidateValidCommands(t *testing.T) {
+	oc := NewOakWriterCommand(
+		cmds.NewCommandDescription("structs"),
+		WithLanguage("go"),
+		WithQueries(tree_sitter.SitterQuery{
+			Name:  "structDeclarations",
+			Query: "(type_spec name: (type_identifier) @structName type: (struct_type) @structBody)",
+		}),
+		WithTemplate("{{ range .Results.structDeclarations.Matches }}{{ .structName.Text }} {{ .structBody.StartPoint.Row }}{{ end }}"),
+		WithRewrites(Rewrite{Query: "structDeclarations", Capture: "structName", Replacement: "X"}),
+	).OakCommand
+
+	for _, oc := range []*OakCommand{oc, newMultiLanguageCommand()} {
+		issues, err := oc.Validate()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(issues) != 0 {
+			t.Fatalf("Expected no issues for %s, got %v", oc.Name, issues)
+		}
+	}
+}
+
+func TestValidateReportsIssues(t *testing.T) {
+	oc := NewOakWriterCommand(
+		cmds.NewCommandDescription("structs"),
+		WithLanguage("go"),
+		WithQueries(
+			tree_sitter.SitterQuery{Name: "structs", Query: "(type_spec\n  name: (type_identifier) @name\n  type: (struct_typ))"},
+			tree_sitter.SitterQuery{Name: "functions", Query: "(function_declaration name: (identifier) @name)"},
+		),
+		WithTemplate("{{ range .structs.Matches }}{{ .nme.Text }}{{ end }}{{ range .funcs.Matches }}{{ end }}"),
+		WithRewrites(Rewrite{Query: "functions", Capture: "function", Replacement: "X"}),
+	).OakCommand
+
+	issues, err := oc.Validate()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	messages := []string{}
+	for _, issue := range issues {
+		messages = append(messages, issue.String())
+	}
+	expected := []string{
+		"error: query structs (go):3:10: invalid node type 'struct_typ'",
+		"error: rewrite functions: query functions has no capture function",
+		"warning: template:1:33: unknown capture nme",
+		"warning: template:1:63: unknown query funcs",
+	}
+	if strings.Join(messages, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("Expected\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(messages, "\n"))
+	}
+}
+
+func TestValidateRendersQueriesWithDefaults(t *testing.T) {
+	loader := &OakCommandLoader{SkipValidation: true}
+	commands, err := loader.loadCommandFromReader(strings.NewReader(`
+name: functions
+short: test
+flags:
+  - name: type
+    type: string
+    default: function_declaration
+language: go
+queries:
+  - name: functions
+    query: "({{ .type }}) @function"
+`), nil, []alias.Option{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	issues, err := commands[0].(*OakWriterCommand).Validate()
+	if err != nil || len(issues) != 0 {
+		t.Fatalf("Expected no issues, got %v (%v)", issues, err)
+	}
+}
+
+func TestLoaderRejectsInvalidTemplate(t *testing.T) {
+	_, err := (&OakCommandLoader{}).loadCommandFromReader(strings.NewReader(`
+name: functions
+short: test
+language: go
+queries:
+  - name: functions
+    query: "(function_declaration) @function"
+template: "{{ range .functions.Matches }}"
+`), nil, []alias.Option{})
+	if err == nil || !strings.Contains(err.Error(), "invalid command functions") {
+		t.Fatalf("Expected the template to be rejected, got %v", err)
+	}
+}
+
+func TestLoaderRejectsInvalidQuery(t *testing.T) {
+	_, err := (&OakCommandLoader{}).loadCommandFromReader(strings.NewReader(`
+name: functions
+short: test
+language: go
+queries:
+  - name: functions
+    query: "(function_declaration name: (identifer) @name)"
+`), nil, []alias.Option{})
+	if err == nil || !strings.Contains(err.Error(), "invalid node type 'identifer'") {
+		t.Fatalf("Expected the query to be rejected, got %v", err)
+	}
+}
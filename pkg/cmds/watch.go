@@ -0,0 +1,410 @@
+package cmds
+
+import (
+	"context"
+	_ "embed"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/alias"
+	"github.com/go-go-golems/glazed/pkg/cmds/loaders"
+	"github.com/go-go-golems/glazed/pkg/cmds/schema"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	"github.com/go-go-golems/oak/pkg/sources"
+	tree_sitter "github.com/go-go-golems/oak/pkg/tree-sitter"
+	"github.com/pkg/errors"
+	sitter "github.com/smacker/go-tree-sitter"
+)
+
+//go:embed "layers/watch.yaml"
+var watchLayerYaml string
+
+const WatchSlug = "watch"
+
+type WatchSettings struct {
+	OutputFile string `glazed:"output-file"`
+	Debounce   int    `glazed:"debounce"`
+}
+
+func NewWatchParameterLayer() (schema.Section, error) {
+	return schema.NewSectionFromYAML([]byte(watchLayerYaml))
+}
+
+// OakWatchCommand runs an oak command once, and then keeps the parse trees of
+// its sources in memory and re-renders its template every time a source
+// changes. Changed files are reparsed incrementally from their previous tree.
+type OakWatchCommand struct {
+	*OakCommand
+}
+
+var _ cmds.WriterCommand = (*OakWatchCommand)(nil)
+
+// watchedFile is the state kept in memory for each source.
+type watchedFile struct {
+	source  []byte
+	tree    *sitter.Tree
+	results tree_sitter.QueryResults
+}
+
+type watchRoot struct {
+	path  string
+	isDir bool
+}
+
+type watcher struct {
+	oc      *OakCommand
+	options []tree_sitter.ExecuteOption
+	roots   []watchRoot
+	// collector selects the files of the source directories
+	collector *sources.Collector
+	files     map[string]*watchedFile
+	watcher   *fsnotify.Watcher
+}
+
+func (oc *OakWatchCommand) RunIntoWriter(
+	ctx context.Context,
+	parsedValues *values.Values,
+	w io.Writer,
+) error {
+	s := &RunSettings{}
+	err := parsedValues.DecodeSectionInto(values.DefaultSlug, s)
+	if err != nil {
+		return err
+	}
+	ss := &OakSettings{}
+	err = parsedValues.DecodeSectionInto(OakSlug, ss)
+	if err != nil {
+		return err
+	}
+	sf := &SourceFilterSettings{}
+	err = parsedValues.DecodeSectionInto(OakSlug, sf)
+	if err != nil {
+		return err
+	}
+	ws := &WatchSettings{}
+	err = parsedValues.DecodeSectionInto(WatchSlug, ws)
+	if err != nil {
+		return err
+	}
+
+	if len(oc.Rewrites) > 0 {
+		return errors.Errorf("command %s has rewrites, which can't be watched", oc.Name)
+	}
+	if ss.UsesGit() {
+		return errors.New("--git-changed, --git-rev and --staged can't be used when watching files")
+	}
+
+	err = oc.RenderQueries(parsedValues)
+	if err != nil {
+		return err
+	}
+
+	glob_ := ss.Glob
+	if len(glob_) == 0 {
+		// directories are always watched recursively
+		glob_, err = oc.LanguageGlobs()
+		if err != nil {
+			return err
+		}
+	}
+
+	sources_ := s.Sources
+	if len(sources_) == 0 {
+		sources_ = []string{"."}
+	}
+
+	fsWatcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return errors.Wrap(err, "could not create file watcher")
+	}
+	defer func() {
+		_ = fsWatcher.Close()
+	}()
+
+	wt := &watcher{
+		oc:        oc.OakCommand,
+		options:   ExecuteOptions(ss),
+		collector: sources.NewCollector(sf.CollectorOptions(glob_)...),
+		files:     map[string]*watchedFile{},
+		watcher:   fsWatcher,
+	}
+	defer wt.close()
+
+	for _, source := range sources_ {
+		err = wt.addRoot(ctx, filepath.Clean(source))
+		if err != nil {
+			return err
+		}
+	}
+
+	data := parsedValues.GetDataMap()
+	err = wt.render(data, w, ws.OutputFile)
+	if err != nil {
+		return err
+	}
+
+	debounce := time.Duration(ws.Debounce) * time.Millisecond
+	changed := map[string]bool{}
+	var timer <-chan time.Time
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case err, ok := <-fsWatcher.Errors:
+			if !ok {
+				return nil
+			}
+			zlog.Warn().Err(err).Msg("file watcher error")
+
+		case event, ok := <-fsWatcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Has(fsnotify.Create) {
+				if fi, err := os.Stat(event.Name); err == nil && fi.IsDir() {
+					// new directories have to be watched as well, and might
+					// already contain files
+					err = wt.addDirectory(ctx, event.Name)
+					if err != nil {
+						zlog.Warn().Err(err).Str("directory", event.Name).Msg("could not watch directory")
+					}
+					timer = time.After(debounce)
+					continue
+				}
+			}
+			if !wt.matches(event.Name) {
+				continue
+			}
+			changed[event.Name] = true
+			// editors often write a file in several steps, wait for them to be done
+			timer = time.After(debounce)
+
+		case <-timer:
+			timer = nil
+			for fileName := range changed {
+				err = wt.update(ctx, fileName)
+				if err != nil {
+					zlog.Warn().Err(err).Str("file", fileName).Msg("could not update file")
+				}
+			}
+			changed = map[string]bool{}
+
+			err = wt.render(data, w, ws.OutputFile)
+			if err != nil {
+				zlog.Warn().Err(err).Msg("could not render results")
+			}
+		}
+	}
+}
+
+// addRoot watches a source given on the command line, either a single file or
+// a directory that is watched recursively.
+func (wt *watcher) addRoot(ctx context.Context, path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	if !fi.IsDir() {
+		wt.roots = append(wt.roots, watchRoot{path: path})
+		// watch the directory, since editors often replace files when saving
+		err = wt.watcher.Add(filepath.Dir(path))
+		if err != nil {
+			return errors.Wrapf(err, "could not watch %s", path)
+		}
+		return wt.update(ctx, path)
+	}
+
+	wt.roots = append(wt.roots, watchRoot{path: path, isDir: true})
+	return wt.addDirectory(ctx, path)
+}
+
+// addDirectory watches dir and its subdirectories, and parses the files
+// matching the globs that are not skipped.
+func (wt *watcher) addDirectory(ctx context.Context, dir string) error {
+	return wt.collector.Walk(dir, func(path string, d fs.DirEntry) error {
+		if d.IsDir() {
+			if path != dir && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return wt.watcher.Add(path)
+		}
+		return wt.update(ctx, path)
+	})
+}
+
+// matches returns true if path is one of the sources or was parsed before,
+// or if it is in one of the source directories and wouldn't be skipped when
+// collecting the directory.
+func (wt *watcher) matches(path string) bool {
+	path = filepath.Clean(path)
+	if _, ok := wt.files[path]; ok {
+		return true
+	}
+	for _, root := range wt.roots {
+		if !root.isDir {
+			if path == root.path {
+				return true
+			}
+			continue
+		}
+		skip, err := wt.collector.Skip(root.path, path)
+		if err == nil && !skip {
+			return true
+		}
+	}
+	return false
+}
+
+// update reparses fileName and runs the queries of the command on it. If the
+// file was parsed before, a copy of its old tree is edited and reused, so that
+// only the changed parts are parsed again. The stored tree is only replaced
+// once the queries ran, so that a failed update leaves the previous state of
+// the file intact for the next one.
+func (wt *watcher) update(ctx context.Context, fileName string) error {
+	previous, known := wt.files[fileName]
+
+	source, err := os.ReadFile(fileName)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			if known {
+				previous.tree.Close()
+				delete(wt.files, fileName)
+			}
+			return nil
+		}
+		return err
+	}
+
+	var oldTree *sitter.Tree
+	if known {
+		edit, ok := tree_sitter.ComputeEditInput(previous.source, source)
+		if !ok {
+			return nil
+		}
+		oldTree = previous.tree.Copy()
+		defer oldTree.Close()
+		oldTree.Edit(edit)
+	}
+
+	jobs, err := wt.oc.FileJobs([]string{fileName})
+	if err != nil {
+		return err
+	}
+	job := jobs[0]
+
+	parser := sitter.NewParser()
+	parser.SetLanguage(job.Language)
+	tree, err := parser.ParseCtx(ctx, oldTree, source)
+	if err != nil {
+		return errors.Wrapf(err, "could not parse file %s", fileName)
+	}
+
+	results, err := job.Execute(ctx, tree.RootNode(), source, wt.options...)
+	if err != nil {
+		tree.Close()
+		return errors.Wrapf(err, "could not execute queries for file %s", fileName)
+	}
+
+	if known {
+		previous.tree.Close()
+	}
+
+	wt.files[fileName] = &watchedFile{
+		source:  source,
+		tree:    tree,
+		results: results,
+	}
+	zlog.Debug().Str("file", fileName).Bool("incremental", known).Msg("parsed file")
+
+	return nil
+}
+
+// render renders the template of the command with the results of all
+// watched files, into outputFile if set, or to w.
+func (wt *watcher) render(data map[string]interface{}, w io.Writer, outputFile string) error {
+	resultsByFile := map[string]tree_sitter.QueryResults{}
+	for fileName, f := range wt.files {
+		resultsByFile[fileName] = f.results
+	}
+
+	s, err := wt.oc.RenderResultsByFile(resultsByFile, data)
+	if err != nil {
+		return err
+	}
+
+	if outputFile == "" {
+		_, err = io.WriteString(w, s)
+		return err
+	}
+
+	// write to a temporary file first, so that readers of outputFile never
+	// see a partial output
+	tmp := outputFile + ".tmp"
+	err = os.WriteFile(tmp, []byte(s), 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, outputFile)
+}
+
+func (wt *watcher) close() {
+	for _, f := range wt.files {
+		f.tree.Close()
+	}
+}
+
+// OakWatchCommandLoader loads oak commands as OakWatchCommand, adding the
+// watch flags to them.
+type OakWatchCommandLoader struct{}
+
+var _ loaders.CommandLoader = (*OakWatchCommandLoader)(nil)
+
+func (o *OakWatchCommandLoader) IsFileSupported(f fs.FS, fileName string) bool {
+	if isFixtureFile(fileName) {
+		return false
+	}
+	return strings.HasSuffix(fileName, ".yaml") || strings.HasSuffix(fileName, ".yml")
+}
+
+func (o *OakWatchCommandLoader) LoadCommands(
+	f fs.FS, entryName string,
+	options []cmds.CommandDescriptionOption,
+	aliasOptions []alias.Option,
+) ([]cmds.Command, error) {
+	watchLayer, err := NewWatchParameterLayer()
+	if err != nil {
+		return nil, err
+	}
+	options_ := append([]cmds.CommandDescriptionOption{cmds.WithSections(watchLayer)}, options...)
+
+	commands, err := (&OakCommandLoader{}).LoadCommands(f, entryName, options_, aliasOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]cmds.Command, 0, len(commands))
+	for _, c := range commands {
+		if oc, ok := c.(*OakWriterCommand); ok {
+			ret = append(ret, &OakWatchCommand{OakCommand: oc.OakCommand})
+			continue
+		}
+		ret = append(ret, c)
+	}
+	return ret, nil
+}
+
+func (o *OakWatchCommandLoader) LoadCommandAliasFromYAML(
+	s io.Reader,
+	options ...alias.Option,
+) ([]*alias.CommandAlias, error) {
+	return loaders.LoadCommandAliasFromYAML(s, options...)
+}
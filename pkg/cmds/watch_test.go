@@ -0,0 +1,88 @@
+package cmds
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	tree_sitter "github.com/go-go-golems/oak/pkg/tree-sitter"
+	sitter "github.com/smacker/go-tree-sitter"
+)
+
+func watchedNames(t *testing.T, wt *watcher, fileName string) string {
+	f, ok := wt.files[fileName]
+	if !ok {
+		t.Fatalf("%s is not watched", fileName)
+	}
+	names := []string{}
+	for _, match := range f.results["functions"].Matches {
+		names = append(names, match["name"].Text)
+	}
+	return strings.Join(names, ",")
+}
+
+func TestWatcherUpdateAfterFailedExecute(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "main.go")
+	initial := "package main\n\nfunc foo() {}\n"
+	writeTestFile(t, fileName, initial)
+
+	oc := NewOakGlazedCommand(
+		cmds.NewCommandDescription("functions"),
+		WithLanguage("go"),
+		WithQueries(tree_sitter.SitterQuery{
+			Name:  "functions",
+			Query: `((function_declaration name: (identifier) @name) (#named? @name))`,
+		}),
+	).OakCommand
+	options := []tree_sitter.ExecuteOption{
+		tree_sitter.WithPredicate("named?", func(tree_sitter.Match, []string) bool { return true }),
+	}
+	wt := &watcher{oc: oc, options: options, files: map[string]*watchedFile{}}
+	defer wt.close()
+
+	err := wt.update(ctx, fileName)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// without the predicate, running the queries fails, and the file keeps
+	// its previous tree and results
+	wt.options = nil
+	writeTestFile(t, fileName, "package main\n\nfunc foo() {}\n\nfunc bar() {}\n")
+	err = wt.update(ctx, fileName)
+	if err == nil {
+		t.Fatalf("Expected an error for the unknown predicate")
+	}
+	if actual := watchedNames(t, wt, fileName); actual != "foo" {
+		t.Fatalf("Expected the previous results foo, got %s", actual)
+	}
+	if end := wt.files[fileName].tree.RootNode().EndByte(); end != uint32(len(initial)) {
+		t.Fatalf("Expected the previous tree to be left unedited, it ends at %d", end)
+	}
+
+	wt.options = options
+	source := "package main\n\nfunc baz() {}\n\nfunc foo() {}\n\nfunc bar() {}\n"
+	writeTestFile(t, fileName, source)
+	err = wt.update(ctx, fileName)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if actual := watchedNames(t, wt, fileName); actual != "baz,foo,bar" {
+		t.Fatalf("Expected baz,foo,bar, got %s", actual)
+	}
+
+	parser := sitter.NewParser()
+	parser.SetLanguage(oc.SitterLanguage)
+	expected, err := parser.ParseCtx(ctx, nil, []byte(source))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer expected.Close()
+	if actual := wt.files[fileName].tree.RootNode().String(); actual != expected.RootNode().String() {
+		t.Fatalf("Expected the tree\n%s\ngot\n%s", expected.RootNode().String(), actual)
+	}
+}
@@ -7,9 +7,11 @@ import (
 	"github.com/go-go-golems/glazed/pkg/cmds"
 	"github.com/go-go-golems/glazed/pkg/cmds/values"
 	"github.com/go-go-golems/glazed/pkg/helpers/templating"
-	"github.com/go-go-golems/oak/pkg"
 	tree_sitter "github.com/go-go-golems/oak/pkg/tree-sitter"
+	"github.com/pkg/errors"
 	"io"
+	"os"
+	"sort"
 	"strings"
 )
 
@@ -60,36 +62,97 @@ func (oc *OakWriterCommand) RunIntoWriter(
 		return nil
 	}
 
-	sources_ := s.Sources
+	sf := &SourceFilterSettings{}
+	err = parsedValues.DecodeSectionInto(OakSlug, sf)
+	if err != nil {
+		return err
+	}
+	sources_, err := oc.CollectOakSources(ctx, s.Sources, ss, sf)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = sources_.Close()
+	}()
 
-	glob_ := ss.Glob
+	options, err := oc.ProcessOptions(ss)
+	if err != nil {
+		return err
+	}
+	options = append(options, sources_.ProcessOptions(ctx)...)
 
-	if ss.Recurse && len(glob_) == 0 {
-		// use standard globs for the language of the command
-		glob_, err = pkg.GetLanguageGlobs(oc.Language)
+	resultsByFile, healthByFile, err := oc.GetResultsByFile(ctx, sources_.FileNames, ss.Workers, options...)
+	if err != nil {
+		return err
+	}
+	if ss.WarnSyntaxErrors {
+		for _, fileName := range sources_.FileNames {
+			fileName = oc.displayFileName(fileName)
+			_, err := PrintSyntaxErrors(os.Stderr, fileName, healthByFile[fileName])
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(oc.Rewrites) > 0 {
+		reports, err := oc.ApplyRewrites(ctx, sources_, resultsByFile, parsedValues.GetDataMap(), w, ss.Write)
 		if err != nil {
 			return err
 		}
+		// the diff goes to w, so report dropped edits separately
+		dropped, err := PrintDroppedEdits(os.Stderr, reports)
+		if err != nil {
+			return err
+		}
+		if dropped > 0 && ss.FailOnDroppedEdits {
+			return errors.Errorf("%d overlapping edits were dropped", dropped)
+		}
+		return nil
 	}
-	sources_, err = collectSources(sources_, glob_)
+
+	data := parsedValues.GetDataMap()
+	data["Revision"] = sources_.Revision
+	data["RevisionByFile"] = sources_.RevisionByFile()
+	data["ParseHealthByFile"] = healthByFile
+	s_, err := oc.RenderResultsByFile(resultsByFile, data)
 	if err != nil {
 		return err
 	}
 
-	resultsByFile, err := oc.GetResultsByFile(ctx, sources_)
+	_, err = w.Write(([]byte)(s_))
 	if err != nil {
 		return err
 	}
 
+	return nil
+}
+
+// RenderResultsByFile renders the template of the command with the results of
+// all files. data is passed to the template, usually the parsed flag values.
+// RevisionByFile and ParseHealthByFile are set to empty maps if data doesn't
+// set the git revision and the syntax errors of the files.
+func (oc *OakCommand) RenderResultsByFile(
+	resultsByFile map[string]tree_sitter.QueryResults,
+	data map[string]interface{},
+) (string, error) {
 	tmpl, err := templating.CreateTemplate("oak").Parse(oc.Template)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	allResults := tree_sitter.QueryResults{}
 
-	for _, fileResults := range resultsByFile {
-		for k, v := range fileResults {
+	// merge in a stable order, so that re-rendering the same results gives the
+	// same output
+	fileNames := make([]string, 0, len(resultsByFile))
+	for fileName := range resultsByFile {
+		fileNames = append(fileNames, fileName)
+	}
+	sort.Strings(fileNames)
+
+	for _, fileName := range fileNames {
+		for k, v := range resultsByFile[fileName] {
 			result, ok := allResults[k]
 			if !ok {
 				// store copy of v in allResults
@@ -100,24 +163,30 @@ func (oc *OakWriterCommand) RunIntoWriter(
 		}
 	}
 
-	data := parsedValues.GetDataMap()
+	languageByFile := map[string]string{}
+	for _, fileName := range fileNames {
+		languageByFile[fileName], _ = oc.LanguageForFile(fileName)
+	}
+
 	data["ResultsByFile"] = resultsByFile
+	data["LanguageByFile"] = languageByFile
+	if _, ok := data["RevisionByFile"]; !ok {
+		data["RevisionByFile"] = map[string]string{}
+	}
+	if _, ok := data["ParseHealthByFile"]; !ok {
+		data["ParseHealthByFile"] = map[string]tree_sitter.ParseHealth{}
+	}
 	data["Results"] = allResults
 
 	var buf bytes.Buffer
 	err = tmpl.Execute(&buf, data)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	s_ := buf.String()
 	// trim left and right
 	s_ = strings.TrimSpace(s_) + "\n"
 
-	_, err = w.Write(([]byte)(s_))
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return s_, nil
 }
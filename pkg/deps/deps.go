@@ -0,0 +1,425 @@
+// Package deps extracts the module dependency graph of source files from
+// their import statements, using built-in queries for each language.
+//
+// Imports are resolved from the syntax alone: Go imports are resolved to the
+// package directories of the sources through their go.mod file, relative
+// imports to the imported files, and module paths such as Python dotted
+// names or Java and PHP qualified names to the files whose path ends with
+// them. Imports that can't be resolved to the sources are external.
+package deps
+
+import (
+	"context"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-go-golems/oak/pkg"
+	"github.com/go-go-golems/oak/pkg/api"
+	tree_sitter "github.com/go-go-golems/oak/pkg/tree-sitter"
+	"github.com/pkg/errors"
+)
+
+// Node is a module of the graph.
+type Node struct {
+	// ID is the package directory of Go files, the file of the other
+	// languages, and the imported package of external modules
+	ID       string `json:"id"`
+	Language string `json:"language"`
+	// External modules are imported but not part of the sources
+	External bool `json:"external,omitempty"`
+	// FanIn is the number of modules importing the module
+	FanIn int `json:"fanIn"`
+	// FanOut is the number of modules imported by the module
+	FanOut int `json:"fanOut"`
+	// Instability is FanOut / (FanIn + FanOut), 0 for isolated modules
+	Instability float64 `json:"instability"`
+	InCycle     bool    `json:"inCycle,omitempty"`
+}
+
+// Edge is an import of To by From. Imports between the same modules are
+// merged, Import, File and Row being those of the first one.
+type Edge struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Count  int    `json:"count"`
+	Import string `json:"import"`
+	File   string `json:"file"`
+	Row    uint32 `json:"row"`
+}
+
+// Graph is a module dependency graph. Nodes are sorted by ID, and edges by
+// importing and imported module.
+type Graph struct {
+	Nodes []*Node `json:"nodes"`
+	Edges []*Edge `json:"edges"`
+	// Cycles are the groups of modules that import each other, directly or
+	// not, as sorted IDs
+	Cycles [][]string `json:"cycles"`
+}
+
+// Node returns the node with the given ID, or nil.
+func (g *Graph) Node(id string) *Node {
+	i := sort.Search(len(g.Nodes), func(i int) bool {
+		return g.Nodes[i].ID >= id
+	})
+	if i < len(g.Nodes) && g.Nodes[i].ID == id {
+		return g.Nodes[i]
+	}
+	return nil
+}
+
+// Imports returns the IDs of the modules imported by the module id.
+func (g *Graph) Imports(id string) []string {
+	ret := []string{}
+	for _, e := range g.Edges {
+		if e.From == id {
+			ret = append(ret, e.To)
+		}
+	}
+	return ret
+}
+
+// Option configures Build.
+type Option func(*config)
+
+type config struct {
+	external bool
+	workers  int
+	// onFileError is called with the files that couldn't be read or parsed
+	onFileError func(fileName string, err error)
+}
+
+// WithExternal keeps the imports of modules that are not part of the
+// sources, such as standard library or third-party packages.
+func WithExternal(external bool) Option {
+	return func(c *config) {
+		c.external = external
+	}
+}
+
+// WithWorkers sets the number of files parsed in parallel.
+func WithWorkers(workers int) Option {
+	return func(c *config) {
+		c.workers = workers
+	}
+}
+
+// WithFileErrors calls fn with the error of each file that couldn't be read
+// or parsed. These files are left out of the graph, and their errors are
+// logged if fn is not set.
+func WithFileErrors(fn func(fileName string, err error)) Option {
+	return func(c *config) {
+		c.onFileError = fn
+	}
+}
+
+// fileError reports the error of a file left out of the graph.
+func (c *config) fileError(fileName string, err error) {
+	if c.onFileError != nil {
+		c.onFileError(fileName, err)
+		return
+	}
+	zlog.Warn().Err(err).Str("file", fileName).Msg("could not process file")
+}
+
+// language extracts the imports of the files of a language. The import
+// query of each language captures the imported module as @import.
+type language struct {
+	query string
+	// module returns the module of a source file
+	module func(b *builder, fileName string) string
+	// addImports resolves the imports matched in fileName, and adds them
+	// with addImport
+	addImports func(b *builder, fileName string, matches []tree_sitter.Match)
+}
+
+var languages = map[string]language{
+	"go":         goLanguage,
+	"java":       javaLanguage,
+	"javascript": javascriptLanguage,
+	"php":        phpLanguage,
+	"python":     pythonLanguage,
+	"rust":       rustLanguage,
+	"tsx":        javascriptLanguage,
+	"typescript": javascriptLanguage,
+}
+
+// Languages returns the names of the languages supported by Build.
+func Languages() []string {
+	ret := make([]string, 0, len(languages))
+	for name := range languages {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Build returns the dependency graph of fileNames. Files of languages that
+// are not supported are ignored, and files that can't be read or parsed are
+// reported with WithFileErrors.
+func Build(ctx context.Context, fileNames []string, options ...Option) (*Graph, error) {
+	c := &config{workers: 4}
+	for _, option := range options {
+		option(c)
+	}
+
+	b := newBuilder(c.external)
+	filesByLanguage := map[string][]string{}
+	for _, fileName := range fileNames {
+		candidates, err := pkg.DefaultLanguageRegistry.LookupFileName(fileName)
+		if err != nil {
+			continue
+		}
+		for _, candidate := range candidates {
+			if _, ok := languages[candidate.Name]; ok {
+				filesByLanguage[candidate.Name] = append(filesByLanguage[candidate.Name], fileName)
+				b.files[cleanPath(fileName)] = candidate.Name
+				break
+			}
+		}
+	}
+
+	// all the modules are known before resolving the imports
+	for _, name := range Languages() {
+		l := languages[name]
+		for _, fileName := range filesByLanguage[name] {
+			b.addModule(l.module(b, fileName), name)
+		}
+	}
+
+	for _, name := range Languages() {
+		files := filesByLanguage[name]
+		if len(files) == 0 {
+			continue
+		}
+		l := languages[name]
+		results, err := api.NewQueryBuilder(
+			api.WithLanguage(name),
+			api.WithQuery("imports", l.query),
+		).Run(ctx, api.WithFiles(files), api.WithMaxWorkers(c.workers), api.WithFileErrors(c.fileError))
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not run the %s import queries", name)
+		}
+		for _, fileName := range files {
+			r, ok := results[fileName]["imports"]
+			if !ok {
+				continue
+			}
+			l.addImports(b, fileName, r.Matches)
+		}
+	}
+
+	return b.graph(), nil
+}
+
+// cleanPath returns fileName as a clean slash separated path, which is the
+// form of the files of the sources in the graph.
+func cleanPath(fileName string) string {
+	return path.Clean(filepath.ToSlash(fileName))
+}
+
+type edgeKey struct {
+	from string
+	to   string
+}
+
+type builder struct {
+	external bool
+	// files are the language of the source files, by clean path
+	files map[string]string
+	nodes map[string]*Node
+	edges map[edgeKey]*Edge
+	// goPackages are the modules of the Go packages, by absolute directory
+	goPackages map[string]string
+	// goModules caches the go.mod file of directories
+	goModules map[string]*goModule
+}
+
+func newBuilder(external bool) *builder {
+	return &builder{
+		external:   external,
+		files:      map[string]string{},
+		nodes:      map[string]*Node{},
+		edges:      map[edgeKey]*Edge{},
+		goPackages: map[string]string{},
+		goModules:  map[string]*goModule{},
+	}
+}
+
+func (b *builder) addModule(id string, language string) {
+	if _, ok := b.nodes[id]; !ok {
+		b.nodes[id] = &Node{ID: id, Language: language}
+	}
+}
+
+// hasFile returns true if fileName, a clean slash separated path, is one of
+// the sources.
+func (b *builder) hasFile(fileName string) bool {
+	_, ok := b.files[fileName]
+	return ok
+}
+
+// firstFile returns the first of candidates that is one of the sources.
+func (b *builder) firstFile(candidates ...string) (string, bool) {
+	for _, candidate := range candidates {
+		if b.hasFile(candidate) {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+// fileWithSuffix returns the only source file whose path is one of suffixes,
+// or ends with "/" followed by one of them. Suffixes are tried in order.
+func (b *builder) fileWithSuffix(suffixes ...string) (string, bool) {
+	for _, suffix := range suffixes {
+		found := []string{}
+		for fileName := range b.files {
+			if fileName == suffix || strings.HasSuffix(fileName, "/"+suffix) {
+				found = append(found, fileName)
+			}
+		}
+		if len(found) == 1 {
+			return found[0], true
+		}
+	}
+	return "", false
+}
+
+// addImport adds the import of the module to by the module from, captured
+// as c in fileName. Imports of external modules are only added when keeping
+// them.
+func (b *builder) addImport(from string, to string, external bool, fileName string, c tree_sitter.Capture) {
+	if from == to {
+		return
+	}
+	if external {
+		if !b.external {
+			return
+		}
+		if _, ok := b.nodes[to]; !ok {
+			b.nodes[to] = &Node{ID: to, Language: b.files[cleanPath(fileName)], External: true}
+		}
+	}
+
+	key := edgeKey{from: from, to: to}
+	e, ok := b.edges[key]
+	if !ok {
+		e = &Edge{
+			From:   from,
+			To:     to,
+			Import: c.Text,
+			File:   fileName,
+			Row:    c.StartPoint.Row,
+		}
+		b.edges[key] = e
+	}
+	e.Count++
+}
+
+func (b *builder) graph() *Graph {
+	g := &Graph{
+		Nodes:  make([]*Node, 0, len(b.nodes)),
+		Edges:  make([]*Edge, 0, len(b.edges)),
+		Cycles: [][]string{},
+	}
+	for _, n := range b.nodes {
+		g.Nodes = append(g.Nodes, n)
+	}
+	sort.Slice(g.Nodes, func(i, j int) bool {
+		return g.Nodes[i].ID < g.Nodes[j].ID
+	})
+	for _, e := range b.edges {
+		g.Edges = append(g.Edges, e)
+		b.nodes[e.From].FanOut++
+		b.nodes[e.To].FanIn++
+	}
+	sort.Slice(g.Edges, func(i, j int) bool {
+		if g.Edges[i].From != g.Edges[j].From {
+			return g.Edges[i].From < g.Edges[j].From
+		}
+		return g.Edges[i].To < g.Edges[j].To
+	})
+
+	for _, n := range g.Nodes {
+		if n.FanIn+n.FanOut > 0 {
+			n.Instability = float64(n.FanOut) / float64(n.FanIn+n.FanOut)
+		}
+	}
+
+	for _, component := range g.stronglyConnectedComponents() {
+		if len(component) < 2 {
+			continue
+		}
+		sort.Strings(component)
+		for _, id := range component {
+			b.nodes[id].InCycle = true
+		}
+		g.Cycles = append(g.Cycles, component)
+	}
+	sort.Slice(g.Cycles, func(i, j int) bool {
+		return g.Cycles[i][0] < g.Cycles[j][0]
+	})
+
+	return g
+}
+
+// stronglyConnectedComponents returns the strongly connected components of
+// g, using Tarjan's algorithm.
+func (g *Graph) stronglyConnectedComponents() [][]string {
+	adjacency := map[string][]string{}
+	for _, e := range g.Edges {
+		adjacency[e.From] = append(adjacency[e.From], e.To)
+	}
+
+	index := map[string]int{}
+	lowLink := map[string]int{}
+	onStack := map[string]bool{}
+	stack := []string{}
+	ret := [][]string{}
+
+	var visit func(id string)
+	visit = func(id string) {
+		index[id] = len(index)
+		lowLink[id] = index[id]
+		stack = append(stack, id)
+		onStack[id] = true
+
+		for _, to := range adjacency[id] {
+			if _, ok := index[to]; !ok {
+				visit(to)
+				lowLink[id] = min(lowLink[id], lowLink[to])
+			} else if onStack[to] {
+				lowLink[id] = min(lowLink[id], index[to])
+			}
+		}
+
+		if lowLink[id] == index[id] {
+			component := []string{}
+			for {
+				top := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[top] = false
+				component = append(component, top)
+				if top == id {
+					break
+				}
+			}
+			ret = append(ret, component)
+		}
+	}
+
+	for _, n := range g.Nodes {
+		if _, ok := index[n.ID]; !ok {
+			visit(n.ID)
+		}
+	}
+	return ret
+}
+
+// unquote removes the quotes of a string literal.
+func unquote(s string) string {
+	return strings.Trim(s, "\"'`")
+}
@@ -0,0 +1,261 @@
+package deps
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/go-go-golems/oak/internal/testutil"
+)
+
+// edgesOf returns the sorted edges of g as "from -> to", with the directory
+// of the files removed from the IDs.
+func edgesOf(g *Graph, dir string) []string {
+	ret := []string{}
+	for _, e := range g.Edges {
+		ret = append(ret, testutil.TrimDir(dir, e.From)+" -> "+testutil.TrimDir(dir, e.To))
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func build(t *testing.T, files map[string]string, options ...Option) (*Graph, string) {
+	dir := t.TempDir()
+	fileNames := testutil.WriteFiles(t, dir, files)
+	g, err := Build(context.Background(), fileNames, options...)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return g, dir
+}
+
+func TestGoDeps(t *testing.T) {
+	g, dir := build(t, map[string]string{
+		"go.mod": "module example.com/project\n\ngo 1.22\n",
+		"cmd/app/main.go": `package main
+
+import (
+	"fmt"
+
+	"example.com/project/pkg/a"
+)
+
+func main() { fmt.Println(a.A()) }
+`,
+		"pkg/a/a.go": `package a
+
+import "example.com/project/pkg/b"
+
+func A() int { return b.B() }
+`,
+		"pkg/b/b.go": `package b
+
+import (
+	"os"
+	util "example.com/project/pkg/a"
+)
+
+var _ = util.A
+
+func B() int { return len(os.Args) }
+`,
+	}, WithExternal(true))
+
+	testutil.AssertLines(t, "edges", []string{
+		"cmd/app -> fmt",
+		"cmd/app -> pkg/a",
+		"pkg/a -> pkg/b",
+		"pkg/b -> os",
+		"pkg/b -> pkg/a",
+	}, edgesOf(g, dir))
+
+	prefix := filepath.ToSlash(dir) + "/"
+	if len(g.Cycles) != 1 || strings.Join(g.Cycles[0], " ") != prefix+"pkg/a "+prefix+"pkg/b" {
+		t.Errorf("Unexpected cycles %v", g.Cycles)
+	}
+	a := g.Node(prefix + "pkg/a")
+	if a == nil || a.FanIn != 2 || a.FanOut != 1 || !a.InCycle || a.Language != "go" {
+		t.Errorf("Unexpected node %+v", a)
+	}
+	external := g.Node("fmt")
+	if external == nil || !external.External || external.FanIn != 1 || external.Instability != 0 {
+		t.Errorf("Unexpected node %+v", external)
+	}
+	if app := g.Node(prefix + "cmd/app"); app == nil || app.Instability != 1 || app.InCycle {
+		t.Errorf("Unexpected node %+v", app)
+	}
+}
+
+func TestTypeScriptDeps(t *testing.T) {
+	g, dir := build(t, map[string]string{
+		"src/main.ts": `import { area } from './shapes'
+import * as util from "./util/index.js"
+import React from 'react'
+export { Square } from './shapes/square'
+
+const lazy = import('./lazy')
+`,
+		"src/shapes/index.ts":  `export function area() {}`,
+		"src/shapes/square.ts": `import { area } from '.'`,
+		"src/util/index.ts":    `const fs = require("node:fs")`,
+		"src/lazy.js":          `import { x } from "@scope/pkg/sub"`,
+	}, WithExternal(true))
+
+	testutil.AssertLines(t, "edges", []string{
+		"src/lazy.js -> @scope/pkg",
+		"src/main.ts -> react",
+		"src/main.ts -> src/lazy.js",
+		"src/main.ts -> src/shapes/index.ts",
+		"src/main.ts -> src/shapes/square.ts",
+		"src/main.ts -> src/util/index.ts",
+		"src/shapes/square.ts -> src/shapes/index.ts",
+		"src/util/index.ts -> node:fs",
+	}, edgesOf(g, dir))
+	if len(g.Cycles) != 0 {
+		t.Errorf("Unexpected cycles %v", g.Cycles)
+	}
+}
+
+func TestPythonDeps(t *testing.T) {
+	g, dir := build(t, map[string]string{
+		"app/__init__.py": ``,
+		"app/main.py": `import os.path
+import app.models as models
+from . import views
+from .util.strings import slugify
+`,
+		"app/models.py":       `from .views import render`,
+		"app/views.py":        `from app.models import Model`,
+		"app/util/strings.py": `from ..models import Model`,
+	})
+
+	testutil.AssertLines(t, "edges", []string{
+		"app/main.py -> app/models.py",
+		"app/main.py -> app/util/strings.py",
+		"app/main.py -> app/views.py",
+		"app/models.py -> app/views.py",
+		"app/util/strings.py -> app/models.py",
+		"app/views.py -> app/models.py",
+	}, edgesOf(g, dir))
+	if len(g.Cycles) != 1 || len(g.Cycles[0]) != 2 {
+		t.Errorf("Unexpected cycles %v", g.Cycles)
+	}
+	if g.Node("os") != nil {
+		t.Errorf("Expected external modules to be dropped")
+	}
+}
+
+func TestPHPJavaRustDeps(t *testing.T) {
+	g, dir := build(t, map[string]string{
+		"web/index.php": `<?php
+require_once __DIR__ . '/lib/helpers.php';
+include "lib/config.php";
+use App\Models\User;
+use Illuminate\Support\Str;
+`,
+		"web/lib/helpers.php":     `<?php`,
+		"web/lib/config.php":      `<?php`,
+		"web/src/Models/User.php": `<?php`,
+		"java/src/com/example/App.java": `package com.example;
+
+import com.example.util.Strings;
+import static com.example.util.Strings.slugify;
+import java.util.*;
+import java.util.List;
+`,
+		"java/src/com/example/util/Strings.java": `package com.example.util;`,
+		"rust/src/main.rs": `mod parser;
+mod inline { fn f() {} }
+use crate::parser::ast::Node;
+use std::collections::HashMap;
+`,
+		"rust/src/parser/mod.rs": `pub mod ast;
+use super::parser;
+`,
+		"rust/src/parser/ast.rs": `use self::inner::X;
+use super::Parser;
+`,
+	}, WithExternal(true))
+
+	testutil.AssertLines(t, "edges", []string{
+		"java/src/com/example/App.java -> java.util",
+		"java/src/com/example/App.java -> java/src/com/example/util/Strings.java",
+		"rust/src/main.rs -> rust/src/parser/ast.rs",
+		"rust/src/main.rs -> rust/src/parser/mod.rs",
+		"rust/src/main.rs -> std",
+		"rust/src/parser/mod.rs -> rust/src/parser/ast.rs",
+		"web/index.php -> Illuminate",
+		"web/index.php -> web/lib/config.php",
+		"web/index.php -> web/lib/helpers.php",
+		"web/index.php -> web/src/Models/User.php",
+	}, edgesOf(g, dir))
+}
+
+func TestOutputFormats(t *testing.T) {
+	g := &Graph{
+		Nodes: []*Node{
+			{ID: "a", Language: "go", FanIn: 1, FanOut: 2, InCycle: true},
+			{ID: "b", Language: "go", FanIn: 1, FanOut: 1, InCycle: true},
+			{ID: "fmt", Language: "go", External: true, FanIn: 1},
+		},
+		Edges: []*Edge{
+			{From: "a", To: "b", Count: 1},
+			{From: "a", To: "fmt", Count: 1},
+			{From: "b", To: "a", Count: 1},
+		},
+		Cycles: [][]string{{"a", "b"}},
+	}
+
+	var dot bytes.Buffer
+	err := g.WriteDOT(&dot)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := `digraph deps {
+  rankdir=LR;
+  node [shape=box];
+  "a" [color=red];
+  "b" [color=red];
+  "fmt" [style=dashed];
+  "a" -> "b" [color=red];
+  "a" -> "fmt";
+  "b" -> "a" [color=red];
+}
+`
+	if dot.String() != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, dot.String())
+	}
+
+	var js bytes.Buffer
+	err = g.WriteJSON(&js)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(js.String(), `"cycles": [`) || !strings.Contains(js.String(), `"fanOut": 2`) {
+		t.Errorf("Unexpected JSON:\n%s", js.String())
+	}
+}
+
+func TestDepsFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	fileNames := testutil.WriteFiles(t, dir, map[string]string{
+		"go.mod":          "module example.com/project\n\ngo 1.22\n",
+		"cmd/app/main.go": "package main\n\nimport \"example.com/project/pkg/a\"\n\nfunc main() { a.A() }\n",
+		"pkg/a/a.go":      "package a\n\nfunc A() {}\n",
+	})
+	missing := filepath.Join(dir, "pkg", "b", "missing.go")
+
+	failed := []string{}
+	g, err := Build(context.Background(), append(fileNames, missing),
+		WithFileErrors(func(fileName string, err error) {
+			failed = append(failed, fileName)
+		}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	testutil.AssertLines(t, "failed files", []string{missing}, failed)
+	testutil.AssertLines(t, "edges", []string{"cmd/app -> pkg/a"}, edgesOf(g, dir))
+}
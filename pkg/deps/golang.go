@@ -0,0 +1,75 @@
+package deps
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	tree_sitter "github.com/go-go-golems/oak/pkg/tree-sitter"
+)
+
+var goLanguage = language{
+	query: `(import_spec path: (interpreted_string_literal) @import)`,
+	module: func(b *builder, fileName string) string {
+		id := path.Dir(cleanPath(fileName))
+		if dir, err := filepath.Abs(filepath.Dir(fileName)); err == nil {
+			b.goPackages[dir] = id
+		}
+		return id
+	},
+	addImports: addGoImports,
+}
+
+// goModule is the module declared by a go.mod file.
+type goModule struct {
+	path string
+	dir  string
+}
+
+var goModuleDirective = regexp.MustCompile(`(?m)^module\s+"?([^\s"]+)"?`)
+
+// goModuleOf returns the module of the Go package in dir, an absolute
+// directory, from the go.mod file of dir or its closest parent, or nil.
+func (b *builder) goModuleOf(dir string) *goModule {
+	if m, ok := b.goModules[dir]; ok {
+		return m
+	}
+
+	var m *goModule
+	content, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+	if err == nil {
+		if match := goModuleDirective.FindSubmatch(content); match != nil {
+			m = &goModule{path: string(match[1]), dir: dir}
+		}
+	} else if parent := filepath.Dir(dir); parent != dir {
+		m = b.goModuleOf(parent)
+	}
+	b.goModules[dir] = m
+	return m
+}
+
+// addGoImports resolves the import paths of the module of the package to the
+// packages of the sources, and keeps the others as external modules.
+func addGoImports(b *builder, fileName string, matches []tree_sitter.Match) {
+	from := path.Dir(cleanPath(fileName))
+	var m *goModule
+	if dir, err := filepath.Abs(filepath.Dir(fileName)); err == nil {
+		m = b.goModuleOf(dir)
+	}
+
+	for _, match := range matches {
+		c := match["import"]
+		importPath := unquote(c.Text)
+		to, ok := importPath, false
+		if m != nil && (importPath == m.path || strings.HasPrefix(importPath, m.path+"/")) {
+			dir := filepath.Join(m.dir, filepath.FromSlash(strings.TrimPrefix(importPath, m.path)))
+			to, ok = b.goPackages[dir]
+			if !ok {
+				to = importPath
+			}
+		}
+		b.addImport(from, to, !ok, fileName, c)
+	}
+}
@@ -0,0 +1,41 @@
+package deps
+
+import (
+	"strings"
+
+	tree_sitter "github.com/go-go-golems/oak/pkg/tree-sitter"
+)
+
+var javaLanguage = language{
+	query: `
+		(import_declaration (scoped_identifier) @import (asterisk)? @wildcard)
+	`,
+	module:     fileModule,
+	addImports: addJavaImports,
+}
+
+// addJavaImports resolves imported classes to the only source file whose
+// path ends with the qualified class name, which is the layout of Java
+// source trees. Static imports and nested classes are resolved to their
+// top-level class. Wildcard imports and unresolved classes are external,
+// named after their package.
+func addJavaImports(b *builder, fileName string, matches []tree_sitter.Match) {
+	from := cleanPath(fileName)
+	for _, match := range matches {
+		c := match["import"]
+		parts := strings.Split(c.Text, ".")
+		if _, ok := match["wildcard"]; ok {
+			b.addImport(from, c.Text, true, fileName, c)
+			continue
+		}
+
+		to, ok := "", false
+		for i := len(parts); i > 1 && !ok; i-- {
+			to, ok = b.fileWithSuffix(strings.Join(parts[:i], "/") + ".java")
+		}
+		if !ok {
+			to = strings.Join(parts[:len(parts)-1], ".")
+		}
+		b.addImport(from, to, !ok, fileName, c)
+	}
+}
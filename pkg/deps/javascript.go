@@ -0,0 +1,80 @@
+package deps
+
+import (
+	"path"
+	"strings"
+
+	tree_sitter "github.com/go-go-golems/oak/pkg/tree-sitter"
+)
+
+// javascriptLanguage is also used for TypeScript, whose grammar extends the
+// JavaScript one.
+var javascriptLanguage = language{
+	query: `
+		(import_statement source: (string) @import)
+		(export_statement source: (string) @import)
+		((call_expression
+		  function: (identifier) @function
+		  arguments: (arguments . (string) @import))
+		 (#eq? @function "require"))
+		(call_expression
+		 function: (import)
+		 arguments: (arguments . (string) @import))
+	`,
+	module:     fileModule,
+	addImports: addJavaScriptImports,
+}
+
+// fileModule is the module of the languages where each file is a module.
+func fileModule(_ *builder, fileName string) string {
+	return cleanPath(fileName)
+}
+
+var javascriptExtensions = []string{".ts", ".tsx", ".d.ts", ".js", ".jsx", ".mjs", ".cjs"}
+
+// addJavaScriptImports resolves relative imports to the files of the
+// sources, trying the known extensions and index files as node and
+// TypeScript do. Other imports are external packages.
+func addJavaScriptImports(b *builder, fileName string, matches []tree_sitter.Match) {
+	from := cleanPath(fileName)
+	for _, match := range matches {
+		c := match["import"]
+		source := unquote(c.Text)
+		if !strings.HasPrefix(source, ".") {
+			b.addImport(from, javascriptPackage(source), true, fileName, c)
+			continue
+		}
+
+		base := path.Join(path.Dir(from), source)
+		// TypeScript sources import the compiled .js files
+		bases := []string{base}
+		if ext := path.Ext(base); ext == ".js" || ext == ".jsx" || ext == ".mjs" || ext == ".cjs" {
+			bases = append(bases, strings.TrimSuffix(base, ext))
+		}
+		candidates := []string{}
+		for _, base := range bases {
+			candidates = append(candidates, base)
+			for _, ext := range javascriptExtensions {
+				candidates = append(candidates, base+ext)
+			}
+			for _, ext := range javascriptExtensions {
+				candidates = append(candidates, base+"/index"+ext)
+			}
+		}
+		if to, ok := b.firstFile(candidates...); ok {
+			b.addImport(from, to, false, fileName, c)
+		} else {
+			b.addImport(from, base, true, fileName, c)
+		}
+	}
+}
+
+// javascriptPackage returns the package of a module specifier, such as
+// "lodash" for "lodash/fp" or "@types/node" for "@types/node/fs".
+func javascriptPackage(source string) string {
+	parts := strings.Split(source, "/")
+	if strings.HasPrefix(source, "@") && len(parts) > 1 {
+		return parts[0] + "/" + parts[1]
+	}
+	return parts[0]
+}
@@ -0,0 +1,59 @@
+package deps
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// WriteDOT writes g in the DOT language of graphviz. External modules are
+// dashed, and the modules and imports of cycles are red.
+func (g *Graph) WriteDOT(w io.Writer) error {
+	var sb strings.Builder
+	sb.WriteString("digraph deps {\n")
+	sb.WriteString("  rankdir=LR;\n")
+	sb.WriteString("  node [shape=box];\n")
+
+	for _, n := range g.Nodes {
+		attributes := []string{}
+		if n.External {
+			attributes = append(attributes, "style=dashed")
+		}
+		if n.InCycle {
+			attributes = append(attributes, "color=red")
+		}
+		if len(attributes) == 0 {
+			fmt.Fprintf(&sb, "  %s;\n", strconv.Quote(n.ID))
+		} else {
+			fmt.Fprintf(&sb, "  %s [%s];\n", strconv.Quote(n.ID), strings.Join(attributes, ", "))
+		}
+	}
+
+	cycles := map[string]int{}
+	for i, cycle := range g.Cycles {
+		for _, id := range cycle {
+			cycles[id] = i + 1
+		}
+	}
+	for _, e := range g.Edges {
+		if c := cycles[e.From]; c != 0 && c == cycles[e.To] {
+			fmt.Fprintf(&sb, "  %s -> %s [color=red];\n", strconv.Quote(e.From), strconv.Quote(e.To))
+		} else {
+			fmt.Fprintf(&sb, "  %s -> %s;\n", strconv.Quote(e.From), strconv.Quote(e.To))
+		}
+	}
+	sb.WriteString("}\n")
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// WriteJSON writes g as a JSON object with the nodes, edges and cycles
+// arrays.
+func (g *Graph) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(g)
+}
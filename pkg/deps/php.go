@@ -0,0 +1,52 @@
+package deps
+
+import (
+	"path"
+	"strings"
+
+	tree_sitter "github.com/go-go-golems/oak/pkg/tree-sitter"
+)
+
+var phpLanguage = language{
+	query: `
+		(include_expression [(string) @include (binary_expression right: (string) @include)])
+		(include_once_expression [(string) @include (binary_expression right: (string) @include)])
+		(require_expression [(string) @include (binary_expression right: (string) @include)])
+		(require_once_expression [(string) @include (binary_expression right: (string) @include)])
+		(namespace_use_clause (qualified_name) @import)
+	`,
+	module:     fileModule,
+	addImports: addPHPImports,
+}
+
+// addPHPImports resolves included files from the directory of the file, and
+// the classes of use clauses to the only source file whose path ends with
+// the class name, dropping leading namespaces as autoloaders map them to
+// directories such as src/. Unresolved classes are external, named after
+// their vendor namespace.
+func addPHPImports(b *builder, fileName string, matches []tree_sitter.Match) {
+	from := cleanPath(fileName)
+	for _, match := range matches {
+		if c, ok := match["include"]; ok {
+			// "__DIR__ . '/file.php'" keeps the leading slash
+			included := strings.TrimPrefix(unquote(c.Text), "/")
+			to := path.Join(path.Dir(from), included)
+			b.addImport(from, to, !b.hasFile(to), fileName, c)
+			continue
+		}
+
+		c := match["import"]
+		parts := strings.Split(strings.TrimPrefix(c.Text, "\\"), "\\")
+		to, ok := "", false
+		for i := 0; i < len(parts) && !ok; i++ {
+			if i > 0 && len(parts)-i < 2 {
+				break
+			}
+			to, ok = b.fileWithSuffix(strings.Join(parts[i:], "/") + ".php")
+		}
+		if !ok {
+			to = parts[0]
+		}
+		b.addImport(from, to, !ok, fileName, c)
+	}
+}
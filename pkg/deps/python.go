@@ -0,0 +1,73 @@
+package deps
+
+import (
+	"path"
+	"strings"
+
+	tree_sitter "github.com/go-go-golems/oak/pkg/tree-sitter"
+)
+
+var pythonLanguage = language{
+	query: `
+		(import_statement name: (dotted_name) @import)
+		(import_statement name: (aliased_import name: (dotted_name) @import))
+		(import_from_statement module_name: (dotted_name) @import)
+		(import_from_statement
+		 module_name: (relative_import) @import
+		 name: [(dotted_name) @name (aliased_import name: (dotted_name) @name)]?)
+	`,
+	module:     fileModule,
+	addImports: addPythonImports,
+}
+
+// addPythonImports resolves relative imports from the directory of the
+// package, and absolute imports from the directory of the file or to the
+// only source file whose path ends with the module path. The names imported
+// from a relative module are tried as submodules first, as in
+// "from . import sibling".
+func addPythonImports(b *builder, fileName string, matches []tree_sitter.Match) {
+	from := cleanPath(fileName)
+	dir := path.Dir(from)
+	for _, match := range matches {
+		c := match["import"]
+		module := c.Text
+
+		if strings.HasPrefix(module, ".") {
+			rest := strings.TrimLeft(module, ".")
+			base := dir
+			for i := 1; i < len(module)-len(rest); i++ {
+				base = path.Dir(base)
+			}
+			if rest != "" {
+				base = path.Join(base, strings.ReplaceAll(rest, ".", "/"))
+			}
+			candidates := []string{}
+			if name, ok := match["name"]; ok {
+				candidates = append(candidates, pythonFiles(path.Join(base, strings.ReplaceAll(name.Text, ".", "/")))...)
+			}
+			candidates = append(candidates, pythonFiles(base)...)
+			if to, ok := b.firstFile(candidates...); ok {
+				b.addImport(from, to, false, fileName, c)
+			} else {
+				b.addImport(from, base, true, fileName, c)
+			}
+			continue
+		}
+
+		modulePath := strings.ReplaceAll(module, ".", "/")
+		to, ok := b.firstFile(pythonFiles(path.Join(dir, modulePath))...)
+		if !ok {
+			to, ok = b.fileWithSuffix(pythonFiles(modulePath)...)
+		}
+		if !ok {
+			to = strings.Split(module, ".")[0]
+		}
+		b.addImport(from, to, !ok, fileName, c)
+	}
+}
+
+// pythonFiles returns the files of the module at modulePath, either a
+// module file or a package.
+func pythonFiles(modulePath string) []string {
+	return []string{modulePath + ".py", modulePath + "/__init__.py"}
+}
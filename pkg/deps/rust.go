@@ -0,0 +1,111 @@
+package deps
+
+import (
+	"path"
+	"strings"
+
+	tree_sitter "github.com/go-go-golems/oak/pkg/tree-sitter"
+)
+
+var rustLanguage = language{
+	query: `
+		(mod_item name: (identifier) @mod body: (declaration_list)? @body)
+		(use_declaration argument: (_) @import)
+		(extern_crate_declaration name: (identifier) @crate)
+	`,
+	module:     fileModule,
+	addImports: addRustImports,
+}
+
+// addRustImports resolves "mod" declarations to the files of the declared
+// modules, and the paths of "use" declarations starting with crate, self or
+// super to the file of their longest module prefix. Other paths are
+// external, named after their crate.
+func addRustImports(b *builder, fileName string, matches []tree_sitter.Match) {
+	from := cleanPath(fileName)
+	for _, match := range matches {
+		if c, ok := match["mod"]; ok {
+			if _, ok := match["body"]; ok {
+				// inline module
+				continue
+			}
+			base := path.Join(rustModuleDir(from), c.Text)
+			if to, ok := b.firstFile(base+".rs", base+"/mod.rs"); ok {
+				b.addImport(from, to, false, fileName, c)
+			}
+			continue
+		}
+		if c, ok := match["crate"]; ok {
+			b.addImport(from, c.Text, true, fileName, c)
+			continue
+		}
+
+		c := match["import"]
+		parts := strings.Split(rustUsePath(c.Text), "::")
+		var dir string
+		switch parts[0] {
+		case "crate":
+			dir = b.rustCrateRoot(from)
+		case "self":
+			dir = rustModuleDir(from)
+		case "super":
+			dir = path.Dir(rustModuleDir(from))
+		default:
+			b.addImport(from, parts[0], true, fileName, c)
+			continue
+		}
+		for len(parts) > 1 && parts[1] == "super" {
+			dir = path.Dir(dir)
+			parts = parts[1:]
+		}
+
+		to, ok := "", false
+		for i := len(parts); i > 1 && !ok; i-- {
+			base := path.Join(dir, strings.Join(parts[1:i], "/"))
+			to, ok = b.firstFile(base+".rs", base+"/mod.rs")
+		}
+		if ok {
+			b.addImport(from, to, false, fileName, c)
+		}
+	}
+}
+
+// rustUsePath returns the module path of the argument of a use declaration,
+// without its use list, wildcard or alias.
+func rustUsePath(argument string) string {
+	if i := strings.Index(argument, "{"); i >= 0 {
+		argument = argument[:i]
+	}
+	if i := strings.Index(argument, " as "); i >= 0 {
+		argument = argument[:i]
+	}
+	argument = strings.TrimPrefix(argument, "::")
+	return strings.TrimSuffix(strings.TrimSuffix(argument, "*"), "::")
+}
+
+// rustModuleDir returns the directory of the submodules of the module in
+// fileName: the directory of crate roots and mod.rs files, and a directory
+// named after the module otherwise.
+func rustModuleDir(fileName string) string {
+	switch path.Base(fileName) {
+	case "lib.rs", "main.rs", "mod.rs":
+		return path.Dir(fileName)
+	}
+	return strings.TrimSuffix(fileName, ".rs")
+}
+
+// rustCrateRoot returns the directory of the crate root of fileName, which
+// is the closest directory containing a lib.rs or main.rs source file.
+func (b *builder) rustCrateRoot(fileName string) string {
+	dir := path.Dir(fileName)
+	for {
+		if _, ok := b.firstFile(path.Join(dir, "lib.rs"), path.Join(dir, "main.rs")); ok {
+			return dir
+		}
+		parent := path.Dir(dir)
+		if parent == dir {
+			return path.Dir(fileName)
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,170 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	sitter "github.com/smacker/go-tree-sitter"
+)
+
+// modelineLines is the number of lines at the start and at the end of a file
+// that are searched for a modeline, like vim does.
+const modelineLines = 5
+
+var (
+	// vim: ft=python, vim: set filetype=python :, vi: syntax=sh
+	vimModelineRegexp = regexp.MustCompile(`\b(?:vi|vim|ex):.*?\b(?:ft|filetype|syntax)=([A-Za-z0-9_+#.-]+)`)
+	// -*- python -*-, -*- mode: python; coding: utf-8 -*-
+	emacsModelineRegexp = regexp.MustCompile(`-\*-(.*?)-\*-`)
+)
+
+// Detect returns the language of a file, looking in order at:
+//
+//   - a vim or emacs modeline in the first or last lines of source
+//   - the shebang line of source
+//   - the globs of the languages matching fileName
+//
+// If several languages match fileName, source is parsed with each of them,
+// and the language resulting in the fewest syntax errors is returned, the
+// priority of the languages breaking ties.
+func (lr *LanguageRegistry) Detect(
+	ctx context.Context,
+	fileName string,
+	source []byte,
+) (*RegisteredLanguage, error) {
+	if mode := FindModeline(source); mode != "" {
+		rl, err := lr.Lookup(strings.ToLower(mode))
+		if err == nil {
+			return rl, nil
+		}
+		zlog.Debug().Str("file", fileName).Str("mode", mode).Msg("ignoring modeline with unknown language")
+	}
+
+	firstLine, _, _ := bytes.Cut(source, []byte("\n"))
+	if bytes.HasPrefix(firstLine, []byte("#!")) {
+		rl, err := lr.LookupShebang(string(firstLine))
+		if err == nil {
+			return rl, nil
+		}
+		zlog.Debug().Str("file", fileName).Err(err).Msg("ignoring shebang line")
+	}
+
+	candidates, err := lr.LookupFileName(fileName)
+	if err != nil {
+		return nil, errors.Errorf("could not detect the language of %s", fileName)
+	}
+	if len(candidates) == 1 {
+		return candidates[0], nil
+	}
+
+	return trialParse(ctx, candidates, source)
+}
+
+// DetectLanguage detects the language of a file using the
+// DefaultLanguageRegistry.
+func DetectLanguage(ctx context.Context, fileName string, source []byte) (*RegisteredLanguage, error) {
+	return DefaultLanguageRegistry.Detect(ctx, fileName, source)
+}
+
+// trialParse parses source with each of the candidates, and returns the first
+// one with the fewest syntax errors.
+func trialParse(
+	ctx context.Context,
+	candidates []*RegisteredLanguage,
+	source []byte,
+) (*RegisteredLanguage, error) {
+	var best *RegisteredLanguage
+	bestErrors := 0
+
+	parser := sitter.NewParser()
+	defer parser.Close()
+
+	for _, candidate := range candidates {
+		parser.SetLanguage(candidate.Language)
+		tree, err := parser.ParseCtx(ctx, nil, source)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not parse source as %s", candidate.Name)
+		}
+		n := CountSyntaxErrors(tree.RootNode())
+		tree.Close()
+
+		if best == nil || n < bestErrors {
+			best, bestErrors = candidate, n
+		}
+		if n == 0 {
+			break
+		}
+	}
+
+	return best, nil
+}
+
+// CountSyntaxErrors returns the number of ERROR and MISSING nodes under node.
+func CountSyntaxErrors(node *sitter.Node) int {
+	if !node.HasError() {
+		return 0
+	}
+
+	cursor := sitter.NewTreeCursor(node)
+	defer cursor.Close()
+
+	n := 0
+	for {
+		current := cursor.CurrentNode()
+		if current.IsError() || current.IsMissing() {
+			n++
+		}
+		// only descend into subtrees that contain errors
+		if current.HasError() && cursor.GoToFirstChild() {
+			continue
+		}
+		for !cursor.GoToNextSibling() {
+			if !cursor.GoToParent() {
+				return n
+			}
+		}
+	}
+}
+
+// FindModeline returns the language set by a vim or emacs modeline in the
+// first or last lines of source, or "" if there is none.
+func FindModeline(source []byte) string {
+	lines := bytes.Split(source, []byte("\n"))
+
+	candidates := lines
+	if len(lines) > 2*modelineLines {
+		candidates = append(lines[:modelineLines:modelineLines], lines[len(lines)-modelineLines:]...)
+	}
+
+	for _, line := range candidates {
+		if m := vimModelineRegexp.FindSubmatch(line); m != nil {
+			return string(m[1])
+		}
+		if m := emacsModelineRegexp.FindSubmatch(line); m != nil {
+			if mode := emacsMode(string(m[1])); mode != "" {
+				return mode
+			}
+		}
+	}
+
+	return ""
+}
+
+// emacsMode returns the mode of the variables of an emacs modeline, which are
+// either just the mode, or a list of "variable: value" separated by ";".
+func emacsMode(variables string) string {
+	variables = strings.TrimSpace(variables)
+	if !strings.Contains(variables, ":") {
+		return variables
+	}
+	for _, variable := range strings.Split(variables, ";") {
+		name, value, ok := strings.Cut(variable, ":")
+		if ok && strings.TrimSpace(strings.ToLower(name)) == "mode" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,65 @@
+package pkg
+
+import (
+	"context"
+	"testing"
+)
+
+func TestFindModeline(t *testing.T) {
+	for source, expected := range map[string]string{
+		"# vim: ft=python\nx = 1\n":                      "python",
+		"x = 1\n# vim: set filetype=ruby :\n":            "ruby",
+		"// -*- go -*-\npackage main\n":                  "go",
+		"/* -*- mode: c++; coding: utf-8 -*- */\nint x;": "c++",
+		"-*- coding: utf-8 -*-\n":                        "",
+		"package main\n":                                 "",
+	} {
+		mode := FindModeline([]byte(source))
+		if mode != expected {
+			t.Errorf("Expected %q for %q, got %q", expected, source, mode)
+		}
+	}
+}
+
+func TestFindModelineOnlyLooksAtFirstAndLastLines(t *testing.T) {
+	source := "a\nb\nc\nd\ne\n# vim: ft=python\nf\ng\nh\ni\nj\nk\n"
+	if mode := FindModeline([]byte(source)); mode != "" {
+		t.Errorf("Expected no modeline, got %q", mode)
+	}
+}
+
+func TestDetect(t *testing.T) {
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		name     string
+		fileName string
+		source   string
+		expected string
+	}{
+		{"shebang", "script", "#!/usr/bin/env python3\nprint(1)\n", "python"},
+		{"modeline", "notes.txt", "// -*- mode: go -*-\npackage main\n", "go"},
+		{"modeline over file name", "config.py", "# vim: ft=ruby\nputs 1\n", "ruby"},
+		{"unknown modeline", "main.go", "// vim: ft=unknown\npackage main\n", "go"},
+		{"single candidate", "main.go", "package main\n", "go"},
+		{"typescript", "cast.ts", "const x = <number>y;\n", "typescript"},
+		{"tsx", "component.ts", "const C = () => <div>hi</div>;\n", "tsx"},
+		{"c++ header", "a.h", "class A { public: int x; };\n", "cpp"},
+		{"c header tie", "b.h", "int add(int a, int b);\n", "cpp"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rl, err := DetectLanguage(ctx, tc.fileName, []byte(tc.source))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if rl.Name != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, rl.Name)
+			}
+		})
+	}
+
+	_, err := DetectLanguage(ctx, "README", []byte("hello\n"))
+	if err == nil {
+		t.Fatalf("Expected an error for an undetectable file")
+	}
+}
@@ -0,0 +1,249 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+type opKind int
+
+const (
+	opEqual opKind = iota
+	opDelete
+	opInsert
+)
+
+type op struct {
+	kind opKind
+	line string
+}
+
+// Unified returns a unified diff between a and b, using oldName and newName
+// in the file headers and contextLines lines of context around each change.
+// It returns the empty string if both inputs are identical.
+func Unified(oldName string, newName string, a []byte, b []byte, contextLines int) string {
+	if string(a) == string(b) {
+		return ""
+	}
+
+	ops := lineOps(splitLines(string(a)), splitLines(string(b)))
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", oldName, newName)
+
+	// oldLine[i] and newLine[i] are the 0-based line numbers in a and b right
+	// before ops[i] is applied.
+	oldLine := make([]int, len(ops)+1)
+	newLine := make([]int, len(ops)+1)
+	for i, o := range ops {
+		oldLine[i+1] = oldLine[i]
+		newLine[i+1] = newLine[i]
+		if o.kind != opInsert {
+			oldLine[i+1]++
+		}
+		if o.kind != opDelete {
+			newLine[i+1]++
+		}
+	}
+
+	i := 0
+	for i < len(ops) {
+		// skip to the next change
+		for i < len(ops) && ops[i].kind == opEqual {
+			i++
+		}
+		if i == len(ops) {
+			break
+		}
+
+		start := i - contextLines
+		if start < 0 {
+			start = 0
+		}
+
+		// extend the hunk as long as changes are at most 2*contextLines apart
+		end := i
+		for end < len(ops) {
+			if ops[end].kind != opEqual {
+				end++
+				continue
+			}
+			run := end
+			for run < len(ops) && ops[run].kind == opEqual {
+				run++
+			}
+			if run == len(ops) || run-end > 2*contextLines {
+				end += contextLines
+				if end > len(ops) {
+					end = len(ops)
+				}
+				break
+			}
+			end = run
+		}
+
+		oldCount := oldLine[end] - oldLine[start]
+		newCount := newLine[end] - newLine[start]
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n",
+			hunkRange(oldLine[start], oldCount),
+			hunkRange(newLine[start], newCount))
+
+		for _, o := range ops[start:end] {
+			prefix := " "
+			switch o.kind {
+			case opDelete:
+				prefix = "-"
+			case opInsert:
+				prefix = "+"
+			case opEqual:
+			}
+			sb.WriteString(prefix)
+			sb.WriteString(o.line)
+			if !strings.HasSuffix(o.line, "\n") {
+				sb.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+
+		i = end
+	}
+
+	return sb.String()
+}
+
+func hunkRange(start int, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// splitLines splits s into lines, keeping the trailing newline of each line.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// lineOps computes a shortest edit script turning a into b, using the
+// linear space variant of Myers' O(ND) algorithm: the middle snake of an
+// optimal path is found by searching from both ends of the edit graph, and the
+// parts before and after it are diffed recursively. Memory stays linear in the
+// size of the inputs, even for files that are mostly rewritten.
+func lineOps(a []string, b []string) []op {
+	d := &differ{a: a, b: b}
+	d.diff(0, len(a), 0, len(b))
+	return d.ops
+}
+
+type differ struct {
+	a   []string
+	b   []string
+	ops []op
+}
+
+func (d *differ) diff(aStart int, aEnd int, bStart int, bEnd int) {
+	for aStart < aEnd && bStart < bEnd && d.a[aStart] == d.b[bStart] {
+		d.ops = append(d.ops, op{kind: opEqual, line: d.a[aStart]})
+		aStart++
+		bStart++
+	}
+	suffix := 0
+	for aEnd > aStart && bEnd > bStart && d.a[aEnd-1] == d.b[bEnd-1] {
+		aEnd--
+		bEnd--
+		suffix++
+	}
+
+	switch {
+	case aStart == aEnd:
+		for _, line := range d.b[bStart:bEnd] {
+			d.ops = append(d.ops, op{kind: opInsert, line: line})
+		}
+	case bStart == bEnd:
+		for _, line := range d.a[aStart:aEnd] {
+			d.ops = append(d.ops, op{kind: opDelete, line: line})
+		}
+	default:
+		x, y, u, v := d.middleSnake(aStart, aEnd, bStart, bEnd)
+		d.diff(aStart, x, bStart, y)
+		for _, line := range d.a[x:u] {
+			d.ops = append(d.ops, op{kind: opEqual, line: line})
+		}
+		d.diff(u, aEnd, v, bEnd)
+	}
+
+	for _, line := range d.a[aEnd : aEnd+suffix] {
+		d.ops = append(d.ops, op{kind: opEqual, line: line})
+	}
+}
+
+// middleSnake returns the start (x, y) and end (u, v) of the middle snake of
+// an optimal path from (aStart, bStart) to (aEnd, bEnd). Only the furthest
+// reaching point of each diagonal is kept, for the forward and the backward
+// search.
+func (d *differ) middleSnake(aStart int, aEnd int, bStart int, bEnd int) (int, int, int, int) {
+	n, m := aEnd-aStart, bEnd-bStart
+	delta := n - m
+	odd := delta%2 != 0
+	maxD := (n + m + 1) / 2
+	offset := maxD + 1
+	// forward[k] is the furthest x reached on diagonal k from the start,
+	// backward[k] the furthest distance from the end reached on diagonal k of
+	// the reversed inputs
+	forward := make([]int, 2*maxD+3)
+	backward := make([]int, 2*maxD+3)
+
+	for D := 0; D <= maxD; D++ {
+		for k := -D; k <= D; k += 2 {
+			var x int
+			if k == -D || (k != D && forward[offset+k-1] < forward[offset+k+1]) {
+				x = forward[offset+k+1]
+			} else {
+				x = forward[offset+k-1] + 1
+			}
+			y := x - k
+			x0, y0 := x, y
+			for x < n && y < m && d.a[aStart+x] == d.b[bStart+y] {
+				x++
+				y++
+			}
+			forward[offset+k] = x
+
+			// diagonal k is diagonal delta-k of the reversed inputs
+			if odd && delta-k >= -(D-1) && delta-k <= D-1 && x+backward[offset+delta-k] >= n {
+				return aStart + x0, bStart + y0, aStart + x, bStart + y
+			}
+		}
+
+		for k := -D; k <= D; k += 2 {
+			var x int
+			if k == -D || (k != D && backward[offset+k-1] < backward[offset+k+1]) {
+				x = backward[offset+k+1]
+			} else {
+				x = backward[offset+k-1] + 1
+			}
+			y := x - k
+			x0, y0 := x, y
+			for x < n && y < m && d.a[aEnd-1-x] == d.b[bEnd-1-y] {
+				x++
+				y++
+			}
+			backward[offset+k] = x
+
+			if !odd && delta-k >= -D && delta-k <= D && x+forward[offset+delta-k] >= n {
+				return aEnd - x, bEnd - y, aEnd - x0, bEnd - y0
+			}
+		}
+	}
+
+	// not reached, the searches always meet
+	panic("diff: no middle snake")
+}
@@ -0,0 +1,101 @@
+package diff
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedIdentical(t *testing.T) {
+	if d := Unified("a", "b", []byte("x\ny\n"), []byte("x\ny\n"), 3); d != "" {
+		t.Fatalf("Expected empty diff, got %q", d)
+	}
+}
+
+func TestUnifiedSingleChange(t *testing.T) {
+	a := "one\ntwo\nthree\nfour\n"
+	b := "one\n2\nthree\nfour\n"
+	expected := "--- a\n+++ b\n@@ -1,3 +1,3 @@\n one\n-two\n+2\n three\n"
+
+	d := Unified("a", "b", []byte(a), []byte(b), 1)
+	if d != expected {
+		t.Fatalf("Expected:\n%s\ngot:\n%s", expected, d)
+	}
+}
+
+func TestUnifiedSeparateHunks(t *testing.T) {
+	a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n"
+	b := "1\nx\n3\n4\n5\n6\n7\ny\n9\n"
+	expected := "--- a\n+++ b\n" +
+		"@@ -1,3 +1,3 @@\n 1\n-2\n+x\n 3\n" +
+		"@@ -7,3 +7,3 @@\n 7\n-8\n+y\n 9\n"
+
+	d := Unified("a", "b", []byte(a), []byte(b), 1)
+	if d != expected {
+		t.Fatalf("Expected:\n%s\ngot:\n%s", expected, d)
+	}
+}
+
+func TestUnifiedNoNewlineAtEnd(t *testing.T) {
+	expected := "--- a\n+++ b\n@@ -1 +1 @@\n-x\n\\ No newline at end of file\n+y\n\\ No newline at end of file\n"
+
+	d := Unified("a", "b", []byte("x"), []byte("y"), 3)
+	if d != expected {
+		t.Fatalf("Expected:\n%s\ngot:\n%s", expected, d)
+	}
+}
+
+// TestLineOpsMinimal checks on random inputs that the edit script turns a
+// into b, and that it is as short as the one given by the longest common
+// subsequence.
+func TestLineOpsMinimal(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	randomLines := func() []string {
+		lines := make([]string, r.Intn(30))
+		for i := range lines {
+			lines[i] = string(rune('a'+r.Intn(4))) + "\n"
+		}
+		return lines
+	}
+
+	for i := 0; i < 500; i++ {
+		a, b := randomLines(), randomLines()
+		ops := lineOps(a, b)
+
+		var oldLines, newLines []string
+		edits := 0
+		for _, o := range ops {
+			if o.kind != opInsert {
+				oldLines = append(oldLines, o.line)
+			}
+			if o.kind != opDelete {
+				newLines = append(newLines, o.line)
+			}
+			if o.kind != opEqual {
+				edits++
+			}
+		}
+		if strings.Join(oldLines, "") != strings.Join(a, "") || strings.Join(newLines, "") != strings.Join(b, "") {
+			t.Fatalf("Edit script of %q -> %q is wrong: %v", a, b, ops)
+		}
+
+		// lcs[i][j] is the length of the longest common subsequence of a[i:]
+		// and b[j:]
+		lcs := make([][]int, len(a)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(b)+1)
+		}
+		for i := len(a) - 1; i >= 0; i-- {
+			for j := len(b) - 1; j >= 0; j-- {
+				if a[i] == b[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else {
+					lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+				}
+			}
+		}
+		if expected := len(a) + len(b) - 2*lcs[0][0]; edits != expected {
+			t.Fatalf("Expected %d edits for %q -> %q, got %d", expected, a, b, edits)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+; Functions and methods, qualified by their receiver type
+
+(function_declaration name: (identifier) @name) @definition.function
+
+(method_declaration
+  receiver: (parameter_list
+    (parameter_declaration
+      type: [
+        (type_identifier) @receiver
+        (pointer_type (type_identifier) @receiver)
+        (generic_type type: (type_identifier) @receiver)
+        (pointer_type (generic_type type: (type_identifier) @receiver))
+      ]))
+  name: (field_identifier) @name) @definition.method
+
+; Types, and the fields and methods of structs and interfaces, qualified by
+; their type
+
+(type_spec name: (type_identifier) @name type: (struct_type)) @definition.struct
+(type_spec name: (type_identifier) @name type: (interface_type)) @definition.interface
+(type_spec name: (type_identifier) @name) @definition.type
+(type_alias name: (type_identifier) @name) @definition.type
+
+(type_spec
+  name: (type_identifier) @struct
+  type: (struct_type
+    (field_declaration_list
+      (field_declaration name: (field_identifier) @name) @definition.field)))
+
+(type_spec
+  name: (type_identifier) @struct
+  type: (struct_type
+    (field_declaration_list
+      (field_declaration
+        !name
+        type: [
+          (type_identifier) @name
+          (pointer_type (type_identifier) @name)
+          (qualified_type name: (type_identifier) @name)
+          (pointer_type (qualified_type name: (type_identifier) @name))
+        ]) @definition.field)))
+
+(type_spec
+  name: (type_identifier) @interface
+  type: (interface_type (method_spec name: (field_identifier) @name) @definition.method))
+
+; Package constants and variables
+
+(source_file (const_declaration (const_spec name: (identifier) @name) @definition.constant))
+(source_file (var_declaration (var_spec name: (identifier) @name) @definition.variable))
@@ -0,0 +1,21 @@
+; Classes and their members, qualified by the class
+
+(class_definition name: (identifier) @name) @definition.class
+
+(class_definition
+  name: (identifier) @class
+  body: (block
+    [(function_definition name: (identifier) @name) @definition.method
+     (decorated_definition definition: (function_definition name: (identifier) @name)) @definition.method]))
+
+(class_definition
+  name: (identifier) @class
+  body: (block (expression_statement (assignment left: (identifier) @name)) @definition.field))
+
+; Module functions and variables
+
+(module
+  [(function_definition name: (identifier) @name) @definition.function
+   (decorated_definition definition: (function_definition name: (identifier) @name)) @definition.function])
+
+(module (expression_statement (assignment left: (identifier) @name)) @definition.variable)
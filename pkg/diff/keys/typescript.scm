@@ -0,0 +1,34 @@
+; Functions
+
+(function_declaration name: (identifier) @name) @definition.function
+(generator_function_declaration name: (identifier) @name) @definition.function
+(function_signature name: (identifier) @name) @definition.function
+
+; Classes and their members, qualified by the class
+
+(class_declaration name: (type_identifier) @name) @definition.class
+(abstract_class_declaration name: (type_identifier) @name) @definition.class
+
+([(class_declaration name: (type_identifier) @class body: (class_body (method_definition name: (property_identifier) @name) @definition.method))
+  (abstract_class_declaration name: (type_identifier) @class body: (class_body (method_definition name: (property_identifier) @name) @definition.method))
+  (abstract_class_declaration name: (type_identifier) @class body: (class_body (abstract_method_signature name: (property_identifier) @name) @definition.method))])
+
+([(class_declaration name: (type_identifier) @class body: (class_body (public_field_definition name: (property_identifier) @name) @definition.field))
+  (abstract_class_declaration name: (type_identifier) @class body: (class_body (public_field_definition name: (property_identifier) @name) @definition.field))])
+
+; Types, and the members of interfaces, qualified by the interface
+
+(interface_declaration name: (type_identifier) @name) @definition.interface
+(type_alias_declaration name: (type_identifier) @name) @definition.type
+(enum_declaration name: (identifier) @name) @definition.enum
+
+(interface_declaration
+  name: (type_identifier) @interface
+  body: (object_type
+    [(property_signature name: (property_identifier) @name) @definition.property
+     (method_signature name: (property_identifier) @name) @definition.method]))
+
+; Module variables
+
+(program (lexical_declaration (variable_declarator name: (identifier) @name) @definition.variable))
+(program (export_statement (lexical_declaration (variable_declarator name: (identifier) @name) @definition.variable)))
@@ -0,0 +1,408 @@
+package diff
+
+import (
+	"embed"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	tree_sitter "github.com/go-go-golems/oak/pkg/tree-sitter"
+	"github.com/go-go-golems/oak/pkg/tree-sitter/dump"
+	"github.com/pkg/errors"
+	sitter "github.com/smacker/go-tree-sitter"
+)
+
+// Key queries find the items compared by a structural diff. They follow the
+// tags.scm convention: each pattern captures an item, such as a function or
+// a struct field, as @definition.<kind>, and its name as @name. The key of
+// an item is the text of all its other captures in source order, joined
+// with dots, so that @receiver and @name make "Server.Start" for a method.
+
+//go:embed keys/*.scm
+var keysFS embed.FS
+
+var keyQueries = tree_sitter.NewQueryRegistry(keysFS, "keys")
+
+// KeyQuery returns the key query of a language, falling back to its tags
+// query, whose definitions are keyed by name only.
+func KeyQuery(languageName string) (string, bool) {
+	if q, ok := keyQueries.Query(languageName); ok {
+		return q, true
+	}
+	return tree_sitter.TagsQuery(languageName)
+}
+
+// RegisterKeyQuery sets the key query of a language, replacing the one
+// shipped with oak if there is one.
+func RegisterKeyQuery(languageName string, query string) {
+	keyQueries.Register(languageName, query)
+}
+
+// Kinds of changes.
+const (
+	ChangeAdded    = "added"
+	ChangeRemoved  = "removed"
+	ChangeModified = "modified"
+	ChangeMoved    = "moved"
+)
+
+// Item is a named node of a file found by a key query.
+type Item struct {
+	// Key identifies the item across versions, such as "Server.Start"
+	Key string `json:"key"`
+	// Kind is the suffix of the definition capture, such as "method"
+	Kind string `json:"kind"`
+	// Parent is the key of the innermost item containing this one, or ""
+	Parent string `json:"parent,omitempty"`
+	Text   string `json:"-"`
+
+	StartByte  uint32       `json:"startByte"`
+	EndByte    uint32       `json:"endByte"`
+	StartPoint sitter.Point `json:"startPoint"`
+	EndPoint   sitter.Point `json:"endPoint"`
+
+	node *sitter.Node
+	// tokens are the leaves of the item that aren't part of a nested item
+	tokens []string
+	// patternIndex is the pattern of the key query that matched the item
+	patternIndex uint16
+}
+
+// Lisp returns the syntax tree of the item as an S-expression of its named
+// nodes, one node per line, which doesn't depend on the formatting of the
+// source.
+func (i *Item) Lisp(source []byte) string {
+	if i.node == nil {
+		return ""
+	}
+	var sb strings.Builder
+	expr := tree_sitter.NodeToLispExpression(i.node, source, false)
+	_ = dump.DumpLispExpression(expr, &sb, dump.LispOptions{Indent: "  "})
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+type itemRange struct {
+	startByte uint32
+	endByte   uint32
+	key       string
+}
+
+// Items returns the items of tree found by keyQuery, in the order of the
+// file. An item matched by several patterns is only kept once, for the
+// first pattern, and items with the same key are numbered from the second
+// one on, as in "init#2".
+func Items(lang *sitter.Language, tree *sitter.Tree, source []byte, keyQuery string) ([]*Item, error) {
+	results, err := tree_sitter.ExecuteQueries(lang, tree.RootNode(),
+		[]tree_sitter.SitterQuery{{Name: "keys", Query: keyQuery}}, source)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not run the key query")
+	}
+
+	byRange := map[itemRange]*Item{}
+	for _, m := range results["keys"].Matches {
+		var definition *tree_sitter.Capture
+		parts := []tree_sitter.Capture{}
+		isReference := false
+		for name, c := range m {
+			switch role, _, _ := strings.Cut(name, "."); role {
+			case tree_sitter.TagDefinitionCapture:
+				definition = &c
+			case tree_sitter.TagReferenceCapture:
+				isReference = true
+			default:
+				parts = append(parts, c)
+			}
+		}
+		if definition == nil || isReference || len(parts) == 0 {
+			continue
+		}
+		sort.Slice(parts, func(i, j int) bool {
+			return parts[i].StartByte < parts[j].StartByte
+		})
+		texts := make([]string, 0, len(parts))
+		for _, p := range parts {
+			texts = append(texts, p.Text)
+		}
+
+		item := &Item{
+			Key:          strings.Join(texts, "."),
+			Kind:         strings.TrimPrefix(strings.TrimPrefix(definition.Name, tree_sitter.TagDefinitionCapture), "."),
+			Text:         definition.Text,
+			StartByte:    definition.StartByte,
+			EndByte:      definition.EndByte,
+			StartPoint:   definition.StartPoint,
+			EndPoint:     definition.EndPoint,
+			node:         findNode(tree.RootNode(), definition),
+			patternIndex: definition.PatternIndex,
+		}
+		r := itemRange{item.StartByte, item.EndByte, item.Key}
+		if previous, ok := byRange[r]; ok && previous.patternIndex <= item.patternIndex {
+			continue
+		}
+		byRange[r] = item
+	}
+
+	items := make([]*Item, 0, len(byRange))
+	for _, item := range byRange {
+		items = append(items, item)
+	}
+	// outer items first
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].StartByte != items[j].StartByte {
+			return items[i].StartByte < items[j].StartByte
+		}
+		if items[i].EndByte != items[j].EndByte {
+			return items[i].EndByte > items[j].EndByte
+		}
+		return items[i].Key < items[j].Key
+	})
+
+	seen := map[string]int{}
+	for _, item := range items {
+		seen[item.Key]++
+		if n := seen[item.Key]; n > 1 {
+			item.Key = fmt.Sprintf("%s#%d", item.Key, n)
+		}
+	}
+
+	nested := map[nodeKey]bool{}
+	stack := []*Item{}
+	for _, item := range items {
+		for len(stack) > 0 && stack[len(stack)-1].EndByte <= item.StartByte {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) > 0 {
+			item.Parent = stack[len(stack)-1].Key
+			if item.node != nil {
+				nested[keyOf(item.node)] = true
+			}
+		}
+		stack = append(stack, item)
+	}
+	for _, item := range items {
+		item.tokens = tokens(item.node, source, nested)
+	}
+
+	return items, nil
+}
+
+// findNode returns the node captured as c.
+func findNode(root *sitter.Node, c *tree_sitter.Capture) *sitter.Node {
+	n := root.NamedDescendantForPointRange(c.StartPoint, c.EndPoint)
+	for n != nil && n.Type() != c.Type {
+		parent := n.Parent()
+		if parent == nil || parent.StartByte() != c.StartByte || parent.EndByte() != c.EndByte {
+			return nil
+		}
+		n = parent
+	}
+	return n
+}
+
+type nodeKey struct {
+	startByte uint32
+	endByte   uint32
+	type_     string
+}
+
+func keyOf(n *sitter.Node) nodeKey {
+	return nodeKey{n.StartByte(), n.EndByte(), n.Type()}
+}
+
+// tokens returns the type and text of the leaves of n, skipping the nested
+// nodes other than n and whitespace.
+func tokens(n *sitter.Node, source []byte, nested map[nodeKey]bool) []string {
+	ret := []string{}
+	if n == nil {
+		return ret
+	}
+	var visit func(n *sitter.Node, root bool)
+	visit = func(n *sitter.Node, root bool) {
+		if !root && nested[keyOf(n)] {
+			return
+		}
+		if n.ChildCount() == 0 {
+			// some grammars have whitespace tokens, such as the newlines
+			// terminating Go statements
+			if content := n.Content(source); strings.TrimSpace(content) != "" {
+				ret = append(ret, n.Type()+"\x00"+content)
+			}
+			return
+		}
+		for i := 0; i < int(n.ChildCount()); i++ {
+			visit(n.Child(i), false)
+		}
+	}
+	visit(n, true)
+	return ret
+}
+
+// Change is a difference between the items of two versions of a file.
+type Change struct {
+	// Type is ChangeAdded, ChangeRemoved, ChangeModified or ChangeMoved
+	Type string `json:"type"`
+	Key  string `json:"key"`
+	Kind string `json:"kind"`
+	// Moved is true for moved items, including the modified ones
+	Moved bool `json:"moved,omitempty"`
+	// Old is nil for added items, New for removed items
+	Old *Item `json:"old,omitempty"`
+	New *Item `json:"new,omitempty"`
+}
+
+// Structural returns the changes between the items of two versions of a
+// file, matched by key: removed items in the order of the old version, then
+// added, modified and moved items in the order of the new one.
+//
+// An item is modified when its tokens change, ignoring whitespace and the
+// items nested in it, so that reformatting a file or modifying a method
+// doesn't modify its class. An item is moved when its order among the items
+// of the same parent changes.
+func Structural(oldItems []*Item, newItems []*Item) []Change {
+	oldByKey := map[string]*Item{}
+	for _, item := range oldItems {
+		oldByKey[item.Key] = item
+	}
+	newByKey := map[string]*Item{}
+	for _, item := range newItems {
+		newByKey[item.Key] = item
+	}
+
+	moved := movedKeys(oldItems, newByKey)
+
+	ret := []Change{}
+	for _, item := range oldItems {
+		if _, ok := newByKey[item.Key]; !ok {
+			ret = append(ret, Change{Type: ChangeRemoved, Key: item.Key, Kind: item.Kind, Old: item})
+		}
+	}
+	for _, item := range newItems {
+		old, ok := oldByKey[item.Key]
+		if !ok {
+			ret = append(ret, Change{Type: ChangeAdded, Key: item.Key, Kind: item.Kind, New: item})
+			continue
+		}
+		c := Change{Key: item.Key, Kind: item.Kind, Moved: moved[item.Key], Old: old, New: item}
+		switch {
+		case old.Kind != item.Kind || !equalTokens(old.tokens, item.tokens):
+			c.Type = ChangeModified
+		case c.Moved:
+			c.Type = ChangeMoved
+		default:
+			continue
+		}
+		ret = append(ret, c)
+	}
+	return ret
+}
+
+func equalTokens(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// movedKeys returns the keys of the items present in both versions whose
+// order changed among the items of the same parent. The items that keep
+// their order are the heaviest increasing subsequence of their positions in
+// the new version, weighted by size, so that moving a small function above
+// a large struct moves the function rather than the struct.
+func movedKeys(oldItems []*Item, newByKey map[string]*Item) map[string]bool {
+	siblings := map[string][]*Item{}
+	parents := []string{}
+	for _, item := range oldItems {
+		n, ok := newByKey[item.Key]
+		if !ok || n.Parent != item.Parent {
+			continue
+		}
+		if _, ok := siblings[item.Parent]; !ok {
+			parents = append(parents, item.Parent)
+		}
+		siblings[item.Parent] = append(siblings[item.Parent], item)
+	}
+
+	ret := map[string]bool{}
+	for _, parent := range parents {
+		items := siblings[parent]
+		positions := make([]uint32, len(items))
+		weights := make([]uint32, len(items))
+		for i, item := range items {
+			positions[i] = newByKey[item.Key].StartByte
+			weights[i] = item.EndByte - item.StartByte + 1
+		}
+		kept := heaviestIncreasingSubsequence(positions, weights)
+		for i, item := range items {
+			if !kept[i] {
+				ret[item.Key] = true
+			}
+		}
+	}
+	return ret
+}
+
+// heaviestIncreasingSubsequence returns the indices of the increasing
+// subsequence of values with the largest sum of weights.
+func heaviestIncreasingSubsequence(values []uint32, weights []uint32) map[int]bool {
+	best := make([]uint64, len(values))
+	previous := make([]int, len(values))
+	last := -1
+	for i := range values {
+		best[i] = uint64(weights[i])
+		previous[i] = -1
+		for j := 0; j < i; j++ {
+			if values[j] < values[i] && best[j]+uint64(weights[i]) > best[i] {
+				best[i] = best[j] + uint64(weights[i])
+				previous[i] = j
+			}
+		}
+		if last == -1 || best[i] > best[last] {
+			last = i
+		}
+	}
+
+	ret := map[int]bool{}
+	for i := last; i >= 0; i = previous[i] {
+		ret[i] = true
+	}
+	return ret
+}
+
+// WriteSummary writes changes as one line per item, prefixed with "+" for
+// added items, "-" for removed ones, "~" for modified ones and ">" for moved
+// ones, followed by the count of each type of change. Lines are 1-based, as
+// in old.go:12.
+func WriteSummary(w io.Writer, oldName string, newName string, changes []Change) error {
+	var sb strings.Builder
+	counts := map[string]int{}
+	for _, c := range changes {
+		counts[c.Type]++
+		switch c.Type {
+		case ChangeAdded:
+			fmt.Fprintf(&sb, "+ %s %s (%s:%d)\n", c.Kind, c.Key, newName, c.New.StartPoint.Row+1)
+		case ChangeRemoved:
+			fmt.Fprintf(&sb, "- %s %s (%s:%d)\n", c.Kind, c.Key, oldName, c.Old.StartPoint.Row+1)
+		case ChangeModified:
+			moved := ""
+			if c.Moved {
+				moved = ", moved"
+			}
+			fmt.Fprintf(&sb, "~ %s %s (%s:%d%s)\n", c.Kind, c.Key, newName, c.New.StartPoint.Row+1, moved)
+		case ChangeMoved:
+			fmt.Fprintf(&sb, "> %s %s (%s:%d -> %s:%d)\n", c.Kind, c.Key,
+				oldName, c.Old.StartPoint.Row+1, newName, c.New.StartPoint.Row+1)
+		}
+	}
+	fmt.Fprintf(&sb, "%d added, %d removed, %d modified, %d moved\n",
+		counts[ChangeAdded], counts[ChangeRemoved], counts[ChangeModified], counts[ChangeMoved])
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
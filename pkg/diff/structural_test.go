@@ -0,0 +1,171 @@
+package diff
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/go-go-golems/oak/internal/testutil"
+	sitter "github.com/smacker/go-tree-sitter"
+	"github.com/smacker/go-tree-sitter/golang"
+	"github.com/smacker/go-tree-sitter/python"
+)
+
+func parseItems(t *testing.T, lang *sitter.Language, languageName string, source string) []*Item {
+	parser := sitter.NewParser()
+	parser.SetLanguage(lang)
+	tree, err := parser.ParseCtx(context.Background(), nil, []byte(source))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	keyQuery, ok := KeyQuery(languageName)
+	if !ok {
+		t.Fatalf("Expected a key query for %s", languageName)
+	}
+	items, err := Items(lang, tree, []byte(source), keyQuery)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return items
+}
+
+func changesOf(changes []Change) []string {
+	ret := []string{}
+	for _, c := range changes {
+		s := fmt.Sprintf("%s %s %s", c.Type, c.Kind, c.Key)
+		if c.Moved && c.Type != ChangeMoved {
+			s += " (moved)"
+		}
+		ret = append(ret, s)
+	}
+	return ret
+}
+
+const oldGo = `package server
+
+type Server struct {
+	addr string
+	port int
+}
+
+func (s *Server) Start() error {
+	return nil
+}
+
+func (s *Server) Stop() {}
+
+func helper() int { return 1 }
+
+func init() {}
+
+func init() {}
+`
+
+func TestGoItems(t *testing.T) {
+	items := parseItems(t, golang.GetLanguage(), "go", oldGo)
+	actual := []string{}
+	for _, item := range items {
+		actual = append(actual, item.Kind+" "+item.Key+" "+item.Parent)
+	}
+	expected := []string{
+		"struct Server ",
+		"field Server.addr Server",
+		"field Server.port Server",
+		"method Server.Start ",
+		"method Server.Stop ",
+		"function helper ",
+		"function init ",
+		"function init#2 ",
+	}
+	testutil.AssertLines(t, "items", expected, actual)
+}
+
+func TestStructuralGo(t *testing.T) {
+	oldItems := parseItems(t, golang.GetLanguage(), "go", oldGo)
+
+	// reformatting doesn't change anything
+	reformatted := strings.ReplaceAll(strings.ReplaceAll(oldGo, "\t", "    "), "{}", "{\n}")
+	testutil.AssertLines(t, "changes", []string{},
+		changesOf(Structural(oldItems, parseItems(t, golang.GetLanguage(), "go", reformatted))))
+
+	newItems := parseItems(t, golang.GetLanguage(), "go", `package server
+
+func helper() int { return 1 }
+
+type Server struct {
+	addr    string
+	port    int
+	timeout int
+}
+
+func (s *Server) Start() error {
+	return s.listen()
+}
+
+func (s *Server) listen() error { return nil }
+
+func init() {}
+
+func init() {}
+`)
+	testutil.AssertLines(t, "changes", []string{
+		"removed method Server.Stop",
+		"moved function helper",
+		"added field Server.timeout",
+		"modified method Server.Start",
+		"added method Server.listen",
+	}, changesOf(Structural(oldItems, newItems)))
+}
+
+func TestStructuralPython(t *testing.T) {
+	oldItems := parseItems(t, python.GetLanguage(), "python", `
+class Shape:
+    sides = 0
+
+    def area(self):
+        return 0
+
+    @property
+    def name(self):
+        return "shape"
+
+def make():
+    return Shape()
+`)
+	newItems := parseItems(t, python.GetLanguage(), "python", `
+def make():
+    return Shape()
+
+class Shape:
+    sides = 4
+
+    @property
+    def name(self):
+        return "shape"
+
+    def area(self):
+        return 1
+`)
+	testutil.AssertLines(t, "changes", []string{
+		"moved function make",
+		"modified field Shape.sides",
+		"modified method Shape.area (moved)",
+	}, changesOf(Structural(oldItems, newItems)))
+}
+
+func TestHeaviestIncreasingSubsequence(t *testing.T) {
+	kept := heaviestIncreasingSubsequence([]uint32{0, 4, 1, 2, 3}, []uint32{1, 1, 1, 1, 1})
+	for i, expected := range []bool{true, false, true, true, true} {
+		if kept[i] != expected {
+			t.Errorf("Expected %d to be kept: %v, got %v", i, expected, kept)
+		}
+	}
+
+	kept = heaviestIncreasingSubsequence([]uint32{0, 4, 1, 2, 3}, []uint32{1, 10, 1, 1, 1})
+	for i, expected := range []bool{true, true, false, false, false} {
+		if kept[i] != expected {
+			t.Errorf("Expected %d to be kept: %v, got %v", i, expected, kept)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+// Package git lists and reads the files of a git repository through the git
+// plumbing commands, so that oak can run on the files changed since a
+// revision, on the staged files, or on the files of a revision without
+// checking it out.
+//
+// Paths passed to and returned by a Repository are relative to the
+// top-level directory of the repository, with slashes.
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Index is the revision of the files of the index, such as the staged
+// files, for ReadFile.
+const Index = ""
+
+// Repository is a git repository.
+type Repository struct {
+	dir string
+	// prefix is the directory passed to Open, relative to dir
+	prefix string
+
+	mutex sync.Mutex
+	// catFile reads objects for ReadFile, started with the first call
+	catFile *catFile
+}
+
+// Open returns the repository containing dir.
+func Open(ctx context.Context, dir string) (*Repository, error) {
+	r := &Repository{dir: dir}
+	out, err := r.run(ctx, "rev-parse", "--show-toplevel", "--show-prefix")
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.SplitN(string(out), "\n", 3)
+	if len(lines) < 2 {
+		return nil, errors.Errorf("unexpected git rev-parse output %q", out)
+	}
+	r.dir = lines[0]
+	r.prefix = strings.TrimSuffix(lines[1], "/")
+	return r, nil
+}
+
+// Dir returns the top-level directory of the repository.
+func (r *Repository) Dir() string {
+	return r.dir
+}
+
+// Prefix returns the directory the repository was opened from, relative to
+// the top-level directory, or "" if it is the top-level directory.
+func (r *Repository) Prefix() string {
+	return r.prefix
+}
+
+// Close stops the git process reading the files of the repository, if any.
+func (r *Repository) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.catFile == nil {
+		return nil
+	}
+	err := r.catFile.close()
+	r.catFile = nil
+	return err
+}
+
+func (r *Repository) run(ctx context.Context, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", r.dir}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			message = err.Error()
+		}
+		return nil, errors.Errorf("git %s: %s", strings.Join(args, " "), message)
+	}
+	return out, nil
+}
+
+// paths splits the NUL separated paths output by git with -z.
+func paths(out []byte) []string {
+	ret := []string{}
+	for _, p := range strings.Split(string(out), "\x00") {
+		if p != "" {
+			ret = append(ret, p)
+		}
+	}
+	return ret
+}
+
+// ResolveRevision returns the hash of the commit rev, such as "HEAD~1" or
+// "v1.0.0".
+func (r *Repository) ResolveRevision(ctx context.Context, rev string) (string, error) {
+	out, err := r.run(ctx, "rev-parse", "--verify", "--end-of-options", rev+"^{commit}")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// Files returns the files of the commit rev.
+func (r *Repository) Files(ctx context.Context, rev string) ([]string, error) {
+	out, err := r.run(ctx, "ls-tree", "-r", "-z", "--name-only", "--full-tree", rev)
+	if err != nil {
+		return nil, err
+	}
+	return paths(out), nil
+}
+
+// ChangedFiles returns the files added, copied, modified or renamed since
+// the branch point of the revision base, as for the files of a pull request
+// against base. Changes are those of the working tree if rev is empty, and
+// those of the commit rev otherwise.
+func (r *Repository) ChangedFiles(ctx context.Context, base string, rev string) ([]string, error) {
+	head := rev
+	if head == "" {
+		head = "HEAD"
+	}
+	out, err := r.run(ctx, "merge-base", base, head)
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"diff", "--name-only", "-z", "--no-renames", "--diff-filter=ACMR", strings.TrimSpace(string(out))}
+	if rev != "" {
+		args = append(args, rev)
+	}
+	out, err = r.run(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	return paths(out), nil
+}
+
+// StagedFiles returns the files added, copied, modified or renamed in the
+// index, relative to HEAD.
+func (r *Repository) StagedFiles(ctx context.Context) ([]string, error) {
+	out, err := r.run(ctx, "diff", "--cached", "--name-only", "-z", "--no-renames", "--diff-filter=ACMR")
+	if err != nil {
+		return nil, err
+	}
+	return paths(out), nil
+}
+
+// ReadFile returns the content of the file p in the commit rev, or in the
+// index if rev is Index. Files are read through a single git process, which
+// is kept until Close.
+func (r *Repository) ReadFile(ctx context.Context, rev string, p string) ([]byte, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.catFile == nil {
+		c, err := newCatFile(r.dir)
+		if err != nil {
+			return nil, err
+		}
+		r.catFile = c
+	}
+	content, err := r.catFile.read(rev + ":" + p)
+	if err != nil {
+		// the process is unusable after an I/O error
+		_ = r.catFile.close()
+		r.catFile = nil
+		return nil, err
+	}
+	if content == nil {
+		if rev == Index {
+			return nil, errors.Errorf("%s is not in the index", p)
+		}
+		return nil, errors.Errorf("%s does not exist in %s", p, rev)
+	}
+	return content, nil
+}
+
+// catFile is a "git cat-file --batch" process, which outputs the objects
+// named on its input.
+type catFile struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+}
+
+func newCatFile(dir string) (*catFile, error) {
+	cmd := exec.Command("git", "-C", dir, "cat-file", "--batch")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not start git cat-file")
+	}
+	return &catFile{cmd: cmd, stdin: stdin, stdout: bufio.NewReader(stdout)}, nil
+}
+
+// read returns the content of the blob named object, or nil if it doesn't
+// exist.
+func (c *catFile) read(object string) ([]byte, error) {
+	if strings.ContainsAny(object, "\n") {
+		return nil, errors.Errorf("invalid object name %q", object)
+	}
+	_, err := io.WriteString(c.stdin, object+"\n")
+	if err != nil {
+		return nil, errors.Wrap(err, "could not write to git cat-file")
+	}
+
+	// <oid> SP <type> SP <size> LF <contents> LF, or <object> SP missing LF
+	header, err := c.stdout.ReadString('\n')
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read from git cat-file")
+	}
+	fields := strings.Fields(header)
+	if len(fields) == 2 && (fields[1] == "missing" || fields[1] == "ambiguous") {
+		return nil, nil
+	}
+	if len(fields) != 3 {
+		return nil, errors.Errorf("unexpected git cat-file output %q", header)
+	}
+	size, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return nil, errors.Errorf("unexpected git cat-file output %q", header)
+	}
+	content := make([]byte, size+1)
+	_, err = io.ReadFull(c.stdout, content)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read from git cat-file")
+	}
+	if fields[1] != "blob" {
+		return nil, errors.Errorf("%s is a %s, not a file", object, fields[1])
+	}
+	return content[:size], nil
+}
+
+func (c *catFile) close() error {
+	_ = c.stdin.Close()
+	return c.cmd.Wait()
+}
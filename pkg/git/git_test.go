@@ -0,0 +1,131 @@
+package git
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-go-golems/oak/internal/testutil"
+)
+
+func gitCommand(t *testing.T, dir string, args ...string) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=oak", "GIT_AUTHOR_EMAIL=oak@example.com",
+		"GIT_COMMITTER_NAME=oak", "GIT_COMMITTER_EMAIL=oak@example.com",
+		"GIT_CONFIG_GLOBAL=/dev/null", "GIT_CONFIG_SYSTEM=/dev/null",
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+}
+
+// newRepository creates a repository with a commit on main adding a.go and
+// sub/b.go, and a branch feature modifying sub/b.go and adding c.go.
+func newRepository(t *testing.T) string {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	gitCommand(t, dir, "init", "-q", "-b", "main")
+	testutil.WriteFiles(t, dir, map[string]string{
+		"a.go":     "package a\n",
+		"sub/b.go": "package sub\n",
+	})
+	gitCommand(t, dir, "add", ".")
+	gitCommand(t, dir, "commit", "-q", "-m", "first")
+	gitCommand(t, dir, "checkout", "-q", "-b", "feature")
+	testutil.WriteFiles(t, dir, map[string]string{
+		"sub/b.go": "package sub\n\nfunc B() {}\n",
+		"c.go":     "package c\n",
+	})
+	gitCommand(t, dir, "add", ".")
+	gitCommand(t, dir, "commit", "-q", "-m", "second")
+	return dir
+}
+
+func TestRepository(t *testing.T) {
+	ctx := context.Background()
+	dir := newRepository(t)
+
+	r, err := Open(ctx, filepath.Join(dir, "sub"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+	if r.Prefix() != "sub" {
+		t.Errorf("Expected prefix sub, got %q", r.Prefix())
+	}
+
+	files, err := r.Files(ctx, "main")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	testutil.AssertLines(t, "paths", []string{"a.go", "sub/b.go"}, files)
+
+	files, err = r.ChangedFiles(ctx, "main", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	testutil.AssertLines(t, "paths", []string{"c.go", "sub/b.go"}, files)
+
+	// uncommitted changes only count without a revision
+	testutil.WriteFiles(t, dir, map[string]string{"a.go": "package a\n\nfunc A() {}\n"})
+	files, err = r.ChangedFiles(ctx, "main", "HEAD")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	testutil.AssertLines(t, "paths", []string{"c.go", "sub/b.go"}, files)
+	files, err = r.ChangedFiles(ctx, "main", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	testutil.AssertLines(t, "paths", []string{"a.go", "c.go", "sub/b.go"}, files)
+
+	files, err = r.StagedFiles(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	testutil.AssertLines(t, "paths", []string{}, files)
+	gitCommand(t, dir, "add", "a.go")
+	testutil.WriteFiles(t, dir, map[string]string{"a.go": "package a\n\nfunc A2() {}\n"})
+	files, err = r.StagedFiles(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	testutil.AssertLines(t, "paths", []string{"a.go"}, files)
+
+	for _, test := range []struct {
+		rev      string
+		path     string
+		expected string
+	}{
+		{"main", "sub/b.go", "package sub\n"},
+		{"feature", "sub/b.go", "package sub\n\nfunc B() {}\n"},
+		{Index, "a.go", "package a\n\nfunc A() {}\n"},
+		{"HEAD", "a.go", "package a\n"},
+	} {
+		content, err := r.ReadFile(ctx, test.rev, test.path)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if string(content) != test.expected {
+			t.Errorf("Expected %s:%s to be %q, got %q", test.rev, test.path, test.expected, content)
+		}
+	}
+
+	_, err = r.ReadFile(ctx, "main", "c.go")
+	if err == nil {
+		t.Errorf("Expected an error for a file missing in the revision")
+	}
+	_, err = r.ResolveRevision(ctx, "unknown")
+	if err == nil {
+		t.Errorf("Expected an error for an unknown revision")
+	}
+}
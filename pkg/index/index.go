@@ -0,0 +1,489 @@
+// Package index maintains a persistent index of the definitions and
+// references of a repository, extracted with the tags queries of
+// tree_sitter.TagsQuery and stored in a bbolt database.
+package index
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-go-golems/oak/pkg"
+	tree_sitter "github.com/go-go-golems/oak/pkg/tree-sitter"
+	"github.com/pkg/errors"
+	sitter "github.com/smacker/go-tree-sitter"
+	bolt "go.etcd.io/bbolt"
+)
+
+// indexVersion is stored in the index, and has to be bumped when the format
+// of the stored data changes. Indexes of another version are rebuilt.
+const indexVersion = "1"
+
+var (
+	metaBucket    = []byte("meta")
+	filesBucket   = []byte("files")
+	symbolsBucket = []byte("symbols")
+
+	versionKey = []byte("version")
+)
+
+// DefaultPath is where oak stores the index of the current directory.
+var DefaultPath = filepath.Join(".oak", "index.db")
+
+// Role tells whether a symbol is a definition or a reference.
+type Role string
+
+const (
+	RoleDefinition Role = "definition"
+	RoleReference  Role = "reference"
+)
+
+// Symbol is a definition or a reference stored in the index.
+type Symbol struct {
+	Name string
+	// Kind is the kind of the tag, such as "function" or "call"
+	Kind     string
+	Role     Role
+	File     string
+	Language string
+
+	// StartByte to EndPoint are the range of the name of the symbol
+	StartByte  uint32
+	EndByte    uint32
+	StartPoint sitter.Point
+	EndPoint   sitter.Point
+
+	// NodeStartByte to NodeEndPoint are the range of the whole definition or
+	// reference, such as a function declaration or a call expression
+	NodeStartByte  uint32
+	NodeEndByte    uint32
+	NodeStartPoint sitter.Point
+	NodeEndPoint   sitter.Point
+}
+
+// fileEntry is stored for each indexed file.
+type fileEntry struct {
+	// Hash covers the source, the language and the tags query of the file,
+	// so that files are indexed again when the query changes
+	Hash     string
+	Language string
+	// Names are the names of the symbols of the file, to find its keys in the
+	// symbols bucket
+	Names []string
+}
+
+// Index is an index stored in a bbolt database. Only one process can open an
+// index at a time.
+type Index struct {
+	db *bolt.DB
+}
+
+// Open opens the index stored at path, creating it if needed. An index
+// written by another version of oak is emptied.
+func Open(path string) (*Index, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not create the directory of index %s", path)
+	}
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not open index %s", path)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists(metaBucket)
+		if err != nil {
+			return err
+		}
+		if string(meta.Get(versionKey)) != indexVersion {
+			for _, name := range [][]byte{filesBucket, symbolsBucket} {
+				if tx.Bucket(name) != nil {
+					err = tx.DeleteBucket(name)
+					if err != nil {
+						return err
+					}
+				}
+			}
+			err = meta.Put(versionKey, []byte(indexVersion))
+			if err != nil {
+				return err
+			}
+		}
+		for _, name := range [][]byte{filesBucket, symbolsBucket} {
+			_, err = tx.CreateBucketIfNotExists(name)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, errors.Wrapf(err, "could not initialize index %s", path)
+	}
+
+	return &Index{db: db}, nil
+}
+
+func (ix *Index) Close() error {
+	return ix.db.Close()
+}
+
+// BuildOption configures Build.
+type BuildOption func(*buildConfig)
+
+type buildConfig struct {
+	workers int
+}
+
+// WithWorkers sets the number of files parsed in parallel.
+func WithWorkers(workers int) BuildOption {
+	return func(bc *buildConfig) {
+		bc.workers = workers
+	}
+}
+
+// BuildStats summarizes what Build did.
+type BuildStats struct {
+	// Files is the number of files passed to Build
+	Files int
+	// Indexed files were new or had changed
+	Indexed int
+	// Unchanged files were already indexed with the same content
+	Unchanged int
+	// Skipped files have no tags query for their language, or could not be
+	// parsed
+	Skipped int
+	// Removed files were in the index but don't exist anymore
+	Removed int
+	// Symbols is the number of symbols of the indexed files
+	Symbols int
+}
+
+// Build indexes fileNames. Files that are already indexed with the same
+// content are skipped, and the files of the index that don't exist anymore
+// are removed from it. Files are stored under their name as given, so that
+// an index built with relative file names is only valid in the same
+// directory.
+func (ix *Index) Build(ctx context.Context, fileNames []string, options ...BuildOption) (*BuildStats, error) {
+	config := &buildConfig{workers: 1}
+	for _, option := range options {
+		option(config)
+	}
+
+	stats := &BuildStats{Files: len(fileNames)}
+
+	err := ix.db.Update(func(tx *bolt.Tx) error {
+		files := tx.Bucket(filesBucket)
+
+		// queries are shared by the jobs of a language, so that ProcessFiles
+		// only compiles them once
+		queries := map[string][]tree_sitter.SitterQuery{}
+		hashes := map[string]string{}
+		jobs := []tree_sitter.FileJob{}
+		for _, fileName := range fileNames {
+			fileName = filepath.Clean(fileName)
+			entry, err := getFileEntry(files, fileName)
+			if err != nil {
+				return err
+			}
+
+			source, err := os.ReadFile(fileName)
+			if err != nil {
+				return errors.Wrapf(err, "could not read file %s", fileName)
+			}
+			lang, query, ok := tagsQueryForFile(ctx, fileName, source)
+			if !ok {
+				stats.Skipped++
+				if entry != nil {
+					err = removeFile(tx, fileName, entry)
+					if err != nil {
+						return err
+					}
+				}
+				continue
+			}
+
+			hash := fileHash(lang.Name, query, source)
+			if entry != nil && entry.Hash == hash {
+				stats.Unchanged++
+				continue
+			}
+			hashes[fileName] = hash
+
+			if _, ok := queries[lang.Name]; !ok {
+				queries[lang.Name] = []tree_sitter.SitterQuery{{Name: "tags", Query: query}}
+			}
+			jobs = append(jobs, tree_sitter.FileJob{
+				FileName:     fileName,
+				LanguageName: lang.Name,
+				Language:     lang.Language,
+				Queries:      queries[lang.Name],
+			})
+		}
+
+		err := tree_sitter.ProcessFiles(ctx, jobs, config.workers,
+			func(result tree_sitter.FileResult) error {
+				entry, err := getFileEntry(files, result.FileName)
+				if err != nil {
+					return err
+				}
+				if entry != nil {
+					err = removeFile(tx, result.FileName, entry)
+					if err != nil {
+						return err
+					}
+				}
+				if result.Err != nil {
+					zlog.Warn().Err(result.Err).Str("file", result.FileName).Msg("could not index file")
+					stats.Skipped++
+					return nil
+				}
+
+				symbols := symbolsFromTags(result.FileName, result.LanguageName,
+					tree_sitter.Tags(result.Results["tags"].Matches))
+				err = putFile(tx, result.FileName, fileEntry{
+					Hash:     hashes[result.FileName],
+					Language: result.LanguageName,
+				}, symbols)
+				if err != nil {
+					return err
+				}
+				stats.Indexed++
+				stats.Symbols += len(symbols)
+				return nil
+			})
+		if err != nil {
+			return err
+		}
+
+		// remove the files that were deleted since they were indexed
+		deleted := map[string]*fileEntry{}
+		err = files.ForEach(func(k, v []byte) error {
+			if _, err := os.Stat(string(k)); !os.IsNotExist(err) {
+				return nil
+			}
+			entry := &fileEntry{}
+			err := json.Unmarshal(v, entry)
+			if err != nil {
+				return err
+			}
+			deleted[string(k)] = entry
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for fileName, entry := range deleted {
+			err = removeFile(tx, fileName, entry)
+			if err != nil {
+				return err
+			}
+			stats.Removed++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// tagsQueryForFile returns the language of a file and its tags query, or
+// false if the language is unknown or has no tags query.
+func tagsQueryForFile(ctx context.Context, fileName string, source []byte) (*pkg.RegisteredLanguage, string, bool) {
+	lang, err := pkg.DetectLanguage(ctx, fileName, source)
+	if err != nil {
+		zlog.Debug().Err(err).Str("file", fileName).Msg("skipping file of unknown language")
+		return nil, "", false
+	}
+	query, ok := tree_sitter.TagsQuery(lang.Name)
+	if !ok {
+		zlog.Debug().Str("file", fileName).Str("language", lang.Name).Msg("skipping file without tags query")
+		return nil, "", false
+	}
+	return lang, query, true
+}
+
+func fileHash(language string, query string, source []byte) string {
+	h := sha256.New()
+	_, _ = fmt.Fprintf(h, "%d:%s%d:%s", len(language), language, len(query), query)
+	_, _ = h.Write(source)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func symbolsFromTags(fileName string, language string, tags []tree_sitter.Tag) []Symbol {
+	ret := make([]Symbol, 0, len(tags))
+	for _, tag := range tags {
+		role := RoleReference
+		if tag.IsDefinition {
+			role = RoleDefinition
+		}
+		ret = append(ret, Symbol{
+			Name:     tag.Name,
+			Kind:     tag.Kind,
+			Role:     role,
+			File:     fileName,
+			Language: language,
+
+			StartByte:  tag.NameNode.StartByte,
+			EndByte:    tag.NameNode.EndByte,
+			StartPoint: tag.NameNode.StartPoint,
+			EndPoint:   tag.NameNode.EndPoint,
+
+			NodeStartByte:  tag.Node.StartByte,
+			NodeEndByte:    tag.Node.EndByte,
+			NodeStartPoint: tag.Node.StartPoint,
+			NodeEndPoint:   tag.Node.EndPoint,
+		})
+	}
+	return ret
+}
+
+// symbolKey is the key of a symbol in the symbols bucket. Keys start with the
+// name of the symbol, so that all the symbols of a name can be found with a
+// prefix scan, followed by the file, so that the symbols of a file can be
+// deleted knowing their names.
+func symbolKey(symbol Symbol) []byte {
+	key := symbolPrefix(symbol.Name, symbol.File)
+	return binary.BigEndian.AppendUint32(key, symbol.StartByte)
+}
+
+func symbolPrefix(name string, fileName string) []byte {
+	key := make([]byte, 0, len(name)+len(fileName)+6)
+	key = append(key, name...)
+	key = append(key, 0)
+	if fileName != "" {
+		key = append(key, fileName...)
+		key = append(key, 0)
+	}
+	return key
+}
+
+func getFileEntry(files *bolt.Bucket, fileName string) (*fileEntry, error) {
+	v := files.Get([]byte(fileName))
+	if v == nil {
+		return nil, nil
+	}
+	entry := &fileEntry{}
+	err := json.Unmarshal(v, entry)
+	if err != nil {
+		return nil, errors.Wrapf(err, "corrupt index entry for %s", fileName)
+	}
+	return entry, nil
+}
+
+func putFile(tx *bolt.Tx, fileName string, entry fileEntry, symbols []Symbol) error {
+	bucket := tx.Bucket(symbolsBucket)
+	names := map[string]bool{}
+	for _, symbol := range symbols {
+		v, err := json.Marshal(symbol)
+		if err != nil {
+			return err
+		}
+		err = bucket.Put(symbolKey(symbol), v)
+		if err != nil {
+			return err
+		}
+		if !names[symbol.Name] {
+			names[symbol.Name] = true
+			entry.Names = append(entry.Names, symbol.Name)
+		}
+	}
+
+	v, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(filesBucket).Put([]byte(fileName), v)
+}
+
+func removeFile(tx *bolt.Tx, fileName string, entry *fileEntry) error {
+	bucket := tx.Bucket(symbolsBucket)
+	for _, name := range entry.Names {
+		prefix := symbolPrefix(name, fileName)
+		c := bucket.Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			err := c.Delete()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Bucket(filesBucket).Delete([]byte(fileName))
+}
+
+// Find returns the symbols called name with the given role, or with any role
+// if role is empty, sorted by file and position.
+func (ix *Index) Find(name string, role Role) ([]Symbol, error) {
+	ret := []Symbol{}
+	err := ix.db.View(func(tx *bolt.Tx) error {
+		prefix := symbolPrefix(name, "")
+		c := tx.Bucket(symbolsBucket).Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			symbol := Symbol{}
+			err := json.Unmarshal(v, &symbol)
+			if err != nil {
+				return errors.Wrapf(err, "corrupt index entry for %s", name)
+			}
+			if role != "" && symbol.Role != role {
+				continue
+			}
+			ret = append(ret, symbol)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// FindDefinitions returns the definitions of name.
+func (ix *Index) FindDefinitions(name string) ([]Symbol, error) {
+	return ix.Find(name, RoleDefinition)
+}
+
+// FindReferences returns the references to name.
+func (ix *Index) FindReferences(name string) ([]Symbol, error) {
+	return ix.Find(name, RoleReference)
+}
+
+// Source returns the code of the whole definition or reference of symbol.
+// It is an error if the file changed since it was indexed.
+func (ix *Index) Source(symbol Symbol) (string, error) {
+	var entry *fileEntry
+	err := ix.db.View(func(tx *bolt.Tx) error {
+		var err error
+		entry, err = getFileEntry(tx.Bucket(filesBucket), symbol.File)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	if entry == nil {
+		return "", errors.Errorf("%s is not indexed", symbol.File)
+	}
+
+	source, err := os.ReadFile(symbol.File)
+	if err != nil {
+		return "", errors.Wrapf(err, "could not read file %s", symbol.File)
+	}
+	query, _ := tree_sitter.TagsQuery(entry.Language)
+	if fileHash(entry.Language, query, source) != entry.Hash {
+		return "", errors.Errorf("%s changed since it was indexed, run oak index build again", symbol.File)
+	}
+	if int(symbol.NodeEndByte) > len(source) {
+		return "", errors.Errorf("invalid range for %s in %s", symbol.Name, symbol.File)
+	}
+	return string(source[symbol.NodeStartByte:symbol.NodeEndByte]), nil
+}
@@ -0,0 +1,129 @@
+package index
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFile(t *testing.T, fileName string, content string) {
+	err := os.WriteFile(fileName, []byte(content), 0644)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func openIndex(t *testing.T, dir string) *Index {
+	ix, err := Open(filepath.Join(dir, ".oak", "index.db"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() { _ = ix.Close() })
+	return ix
+}
+
+func build(t *testing.T, ix *Index, fileNames ...string) *BuildStats {
+	stats, err := ix.Build(context.Background(), fileNames, WithWorkers(2))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return stats
+}
+
+func find(t *testing.T, ix *Index, name string, role Role) []Symbol {
+	symbols, err := ix.Find(name, role)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return symbols
+}
+
+func TestBuildAndFind(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.go")
+	b := filepath.Join(dir, "b.py")
+	readme := filepath.Join(dir, "README.md")
+	writeFile(t, a, "package main\n\nfunc helper() int {\n\treturn 1\n}\n\nfunc main() {\n\thelper()\n}\n")
+	writeFile(t, b, "def helper():\n    pass\n\nhelper()\n")
+	writeFile(t, readme, "# helper\n")
+
+	ix := openIndex(t, dir)
+	stats := build(t, ix, a, b, readme)
+	if stats.Indexed != 2 || stats.Skipped != 1 {
+		t.Errorf("Expected 2 indexed and 1 skipped file, got %+v", stats)
+	}
+
+	definitions := find(t, ix, "helper", RoleDefinition)
+	if len(definitions) != 2 {
+		t.Fatalf("Expected 2 definitions, got %v", definitions)
+	}
+	d := definitions[0]
+	if d.File != a || d.Language != "go" || d.Kind != "function" || d.StartPoint.Row != 2 {
+		t.Errorf("Unexpected definition %+v", d)
+	}
+	if definitions[1].File != b || definitions[1].Language != "python" {
+		t.Errorf("Unexpected definition %+v", definitions[1])
+	}
+
+	source, err := ix.Source(d)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if source != "func helper() int {\n\treturn 1\n}" {
+		t.Errorf("Unexpected source %q", source)
+	}
+
+	references := find(t, ix, "helper", RoleReference)
+	if len(references) != 2 || references[0].Kind != "call" || references[0].StartPoint.Row != 7 {
+		t.Errorf("Unexpected references %v", references)
+	}
+	if symbols := find(t, ix, "help", ""); len(symbols) != 0 {
+		t.Errorf("Expected no symbols for a prefix of a name, got %v", symbols)
+	}
+}
+
+func TestIncrementalBuild(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.go")
+	b := filepath.Join(dir, "b.go")
+	writeFile(t, a, "package main\n\nfunc old() {}\n")
+	writeFile(t, b, "package main\n\nfunc other() {}\n")
+
+	ix := openIndex(t, dir)
+	build(t, ix, a, b)
+
+	writeFile(t, a, "package main\n\nfunc renamed() {}\n")
+	stats := build(t, ix, a, b)
+	if stats.Indexed != 1 || stats.Unchanged != 1 {
+		t.Errorf("Expected only the changed file to be indexed, got %+v", stats)
+	}
+	if symbols := find(t, ix, "old", ""); len(symbols) != 0 {
+		t.Errorf("Expected the symbols of the old version to be removed, got %v", symbols)
+	}
+	if symbols := find(t, ix, "renamed", RoleDefinition); len(symbols) != 1 {
+		t.Errorf("Expected the new definition, got %v", symbols)
+	}
+
+	_, err := ix.Source(find(t, ix, "other", RoleDefinition)[0])
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	writeFile(t, b, "package main\n\n// moved\nfunc other() {}\n")
+	_, err = ix.Source(find(t, ix, "other", RoleDefinition)[0])
+	if err == nil {
+		t.Errorf("Expected an error for a file changed since it was indexed")
+	}
+
+	err = os.Remove(b)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	stats = build(t, ix, a)
+	if stats.Removed != 1 || stats.Unchanged != 1 {
+		t.Errorf("Expected the deleted file to be removed, got %+v", stats)
+	}
+	if symbols := find(t, ix, "other", ""); len(symbols) != 0 {
+		t.Errorf("Expected the symbols of the deleted file to be removed, got %v", symbols)
+	}
+}
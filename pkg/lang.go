@@ -1,8 +1,6 @@
 package pkg
 
 import (
-	"fmt"
-	"github.com/pkg/errors"
 	"github.com/smacker/go-tree-sitter"
 	"github.com/smacker/go-tree-sitter/bash"
 	"github.com/smacker/go-tree-sitter/c"
@@ -32,142 +30,100 @@ import (
 	"github.com/smacker/go-tree-sitter/typescript/tsx"
 	"github.com/smacker/go-tree-sitter/typescript/typescript"
 	"github.com/smacker/go-tree-sitter/yaml"
-	"path"
 )
 
-func LanguageNameToSitterLanguage(name string) (*sitter.Language, error) {
-	switch name {
-	case "bash":
-		return bash.GetLanguage(), nil
-	case "c":
-		return c.GetLanguage(), nil
-	case "cpp":
-		return cpp.GetLanguage(), nil
-	case "csharp":
-		return csharp.GetLanguage(), nil
-	case "css":
-		return css.GetLanguage(), nil
-	case "cue":
-		return cue.GetLanguage(), nil
-	case "dockerfile":
-		return dockerfile.GetLanguage(), nil
-	case "elixir":
-		return elixir.GetLanguage(), nil
-	case "elm":
-		return elm.GetLanguage(), nil
-	case "golang":
-		fallthrough
-	case "go":
-		return golang.GetLanguage(), nil
-	case "hcl":
-		return hcl.GetLanguage(), nil
-	case "html":
-		return html.GetLanguage(), nil
-	case "java":
-		return java.GetLanguage(), nil
-	case "javascript":
-		return javascript.GetLanguage(), nil
-	case "kotlin":
-		return kotlin.GetLanguage(), nil
-	//case "lua":
-	//	return lua.GetLanguage(), nil
-	case "ocaml":
-		return ocaml.GetLanguage(), nil
-	case "php":
-		return php.GetLanguage(), nil
-	case "protobuf":
-		return protobuf.GetLanguage(), nil
-	case "python":
-		return python.GetLanguage(), nil
-	case "ruby":
-		return ruby.GetLanguage(), nil
-	case "rust":
-		return rust.GetLanguage(), nil
-	case "scala":
-		return scala.GetLanguage(), nil
-	case "svelte":
-		return svelte.GetLanguage(), nil
-	case "toml":
-		return toml.GetLanguage(), nil
-	case "typescript":
-		return typescript.GetLanguage(), nil
-	case "tsx":
-		return tsx.GetLanguage(), nil
-	case "yaml":
-		return yaml.GetLanguage(), nil
-	default:
-		return nil, errors.Errorf("unsupported language name: %s", name)
+// DefaultLanguageRegistry holds the grammars shipped with oak. Embedders can
+// register their own grammars, aliases and globs in it.
+var DefaultLanguageRegistry = newDefaultLanguageRegistry()
+
+func newDefaultLanguageRegistry() *LanguageRegistry {
+	lr := NewLanguageRegistry()
+
+	languages := []struct {
+		name    string
+		aliases []string
+		globs   []string
+		lang    *sitter.Language
+	}{
+		{"bash", []string{"sh"}, []string{"*.sh", "*.bash"}, bash.GetLanguage()},
+		{"c", nil, []string{"*.c", "*.h"}, c.GetLanguage()},
+		{"cpp", []string{"c++"}, []string{"*.cpp", "*.h", "*.hpp"}, cpp.GetLanguage()},
+		{"csharp", []string{"c#", "cs"}, []string{"*.cs"}, csharp.GetLanguage()},
+		{"css", nil, []string{"*.css"}, css.GetLanguage()},
+		{"cue", nil, []string{"*.cue"}, cue.GetLanguage()},
+		{"dockerfile", nil, []string{"Dockerfile"}, dockerfile.GetLanguage()},
+		{"elixir", nil, []string{"*.ex"}, elixir.GetLanguage()},
+		{"elm", nil, []string{"*.elm"}, elm.GetLanguage()},
+		{"go", []string{"golang"}, []string{"*.go"}, golang.GetLanguage()},
+		{"hcl", nil, []string{"*.hcl", "*.tf"}, hcl.GetLanguage()},
+		{"html", nil, []string{"*.html"}, html.GetLanguage()},
+		{"java", nil, []string{"*.java"}, java.GetLanguage()},
+		{"javascript", []string{"js", "node", "javascriptreact"}, []string{"*.js", "*.jsx"}, javascript.GetLanguage()},
+		{"kotlin", nil, []string{"*.kt"}, kotlin.GetLanguage()},
+		//{"lua", nil, []string{"*.lua"}, lua.GetLanguage()},
+		{"ocaml", nil, []string{"*.ml", "*.mli"}, ocaml.GetLanguage()},
+		{"php", nil, []string{"*.php"}, php.GetLanguage()},
+		{"protobuf", nil, []string{"*.proto"}, protobuf.GetLanguage()},
+		{"python", nil, []string{"*.py"}, python.GetLanguage()},
+		{"ruby", nil, []string{"*.rb"}, ruby.GetLanguage()},
+		{"rust", nil, []string{"*.rs"}, rust.GetLanguage()},
+		{"scala", nil, []string{"*.scala"}, scala.GetLanguage()},
+		{"svelte", nil, []string{"*.svelte"}, svelte.GetLanguage()},
+		{"toml", nil, []string{"*.toml"}, toml.GetLanguage()},
+		// typescript comes before tsx, so that *.ts files are parsed as
+		// typescript unless a command only supports tsx
+		{"typescript", []string{"ts"}, []string{"*.ts"}, typescript.GetLanguage()},
+		{"tsx", []string{"typescriptreact"}, []string{"*.ts", "*.tsx"}, tsx.GetLanguage()},
+		{"yaml", nil, []string{"*.yml", "*.yaml"}, yaml.GetLanguage()},
+	}
+
+	for _, l := range languages {
+		err := lr.Register(l.name, l.aliases, l.globs, l.lang)
+		if err != nil {
+			panic(err)
+		}
 	}
+
+	// *.h files are parsed as cpp unless they parse with fewer syntax errors
+	// as c
+	err := lr.SetPriority("cpp", 1)
+	if err != nil {
+		panic(err)
+	}
+
+	return lr
 }
 
-var (
-	fileEndingToLanguageName = map[string][]string{
-		"*.sh":       {"bash"},
-		"*.c":        {"c"},
-		"*.cpp":      {"cpp"},
-		"*.h":        {"cpp"},
-		"*.hpp":      {"cpp"},
-		"*.cs":       {"csharp"},
-		"*.css":      {"css"},
-		"*.cue":      {"cue"},
-		"Dockerfile": {"dockerfile"},
-		"*.ex":       {"elixir"},
-		"*.elm":      {"elm"},
-		"*.go":       {"go"},
-		"*.hcl":      {"hcl"},
-		"*.tf":       {"hcl"},
-		"*.html":     {"html"},
-		"*.java":     {"java"},
-		"*.js":       {"javascript"},
-		"*.jsx":      {"javascript"},
-		"*.kt":       {"kotlin"},
-		//"*.lua":      []string{"lua"},
-		"*.ml":     {"ocaml"},
-		"*.mli":    {"ocaml"},
-		"*.php":    {"php"},
-		"*.proto":  {"protobuf"},
-		"*.py":     {"python"},
-		"*.rb":     {"ruby"},
-		"*.rs":     {"rust"},
-		"*.scala":  {"scala"},
-		"*.svelte": {"svelte"},
-		"*.toml":   {"toml"},
-		"*.ts":     {"typescript", "tsx"},
-		"*.tsx":    {"tsx"},
-		"*.yml":    {"yaml"},
-		"*.yaml":   {"yaml"},
+func LanguageNameToSitterLanguage(name string) (*sitter.Language, error) {
+	rl, err := DefaultLanguageRegistry.Lookup(name)
+	if err != nil {
+		return nil, err
 	}
-)
+	return rl.Language, nil
+}
 
 func GetLanguageGlobs(lang string) ([]string, error) {
-	ret := []string{}
+	return DefaultLanguageRegistry.Globs(lang)
+}
 
-	for filename, lang_ := range fileEndingToLanguageName {
-		for _, lang__ := range lang_ {
-			if lang__ == lang {
-				ret = append(ret, fmt.Sprintf("**/%s", filename))
-			}
-		}
+// FileNameToLanguageNames returns the names of the languages that can parse
+// filename, most likely first.
+func FileNameToLanguageNames(filename string) ([]string, error) {
+	languages, err := DefaultLanguageRegistry.LookupFileName(filename)
+	if err != nil {
+		return nil, err
 	}
-
-	if len(ret) == 0 {
-		return nil, errors.Errorf("unsupported language name: %s", lang)
-	} else {
-		return ret, nil
+	ret := make([]string, 0, len(languages))
+	for _, l := range languages {
+		ret = append(ret, l.Name)
 	}
+	return ret, nil
 }
 
 func FileNameToSitterLanguage(filename string) (*sitter.Language, error) {
-	baseName := path.Base(filename)
-	for ending, name := range fileEndingToLanguageName {
-		// use glob
-		matched, err := path.Match(ending, baseName)
-		if err != nil {
-			return nil, err
-		}
-		if matched {
-			return LanguageNameToSitterLanguage(name[0])
-		}
+	languages, err := DefaultLanguageRegistry.LookupFileName(filename)
+	if err != nil {
+		return nil, err
 	}
-	return nil, errors.Errorf("unsupported file name: %s", filename)
+	return languages[0].Language, nil
 }
@@ -0,0 +1,244 @@
+package pkg
+
+import (
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	sitter "github.com/smacker/go-tree-sitter"
+)
+
+// RegisteredLanguage is a grammar registered in a LanguageRegistry.
+type RegisteredLanguage struct {
+	// Name is the canonical name of the language, as used in oak commands.
+	Name string
+	// Aliases are other names of the language. They are also matched against
+	// the interpreter of a shebang line.
+	Aliases []string
+	// Globs are matched against the base name of files, for example "*.go"
+	// or "Dockerfile".
+	Globs    []string
+	Language *sitter.Language
+	// Priority orders the languages matching the same file name, highest
+	// first. Languages with the same priority keep their registration order.
+	Priority int
+}
+
+// LanguageRegistry maps language names, aliases and file names to tree-sitter
+// grammars. Lookups by file name return the languages by decreasing priority,
+// and in the order they were registered for the same priority, so that the
+// result never depends on map iteration order.
+//
+// A LanguageRegistry can be used from several goroutines.
+type LanguageRegistry struct {
+	mutex     sync.RWMutex
+	languages []*RegisteredLanguage
+	// byName indexes languages by name and alias
+	byName map[string]*RegisteredLanguage
+}
+
+func NewLanguageRegistry() *LanguageRegistry {
+	return &LanguageRegistry{
+		byName: map[string]*RegisteredLanguage{},
+	}
+}
+
+// Register adds a language to the registry. Registering a name again replaces
+// the previous language of that name, which allows overriding the grammars of
+// the DefaultLanguageRegistry. Using the name or alias of another language is
+// an error.
+func (lr *LanguageRegistry) Register(
+	name string,
+	aliases []string,
+	globs []string,
+	lang *sitter.Language,
+) error {
+	if name == "" {
+		return errors.New("language name can't be empty")
+	}
+	if lang == nil {
+		return errors.Errorf("language %s has no grammar", name)
+	}
+	for _, glob := range globs {
+		if _, err := path.Match(glob, ""); err != nil {
+			return errors.Wrapf(err, "invalid glob %s for language %s", glob, name)
+		}
+	}
+
+	lr.mutex.Lock()
+	defer lr.mutex.Unlock()
+
+	for _, n := range append([]string{name}, aliases...) {
+		if existing, ok := lr.byName[n]; ok && existing.Name != name {
+			return errors.Errorf("name %s of language %s is already used by language %s", n, name, existing.Name)
+		}
+	}
+
+	rl := &RegisteredLanguage{
+		Name:     name,
+		Aliases:  aliases,
+		Globs:    globs,
+		Language: lang,
+	}
+
+	if previous, ok := lr.byName[name]; ok {
+		rl.Priority = previous.Priority
+		for _, alias := range previous.Aliases {
+			delete(lr.byName, alias)
+		}
+		for i, l := range lr.languages {
+			if l == previous {
+				lr.languages[i] = rl
+				break
+			}
+		}
+	} else {
+		lr.languages = append(lr.languages, rl)
+	}
+
+	lr.byName[name] = rl
+	for _, alias := range aliases {
+		lr.byName[alias] = rl
+	}
+
+	return nil
+}
+
+// SetPriority sets the priority of the language name, used to order the
+// languages matching the same file name.
+func (lr *LanguageRegistry) SetPriority(name string, priority int) error {
+	lr.mutex.Lock()
+	defer lr.mutex.Unlock()
+
+	rl, ok := lr.byName[name]
+	if !ok {
+		return errors.Errorf("unsupported language name: %s", name)
+	}
+	rl.Priority = priority
+	return nil
+}
+
+// Lookup returns the language registered under name or under one of its
+// aliases.
+func (lr *LanguageRegistry) Lookup(name string) (*RegisteredLanguage, error) {
+	lr.mutex.RLock()
+	defer lr.mutex.RUnlock()
+
+	rl, ok := lr.byName[name]
+	if !ok {
+		return nil, errors.Errorf("unsupported language name: %s", name)
+	}
+	return rl, nil
+}
+
+// Names returns the canonical names of all the languages, in the order they
+// were registered.
+func (lr *LanguageRegistry) Names() []string {
+	lr.mutex.RLock()
+	defer lr.mutex.RUnlock()
+
+	ret := make([]string, 0, len(lr.languages))
+	for _, l := range lr.languages {
+		ret = append(ret, l.Name)
+	}
+	return ret
+}
+
+// LookupFileName returns the languages with a glob matching the base name of
+// fileName, highest priority first.
+func (lr *LanguageRegistry) LookupFileName(fileName string) ([]*RegisteredLanguage, error) {
+	baseName := path.Base(fileName)
+
+	lr.mutex.RLock()
+	defer lr.mutex.RUnlock()
+
+	ret := []*RegisteredLanguage{}
+	for _, l := range lr.languages {
+		for _, glob := range l.Globs {
+			// globs are validated in Register
+			if matched, _ := path.Match(glob, baseName); matched {
+				ret = append(ret, l)
+				break
+			}
+		}
+	}
+	if len(ret) == 0 {
+		return nil, errors.Errorf("unsupported file name: %s", fileName)
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Priority > ret[j].Priority
+	})
+	return ret, nil
+}
+
+// LookupShebang returns the language of the interpreter of a shebang line such
+// as "#!/bin/bash" or "#!/usr/bin/env python3". Interpreters are matched
+// against the names and aliases of the languages, first as is, then without a
+// trailing version number.
+func (lr *LanguageRegistry) LookupShebang(line string) (*RegisteredLanguage, error) {
+	interpreter := ShebangInterpreter(line)
+	if interpreter == "" {
+		return nil, errors.Errorf("not a shebang line: %s", line)
+	}
+
+	rl, err := lr.Lookup(interpreter)
+	if err == nil {
+		return rl, nil
+	}
+	// python3.11 -> python
+	unversioned := strings.TrimRight(interpreter, "0123456789.")
+	if unversioned != "" && unversioned != interpreter {
+		if rl, err := lr.Lookup(unversioned); err == nil {
+			return rl, nil
+		}
+	}
+
+	return nil, errors.Errorf("unsupported interpreter: %s", interpreter)
+}
+
+// ShebangInterpreter returns the base name of the interpreter of a shebang
+// line, skipping env and its flags, or "" if line is not a shebang line.
+func ShebangInterpreter(line string) string {
+	if !strings.HasPrefix(line, "#!") {
+		return ""
+	}
+	fields := strings.Fields(line[2:])
+	if len(fields) == 0 {
+		return ""
+	}
+
+	interpreter := path.Base(fields[0])
+	if interpreter == "env" {
+		interpreter = ""
+		for _, f := range fields[1:] {
+			// skip flags such as -S and variable assignments
+			if strings.HasPrefix(f, "-") || strings.Contains(f, "=") {
+				continue
+			}
+			interpreter = path.Base(f)
+			break
+		}
+	}
+
+	return interpreter
+}
+
+// Globs returns the globs of the language name, prefixed with **/ so that they
+// match files in subdirectories.
+func (lr *LanguageRegistry) Globs(name string) ([]string, error) {
+	rl, err := lr.Lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(rl.Globs) == 0 {
+		return nil, errors.Errorf("language %s has no globs", name)
+	}
+
+	ret := make([]string, 0, len(rl.Globs))
+	for _, glob := range rl.Globs {
+		ret = append(ret, "**/"+glob)
+	}
+	return ret, nil
+}
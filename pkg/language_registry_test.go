@@ -0,0 +1,122 @@
+package pkg
+
+import (
+	"testing"
+
+	"github.com/smacker/go-tree-sitter/golang"
+	"github.com/smacker/go-tree-sitter/python"
+)
+
+func TestRegistryLookupByNameAndAlias(t *testing.T) {
+	lr := NewLanguageRegistry()
+	err := lr.Register("go", []string{"golang"}, []string{"*.go"}, golang.GetLanguage())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, name := range []string{"go", "golang"} {
+		rl, err := lr.Lookup(name)
+		if err != nil {
+			t.Fatalf("Unexpected error for %s: %v", name, err)
+		}
+		if rl.Name != "go" {
+			t.Errorf("Expected go for %s, got %s", name, rl.Name)
+		}
+	}
+
+	_, err = lr.Lookup("python")
+	if err == nil {
+		t.Fatalf("Expected an error for an unregistered language")
+	}
+}
+
+func TestRegistryRejectsNameOfOtherLanguage(t *testing.T) {
+	lr := NewLanguageRegistry()
+	err := lr.Register("go", []string{"golang"}, []string{"*.go"}, golang.GetLanguage())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = lr.Register("python", []string{"golang"}, []string{"*.py"}, python.GetLanguage())
+	if err == nil {
+		t.Fatalf("Expected an error when reusing the alias of another language")
+	}
+}
+
+func TestRegistryReplacesLanguage(t *testing.T) {
+	lr := NewLanguageRegistry()
+	err := lr.Register("go", []string{"golang"}, []string{"*.go"}, golang.GetLanguage())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = lr.Register("go", nil, []string{"*.go", "*.go.txt"}, golang.GetLanguage())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if _, err = lr.Lookup("golang"); err == nil {
+		t.Errorf("Expected the aliases of the replaced language to be removed")
+	}
+	languages, err := lr.LookupFileName("dir/main.go.txt")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(languages) != 1 || languages[0].Name != "go" {
+		t.Errorf("Expected go, got %v", languages)
+	}
+	if names := lr.Names(); len(names) != 1 {
+		t.Errorf("Expected a single language, got %v", names)
+	}
+}
+
+func TestDefaultRegistryFileNames(t *testing.T) {
+	for fileName, expected := range map[string][]string{
+		"main.go":        {"go"},
+		"src/index.ts":   {"typescript", "tsx"},
+		"src/App.tsx":    {"tsx"},
+		"app/Dockerfile": {"dockerfile"},
+	} {
+		names, err := FileNameToLanguageNames(fileName)
+		if err != nil {
+			t.Fatalf("Unexpected error for %s: %v", fileName, err)
+		}
+		if len(names) != len(expected) {
+			t.Fatalf("Expected %v for %s, got %v", expected, fileName, names)
+		}
+		for i := range names {
+			if names[i] != expected[i] {
+				t.Errorf("Expected %v for %s, got %v", expected, fileName, names)
+			}
+		}
+	}
+
+	_, err := FileNameToLanguageNames("README.md")
+	if err == nil {
+		t.Fatalf("Expected an error for an unsupported file")
+	}
+}
+
+func TestLookupShebang(t *testing.T) {
+	for line, expected := range map[string]string{
+		"#!/bin/bash":                      "bash",
+		"#!/bin/sh -e":                     "bash",
+		"#!/usr/bin/env python3":           "python",
+		"#!/usr/bin/python3.11":            "python",
+		"#!/usr/bin/env -S node --inspect": "javascript",
+		"#! /usr/bin/env ruby":             "ruby",
+	} {
+		rl, err := DefaultLanguageRegistry.LookupShebang(line)
+		if err != nil {
+			t.Fatalf("Unexpected error for %s: %v", line, err)
+		}
+		if rl.Name != expected {
+			t.Errorf("Expected %s for %s, got %s", expected, line, rl.Name)
+		}
+	}
+
+	for _, line := range []string{"package main", "#!/usr/bin/env perl", "#!"} {
+		_, err := DefaultLanguageRegistry.LookupShebang(line)
+		if err == nil {
+			t.Errorf("Expected an error for %q", line)
+		}
+	}
+}
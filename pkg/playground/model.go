@@ -0,0 +1,448 @@
+package playground
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/go-go-golems/bobatea/pkg/textarea"
+	sitter "github.com/smacker/go-tree-sitter"
+)
+
+type focus int
+
+const (
+	focusQuery focus = iota
+	focusSource
+)
+
+const tabWidth = 4
+
+// capturePalette are the background colors of the captures, by their index
+// in the query.
+var capturePalette = []lipgloss.Color{"24", "58", "53", "23", "94", "60", "22", "89"}
+
+var (
+	borderStyle        = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).BorderForeground(lipgloss.Color("240"))
+	focusedBorderStyle = borderStyle.BorderForeground(lipgloss.Color("62"))
+	titleStyle         = lipgloss.NewStyle().Bold(true)
+	gutterStyle        = lipgloss.NewStyle().Foreground(lipgloss.Color("241"))
+	errorStyle         = lipgloss.NewStyle().Foreground(lipgloss.Color("196"))
+	statusStyle        = lipgloss.NewStyle().Foreground(lipgloss.Color("245"))
+)
+
+// Model is the bubbletea model of the playground: the source of a session on
+// the left, and the query editor, the captures of the query and the AST of
+// the node under the cursor on the right.
+//
+// The query is run on each edit, and its captures are highlighted in the
+// source. tab switches the focus between the query editor and the source, in
+// which the cursor is moved with the arrow keys. ctrl+n and ctrl+p move the
+// cursor to the next and previous capture.
+type Model struct {
+	session    *Session
+	editor     textarea.Model
+	evaluation *Evaluation
+	// lines are the lines of the source, and lineStarts their byte offsets
+	lines      []string
+	lineStarts []uint32
+
+	focus focus
+	// row and col are the position of the cursor in the source, col counting
+	// runes
+	row, col int
+	// offset is the first line of the source that is displayed
+	offset int
+	// current is the index of the highlight selected with ctrl+n and ctrl+p,
+	// or -1
+	current int
+
+	nodePath string
+	nodeAST  string
+
+	width, height int
+}
+
+// NewModel returns a playground on session, with query in the editor.
+func NewModel(session *Session, query string) Model {
+	editor := textarea.New()
+	editor.CharLimit = 0
+	editor.MaxHeight = 0
+	editor.Placeholder = "(function_declaration name: (identifier) @name)"
+	editor.SetValue(query)
+	editor.Focus()
+
+	m := Model{
+		session: session,
+		editor:  editor,
+		current: -1,
+	}
+	offset := uint32(0)
+	for _, line := range strings.Split(string(session.Source), "\n") {
+		m.lines = append(m.lines, line)
+		m.lineStarts = append(m.lineStarts, offset)
+		offset += uint32(len(line)) + 1
+	}
+	m.evaluation = session.Run(query)
+	m.updateNode()
+	return m
+}
+
+// Query returns the query in the editor.
+func (m Model) Query() string {
+	return m.editor.Value()
+}
+
+// Evaluation returns the result of the query in the editor.
+func (m Model) Evaluation() *Evaluation {
+	return m.evaluation
+}
+
+func (m Model) Init() tea.Cmd {
+	return textarea.Blink
+}
+
+func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		m.resize()
+		return m, nil
+
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "ctrl+c", "esc":
+			return m, tea.Quit
+		case "tab":
+			if m.focus == focusQuery {
+				m.focus = focusSource
+				m.editor.Blur()
+				return m, nil
+			}
+			m.focus = focusQuery
+			return m, m.editor.Focus()
+		case "ctrl+n":
+			m.selectHighlight(m.current + 1)
+			return m, nil
+		case "ctrl+p":
+			m.selectHighlight(m.current - 1)
+			return m, nil
+		}
+		if m.focus == focusSource {
+			m.moveCursor(msg.String())
+			return m, nil
+		}
+	}
+
+	query := m.editor.Value()
+	var cmd tea.Cmd
+	m.editor, cmd = m.editor.Update(msg)
+	if m.editor.Value() != query {
+		m.evaluation = m.session.Run(m.editor.Value())
+		m.current = -1
+	}
+	return m, cmd
+}
+
+// resize lays out the panes for the size of the window.
+func (m *Model) resize() {
+	_, rightWidth := m.columnWidths()
+	editorHeight, _, _ := m.rightHeights()
+	m.editor.SetWidth(rightWidth - 2)
+	// the border, the title and the status lines
+	m.editor.SetHeight(max(1, editorHeight-6))
+	m.updateNode()
+}
+
+func (m Model) columnWidths() (int, int) {
+	left := m.width / 2
+	return left, m.width - left
+}
+
+func (m Model) rightHeights() (int, int, int) {
+	editor := max(8, m.height*2/5)
+	results := (m.height - editor) / 2
+	return editor, results, m.height - editor - results
+}
+
+func (m *Model) moveCursor(key string) {
+	lineLength := func(row int) int {
+		return utf8.RuneCountInString(m.lines[row])
+	}
+	_, sourceHeight := m.sourceSize()
+	switch key {
+	case "up", "k":
+		m.row--
+	case "down", "j":
+		m.row++
+	case "left", "h":
+		if m.col > 0 {
+			m.col--
+		} else if m.row > 0 {
+			m.row--
+			m.col = lineLength(m.row)
+		}
+	case "right", "l":
+		if m.col < lineLength(m.row) {
+			m.col++
+		} else if m.row < len(m.lines)-1 {
+			m.row++
+			m.col = 0
+		}
+	case "home", "0":
+		m.col = 0
+	case "end", "$":
+		m.col = lineLength(m.row)
+	case "pgup":
+		m.row -= sourceHeight
+	case "pgdown":
+		m.row += sourceHeight
+	case "g":
+		m.row = 0
+	case "G":
+		m.row = len(m.lines) - 1
+	default:
+		return
+	}
+	m.row = clamp(m.row, 0, len(m.lines)-1)
+	m.col = clamp(m.col, 0, lineLength(m.row))
+	m.updateNode()
+}
+
+// selectHighlight selects the highlight i, wrapping around, and moves the
+// cursor to its start.
+func (m *Model) selectHighlight(i int) {
+	highlights := m.evaluation.Highlights
+	if len(highlights) == 0 {
+		m.current = -1
+		return
+	}
+	m.current = (i + len(highlights)) % len(highlights)
+	h := highlights[m.current]
+	m.row = int(h.StartPoint.Row)
+	m.col = utf8.RuneCountInString(m.lines[m.row][:h.StartPoint.Column])
+	m.updateNode()
+}
+
+// updateNode scrolls the source to the cursor and dumps the node at the
+// cursor.
+func (m *Model) updateNode() {
+	_, sourceHeight := m.sourceSize()
+	if m.row < m.offset {
+		m.offset = m.row
+	} else if m.row >= m.offset+sourceHeight {
+		m.offset = m.row - sourceHeight + 1
+	}
+
+	column := len(string([]rune(m.lines[m.row])[:m.col]))
+	node := m.session.NodeAt(sitter.Point{Row: uint32(m.row), Column: uint32(column)})
+	if node == nil {
+		m.nodePath, m.nodeAST = "", ""
+		return
+	}
+	m.nodePath = NodePath(node)
+	m.nodeAST = m.session.NodeAST(node)
+}
+
+// sourceSize returns the number of columns and lines of the source pane.
+func (m Model) sourceSize() (int, int) {
+	left, _ := m.columnWidths()
+	// the border and the title
+	return left - 2, max(1, m.height-3)
+}
+
+func (m Model) View() string {
+	if m.width == 0 {
+		return "loading..."
+	}
+	left, right := m.columnWidths()
+	editorHeight, resultsHeight, astHeight := m.rightHeights()
+
+	return lipgloss.JoinHorizontal(lipgloss.Top,
+		m.sourceView(left, m.height),
+		lipgloss.JoinVertical(lipgloss.Left,
+			m.editorView(right, editorHeight),
+			m.resultsView(right, resultsHeight),
+			m.astView(right, astHeight),
+		),
+	)
+}
+
+// box renders lines in a bordered box of width and height, with title as
+// first line.
+func box(title string, lines []string, width, height int, focused bool) string {
+	style := borderStyle
+	if focused {
+		style = focusedBorderStyle
+	}
+	innerWidth, innerHeight := max(1, width-2), max(1, height-2)
+	content := append([]string{titleStyle.Render(truncate(title, innerWidth))}, lines...)
+	if len(content) > innerHeight {
+		content = content[:innerHeight]
+	}
+	for len(content) < innerHeight {
+		content = append(content, "")
+	}
+	return style.Width(innerWidth).Render(strings.Join(content, "\n"))
+}
+
+func (m Model) sourceView(width, height int) string {
+	s := m.session
+	title := fmt.Sprintf("%s (%s)", s.FileName, s.LanguageName)
+	if s.Health.HasError {
+		title += fmt.Sprintf(" - %d syntax errors", s.Health.ErrorCount+s.Health.MissingCount)
+	}
+	if m.focus == focusSource {
+		title += " - arrows move, tab edits the query"
+	}
+
+	innerWidth, innerHeight := m.sourceSize()
+
+	gutterWidth := len(fmt.Sprint(len(m.lines)))
+	lines := []string{}
+	for row := m.offset; row < len(m.lines) && row < m.offset+innerHeight; row++ {
+		gutter := gutterStyle.Render(fmt.Sprintf("%*d ", gutterWidth, row+1))
+		lines = append(lines, gutter+m.renderSourceLine(row, innerWidth-gutterWidth-1))
+	}
+	return box(title, lines, width, height, m.focus == focusSource)
+}
+
+// renderSourceLine renders the line row of the source in width cells, with
+// the background of the innermost capture of each character.
+func (m Model) renderSourceLine(row int, width int) string {
+	line := m.lines[row]
+	start := m.lineStarts[row]
+	end := start + uint32(len(line))
+
+	captures := make([]int, len(line))
+	selected := make([]bool, len(line))
+	for i := range captures {
+		captures[i] = -1
+	}
+	for i, h := range m.evaluation.Highlights {
+		if h.StartByte >= end || h.EndByte <= start {
+			continue
+		}
+		from, to := max(h.StartByte, start)-start, min(h.EndByte, end)-start
+		for b := from; b < to; b++ {
+			captures[b] = h.CaptureIndex
+			if i == m.current {
+				selected[b] = true
+			}
+		}
+	}
+
+	var sb strings.Builder
+	cells, col := 0, 0
+	for b, r := range line {
+		text := string(r)
+		if r == '\t' {
+			text = strings.Repeat(" ", tabWidth)
+		}
+		if cells+len([]rune(text)) > width {
+			return sb.String()
+		}
+		cells += len([]rune(text))
+
+		style := lipgloss.NewStyle()
+		if captures[b] >= 0 {
+			style = style.Background(capturePalette[captures[b]%len(capturePalette)])
+		}
+		if selected[b] {
+			style = style.Underline(true).Bold(true)
+		}
+		if row == m.row && col == m.col {
+			style = style.Reverse(true)
+		}
+		sb.WriteString(style.Render(text))
+		col++
+	}
+	if row == m.row && m.col == col && cells < width {
+		sb.WriteString(lipgloss.NewStyle().Reverse(true).Render(" "))
+	}
+	return sb.String()
+}
+
+func (m Model) editorView(width, height int) string {
+	title := "Query"
+	if m.focus == focusQuery {
+		title += " - tab moves in the source, ctrl+n/ctrl+p select captures, esc quits"
+	}
+	lines := strings.Split(strings.TrimRight(m.editor.View(), "\n"), "\n")
+	lines = append(lines, m.statusLines(width-2)...)
+	return box(title, lines, width, height, m.focus == focusQuery)
+}
+
+// statusLines returns the number of matches of the query, or its error
+// followed by the line of the query with a caret under the error.
+func (m Model) statusLines(width int) []string {
+	e := m.evaluation
+	switch {
+	case e.QueryError != nil:
+		ret := []string{errorStyle.Render(truncate("✗ "+e.QueryError.String(), width))}
+		queryLines := strings.Split(e.Query, "\n")
+		if e.QueryError.Line > 0 && e.QueryError.Line <= len(queryLines) {
+			line := strings.ReplaceAll(queryLines[e.QueryError.Line-1], "\t", " ")
+			column := max(0, e.QueryError.Column-1)
+			first := max(0, column-width/2)
+			ret = append(ret,
+				truncate(string([]rune(line)[min(first, len([]rune(line))):]), width),
+				errorStyle.Render(strings.Repeat(" ", column-first)+"^"))
+		}
+		return ret
+	case e.Err != nil:
+		return []string{errorStyle.Render(truncate("✗ "+e.Err.Error(), width))}
+	case strings.TrimSpace(e.Query) == "":
+		return []string{statusStyle.Render("type a query")}
+	}
+	return []string{statusStyle.Render(truncate(e.Summary(), width))}
+}
+
+func (m Model) resultsView(width, height int) string {
+	highlights := m.evaluation.Highlights
+	innerHeight := max(1, height-3)
+	first := 0
+	if m.current >= 0 {
+		first = clamp(m.current-innerHeight/2, 0, max(0, len(highlights)-innerHeight))
+	}
+
+	lines := []string{}
+	for i := first; i < len(highlights) && i < first+innerHeight; i++ {
+		h := highlights[i]
+		marker := "  "
+		if i == m.current {
+			marker = "> "
+		}
+		prefix := marker + h.Position() + " "
+		name := lipgloss.NewStyle().Background(capturePalette[h.CaptureIndex%len(capturePalette)]).Render("@" + h.Capture)
+		available := width - 2 - len(prefix) - len(h.Capture) - 1
+		lines = append(lines, prefix+name+truncate(" "+h.Description(), max(0, available)))
+	}
+	return box(fmt.Sprintf("Captures (%d)", len(highlights)), lines, width, height, false)
+}
+
+func (m Model) astView(width, height int) string {
+	lines := []string{}
+	for _, line := range strings.Split(strings.TrimRight(m.nodeAST, "\n"), "\n") {
+		lines = append(lines, truncate(strings.ReplaceAll(line, "\t", " "), width-2))
+	}
+	return box(m.nodePath, lines, width, height, false)
+}
+
+// truncate cuts s to width runes.
+func truncate(s string, width int) string {
+	runes := []rune(s)
+	if len(runes) <= width {
+		return s
+	}
+	if width <= 1 {
+		return string(runes[:max(0, width)])
+	}
+	return string(runes[:width-1]) + "…"
+}
+
+func clamp(v, low, high int) int {
+	return max(low, min(v, high))
+}
@@ -0,0 +1,214 @@
+package playground
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/go-go-golems/oak/pkg"
+	tree_sitter "github.com/go-go-golems/oak/pkg/tree-sitter"
+	"github.com/go-go-golems/oak/pkg/tree-sitter/dump"
+	"github.com/pkg/errors"
+	sitter "github.com/smacker/go-tree-sitter"
+)
+
+// QueryName is the name of the query run by a Session, in its results.
+const QueryName = "query"
+
+// Session is a parsed source file on which queries are run as they are
+// edited.
+type Session struct {
+	FileName     string
+	LanguageName string
+	Language     *sitter.Language
+	Source       []byte
+	Tree         *sitter.Tree
+	// Health are the syntax errors of the source
+	Health tree_sitter.ParseHealth
+}
+
+// NewSession parses source with the language languageName, or the language
+// detected from fileName and source if languageName is empty.
+func NewSession(ctx context.Context, fileName string, source []byte, languageName string) (*Session, error) {
+	var rl *pkg.RegisteredLanguage
+	var err error
+	if languageName != "" {
+		rl, err = pkg.DefaultLanguageRegistry.Lookup(languageName)
+	} else {
+		rl, err = pkg.DetectLanguage(ctx, fileName, source)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	parser := sitter.NewParser()
+	parser.SetLanguage(rl.Language)
+	tree, err := parser.ParseCtx(ctx, nil, source)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not parse %s", fileName)
+	}
+
+	return &Session{
+		FileName:     fileName,
+		LanguageName: rl.Name,
+		Language:     rl.Language,
+		Source:       source,
+		Tree:         tree,
+		Health:       tree_sitter.CheckParseHealth(tree.RootNode()),
+	}, nil
+}
+
+// LoadSession reads fileName and parses it, see NewSession.
+func LoadSession(ctx context.Context, fileName string, languageName string) (*Session, error) {
+	source, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not read file %s", fileName)
+	}
+	return NewSession(ctx, fileName, source, languageName)
+}
+
+// Close releases the tree of the session. The session can't be used after
+// it is closed.
+func (s *Session) Close() {
+	s.Tree.Close()
+}
+
+// Highlight is a node captured by a query.
+type Highlight struct {
+	Capture string
+	// CaptureIndex is the index of the capture in the query, which stays
+	// the same while the rest of the query is edited
+	CaptureIndex int
+	// Match is the index of the match of the capture
+	Match int
+	tree_sitter.CaptureNode
+}
+
+func (h Highlight) String() string {
+	return fmt.Sprintf("%s @%s %s", h.Position(), h.Capture, h.Description())
+}
+
+// Position returns the 1-based line and column of the start of the node.
+func (h Highlight) Position() string {
+	return fmt.Sprintf("%d:%d", h.StartPoint.Row+1, h.StartPoint.Column+1)
+}
+
+// Description returns the type of the node and the beginning of its text.
+func (h Highlight) Description() string {
+	text := []rune(strings.NewReplacer("\n", `\n`, "\t", `\t`).Replace(h.Text))
+	if len(text) > 40 {
+		text = append(text[:37], []rune("...")...)
+	}
+	return fmt.Sprintf("%s %q", h.Type, string(text))
+}
+
+// Evaluation is the result of running a query on the source of a Session.
+type Evaluation struct {
+	Query   string
+	Matches []tree_sitter.Match
+	// Highlights are the nodes of all the captures, ordered by position, with
+	// the enclosing nodes before the nodes they contain
+	Highlights []Highlight
+	// Err is the error of compiling or running the query, and QueryError its
+	// description if it is an error in the text of the query.
+	Err        error
+	QueryError *tree_sitter.QueryErrorDescription
+}
+
+// Summary returns the number of matches and captures, or the error of the
+// query.
+func (e *Evaluation) Summary() string {
+	switch {
+	case e.QueryError != nil:
+		return e.QueryError.String()
+	case e.Err != nil:
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%d matches, %d captures", len(e.Matches), len(e.Highlights))
+}
+
+// Run runs query on the source of the session. Errors are returned as part of
+// the evaluation, since queries are run while they are being typed.
+func (s *Session) Run(query string) *Evaluation {
+	ret := &Evaluation{Query: query}
+	if strings.TrimSpace(query) == "" {
+		return ret
+	}
+
+	// the query is compiled outside of the shared cache, which would keep
+	// every version of the query typed in the playground
+	queries := tree_sitter.NewQueryCache()
+	defer queries.Close()
+
+	sq := tree_sitter.SitterQuery{Name: QueryName, Query: query}
+	compiled, err := queries.Get(s.Language, sq)
+	if err == nil {
+		var results tree_sitter.QueryResults
+		results, err = tree_sitter.ExecuteQueries(s.Language, s.Tree.RootNode(), []tree_sitter.SitterQuery{sq}, s.Source,
+			tree_sitter.WithLanguageName(s.LanguageName), tree_sitter.WithQueryCache(queries))
+		if err == nil {
+			ret.Matches = results[QueryName].Matches
+		}
+	}
+	if err != nil {
+		ret.Err = err
+		if d, ok := tree_sitter.DescribeQueryError(query, err); ok {
+			ret.QueryError = &d
+		}
+		return ret
+	}
+
+	captureIndexes := map[string]int{}
+	for i := uint32(0); i < compiled.CaptureCount(); i++ {
+		captureIndexes[compiled.CaptureNameForId(i)] = int(i)
+	}
+	for i, match := range ret.Matches {
+		for name, capture := range match {
+			for _, node := range capture.Nodes {
+				ret.Highlights = append(ret.Highlights, Highlight{
+					Capture:      name,
+					CaptureIndex: captureIndexes[name],
+					Match:        i,
+					CaptureNode:  node,
+				})
+			}
+		}
+	}
+	sort.SliceStable(ret.Highlights, func(i, j int) bool {
+		a, b := ret.Highlights[i], ret.Highlights[j]
+		if a.StartByte != b.StartByte {
+			return a.StartByte < b.StartByte
+		}
+		if a.EndByte != b.EndByte {
+			return a.EndByte > b.EndByte
+		}
+		return a.CaptureIndex < b.CaptureIndex
+	})
+
+	return ret
+}
+
+// NodeAt returns the smallest named node at point.
+func (s *Session) NodeAt(point sitter.Point) *sitter.Node {
+	return s.Tree.RootNode().NamedDescendantForPointRange(point, point)
+}
+
+// NodePath returns the types of node and its ancestors, outermost first,
+// separated by " > ".
+func NodePath(node *sitter.Node) string {
+	types := []string{}
+	for n := node; n != nil && !n.IsNull(); n = n.Parent() {
+		types = append([]string{n.Type()}, types...)
+	}
+	return strings.Join(types, " > ")
+}
+
+// NodeAST returns the verbose dump of node and its children.
+func (s *Session) NodeAST(node *sitter.Node) string {
+	var buf bytes.Buffer
+	dump.DumpVerboseAST(node, s.Source, &buf)
+	return buf.String()
+}
@@ -0,0 +1,115 @@
+package playground
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	sitter "github.com/smacker/go-tree-sitter"
+)
+
+const testSource = `package main
+
+func foo(a int) {}
+
+func bar() {}
+`
+
+func newTestSession(t *testing.T) *Session {
+	s, err := NewSession(context.Background(), "main.go", []byte(testSource), "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if s.LanguageName != "go" {
+		t.Fatalf("Expected language go, got %s", s.LanguageName)
+	}
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestSessionRun(t *testing.T) {
+	s := newTestSession(t)
+
+	e := s.Run(`(function_declaration name: (identifier) @name) @function`)
+	if e.Err != nil {
+		t.Fatalf("Unexpected error: %v", e.Err)
+	}
+	actual := []string{}
+	for _, h := range e.Highlights {
+		actual = append(actual, h.String())
+	}
+	expected := []string{
+		`3:1 @function function_declaration "func foo(a int) {}"`,
+		`3:6 @name identifier "foo"`,
+		`5:1 @function function_declaration "func bar() {}"`,
+		`5:6 @name identifier "bar"`,
+	}
+	if strings.Join(actual, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("Expected highlights\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(actual, "\n"))
+	}
+	if e.Highlights[0].CaptureIndex != 1 || e.Highlights[1].CaptureIndex != 0 {
+		t.Errorf("Expected capture indexes in the order of the query, got %+v", e.Highlights[:2])
+	}
+	if e.Summary() != "2 matches, 4 captures" {
+		t.Errorf("Unexpected summary %q", e.Summary())
+	}
+}
+
+func TestSessionRunQueryError(t *testing.T) {
+	s := newTestSession(t)
+
+	e := s.Run("(function_declaration\n  name: (identifer) @name)")
+	if e.Err == nil || e.QueryError == nil {
+		t.Fatalf("Expected a query error, got %+v", e)
+	}
+	if e.Summary() != "2:10: invalid node type 'identifer'" {
+		t.Errorf("Unexpected summary %q", e.Summary())
+	}
+	if len(e.Highlights) != 0 {
+		t.Errorf("Expected no highlights, got %+v", e.Highlights)
+	}
+
+	e = s.Run("  ")
+	if e.Err != nil || len(e.Matches) != 0 {
+		t.Errorf("Expected an empty query to have no results, got %+v", e)
+	}
+}
+
+func TestSessionNodeAt(t *testing.T) {
+	s := newTestSession(t)
+
+	node := s.NodeAt(sitter.Point{Row: 2, Column: 9})
+	if node.Type() != "identifier" || node.Content(s.Source) != "a" {
+		t.Fatalf("Expected the identifier a, got %s", node.Type())
+	}
+	expected := "source_file > function_declaration > parameter_list > parameter_declaration > identifier"
+	if NodePath(node) != expected {
+		t.Errorf("Expected %s, got %s", expected, NodePath(node))
+	}
+	if !strings.HasPrefix(s.NodeAST(node), "[3:10-3:11] identifier") {
+		t.Errorf("Unexpected AST %q", s.NodeAST(node))
+	}
+}
+
+func TestModel(t *testing.T) {
+	s := newTestSession(t)
+
+	var m tea.Model = NewModel(s, "(function_declaration name: (identifier) @name)")
+	m, _ = m.Update(tea.WindowSizeMsg{Width: 120, Height: 30})
+	m, _ = m.Update(tea.KeyMsg{Type: tea.KeyCtrlN})
+	m, _ = m.Update(tea.KeyMsg{Type: tea.KeyCtrlN})
+
+	view := m.View()
+	for _, expected := range []string{"main.go (go)", "> 5:6 @name identifier \"bar\"", "Captures (2)", "function_declaration > identifier"} {
+		if !strings.Contains(view, expected) {
+			t.Errorf("Expected %q in view\n%s", expected, view)
+		}
+	}
+
+	m, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("x")})
+	pm := m.(Model)
+	if pm.Query() != "(function_declaration name: (identifier) @name)x" || pm.Evaluation().QueryError == nil {
+		t.Errorf("Expected the edited query to be run, got %q: %+v", pm.Query(), pm.Evaluation())
+	}
+}
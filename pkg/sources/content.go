@@ -0,0 +1,25 @@
+package sources
+
+import (
+	"bytes"
+	"regexp"
+)
+
+// generatedRegexp matches the comment marking generated files, as the
+// "// Code generated ... DO NOT EDIT." line of Go files, with the comment
+// syntax of other languages, or the "@generated" tag used by JavaScript, PHP
+// and Python tools.
+var generatedRegexp = regexp.MustCompile(
+	`(?m)^\s*(?://|#|--|;+|/\*+|\*+)?\s*(?:Code generated .* DO NOT EDIT\.?|@generated\b)`)
+
+// IsBinary returns true if head, the beginning of a file, looks like binary
+// data, that is, contains a NUL byte like git checks.
+func IsBinary(head []byte) bool {
+	return bytes.IndexByte(head, 0) != -1
+}
+
+// IsGenerated returns true if head, the beginning of a file, contains a
+// comment marking the file as generated.
+func IsGenerated(head []byte) bool {
+	return generatedRegexp.Match(head)
+}
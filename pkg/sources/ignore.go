@@ -0,0 +1,183 @@
+package sources
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/pkg/errors"
+)
+
+// ignorePattern is a line of an ignore file, in gitignore syntax.
+type ignorePattern struct {
+	// base is the directory of the ignore file, patterns containing a slash
+	// are relative to it
+	base     string
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// ignoreList holds the patterns applying to a directory, from the outermost
+// ignore file to the innermost. The last matching pattern wins.
+type ignoreList []ignorePattern
+
+// parseIgnorePatterns parses the lines of an ignore file of the directory
+// base.
+func parseIgnorePatterns(base string, lines []string) ignoreList {
+	ret := ignoreList{}
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p := ignorePattern{base: base}
+		if strings.HasPrefix(line, "!") {
+			p.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			p.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		p.anchored = strings.Contains(line, "/")
+		p.pattern = strings.TrimPrefix(line, "/")
+		if p.pattern == "" {
+			continue
+		}
+		ret = append(ret, p)
+	}
+	return ret
+}
+
+// readIgnoreFiles returns the patterns of the ignore files in dir, whose
+// absolute slash separated path is absDir.
+func readIgnoreFiles(dir string, absDir string) (ignoreList, error) {
+	ret := ignoreList{}
+	for _, name := range IgnoreFiles {
+		list, err := readIgnoreFile(filepath.Join(dir, name), absDir)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, list...)
+	}
+	return ret, nil
+}
+
+func readIgnoreFile(fileName string, base string) (ignoreList, error) {
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "could not read ignore file %s", fileName)
+	}
+	lines := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return parseIgnorePatterns(base, lines), nil
+}
+
+// parentIgnoreList returns the patterns of the ignore files of the parent
+// directories of absDir, up to the top-level directory of its git
+// repository, including the excludes of the repository. It is empty if absDir
+// is not in a git repository.
+func parentIgnoreList(absDir string) (ignoreList, error) {
+	hasGit := func(dir string) bool {
+		_, err := os.Stat(filepath.Join(filepath.FromSlash(dir), ".git"))
+		return err == nil
+	}
+
+	// the ignore files of absDir itself are read while walking it
+	parents := []string{}
+	root := ""
+	if hasGit(absDir) {
+		root = absDir
+	} else {
+		for dir := path.Dir(absDir); ; dir = path.Dir(dir) {
+			parents = append(parents, dir)
+			if hasGit(dir) {
+				root = dir
+				break
+			}
+			if dir == path.Dir(dir) {
+				break
+			}
+		}
+	}
+	if root == "" {
+		return ignoreList{}, nil
+	}
+
+	ret, err := readIgnoreFile(filepath.Join(filepath.FromSlash(root), ".git", "info", "exclude"), root)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(parents) - 1; i >= 0; i-- {
+		list, err := readIgnoreFiles(filepath.FromSlash(parents[i]), parents[i])
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, list...)
+	}
+	return ret, nil
+}
+
+// concat returns the patterns of l followed by those of other, without
+// modifying l.
+func (l ignoreList) concat(other ignoreList) ignoreList {
+	if len(other) == 0 {
+		return l
+	}
+	ret := make(ignoreList, 0, len(l)+len(other))
+	ret = append(ret, l...)
+	return append(ret, other...)
+}
+
+// ignored returns true if the file or directory p, a slash separated path,
+// is ignored by the patterns of l. The parent directories of p are not
+// looked at.
+func (l ignoreList) ignored(p string, isDir bool) bool {
+	ret := false
+	for _, pattern := range l {
+		if pattern.dirOnly && !isDir {
+			continue
+		}
+		rel, ok := relativePath(pattern.base, p)
+		if !ok {
+			continue
+		}
+		var matched bool
+		if pattern.anchored {
+			matched, _ = doublestar.Match(pattern.pattern, rel)
+		} else {
+			matched, _ = doublestar.Match(pattern.pattern, path.Base(rel))
+		}
+		if matched {
+			ret = !pattern.negate
+		}
+	}
+	return ret
+}
+
+// ignoredPath returns true if the file rel, relative to the directory dir, or
+// one of its parent directories below dir is ignored by the patterns of l.
+func (l ignoreList) ignoredPath(dir string, rel string) bool {
+	parts := strings.Split(rel, "/")
+	for i := range parts {
+		p := path.Join(dir, strings.Join(parts[:i+1], "/"))
+		if l.ignored(p, i < len(parts)-1) {
+			return true
+		}
+	}
+	return false
+}
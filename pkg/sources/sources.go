@@ -0,0 +1,403 @@
+// Package sources collects the files oak runs on from the files and
+// directories given on the command line.
+//
+// Directories are walked recursively, keeping the files that match the globs
+// of the collector and skipping the files ignored by .gitignore and
+// .oakignore files, by exclude patterns, and binary, generated or too large
+// files. Files named explicitly are always kept.
+package sources
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/go-go-golems/glazed/pkg/helpers/compare"
+	"github.com/pkg/errors"
+)
+
+// IgnoreFiles are the names of the files listing the files to skip in their
+// directory, in gitignore syntax. Later files take precedence, so that
+// .oakignore can re-include a file ignored by .gitignore.
+var IgnoreFiles = []string{".gitignore", ".oakignore"}
+
+// vcsDirectories are the directories that are never walked.
+var vcsDirectories = map[string]bool{".git": true, ".hg": true, ".svn": true}
+
+// headSize is the number of bytes looked at to detect binary and generated
+// files.
+const headSize = 8000
+
+// Collector collects the files of sources.
+type Collector struct {
+	globs         []string
+	excludes      []string
+	ignoreFiles   bool
+	maxFileSize   int64
+	skipBinary    bool
+	skipGenerated bool
+}
+
+// Option configures a Collector.
+type Option func(*Collector)
+
+// WithGlobs sets the glob patterns, relative to the directory, of the files
+// collected in directories. Directories are skipped if there are no globs.
+func WithGlobs(globs ...string) Option {
+	return func(c *Collector) {
+		c.globs = append(c.globs, globs...)
+	}
+}
+
+// WithExcludes skips the files matching patterns, in gitignore syntax and
+// relative to the directory, as if they were listed in an ignore file of
+// the directory.
+func WithExcludes(patterns ...string) Option {
+	return func(c *Collector) {
+		c.excludes = append(c.excludes, patterns...)
+	}
+}
+
+// WithIgnoreFiles sets whether the .gitignore and .oakignore files of
+// directories are read, which is the default.
+func WithIgnoreFiles(ignoreFiles bool) Option {
+	return func(c *Collector) {
+		c.ignoreFiles = ignoreFiles
+	}
+}
+
+// WithMaxFileSize skips the files of directories larger than size bytes. 0,
+// the default, doesn't limit the size of files.
+func WithMaxFileSize(size int64) Option {
+	return func(c *Collector) {
+		c.maxFileSize = size
+	}
+}
+
+// WithSkipBinary sets whether binary files are skipped in directories, which
+// is the default.
+func WithSkipBinary(skip bool) Option {
+	return func(c *Collector) {
+		c.skipBinary = skip
+	}
+}
+
+// WithSkipGenerated sets whether generated files, marked with a "Code
+// generated ... DO NOT EDIT." or "@generated" comment, are skipped in
+// directories, which is the default.
+func WithSkipGenerated(skip bool) Option {
+	return func(c *Collector) {
+		c.skipGenerated = skip
+	}
+}
+
+// NewCollector returns a collector with options.
+func NewCollector(options ...Option) *Collector {
+	c := &Collector{
+		ignoreFiles:   true,
+		skipBinary:    true,
+		skipGenerated: true,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// Collect returns the files of sources, sorted and without duplicates. Files
+// are returned as is, directories are expanded to the files they contain
+// that match the globs of the collector and are not skipped.
+func (c *Collector) Collect(sources []string) ([]string, error) {
+	ret := []string{}
+	for _, source := range sources {
+		fi, err := os.Stat(source)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			ret = append(ret, strings.TrimSuffix(source, "/"))
+			continue
+		}
+		if len(c.globs) == 0 {
+			continue
+		}
+		err = c.Walk(source, func(p string, d fs.DirEntry) error {
+			if !d.IsDir() {
+				ret = append(ret, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// remove duplicates, and sort so that the output doesn't depend on the order
+	// in which the files were found
+	ret = compare.RemoveDuplicates(ret)
+	sort.Strings(ret)
+
+	return ret, nil
+}
+
+// ignoreLists returns the patterns applying to the entries of dir, whose
+// absolute slash separated path is absDir, from ignore files and from the
+// excludes of the collector.
+func (c *Collector) ignoreLists(absDir string) (ignoreList, ignoreList, error) {
+	list := ignoreList{}
+	if c.ignoreFiles {
+		var err error
+		list, err = parentIgnoreList(absDir)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return list, parseIgnorePatterns(absDir, c.excludes), nil
+}
+
+// Walk walks dir like Collect, calling fn with each directory that isn't
+// skipped, before its content, and with each file that is collected. fn can
+// return filepath.SkipDir to skip a directory.
+func (c *Collector) Walk(dir string, fn func(p string, d fs.DirEntry) error) error {
+	dir = filepath.Clean(dir)
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	absDir = filepath.ToSlash(absDir)
+	root, excludes, err := c.ignoreLists(absDir)
+	if err != nil {
+		return err
+	}
+
+	// lists holds the ignore patterns applying to the entries of each walked
+	// directory
+	lists := map[string]ignoreList{}
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		absPath := path.Join(absDir, rel)
+
+		if d.IsDir() {
+			list := root
+			if p != dir {
+				if vcsDirectories[d.Name()] {
+					return filepath.SkipDir
+				}
+				list = lists[filepath.Dir(p)]
+				if list.ignored(absPath, true) || excludes.ignored(absPath, true) {
+					return filepath.SkipDir
+				}
+			}
+			if c.ignoreFiles {
+				own, err := readIgnoreFiles(p, absPath)
+				if err != nil {
+					return err
+				}
+				list = list.concat(own)
+			}
+			lists[p] = list
+			return fn(p, d)
+		}
+
+		if lists[filepath.Dir(p)].ignored(absPath, false) || excludes.ignored(absPath, false) {
+			return nil
+		}
+		matched, err := matchAny(c.globs, rel)
+		if err != nil || !matched {
+			return err
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			// skip broken links and links to directories
+			fi, err := os.Stat(p)
+			if err != nil || !fi.Mode().IsRegular() {
+				return nil
+			}
+		} else if !d.Type().IsRegular() {
+			return nil
+		}
+		keep, err := c.keepFile(p)
+		if err != nil || !keep {
+			return err
+		}
+		return fn(p, d)
+	})
+}
+
+// Skip returns true if Collect would skip fileName when walking the
+// directory dir, for example because it doesn't match the globs, is ignored
+// or is generated.
+func (c *Collector) Skip(dir string, fileName string) (bool, error) {
+	dir = filepath.Clean(dir)
+	rel, err := filepath.Rel(dir, fileName)
+	if err != nil {
+		return true, nil
+	}
+	rel = filepath.ToSlash(rel)
+	if rel == "." || rel == ".." || strings.HasPrefix(rel, "../") {
+		return true, nil
+	}
+	matched, err := matchAny(c.globs, rel)
+	if err != nil || !matched {
+		return true, err
+	}
+
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return false, err
+	}
+	absDir = filepath.ToSlash(absDir)
+	list, excludes, err := c.ignoreLists(absDir)
+	if err != nil {
+		return false, err
+	}
+	parts := strings.Split(rel, "/")
+	current, absCurrent := dir, absDir
+	for i, part := range parts {
+		if c.ignoreFiles {
+			own, err := readIgnoreFiles(current, absCurrent)
+			if err != nil {
+				return false, err
+			}
+			list = list.concat(own)
+		}
+		isDir := i < len(parts)-1
+		current, absCurrent = filepath.Join(current, part), path.Join(absCurrent, part)
+		if (isDir && vcsDirectories[part]) || list.ignored(absCurrent, isDir) || excludes.ignored(absCurrent, isDir) {
+			return true, nil
+		}
+	}
+
+	keep, err := c.keepFile(fileName)
+	return !keep, err
+}
+
+// keepFile returns false if fileName is too large, binary or generated.
+func (c *Collector) keepFile(fileName string) (bool, error) {
+	if c.maxFileSize == 0 && !c.skipBinary && !c.skipGenerated {
+		return true, nil
+	}
+
+	f, err := os.Open(fileName)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	if c.maxFileSize > 0 {
+		fi, err := f.Stat()
+		if err != nil {
+			return false, err
+		}
+		if fi.Size() > c.maxFileSize {
+			return false, nil
+		}
+	}
+	if !c.skipBinary && !c.skipGenerated {
+		return true, nil
+	}
+
+	head := make([]byte, headSize)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return false, errors.Wrapf(err, "could not read %s", fileName)
+	}
+	head = head[:n]
+	if c.skipBinary && IsBinary(head) {
+		return false, nil
+	}
+	if c.skipGenerated && IsGenerated(head) {
+		return false, nil
+	}
+	return true, nil
+}
+
+// Filter returns the files of a list of files, such as the files of a git
+// revision, that are in sources (the current directory if empty). Files
+// named in sources are always kept. The files of source directories are kept
+// if they match the globs of the collector and are not excluded. Ignore files
+// and the content of the files are not looked at.
+func (c *Collector) Filter(files []string, sources []string) ([]string, error) {
+	if len(sources) == 0 {
+		sources = []string{"."}
+	}
+
+	type sourceDir struct {
+		dir      string
+		excludes ignoreList
+	}
+	dirs := make([]sourceDir, 0, len(sources))
+	for _, source := range sources {
+		source = path.Clean(filepath.ToSlash(source))
+		dirs = append(dirs, sourceDir{dir: source, excludes: parseIgnorePatterns(source, c.excludes)})
+	}
+
+	ret := []string{}
+	for _, file := range files {
+		slashFile := filepath.ToSlash(file)
+		for _, source := range dirs {
+			if slashFile == source.dir {
+				ret = append(ret, file)
+				break
+			}
+			rel, ok := relativePath(source.dir, slashFile)
+			if !ok || source.excludes.ignoredPath(source.dir, rel) {
+				continue
+			}
+			matched, err := matchAny(c.globs, rel)
+			if err != nil {
+				return nil, err
+			}
+			if matched {
+				ret = append(ret, file)
+				break
+			}
+		}
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+func matchAny(globs []string, name string) (bool, error) {
+	for _, glob := range globs {
+		matched, err := doublestar.Match(glob, name)
+		if err != nil {
+			return false, errors.Wrapf(err, "invalid glob %s", glob)
+		}
+		if matched {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// relativePath returns p relative to the directory dir, and false if p is
+// not in dir. Both are slash separated paths.
+func relativePath(dir string, p string) (string, bool) {
+	switch {
+	case dir == ".":
+		if p == ".." || strings.HasPrefix(p, "../") || strings.HasPrefix(p, "/") {
+			return "", false
+		}
+		return p, true
+	case dir == "/":
+		return strings.TrimPrefix(p, "/"), strings.HasPrefix(p, "/") && p != "/"
+	case strings.HasPrefix(p, dir+"/"):
+		return strings.TrimPrefix(p, dir+"/"), true
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,124 @@
+package sources
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-go-golems/oak/internal/testutil"
+)
+
+func relativeFiles(t *testing.T, dir string, files []string) []string {
+	ret := []string{}
+	for _, file := range files {
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		ret = append(ret, filepath.ToSlash(rel))
+	}
+	return ret
+}
+
+func TestCollect(t *testing.T) {
+	dir := t.TempDir()
+	testutil.WriteFiles(t, dir, map[string]string{
+		".git/config":                 "",
+		".git/info/exclude":           "local.go\n",
+		".gitignore":                  "# build output\n/build/\nnode_modules/\n*.gen.go\n!keep.gen.go\n",
+		"main.go":                     "package main\n",
+		"local.go":                    "package main\n",
+		"api.pb.go":                   "// Code generated by protoc-gen-go. DO NOT EDIT.\n\npackage main\n",
+		"blob.go":                     "package main\x00",
+		"big.go":                      "package main\n\n// " + strings.Repeat("x", 100) + "\n",
+		"a.gen.go":                    "package main\n",
+		"keep.gen.go":                 "package main\n",
+		"build/out.go":                "package build\n",
+		"node_modules/x/index.js":     "",
+		"pkg/build/build.go":          "package build\n",
+		"pkg/lib.go":                  "package pkg\n",
+		"pkg/.oakignore":              "lib_test.go\nfixtures\n",
+		"pkg/lib_test.go":             "package pkg\n",
+		"pkg/fixtures/fixture.go":     "package fixtures\n",
+		"web/app.js":                  "/** @generated */\nexport {}\n",
+		"web/index.js":                "export {}\n",
+		"web/node_modules/y/index.js": "",
+	})
+
+	c := NewCollector(WithGlobs("**/*.go", "**/*.js"), WithMaxFileSize(100))
+	files, err := c.Collect([]string{dir})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	testutil.AssertLines(t, "files", []string{"keep.gen.go", "main.go", "pkg/build/build.go", "pkg/lib.go", "web/index.js"},
+		relativeFiles(t, dir, files))
+
+	// ignore files of the parent directories apply to sources in subdirectories
+	files, err = c.Collect([]string{filepath.Join(dir, "pkg"), filepath.Join(dir, "pkg", "lib_test.go")})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	testutil.AssertLines(t, "files", []string{"pkg/build/build.go", "pkg/lib.go", "pkg/lib_test.go"}, relativeFiles(t, dir, files))
+
+	c = NewCollector(WithGlobs("**/*.go"), WithIgnoreFiles(false), WithSkipGenerated(false),
+		WithExcludes("build/", "pkg/**/*_test.go", "*.gen.go"))
+	files, err = c.Collect([]string{dir})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// unanchored patterns match at any depth
+	testutil.AssertLines(t, "files", []string{"api.pb.go", "big.go", "local.go", "main.go", "pkg/fixtures/fixture.go", "pkg/lib.go"},
+		relativeFiles(t, dir, files))
+
+	// directories are skipped without globs
+	files, err = NewCollector().Collect([]string{dir, filepath.Join(dir, "main.go")})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	testutil.AssertLines(t, "files", []string{"main.go"}, relativeFiles(t, dir, files))
+}
+
+func TestFilter(t *testing.T) {
+	files := []string{"a.go", "a.ts", "sub/b.go", "sub/c.md", "sub/gen/d.go", "../cmd/main.go"}
+
+	for _, test := range []struct {
+		sources  []string
+		globs    []string
+		excludes []string
+		expected []string
+	}{
+		{nil, []string{"**/*.go"}, nil, []string{"a.go", "sub/b.go", "sub/gen/d.go"}},
+		{[]string{"sub/"}, []string{"**/*.go"}, nil, []string{"sub/b.go", "sub/gen/d.go"}},
+		// files named in sources don't need to match the globs
+		{[]string{"sub", "a.ts"}, []string{"**/*.go"}, nil, []string{"a.ts", "sub/b.go", "sub/gen/d.go"}},
+		{[]string{"../cmd"}, []string{"*.go"}, nil, []string{"../cmd/main.go"}},
+		{[]string{"."}, []string{"*.go"}, nil, []string{"a.go"}},
+		{nil, []string{"**/*.go"}, []string{"gen/"}, []string{"a.go", "sub/b.go"}},
+		{[]string{"sub"}, []string{"**/*.go"}, []string{"/b.go"}, []string{"sub/gen/d.go"}},
+	} {
+		c := NewCollector(WithGlobs(test.globs...), WithExcludes(test.excludes...))
+		actual, err := c.Filter(files, test.sources)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		testutil.AssertLines(t, "files", test.expected, actual)
+	}
+}
+
+func TestIsGenerated(t *testing.T) {
+	for _, test := range []struct {
+		head      string
+		generated bool
+	}{
+		{"// Code generated by stringer; DO NOT EDIT.\n\npackage x\n", true},
+		{"// Copyright 2024\n\n// Code generated by mockgen. DO NOT EDIT.\npackage x\n", true},
+		{"# Code generated by a tool. DO NOT EDIT.\nx = 1\n", true},
+		{"/**\n * @generated\n */\n", true},
+		{"package x\n\n// generated code is skipped\n", false},
+		{"// This comment says Code generated without the marker\n", false},
+	} {
+		if IsGenerated([]byte(test.head)) != test.generated {
+			t.Errorf("Expected IsGenerated to be %v for %q", test.generated, test.head)
+		}
+	}
+}
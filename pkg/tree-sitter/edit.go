@@ -0,0 +1,54 @@
+package tree_sitter
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// Edit replaces the bytes between StartByte and EndByte of a source file
+// with Replacement.
+type Edit struct {
+	StartByte   uint32
+	EndByte     uint32
+	Replacement string
+	// Origin describes where the edit comes from, for example the query and
+	// capture of a rewrite, and is used when reporting conflicts.
+	Origin string
+}
+
+// describe returns the origin and the range of the edit, for error messages.
+func (e Edit) describe() string {
+	if e.Origin == "" {
+		return fmt.Sprintf("[%d-%d]", e.StartByte, e.EndByte)
+	}
+	return fmt.Sprintf("%s [%d-%d]", e.Origin, e.StartByte, e.EndByte)
+}
+
+// ApplyEdits applies the given edits to source and returns the edited copy.
+// Edits are applied in order of their start offset, and must not overlap.
+func ApplyEdits(source []byte, edits []Edit) ([]byte, error) {
+	sorted := make([]Edit, len(edits))
+	copy(sorted, edits)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].StartByte < sorted[j].StartByte
+	})
+
+	ret := make([]byte, 0, len(source))
+	last := uint32(0)
+	for _, e := range sorted {
+		if e.StartByte > e.EndByte || int(e.EndByte) > len(source) {
+			return nil, errors.Errorf("edit [%d-%d] is out of bounds", e.StartByte, e.EndByte)
+		}
+		if e.StartByte < last {
+			return nil, errors.Errorf("edit [%d-%d] overlaps a previous edit", e.StartByte, e.EndByte)
+		}
+		ret = append(ret, source[last:e.StartByte]...)
+		ret = append(ret, e.Replacement...)
+		last = e.EndByte
+	}
+	ret = append(ret, source[last:]...)
+
+	return ret, nil
+}
@@ -0,0 +1,292 @@
+package tree_sitter
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// ConflictPolicy decides what happens when edits to the same file overlap.
+type ConflictPolicy string
+
+const (
+	// ConflictFail refuses to apply overlapping edits.
+	ConflictFail ConflictPolicy = "fail"
+	// ConflictOutermost keeps the largest of overlapping edits and drops the
+	// edits nested in or overlapping with it.
+	ConflictOutermost ConflictPolicy = "outermost"
+	// ConflictInnermost keeps the smallest of overlapping edits and drops the
+	// edits containing or overlapping with it.
+	ConflictInnermost ConflictPolicy = "innermost"
+	// ConflictMerge applies nested edits inside the replacement of the edit
+	// containing them. This only works if that replacement contains the
+	// original text of the outer range verbatim, for example when wrapping a
+	// function body whose name is renamed at the same time.
+	ConflictMerge ConflictPolicy = "merge"
+)
+
+func ParseConflictPolicy(s string) (ConflictPolicy, error) {
+	switch ConflictPolicy(s) {
+	case "":
+		return ConflictFail, nil
+	case ConflictFail, ConflictOutermost, ConflictInnermost, ConflictMerge:
+		return ConflictPolicy(s), nil
+	default:
+		return "", errors.Errorf("unknown conflict policy %s", s)
+	}
+}
+
+// DroppedEdit is an edit that was not applied because it overlapped with
+// another edit that was kept.
+type DroppedEdit struct {
+	Edit   Edit
+	KeptBy Edit
+}
+
+// EditReport lists, for a single file, the edits that were applied and the
+// ones that were dropped while resolving conflicts.
+type EditReport struct {
+	File    string
+	Applied []Edit
+	Dropped []DroppedEdit
+}
+
+// EditSet collects edits per file, and resolves overlapping edits according
+// to its ConflictPolicy before applying them.
+type EditSet struct {
+	Policy ConflictPolicy
+	edits  map[string][]Edit
+}
+
+func NewEditSet(policy ConflictPolicy) *EditSet {
+	return &EditSet{
+		Policy: policy,
+		edits:  map[string][]Edit{},
+	}
+}
+
+func (es *EditSet) Add(fileName string, edits ...Edit) {
+	es.edits[fileName] = append(es.edits[fileName], edits...)
+}
+
+// Files returns the names of the files that have edits, sorted.
+func (es *EditSet) Files() []string {
+	ret := make([]string, 0, len(es.edits))
+	for fileName, edits := range es.edits {
+		if len(edits) > 0 {
+			ret = append(ret, fileName)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Apply resolves the edits collected for fileName and applies them to source.
+func (es *EditSet) Apply(fileName string, source []byte) ([]byte, *EditReport, error) {
+	applied, dropped, err := ResolveEdits(source, es.edits[fileName], es.Policy)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "could not resolve edits for file %s", fileName)
+	}
+
+	ret, err := ApplyEdits(source, applied)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "could not apply edits to file %s", fileName)
+	}
+
+	return ret, &EditReport{
+		File:    fileName,
+		Applied: applied,
+		Dropped: dropped,
+	}, nil
+}
+
+// overlaps returns true if both edits touch a common byte. Insertions (empty
+// edits) only overlap with edits that strictly contain their offset, so that
+// two insertions at the same offset are both applied, in order.
+func (e Edit) overlaps(other Edit) bool {
+	return e.StartByte < other.EndByte && other.StartByte < e.EndByte
+}
+
+func (e Edit) contains(other Edit) bool {
+	return e.StartByte <= other.StartByte && other.EndByte <= e.EndByte
+}
+
+func (e Edit) length() uint32 {
+	return e.EndByte - e.StartByte
+}
+
+// before orders edits by offset. At the same offset, insertions come first,
+// so that they can be applied, then larger edits come before the edits they
+// contain.
+func (e Edit) before(other Edit) bool {
+	if e.StartByte != other.StartByte {
+		return e.StartByte < other.StartByte
+	}
+	if (e.length() == 0) != (other.length() == 0) {
+		return e.length() == 0
+	}
+	return e.EndByte > other.EndByte
+}
+
+// ResolveEdits sorts edits by offset and resolves overlapping edits according
+// to policy. It returns the non-overlapping edits to apply, and the edits
+// that were dropped. Identical edits are collapsed into one, whatever the
+// policy.
+//
+// source is only needed for ConflictMerge, to find the original text of the
+// outer edits in their replacements.
+func ResolveEdits(source []byte, edits []Edit, policy ConflictPolicy) ([]Edit, []DroppedEdit, error) {
+	type editKey struct {
+		startByte   uint32
+		endByte     uint32
+		replacement string
+	}
+	seen := map[editKey]bool{}
+
+	sorted := make([]Edit, 0, len(edits))
+	for _, e := range edits {
+		if e.StartByte > e.EndByte || int(e.EndByte) > len(source) {
+			return nil, nil, errors.Errorf("edit [%d-%d] is out of bounds", e.StartByte, e.EndByte)
+		}
+		// identical edits, for example from two queries matching the same node
+		key := editKey{e.StartByte, e.EndByte, e.Replacement}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		sorted = append(sorted, e)
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].before(sorted[j])
+	})
+
+	var ret []Edit
+	var dropped []DroppedEdit
+
+	// split the sorted edits into groups of transitively overlapping edits
+	for i := 0; i < len(sorted); {
+		group := []Edit{sorted[i]}
+		end := sorted[i].EndByte
+		j := i + 1
+		for ; j < len(sorted) && sorted[j].StartByte < end; j++ {
+			group = append(group, sorted[j])
+			if sorted[j].EndByte > end {
+				end = sorted[j].EndByte
+			}
+		}
+		i = j
+
+		if len(group) == 1 {
+			ret = append(ret, group[0])
+			continue
+		}
+
+		switch policy {
+		case ConflictFail, "":
+			return nil, nil, errors.Errorf("edit %s overlaps edit %s", group[1].describe(), group[0].describe())
+
+		case ConflictOutermost, ConflictInnermost:
+			kept, dropped_ := resolveBySize(group, policy == ConflictOutermost)
+			ret = append(ret, kept...)
+			dropped = append(dropped, dropped_...)
+
+		case ConflictMerge:
+			merged, err := mergeEdits(source, group)
+			if err != nil {
+				return nil, nil, err
+			}
+			ret = append(ret, merged)
+
+		default:
+			return nil, nil, errors.Errorf("unknown conflict policy %s", policy)
+		}
+	}
+
+	return ret, dropped, nil
+}
+
+// resolveBySize keeps the edits of group, largest (outermost) or smallest
+// first, as long as they don't overlap an edit that was already kept.
+func resolveBySize(group []Edit, outermost bool) ([]Edit, []DroppedEdit) {
+	bySize := make([]Edit, len(group))
+	copy(bySize, group)
+	sort.SliceStable(bySize, func(i, j int) bool {
+		if outermost {
+			return bySize[i].length() > bySize[j].length()
+		}
+		return bySize[i].length() < bySize[j].length()
+	})
+
+	var kept []Edit
+	var dropped []DroppedEdit
+	for _, e := range bySize {
+		overlapping := -1
+		for idx, k := range kept {
+			if e.overlaps(k) {
+				overlapping = idx
+				break
+			}
+		}
+		if overlapping >= 0 {
+			dropped = append(dropped, DroppedEdit{Edit: e, KeptBy: kept[overlapping]})
+			continue
+		}
+		kept = append(kept, e)
+	}
+
+	sort.SliceStable(kept, func(i, j int) bool {
+		return kept[i].before(kept[j])
+	})
+	return kept, dropped
+}
+
+// mergeEdits merges a group of overlapping edits into a single edit. The
+// group is sorted by offset, so its first edit has to contain all the others.
+// The nested edits are merged recursively, and then applied to the copy of
+// the original text found in the replacement of the outer edit.
+func mergeEdits(source []byte, group []Edit) (Edit, error) {
+	outer := group[0]
+	for _, e := range group[1:] {
+		if !outer.contains(e) {
+			return Edit{}, errors.Errorf("cannot merge edit %s partially overlapping edit %s",
+				e.describe(), outer.describe())
+		}
+		if e.StartByte == outer.StartByte && e.EndByte == outer.EndByte {
+			return Edit{}, errors.Errorf("cannot merge different replacements for edit [%d-%d]",
+				e.StartByte, e.EndByte)
+		}
+	}
+
+	original := source[outer.StartByte:outer.EndByte]
+	replacement := []byte(outer.Replacement)
+	idx := bytes.Index(replacement, original)
+	if len(original) == 0 || idx < 0 || bytes.Index(replacement[idx+1:], original) >= 0 {
+		return Edit{}, errors.Errorf("cannot merge edits nested in edit [%d-%d]: its replacement does not contain its original text exactly once",
+			outer.StartByte, outer.EndByte)
+	}
+
+	// shift the nested edits so that they apply to the original text
+	nested := make([]Edit, 0, len(group)-1)
+	for _, e := range group[1:] {
+		e.StartByte -= outer.StartByte
+		e.EndByte -= outer.StartByte
+		nested = append(nested, e)
+	}
+	nested, _, err := ResolveEdits(original, nested, ConflictMerge)
+	if err != nil {
+		return Edit{}, err
+	}
+	inner, err := ApplyEdits(original, nested)
+	if err != nil {
+		return Edit{}, err
+	}
+
+	merged := make([]byte, 0, len(replacement)-len(original)+len(inner))
+	merged = append(merged, replacement[:idx]...)
+	merged = append(merged, inner...)
+	merged = append(merged, replacement[idx+len(original):]...)
+
+	outer.Replacement = string(merged)
+	return outer, nil
+}
@@ -0,0 +1,74 @@
+package tree_sitter
+
+import (
+	"testing"
+)
+
+// source has a function body containing its name
+const editSetSource = "func foo() { foo() }"
+
+var (
+	renameDecl = Edit{StartByte: 5, EndByte: 8, Replacement: "bar", Origin: "decl.name"}
+	renameCall = Edit{StartByte: 13, EndByte: 16, Replacement: "bar", Origin: "call.name"}
+	wrapBody   = Edit{StartByte: 11, EndByte: 20, Replacement: "{ defer x(); { foo() } }", Origin: "body.body"}
+)
+
+func TestResolveEditsPolicies(t *testing.T) {
+	tests := []struct {
+		policy   ConflictPolicy
+		expected string
+		dropped  int
+	}{
+		{ConflictOutermost, "func bar() { defer x(); { foo() } }", 1},
+		{ConflictInnermost, "func bar() { bar() }", 1},
+		{ConflictMerge, "func bar() { defer x(); { bar() } }", 0},
+	}
+
+	for _, tt := range tests {
+		es := NewEditSet(tt.policy)
+		es.Add("test.go", renameDecl, renameCall, wrapBody)
+		ret, report, err := es.Apply("test.go", []byte(editSetSource))
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.policy, err)
+		}
+		if string(ret) != tt.expected {
+			t.Fatalf("%s: expected %q, got %q", tt.policy, tt.expected, string(ret))
+		}
+		if len(report.Dropped) != tt.dropped {
+			t.Fatalf("%s: expected %d dropped edits, got %v", tt.policy, tt.dropped, report.Dropped)
+		}
+	}
+}
+
+func TestResolveEditsFail(t *testing.T) {
+	_, _, err := ResolveEdits([]byte(editSetSource), []Edit{renameCall, wrapBody}, ConflictFail)
+	if err == nil {
+		t.Fatalf("Expected overlapping edits to fail")
+	}
+	expected := "edit call.name [13-16] overlaps edit body.body [11-20]"
+	if err.Error() != expected {
+		t.Fatalf("Expected %q, got %q", expected, err.Error())
+	}
+
+	// identical edits and insertions at the same offset are not conflicts
+	insert := Edit{StartByte: 5, EndByte: 5, Replacement: "_"}
+	edits, _, err := ResolveEdits([]byte(editSetSource), []Edit{renameDecl, insert, renameDecl, renameCall}, ConflictFail)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ret, err := ApplyEdits([]byte(editSetSource), edits)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(ret) != "func _bar() { bar() }" {
+		t.Fatalf("Unexpected result %q", string(ret))
+	}
+}
+
+func TestResolveEditsMergeNeedsOriginalText(t *testing.T) {
+	replaceBody := Edit{StartByte: 11, EndByte: 20, Replacement: "{}"}
+	_, _, err := ResolveEdits([]byte(editSetSource), []Edit{renameCall, replaceBody}, ConflictMerge)
+	if err == nil {
+		t.Fatalf("Expected merge to fail when the outer replacement drops the original text")
+	}
+}
@@ -0,0 +1,102 @@
+package tree_sitter
+
+import (
+	"fmt"
+
+	sitter "github.com/smacker/go-tree-sitter"
+)
+
+// SyntaxError is a node tree-sitter inserted to recover from a syntax error:
+// an ERROR node spanning the code that could not be parsed, or a MISSING node
+// of zero width where a token was expected.
+type SyntaxError struct {
+	// Missing is true for MISSING nodes, false for ERROR nodes.
+	Missing bool `json:",omitempty"`
+	// Type is the type of the missing node, such as ";" or "identifier", and
+	// "ERROR" for ERROR nodes.
+	Type       string
+	StartByte  uint32
+	EndByte    uint32
+	StartPoint sitter.Point
+	EndPoint   sitter.Point
+}
+
+// Kind returns "missing" or "error".
+func (e SyntaxError) Kind() string {
+	if e.Missing {
+		return "missing"
+	}
+	return "error"
+}
+
+// Message describes the error, such as "missing ;" or "syntax error".
+func (e SyntaxError) Message() string {
+	if e.Missing {
+		return "missing " + e.Type
+	}
+	return "syntax error"
+}
+
+// String returns the 1-based line and column of the error and its message.
+func (e SyntaxError) String() string {
+	return fmt.Sprintf("%d:%d: %s", e.StartPoint.Row+1, e.StartPoint.Column+1, e.Message())
+}
+
+// ParseHealth describes how cleanly a file parsed. Tree-sitter always
+// produces a tree, so code it couldn't parse is only visible as ERROR and
+// MISSING nodes, which queries usually don't match.
+type ParseHealth struct {
+	HasError     bool
+	ErrorCount   int
+	MissingCount int
+	// Errors are the outermost ERROR nodes and the MISSING nodes, in the
+	// order of the source.
+	Errors []SyntaxError `json:",omitempty"`
+}
+
+// CheckParseHealth collects the syntax errors of the tree rooted at root.
+// Only the subtrees containing errors are visited, so checking a tree that
+// parsed cleanly is cheap.
+func CheckParseHealth(root *sitter.Node) ParseHealth {
+	ret := ParseHealth{}
+	if root == nil || !root.HasError() {
+		return ret
+	}
+	ret.HasError = true
+
+	var visit func(n *sitter.Node)
+	visit = func(n *sitter.Node) {
+		switch {
+		case n.IsMissing():
+			ret.MissingCount++
+			ret.Errors = append(ret.Errors, newSyntaxError(n, true))
+			return
+		case n.IsError():
+			// the content of an ERROR node is whatever the parser could make
+			// of the broken code, nested errors don't add information
+			ret.ErrorCount++
+			ret.Errors = append(ret.Errors, newSyntaxError(n, false))
+			return
+		}
+		for i := 0; i < int(n.ChildCount()); i++ {
+			child := n.Child(i)
+			if child != nil && child.HasError() {
+				visit(child)
+			}
+		}
+	}
+	visit(root)
+
+	return ret
+}
+
+func newSyntaxError(n *sitter.Node, missing bool) SyntaxError {
+	return SyntaxError{
+		Missing:    missing,
+		Type:       n.Type(),
+		StartByte:  n.StartByte(),
+		EndByte:    n.EndByte(),
+		StartPoint: n.StartPoint(),
+		EndPoint:   n.EndPoint(),
+	}
+}
@@ -0,0 +1,47 @@
+package tree_sitter
+
+import (
+	"context"
+	"testing"
+
+	sitter "github.com/smacker/go-tree-sitter"
+	"github.com/smacker/go-tree-sitter/golang"
+)
+
+func parseHealth(t *testing.T, source string) ParseHealth {
+	parser := sitter.NewParser()
+	parser.SetLanguage(golang.GetLanguage())
+	tree, err := parser.ParseCtx(context.Background(), nil, []byte(source))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer tree.Close()
+	return CheckParseHealth(tree.RootNode())
+}
+
+func TestCheckParseHealth(t *testing.T) {
+	health := parseHealth(t, "package test\n\nfunc f() {}\n")
+	if health.HasError || len(health.Errors) != 0 {
+		t.Fatalf("Expected no errors, got %v", health)
+	}
+
+	health = parseHealth(t, "package test\n\nfunc f() {\n\tx := )\n}\n")
+	if !health.HasError || health.ErrorCount == 0 || len(health.Errors) != health.ErrorCount+health.MissingCount {
+		t.Fatalf("Expected errors, got %v", health)
+	}
+	e := health.Errors[0]
+	if e.Missing || e.Type != "ERROR" || e.StartPoint.Row != 3 {
+		t.Fatalf("Expected an ERROR node on line 4, got %v", e)
+	}
+}
+
+func TestCheckParseHealthMissing(t *testing.T) {
+	health := parseHealth(t, "package test\n\nfunc f() {\n\tg(1, 2\n}\n")
+	if health.MissingCount != 1 {
+		t.Fatalf("Expected a missing node, got %v", health)
+	}
+	e := health.Errors[0]
+	if !e.Missing || e.Type != ")" || e.String() != "4:8: missing )" {
+		t.Fatalf("Expected a missing ), got %v", e)
+	}
+}
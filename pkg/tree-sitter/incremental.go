@@ -0,0 +1,54 @@
+package tree_sitter
+
+import (
+	sitter "github.com/smacker/go-tree-sitter"
+)
+
+// ComputeEditInput returns the edit turning oldSource into newSource, to be
+// passed to sitter.Tree.Edit before reparsing newSource incrementally.
+//
+// The edit covers the bytes between the common prefix and the common suffix
+// of both sources, which is exact for the usual case of a single change
+// between two saves, and still correct (if less precise) for several. ok is
+// false if both sources are identical.
+func ComputeEditInput(oldSource []byte, newSource []byte) (sitter.EditInput, bool) {
+	prefix := 0
+	for prefix < len(oldSource) && prefix < len(newSource) && oldSource[prefix] == newSource[prefix] {
+		prefix++
+	}
+	if prefix == len(oldSource) && prefix == len(newSource) {
+		return sitter.EditInput{}, false
+	}
+
+	suffix := 0
+	for suffix < len(oldSource)-prefix && suffix < len(newSource)-prefix &&
+		oldSource[len(oldSource)-1-suffix] == newSource[len(newSource)-1-suffix] {
+		suffix++
+	}
+
+	oldEnd := len(oldSource) - suffix
+	newEnd := len(newSource) - suffix
+
+	return sitter.EditInput{
+		StartIndex:  uint32(prefix),
+		OldEndIndex: uint32(oldEnd),
+		NewEndIndex: uint32(newEnd),
+		StartPoint:  pointAt(oldSource, prefix),
+		OldEndPoint: pointAt(oldSource, oldEnd),
+		NewEndPoint: pointAt(newSource, newEnd),
+	}, true
+}
+
+// pointAt returns the row and byte column of offset in source.
+func pointAt(source []byte, offset int) sitter.Point {
+	p := sitter.Point{}
+	for _, c := range source[:offset] {
+		if c == '\n' {
+			p.Row++
+			p.Column = 0
+		} else {
+			p.Column++
+		}
+	}
+	return p
+}
@@ -0,0 +1,72 @@
+package tree_sitter
+
+import (
+	"context"
+	"testing"
+
+	sitter "github.com/smacker/go-tree-sitter"
+	"github.com/smacker/go-tree-sitter/golang"
+)
+
+func TestComputeEditInput(t *testing.T) {
+	oldSource := []byte("package x\n\nfunc a() {}\n")
+	newSource := []byte("package x\n\nfunc abc() {}\n")
+
+	edit, ok := ComputeEditInput(oldSource, newSource)
+	if !ok {
+		t.Fatalf("Expected an edit")
+	}
+	expected := sitter.EditInput{
+		StartIndex:  17,
+		OldEndIndex: 17,
+		NewEndIndex: 19,
+		StartPoint:  sitter.Point{Row: 2, Column: 6},
+		OldEndPoint: sitter.Point{Row: 2, Column: 6},
+		NewEndPoint: sitter.Point{Row: 2, Column: 8},
+	}
+	if edit != expected {
+		t.Fatalf("Expected %+v, got %+v", expected, edit)
+	}
+
+	if _, ok := ComputeEditInput(oldSource, oldSource); ok {
+		t.Fatalf("Expected no edit for identical sources")
+	}
+}
+
+func TestIncrementalReparse(t *testing.T) {
+	sources := []string{
+		"package x\n\nfunc a() {}\n",
+		"package x\n\nfunc a() {}\n\nfunc b(x int) {}\n",
+		"package x\n\nfunc b(x int) {}\n",
+		"package x\n\ntype T struct{}\n\nfunc b(x int) {}\n",
+	}
+
+	parser := sitter.NewParser()
+	parser.SetLanguage(golang.GetLanguage())
+	ctx := context.Background()
+
+	tree, err := parser.ParseCtx(ctx, nil, []byte(sources[0]))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for i := 1; i < len(sources); i++ {
+		edit, ok := ComputeEditInput([]byte(sources[i-1]), []byte(sources[i]))
+		if !ok {
+			t.Fatalf("Expected an edit")
+		}
+		tree.Edit(edit)
+		tree, err = parser.ParseCtx(ctx, tree, []byte(sources[i]))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		fresh, err := parser.ParseCtx(ctx, nil, []byte(sources[i]))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if tree.RootNode().String() != fresh.RootNode().String() {
+			t.Fatalf("Incremental parse differs from a fresh parse:\n%s\n%s",
+				tree.RootNode().String(), fresh.RootNode().String())
+		}
+	}
+}
@@ -0,0 +1,410 @@
+package tree_sitter
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/pkg/errors"
+	sitter "github.com/smacker/go-tree-sitter"
+)
+
+const (
+	// InjectionContentCapture captures the nodes containing the embedded code.
+	InjectionContentCapture = "injection.content"
+	// InjectionLanguageCapture optionally captures a node whose text is the
+	// name of the embedded language, for injections without a Language.
+	InjectionLanguageCapture = "injection.language"
+
+	// maxInjectionDepth limits how deep injections are followed, for example
+	// php -> html -> javascript.
+	maxInjectionDepth = 4
+)
+
+// Injection declares that the nodes captured as @injection.content by Query,
+// in code of the language Host, contain code of the language Language. This
+// mirrors the injections.scm files of tree-sitter grammars.
+//
+// Each captured node is parsed on its own, unless Combined is set, in which
+// case all the nodes captured in a file are parsed together as a single
+// document, which is how the HTML around PHP code has to be parsed.
+type Injection struct {
+	// Host is the language the query runs on. An empty Host is the language
+	// of the file.
+	Host     string `yaml:"host,omitempty"`
+	Language string `yaml:"language,omitempty"`
+	Query    string `yaml:"query"`
+	Combined bool   `yaml:"combined,omitempty"`
+}
+
+// DefaultInjections are the injections used for the grammars shipped with oak.
+var DefaultInjections = []Injection{
+	{
+		Host:     "html",
+		Language: "javascript",
+		Query:    "(script_element (raw_text) @injection.content)",
+	},
+	{
+		Host:     "html",
+		Language: "css",
+		Query:    "(style_element (raw_text) @injection.content)",
+	},
+	{
+		Host:     "svelte",
+		Language: "javascript",
+		Query:    "(script_element (raw_text) @injection.content)",
+	},
+	{
+		Host:     "svelte",
+		Language: "css",
+		Query:    "(style_element (raw_text) @injection.content)",
+	},
+	{
+		Host:     "php",
+		Language: "html",
+		Query:    "(text) @injection.content",
+		Combined: true,
+	},
+}
+
+// MergeInjections returns injections followed by the defaults that don't
+// inject the same language into the same host, so that an injection declared
+// by a command replaces the default one.
+func MergeInjections(defaults []Injection, injections []Injection) []Injection {
+	ret := append([]Injection{}, injections...)
+	for _, d := range defaults {
+		overridden := false
+		for _, i := range injections {
+			if i.Host == d.Host && i.Language == d.Language {
+				overridden = true
+				break
+			}
+		}
+		if !overridden {
+			ret = append(ret, d)
+		}
+	}
+	return ret
+}
+
+// LanguageResolver returns the grammar of a language name.
+type LanguageResolver func(name string) (*sitter.Language, error)
+
+// InjectionSet runs queries on the code embedded in a file. Queries with a
+// Language other than the language of the file are run on the regions of the
+// file where that language is injected, and their captures keep the byte and
+// point coordinates of the host file.
+type InjectionSet struct {
+	Injections []Injection
+	Resolve    LanguageResolver
+}
+
+func NewInjectionSet(resolve LanguageResolver, injections ...Injection) *InjectionSet {
+	return &InjectionSet{
+		Injections: injections,
+		Resolve:    resolve,
+	}
+}
+
+// injectedRegion is a part of a file parsed with an injected language.
+type injectedRegion struct {
+	languageName string
+	lang         *sitter.Language
+	tree         *sitter.Tree
+}
+
+// splitQueries returns the queries to run on the language of the file, and the
+// other queries by language.
+func splitQueries(languageName string, queries []SitterQuery) ([]SitterQuery, map[string][]SitterQuery) {
+	host := []SitterQuery{}
+	injected := map[string][]SitterQuery{}
+	for _, q := range queries {
+		if q.Language == "" || q.Language == languageName {
+			host = append(host, q)
+			continue
+		}
+		injected[q.Language] = append(injected[q.Language], q)
+	}
+	return host, injected
+}
+
+// Compile compiles queries and the injection queries they need, to report
+// errors before processing any file.
+func (is *InjectionSet) Compile(
+	languageName string,
+	lang *sitter.Language,
+	queries []SitterQuery,
+	options ...ExecuteOption,
+) error {
+	host, injected := splitQueries(languageName, queries)
+	err := DefaultQueryCache.Compile(lang, host, options...)
+	if err != nil {
+		return err
+	}
+
+	for name, queries := range injected {
+		injectedLang, err := is.Resolve(name)
+		if err != nil {
+			return err
+		}
+		err = DefaultQueryCache.Compile(injectedLang, queries, options...)
+		if err != nil {
+			return err
+		}
+	}
+
+	// only the injections reachable from languageName are used
+	hosts := []string{languageName}
+	seen := map[string]bool{languageName: true}
+	for len(hosts) > 0 {
+		hostName := hosts[0]
+		hosts = hosts[1:]
+
+		for i, injection := range is.Injections {
+			if injection.Host != hostName && (injection.Host != "" || hostName != languageName) {
+				continue
+			}
+			hostLang := lang
+			if hostName != languageName {
+				hostLang, err = is.Resolve(hostName)
+				if err != nil {
+					return err
+				}
+			}
+			_, err = DefaultQueryCache.Get(hostLang, injection.sitterQuery(i))
+			if err != nil {
+				return err
+			}
+			if injection.Language != "" && !seen[injection.Language] {
+				seen[injection.Language] = true
+				hosts = append(hosts, injection.Language)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (i Injection) sitterQuery(idx int) SitterQuery {
+	return SitterQuery{
+		Name:  fmt.Sprintf("injection %d (%s in %s)", idx, i.Language, i.Host),
+		Query: i.Query,
+	}
+}
+
+// ExecuteQueries runs queries on the file parsed as tree, whose language is
+// languageName. Queries for the language of the file are run as with
+// ExecuteQueries, the others are run on the injected regions of their
+// language. The Language of the results of injected queries is set to the
+// injected language.
+func (is *InjectionSet) ExecuteQueries(
+	ctx context.Context,
+	languageName string,
+	lang *sitter.Language,
+	tree *sitter.Node,
+	queries []SitterQuery,
+	sourceCode []byte,
+	options ...ExecuteOption,
+) (QueryResults, error) {
+	host, injected := splitQueries(languageName, queries)
+
+	results, err := ExecuteQueries(lang, tree, host, sourceCode, withLanguageName(options, languageName)...)
+	if err != nil {
+		return nil, err
+	}
+	if len(injected) == 0 {
+		return results, nil
+	}
+
+	for name, queries := range injected {
+		for _, q := range queries {
+			results[q.Name] = &Result{QueryName: q.Name, Language: name, Matches: []Match{}}
+		}
+	}
+
+	regions := []injectedRegion{}
+	defer func() {
+		for _, r := range regions {
+			r.tree.Close()
+		}
+	}()
+	err = is.collectRegions(ctx, languageName, lang, tree, sourceCode, true, 0, &regions)
+	if err != nil {
+		return nil, err
+	}
+
+	// merge the matches of all regions in the order of the file
+	sort.SliceStable(regions, func(i, j int) bool {
+		return regions[i].tree.RootNode().StartByte() < regions[j].tree.RootNode().StartByte()
+	})
+	for _, region := range regions {
+		queries, ok := injected[region.languageName]
+		if !ok {
+			continue
+		}
+		regionResults, err := ExecuteQueries(region.lang, region.tree.RootNode(), queries, sourceCode,
+			withLanguageName(options, region.languageName)...)
+		if err != nil {
+			return nil, err
+		}
+		for name, r := range regionResults {
+			results[name].Matches = append(results[name].Matches, r.Matches...)
+		}
+	}
+
+	return results, nil
+}
+
+// withLanguageName returns options followed by WithLanguageName(name),
+// without modifying options.
+func withLanguageName(options []ExecuteOption, name string) []ExecuteOption {
+	return append(options[:len(options):len(options)], WithLanguageName(name))
+}
+
+// collectRegions parses the regions injected into tree, and recursively the
+// regions injected into those.
+func (is *InjectionSet) collectRegions(
+	ctx context.Context,
+	languageName string,
+	lang *sitter.Language,
+	tree *sitter.Node,
+	sourceCode []byte,
+	isFile bool,
+	depth int,
+	regions *[]injectedRegion,
+) error {
+	if depth >= maxInjectionDepth {
+		return nil
+	}
+
+	parser := sitter.NewParser()
+	defer parser.Close()
+
+	for i, injection := range is.Injections {
+		if injection.Host != languageName && (injection.Host != "" || !isFile) {
+			continue
+		}
+
+		ranges, err := is.injectedRanges(lang, tree, injection, i, sourceCode)
+		if err != nil {
+			return err
+		}
+
+		for name, ranges_ := range ranges {
+			injectedLang, err := is.Resolve(name)
+			if err != nil {
+				if injection.Language == "" {
+					// languages captured from the source, such as the info
+					// string of a markdown code block, can be anything
+					continue
+				}
+				return errors.Wrapf(err, "could not resolve injected language %s", name)
+			}
+
+			groups := [][]sitter.Range{ranges_}
+			if !injection.Combined {
+				groups = make([][]sitter.Range, 0, len(ranges_))
+				for _, r := range ranges_ {
+					groups = append(groups, []sitter.Range{r})
+				}
+			}
+
+			for _, group := range groups {
+				parser.SetLanguage(injectedLang)
+				parser.SetIncludedRanges(group)
+				injectedTree, err := parser.ParseCtx(ctx, nil, sourceCode)
+				if err != nil {
+					return errors.Wrapf(err, "could not parse injected %s", name)
+				}
+				*regions = append(*regions, injectedRegion{
+					languageName: name,
+					lang:         injectedLang,
+					tree:         injectedTree,
+				})
+
+				err = is.collectRegions(ctx, name, injectedLang, injectedTree.RootNode(), sourceCode, false, depth+1, regions)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// injectedRanges returns the ranges captured by injection, by language. Ranges
+// are sorted and don't overlap, as required by SetIncludedRanges.
+func (is *InjectionSet) injectedRanges(
+	lang *sitter.Language,
+	tree *sitter.Node,
+	injection Injection,
+	idx int,
+	sourceCode []byte,
+) (map[string][]sitter.Range, error) {
+	q, err := DefaultQueryCache.Get(lang, injection.sitterQuery(idx))
+	if err != nil {
+		return nil, err
+	}
+
+	config := newExecuteConfig()
+	err = checkPredicates(config, q)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error in injection query of %s into %s", injection.Language, injection.Host)
+	}
+
+	ret := map[string][]sitter.Range{}
+	qc := sitter.NewQueryCursor()
+	defer qc.Close()
+	qc.Exec(q.Query, tree)
+	for {
+		m, ok := qc.NextMatch()
+		if !ok {
+			break
+		}
+		if !evaluatePredicates(config, q.Predicates[m.PatternIndex], newMatch(config, q, "", m, sourceCode)) {
+			continue
+		}
+
+		name := injection.Language
+		var content []*sitter.Node
+		for _, c := range m.Captures {
+			switch q.CaptureNameForId(c.Index) {
+			case InjectionContentCapture:
+				content = append(content, c.Node)
+			case InjectionLanguageCapture:
+				if name == "" {
+					name = c.Node.Content(sourceCode)
+				}
+			}
+		}
+		if name == "" {
+			continue
+		}
+		for _, n := range content {
+			ret[name] = append(ret[name], sitter.Range{
+				StartPoint: n.StartPoint(),
+				EndPoint:   n.EndPoint(),
+				StartByte:  n.StartByte(),
+				EndByte:    n.EndByte(),
+			})
+		}
+	}
+
+	for name, ranges := range ret {
+		sort.Slice(ranges, func(i, j int) bool {
+			return ranges[i].StartByte < ranges[j].StartByte
+		})
+		// drop ranges nested in the previous one
+		kept := ranges[:0]
+		for _, r := range ranges {
+			if len(kept) > 0 && r.StartByte < kept[len(kept)-1].EndByte {
+				continue
+			}
+			kept = append(kept, r)
+		}
+		ret[name] = kept
+	}
+
+	return ret, nil
+}
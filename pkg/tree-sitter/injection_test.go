@@ -0,0 +1,143 @@
+package tree_sitter
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	sitter "github.com/smacker/go-tree-sitter"
+	"github.com/smacker/go-tree-sitter/css"
+	"github.com/smacker/go-tree-sitter/html"
+	"github.com/smacker/go-tree-sitter/javascript"
+	"github.com/smacker/go-tree-sitter/php"
+)
+
+func resolveTestLanguage(name string) (*sitter.Language, error) {
+	switch name {
+	case "css":
+		return css.GetLanguage(), nil
+	case "html":
+		return html.GetLanguage(), nil
+	case "javascript":
+		return javascript.GetLanguage(), nil
+	case "php":
+		return php.GetLanguage(), nil
+	}
+	return nil, errors.Errorf("unsupported language name: %s", name)
+}
+
+func executeWithInjections(
+	t *testing.T,
+	languageName string,
+	source string,
+	queries []SitterQuery,
+	injections ...Injection,
+) QueryResults {
+	lang, err := resolveTestLanguage(languageName)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	parser := sitter.NewParser()
+	parser.SetLanguage(lang)
+	tree, err := parser.ParseCtx(context.Background(), nil, []byte(source))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer tree.Close()
+
+	is := NewInjectionSet(resolveTestLanguage, injections...)
+	err = is.Compile(languageName, lang, queries)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	results, err := is.ExecuteQueries(context.Background(), languageName, lang, tree.RootNode(), queries, []byte(source))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return results
+}
+
+func TestInjectionMapsCapturesToHostCoordinates(t *testing.T) {
+	source := "<p>hi</p>\n<script>\nfunction first() {}\n</script>\n<script>function second() {}</script>\n"
+	queries := []SitterQuery{
+		{Name: "tags", Query: "(start_tag (tag_name) @tag)"},
+		{Name: "functions", Language: "javascript", Query: "(function_declaration name: (identifier) @name)"},
+	}
+
+	results := executeWithInjections(t, "html", source, queries, DefaultInjections...)
+
+	if len(results["tags"].Matches) != 3 {
+		t.Errorf("Expected 3 tags, got %d", len(results["tags"].Matches))
+	}
+
+	functions := results["functions"]
+	if functions.Language != "javascript" {
+		t.Errorf("Expected javascript results, got %s", functions.Language)
+	}
+	if len(functions.Matches) != 2 {
+		t.Fatalf("Expected 2 functions, got %d", len(functions.Matches))
+	}
+	for i, expected := range []struct {
+		text   string
+		row    uint32
+		column uint32
+	}{
+		{"first", 2, 9},
+		{"second", 4, 17},
+	} {
+		name := functions.Matches[i]["name"]
+		if name.Text != expected.text {
+			t.Errorf("Expected %s, got %s", expected.text, name.Text)
+		}
+		if source[name.StartByte:name.EndByte] != expected.text {
+			t.Errorf("Expected byte offsets of %s in the host file, got %d-%d", expected.text, name.StartByte, name.EndByte)
+		}
+		if name.StartPoint.Row != expected.row || name.StartPoint.Column != expected.column {
+			t.Errorf("Expected %s at %d:%d, got %d:%d", expected.text,
+				expected.row, expected.column, name.StartPoint.Row, name.StartPoint.Column)
+		}
+	}
+}
+
+func TestNestedInjections(t *testing.T) {
+	source := "<?php add_action('init', 'f'); ?>\n<div><script>function inline() {}</script></div>\n"
+	queries := []SitterQuery{
+		{Name: "functions", Language: "javascript", Query: "(function_declaration name: (identifier) @name)"},
+	}
+
+	// php -> html -> javascript
+	results := executeWithInjections(t, "php", source, queries, DefaultInjections...)
+
+	functions := results["functions"]
+	if len(functions.Matches) != 1 || functions.Matches[0]["name"].Text != "inline" {
+		t.Fatalf("Expected the inline function, got %v", functions.Matches)
+	}
+}
+
+func TestInjectionWithoutRegions(t *testing.T) {
+	queries := []SitterQuery{
+		{Name: "rules", Language: "css", Query: "(rule_set) @rule"},
+	}
+
+	results := executeWithInjections(t, "html", "<p>no style</p>\n", queries, DefaultInjections...)
+
+	rules, ok := results["rules"]
+	if !ok {
+		t.Fatalf("Expected an empty result for queries without injected regions")
+	}
+	if len(rules.Matches) != 0 {
+		t.Errorf("Expected no matches, got %v", rules.Matches)
+	}
+}
+
+func TestMergeInjectionsOverridesDefaults(t *testing.T) {
+	custom := Injection{Host: "html", Language: "javascript", Query: "(script_element) @injection.content"}
+	merged := MergeInjections(DefaultInjections, []Injection{custom})
+
+	if len(merged) != len(DefaultInjections) {
+		t.Fatalf("Expected the custom injection to replace a default one, got %d injections", len(merged))
+	}
+	if merged[0] != custom {
+		t.Errorf("Expected the custom injection first, got %v", merged[0])
+	}
+}
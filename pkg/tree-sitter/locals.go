@@ -0,0 +1,314 @@
+package tree_sitter
+
+import (
+	"embed"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	sitter "github.com/smacker/go-tree-sitter"
+)
+
+// Capture names of locals queries, following the locals.scm convention of
+// tree-sitter grammars. Definitions can have a kind suffix, as in
+// @local.definition.function.
+const (
+	LocalScopeCapture      = "local.scope"
+	LocalDefinitionCapture = "local.definition"
+	LocalReferenceCapture  = "local.reference"
+
+	// LocalScopeInheritsProperty set to "false" on a scope, with
+	// (#set! local.scope-inherits "false"), hides the variables and
+	// parameters of the enclosing scopes, as for functions in PHP.
+	LocalScopeInheritsProperty = "local.scope-inherits"
+)
+
+//go:embed locals/*.scm
+var localsFS embed.FS
+
+// localsQueries are the locals queries of the languages.
+var localsQueries = NewQueryRegistry(localsFS, "locals")
+
+// LocalsQuery returns the locals query of a language.
+func LocalsQuery(languageName string) (string, bool) {
+	return localsQueries.Query(languageName)
+}
+
+// RegisterLocalsQuery sets the locals query of a language, replacing the one
+// shipped with oak if there is one.
+func RegisterLocalsQuery(languageName string, query string) {
+	localsQueries.Register(languageName, query)
+}
+
+// LocalsLanguages returns the names of the languages with a locals query.
+func LocalsLanguages() []string {
+	return localsQueries.Languages()
+}
+
+// LocalDefinition is a definition found by a locals query, such as a
+// variable, a parameter or a function.
+type LocalDefinition struct {
+	Name string
+	// Kind is the suffix of the definition capture, such as "function" for
+	// @local.definition.function, or "" for @local.definition
+	Kind string
+
+	StartByte  uint32
+	EndByte    uint32
+	StartPoint sitter.Point
+	EndPoint   sitter.Point
+}
+
+// Scope is a scope of a file, as captured by @local.scope.
+type Scope struct {
+	StartByte uint32
+	EndByte   uint32
+	// Inherits is false if the variables and parameters of the enclosing
+	// scopes are not visible in the scope
+	Inherits bool
+
+	Parent      *Scope
+	Children    []*Scope
+	Definitions []*LocalDefinition
+}
+
+func (s *Scope) contains(startByte, endByte uint32) bool {
+	return s.StartByte <= startByte && endByte <= s.EndByte
+}
+
+// innermost returns the innermost scope containing the given range.
+func (s *Scope) innermost(startByte, endByte uint32) *Scope {
+	for _, c := range s.Children {
+		if c.contains(startByte, endByte) {
+			return c.innermost(startByte, endByte)
+		}
+	}
+	return s
+}
+
+type nodeRange struct {
+	start uint32
+	end   uint32
+}
+
+// Locals are the scopes of a file, with each reference resolved to its
+// definition.
+type Locals struct {
+	Root *Scope
+
+	definitions map[nodeRange]*LocalDefinition
+	references  map[nodeRange]*LocalDefinition
+}
+
+// Resolve returns the definition of the node at the given range: the node
+// itself if it is a definition, or the definition it refers to. It returns
+// nil for nodes that are neither, and for references to names that aren't
+// defined in the file.
+func (l *Locals) Resolve(startByte, endByte uint32) *LocalDefinition {
+	r := nodeRange{startByte, endByte}
+	if d, ok := l.definitions[r]; ok {
+		return d
+	}
+	return l.references[r]
+}
+
+type localCapture struct {
+	name       string
+	node       *sitter.Node
+	properties map[string]string
+}
+
+// ComputeLocals runs localsQuery on tree, builds the scope tree of the file
+// and resolves each reference to a definition.
+//
+// A reference resolves to the closest definition of the same name in its
+// scope or the enclosing ones, preferring definitions that come before the
+// reference. If there are none, definitions after the reference are used, as
+// with functions called before their declaration. A definition that is the
+// name of its scope, like the name of a function, is part of the enclosing
+// scope.
+func ComputeLocals(
+	lang *sitter.Language,
+	tree *sitter.Node,
+	localsQuery string,
+	sourceCode []byte,
+) (*Locals, error) {
+	q, err := DefaultQueryCache.Get(lang, SitterQuery{Name: "locals", Query: localsQuery})
+	if err != nil {
+		return nil, err
+	}
+	config := newExecuteConfig()
+	err = checkPredicates(config, q)
+	if err != nil {
+		return nil, errors.Wrap(err, "error in locals query")
+	}
+
+	var scopes, definitions, references []localCapture
+	qc := sitter.NewQueryCursor()
+	defer qc.Close()
+	qc.Exec(q.Query, tree)
+	for {
+		m, ok := qc.NextMatch()
+		if !ok {
+			break
+		}
+		match := newMatch(config, q, "locals", m, sourceCode)
+		if !evaluatePredicates(config, q.Predicates[m.PatternIndex], match) {
+			continue
+		}
+		for _, c := range m.Captures {
+			name := q.CaptureNameForId(c.Index)
+			lc := localCapture{name: name, node: c.Node, properties: match[name].Properties}
+			switch {
+			case name == LocalScopeCapture:
+				scopes = append(scopes, lc)
+			case name == LocalDefinitionCapture || strings.HasPrefix(name, LocalDefinitionCapture+"."):
+				definitions = append(definitions, lc)
+			case name == LocalReferenceCapture:
+				references = append(references, lc)
+			}
+		}
+	}
+
+	l := &Locals{
+		definitions: map[nodeRange]*LocalDefinition{},
+		references:  map[nodeRange]*LocalDefinition{},
+	}
+	l.buildScopes(tree, scopes)
+
+	for _, c := range definitions {
+		r := nodeRange{c.node.StartByte(), c.node.EndByte()}
+		if _, ok := l.definitions[r]; ok {
+			continue
+		}
+		d := &LocalDefinition{
+			Name:       c.node.Content(sourceCode),
+			Kind:       strings.TrimPrefix(strings.TrimPrefix(c.name, LocalDefinitionCapture), "."),
+			StartByte:  r.start,
+			EndByte:    r.end,
+			StartPoint: c.node.StartPoint(),
+			EndPoint:   c.node.EndPoint(),
+		}
+		l.definitions[r] = d
+
+		scope := l.Root.innermost(r.start, r.end)
+		if scope.Parent != nil && isScopeName(scope, c.node) {
+			scope = scope.Parent
+		}
+		scope.Definitions = append(scope.Definitions, d)
+	}
+	sortDefinitions(l.Root)
+
+	for _, c := range references {
+		r := nodeRange{c.node.StartByte(), c.node.EndByte()}
+		if _, ok := l.definitions[r]; ok {
+			continue
+		}
+		if _, ok := l.references[r]; ok {
+			continue
+		}
+		d := l.resolve(l.Root.innermost(r.start, r.end), c.node.Content(sourceCode), r.start)
+		if d != nil {
+			l.references[r] = d
+		}
+	}
+
+	return l, nil
+}
+
+// buildScopes builds the scope tree from the captured scopes. The root scope
+// always spans the whole file.
+func (l *Locals) buildScopes(tree *sitter.Node, captures []localCapture) {
+	sort.SliceStable(captures, func(i, j int) bool {
+		a, b := captures[i].node, captures[j].node
+		if a.StartByte() != b.StartByte() {
+			return a.StartByte() < b.StartByte()
+		}
+		return a.EndByte() > b.EndByte()
+	})
+
+	l.Root = &Scope{StartByte: tree.StartByte(), EndByte: tree.EndByte(), Inherits: true}
+	stack := []*Scope{l.Root}
+	for _, c := range captures {
+		s := &Scope{
+			StartByte: c.node.StartByte(),
+			EndByte:   c.node.EndByte(),
+			Inherits:  c.properties[LocalScopeInheritsProperty] != "false",
+		}
+		if s.StartByte == l.Root.StartByte && s.EndByte == l.Root.EndByte {
+			l.Root.Inherits = s.Inherits
+			continue
+		}
+		for len(stack) > 1 && !stack[len(stack)-1].contains(s.StartByte, s.EndByte) {
+			stack = stack[:len(stack)-1]
+		}
+		parent := stack[len(stack)-1]
+		if parent.StartByte == s.StartByte && parent.EndByte == s.EndByte {
+			// the same node captured twice
+			continue
+		}
+		s.Parent = parent
+		parent.Children = append(parent.Children, s)
+		stack = append(stack, s)
+	}
+}
+
+// isScopeName returns true if node is the name of the node of scope, such as
+// the name of a function declaration.
+func isScopeName(scope *Scope, node *sitter.Node) bool {
+	for p := node.Parent(); p != nil; p = p.Parent() {
+		if p.StartByte() != scope.StartByte || p.EndByte() != scope.EndByte {
+			if p.StartByte() < scope.StartByte || p.EndByte() > scope.EndByte {
+				return false
+			}
+			continue
+		}
+		name := p.ChildByFieldName("name")
+		return name != nil && name.Equal(node)
+	}
+	return false
+}
+
+func sortDefinitions(s *Scope) {
+	sort.SliceStable(s.Definitions, func(i, j int) bool {
+		return s.Definitions[i].StartByte < s.Definitions[j].StartByte
+	})
+	for _, c := range s.Children {
+		sortDefinitions(c)
+	}
+}
+
+// resolve returns the definition of name for a reference at startByte in
+// scope.
+func (l *Locals) resolve(scope *Scope, name string, startByte uint32) *LocalDefinition {
+	// definitions before the reference first, then hoisted ones
+	for _, hoisted := range []bool{false, true} {
+		variables := true
+		for s := scope; s != nil; s = s.Parent {
+			var found *LocalDefinition
+			for _, d := range s.Definitions {
+				if d.Name != name || (!variables && isVariableKind(d.Kind)) {
+					continue
+				}
+				if d.StartByte > startByte {
+					if hoisted && found == nil {
+						found = d
+					}
+					break
+				}
+				found = d
+			}
+			if found != nil {
+				return found
+			}
+			if !s.Inherits {
+				variables = false
+			}
+		}
+	}
+	return nil
+}
+
+func isVariableKind(kind string) bool {
+	return kind == "var" || kind == "parameter"
+}
@@ -0,0 +1,42 @@
+; Scopes
+
+(source_file) @local.scope
+(function_declaration) @local.scope
+(method_declaration) @local.scope
+(func_literal) @local.scope
+(block) @local.scope
+(if_statement) @local.scope
+(for_statement) @local.scope
+(expression_switch_statement) @local.scope
+(type_switch_statement) @local.scope
+(select_statement) @local.scope
+(expression_case) @local.scope
+(type_case) @local.scope
+(default_case) @local.scope
+(communication_case) @local.scope
+
+; Definitions
+
+(function_declaration name: (identifier) @local.definition.function)
+(method_declaration name: (field_identifier) @local.definition.method)
+
+(parameter_declaration name: (identifier) @local.definition.parameter)
+(variadic_parameter_declaration name: (identifier) @local.definition.parameter)
+
+(short_var_declaration left: (expression_list (identifier) @local.definition.var))
+(var_spec name: (identifier) @local.definition.var)
+(range_clause left: (expression_list (identifier) @local.definition.var))
+(type_switch_statement alias: (expression_list (identifier) @local.definition.var))
+(receive_statement left: (expression_list (identifier) @local.definition.var))
+
+(const_spec name: (identifier) @local.definition.constant)
+(type_spec name: (type_identifier) @local.definition.type)
+(import_spec name: (package_identifier) @local.definition.import)
+(labeled_statement label: (label_name) @local.definition.label)
+
+; References
+
+(identifier) @local.reference
+(type_identifier) @local.reference
+(package_identifier) @local.reference
+(label_name) @local.reference
@@ -0,0 +1,35 @@
+; Scopes
+;
+; Functions don't see the variables of the code around them
+
+(program) @local.scope
+((function_definition) @local.scope
+ (#set! local.scope-inherits "false"))
+((method_declaration) @local.scope
+ (#set! local.scope-inherits "false"))
+(anonymous_function_creation_expression) @local.scope
+(class_declaration) @local.scope
+
+; Definitions
+
+(function_definition name: (name) @local.definition.function)
+(method_declaration name: (name) @local.definition.method)
+(class_declaration name: (name) @local.definition.class)
+(interface_declaration name: (name) @local.definition.class)
+(trait_declaration name: (name) @local.definition.class)
+
+(simple_parameter name: (variable_name) @local.definition.parameter)
+(variadic_parameter name: (variable_name) @local.definition.parameter)
+
+(assignment_expression left: (variable_name) @local.definition.var)
+(foreach_statement (pair (variable_name) @local.definition.var))
+(foreach_statement . (_) (variable_name) @local.definition.var)
+(global_declaration (variable_name) @local.definition.var)
+(static_variable_declaration name: (variable_name) @local.definition.var)
+(catch_clause name: (variable_name) @local.definition.var)
+
+; References
+
+(variable_name) @local.reference
+(function_call_expression function: (qualified_name (name) @local.reference))
+(object_creation_expression (qualified_name (name) @local.reference))
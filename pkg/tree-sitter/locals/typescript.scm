@@ -0,0 +1,49 @@
+; Scopes
+
+(program) @local.scope
+(statement_block) @local.scope
+(function_declaration) @local.scope
+(generator_function_declaration) @local.scope
+(function) @local.scope
+(generator_function) @local.scope
+(arrow_function) @local.scope
+(method_definition) @local.scope
+(class_declaration) @local.scope
+(interface_declaration) @local.scope
+(type_alias_declaration) @local.scope
+(for_statement) @local.scope
+(for_in_statement) @local.scope
+(catch_clause) @local.scope
+
+; Definitions
+
+(function_declaration name: (identifier) @local.definition.function)
+(generator_function_declaration name: (identifier) @local.definition.function)
+(class_declaration name: (type_identifier) @local.definition.class)
+(interface_declaration name: (type_identifier) @local.definition.type)
+(type_alias_declaration name: (type_identifier) @local.definition.type)
+(enum_declaration name: (identifier) @local.definition.enum)
+(type_parameter name: (type_identifier) @local.definition.type)
+
+(required_parameter pattern: (identifier) @local.definition.parameter)
+(optional_parameter pattern: (identifier) @local.definition.parameter)
+(required_parameter pattern: (rest_pattern (identifier) @local.definition.parameter))
+(arrow_function parameter: (identifier) @local.definition.parameter)
+
+(variable_declarator name: (identifier) @local.definition.var)
+(variable_declarator name: (object_pattern (shorthand_property_identifier_pattern) @local.definition.var))
+(variable_declarator name: (object_pattern (pair_pattern value: (identifier) @local.definition.var)))
+(variable_declarator name: (array_pattern (identifier) @local.definition.var))
+(for_in_statement left: (identifier) @local.definition.var)
+(catch_clause parameter: (identifier) @local.definition.var)
+
+(import_clause (identifier) @local.definition.import)
+(import_specifier name: (identifier) @local.definition.import)
+(import_specifier alias: (identifier) @local.definition.import)
+(namespace_import (identifier) @local.definition.import)
+
+; References
+
+(identifier) @local.reference
+(type_identifier) @local.reference
+(shorthand_property_identifier) @local.reference
@@ -0,0 +1,178 @@
+package tree_sitter
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	sitter "github.com/smacker/go-tree-sitter"
+	"github.com/smacker/go-tree-sitter/golang"
+	"github.com/smacker/go-tree-sitter/javascript"
+	"github.com/smacker/go-tree-sitter/php"
+	"github.com/smacker/go-tree-sitter/python"
+	"github.com/smacker/go-tree-sitter/typescript/tsx"
+	"github.com/smacker/go-tree-sitter/typescript/typescript"
+)
+
+func TestLocalsQueriesCompile(t *testing.T) {
+	languages := map[string]*sitter.Language{
+		"go":         golang.GetLanguage(),
+		"javascript": javascript.GetLanguage(),
+		"php":        php.GetLanguage(),
+		"python":     python.GetLanguage(),
+		"tsx":        tsx.GetLanguage(),
+		"typescript": typescript.GetLanguage(),
+	}
+	for _, name := range LocalsLanguages() {
+		lang, ok := languages[name]
+		if !ok {
+			t.Errorf("No grammar to test the locals query of %s", name)
+			continue
+		}
+		query, _ := LocalsQuery(name)
+		_, err := NewQueryCache().Get(lang, SitterQuery{Name: name, Query: query})
+		if err != nil {
+			t.Errorf("Invalid locals query for %s: %v", name, err)
+		}
+	}
+}
+
+// definitionsOf returns the definition of each capture named name, as
+// "kind@row", or "" for unresolved captures.
+func definitionsOf(t *testing.T, languageName string, lang *sitter.Language, source string, query string) []string {
+	parser := sitter.NewParser()
+	parser.SetLanguage(lang)
+	tree, err := parser.ParseCtx(context.Background(), nil, []byte(source))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer tree.Close()
+
+	results, err := ExecuteQueries(lang, tree.RootNode(), []SitterQuery{{Name: "q", Query: query}}, []byte(source),
+		WithLanguageName(languageName), WithLocals())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ret := []string{}
+	for _, m := range results["q"].Matches {
+		d := m["name"].Definition
+		if d == nil {
+			ret = append(ret, "")
+			continue
+		}
+		ret = append(ret, fmt.Sprintf("%s@%d", d.Kind, d.StartPoint.Row))
+	}
+	return ret
+}
+
+func assertDefinitions(t *testing.T, expected []string, actual []string) {
+	if len(expected) != len(actual) {
+		t.Fatalf("Expected %v, got %v", expected, actual)
+	}
+	for i := range expected {
+		if expected[i] != actual[i] {
+			t.Errorf("Expected %v, got %v", expected, actual)
+			return
+		}
+	}
+}
+
+func TestGoLocals(t *testing.T) {
+	source := `package main
+
+func run(x int) int {
+	y := x
+	if true {
+		x := 2
+		y = x
+	}
+	return helper(x, y)
+}
+
+func helper(a, b int) int { return fmt(a) }
+`
+	// identifiers used as call arguments and on the right of assignments
+	query := `
+[
+  (argument_list (identifier) @name)
+  (assignment_statement right: (expression_list (identifier) @name))
+  (short_var_declaration right: (expression_list (identifier) @name))
+  (call_expression function: (identifier) @name)
+]`
+	assertDefinitions(t,
+		// y := x, y = x (shadowed), helper, x, y, fmt, a
+		[]string{"parameter@2", "var@5", "function@11", "parameter@2", "var@3", "", "parameter@11"},
+		definitionsOf(t, "go", golang.GetLanguage(), source, query))
+}
+
+func TestPythonLocals(t *testing.T) {
+	source := `import os
+
+def f(path):
+    return os.path.join(path, g())
+
+def g():
+    path = "x"
+    return path
+`
+	query := `(call function: (_) arguments: (argument_list (identifier) @name))
+(return_statement (identifier) @name)
+(call function: (identifier) @name)`
+	assertDefinitions(t,
+		[]string{"parameter@2", "function@5", "var@6"},
+		definitionsOf(t, "python", python.GetLanguage(), source, query))
+}
+
+func TestPHPFunctionsDontInheritVariables(t *testing.T) {
+	source := `<?php
+$x = 1;
+function f($y) {
+    return $x + $y;
+}
+echo f($x);
+`
+	query := `(binary_expression (variable_name) @name)
+(echo_statement (function_call_expression (arguments (variable_name) @name)))`
+	assertDefinitions(t,
+		[]string{"", "parameter@2", "var@1"},
+		definitionsOf(t, "php", php.GetLanguage(), source, query))
+}
+
+func TestResolvesToPredicate(t *testing.T) {
+	source := `const load = () => 1;
+
+function main(load) {
+  load();
+}
+
+function other() {
+  load();
+}
+`
+	query := `((call_expression function: (identifier) @name) (#resolves-to? @name "var"))`
+	assertDefinitions(t,
+		[]string{"var@0"},
+		definitionsOf(t, "typescript", typescript.GetLanguage(), source, query))
+
+	query = `((function_declaration
+  name: (identifier) @function
+  body: (statement_block (expression_statement (call_expression function: (identifier) @name))))
+ (#resolves-to? @name "parameter"))`
+	assertDefinitions(t,
+		[]string{"parameter@2"},
+		definitionsOf(t, "typescript", typescript.GetLanguage(), source, query))
+}
+
+func TestResolvesToRequiresLocalsQuery(t *testing.T) {
+	source := []byte("package main\n")
+	tree := parseGo(t, source)
+	defer tree.Close()
+
+	_, err := ExecuteQueries(golang.GetLanguage(), tree.RootNode(), []SitterQuery{{
+		Name:  "q",
+		Query: `((identifier) @name (#resolves-to? @name))`,
+	}}, source)
+	if err == nil {
+		t.Fatalf("Expected an error without a language name")
+	}
+}
@@ -0,0 +1,508 @@
+package tree_sitter
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	sitter "github.com/smacker/go-tree-sitter"
+)
+
+// Predicate is a predicate or a directive of a query pattern, such as
+// (#eq? @name "main") or (#set! kind "test").
+//
+// oak evaluates predicates itself, instead of relying on the few predicates
+// supported by go-tree-sitter:
+//
+//   - #eq?, #not-eq?, #any-eq?, #any-not-eq? compare the text of a capture
+//     with a string or with the text of another capture
+//   - #match?, #not-match?, #any-match?, #any-not-match? and #lua-match?
+//     match the text of a capture against a regular expression, or a Lua
+//     pattern for #lua-match?
+//   - #any-of? and #not-any-of? compare the text of a capture with a list of
+//     strings
+//   - #set! key [value] sets a property of the match, which is available as
+//     the Properties of its captures
+//   - #is? key [value] and #is-not? key [value] check the properties of the
+//     match
+//   - #resolves-to? @capture, #resolves-to? @capture "kind" and
+//     #resolves-to? @capture @definition check that the capture refers to a
+//     definition of the file, to a definition of the given kind, or to the
+//     node captured as @definition, see ComputeLocals
+//
+// go-tree-sitter rejects #set!, #is? and #is-not? without a value when
+// compiling queries, so in practice they take both a key and a value.
+//
+// For quantified captures, the predicates without an any- prefix have to hold
+// for every node of the capture, and the others for at least one of them.
+type Predicate struct {
+	// Name is the name of the predicate without the #, such as "eq?"
+	Name string
+	Args []PredicateArg
+
+	regexp *regexp.Regexp
+}
+
+// PredicateArg is an argument of a predicate, either a capture or a string.
+type PredicateArg struct {
+	// Capture is the name of the capture, for arguments such as @name
+	Capture string
+	// Value is the value of string arguments
+	Value string
+}
+
+func (a PredicateArg) IsCapture() bool {
+	return a.Capture != ""
+}
+
+func (a PredicateArg) String() string {
+	if a.IsCapture() {
+		return "@" + a.Capture
+	}
+	return fmt.Sprintf("%q", a.Value)
+}
+
+func (p Predicate) String() string {
+	parts := []string{"#" + p.Name}
+	for _, a := range p.Args {
+		parts = append(parts, a.String())
+	}
+	return "(" + strings.Join(parts, " ") + ")"
+}
+
+type predicateFunc func(p *Predicate, match Match, properties map[string]string) bool
+
+// builtinPredicates are the predicates evaluated on matches. #set! is a
+// directive and is applied before them.
+var builtinPredicates = map[string]predicateFunc{
+	"eq?":            textPredicate(true, false, equals),
+	"not-eq?":        textPredicate(false, false, equals),
+	"any-eq?":        textPredicate(true, true, equals),
+	"any-not-eq?":    textPredicate(false, true, equals),
+	"match?":         textPredicate(true, false, matches),
+	"not-match?":     textPredicate(false, false, matches),
+	"any-match?":     textPredicate(true, true, matches),
+	"any-not-match?": textPredicate(false, true, matches),
+	"lua-match?":     textPredicate(true, false, matches),
+	"any-of?":        textPredicate(true, false, isOneOf),
+	"not-any-of?":    textPredicate(false, false, isOneOf),
+	"is?":            propertyPredicate(true),
+	"is-not?":        propertyPredicate(false),
+	"resolves-to?":   resolvesTo,
+}
+
+const (
+	setDirective        = "set!"
+	resolvesToPredicate = "resolves-to?"
+)
+
+// compilePredicates returns the predicates of each pattern of q, with their
+// arguments checked and their regular expressions compiled.
+func compilePredicates(q *sitter.Query) ([][]Predicate, error) {
+	ret := make([][]Predicate, q.PatternCount())
+	for i := uint32(0); i < q.PatternCount(); i++ {
+		for _, steps := range q.PredicatesForPattern(i) {
+			p := Predicate{}
+			for j, step := range steps {
+				switch step.Type {
+				case sitter.QueryPredicateStepTypeDone:
+				case sitter.QueryPredicateStepTypeCapture:
+					if j == 0 {
+						return nil, errors.New("predicate must begin with a name")
+					}
+					p.Args = append(p.Args, PredicateArg{Capture: q.CaptureNameForId(step.ValueId)})
+				case sitter.QueryPredicateStepTypeString:
+					value := q.StringValueForId(step.ValueId)
+					if j == 0 {
+						p.Name = value
+						continue
+					}
+					p.Args = append(p.Args, PredicateArg{Value: value})
+				}
+			}
+			if p.Name == "" {
+				continue
+			}
+
+			err := p.compile()
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid predicate %s in pattern %d", p, i)
+			}
+			ret[i] = append(ret[i], p)
+		}
+	}
+	return ret, nil
+}
+
+func (p *Predicate) compile() error {
+	switch p.Name {
+	case "eq?", "not-eq?", "any-eq?", "any-not-eq?":
+		if len(p.Args) != 2 || !p.Args[0].IsCapture() {
+			return errors.New("expected a capture and a capture or a string")
+		}
+	case "match?", "not-match?", "any-match?", "any-not-match?", "lua-match?":
+		if len(p.Args) != 2 || !p.Args[0].IsCapture() || p.Args[1].IsCapture() {
+			return errors.New("expected a capture and a pattern")
+		}
+		pattern := p.Args[1].Value
+		if p.Name == "lua-match?" {
+			var err error
+			pattern, err = luaPatternToRegexp(pattern)
+			if err != nil {
+				return err
+			}
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return err
+		}
+		p.regexp = re
+	case "any-of?", "not-any-of?":
+		if len(p.Args) < 2 || !p.Args[0].IsCapture() {
+			return errors.New("expected a capture and a list of strings")
+		}
+		for _, a := range p.Args[1:] {
+			if a.IsCapture() {
+				return errors.New("expected a capture and a list of strings")
+			}
+		}
+	case resolvesToPredicate:
+		if len(p.Args) < 1 || len(p.Args) > 2 || !p.Args[0].IsCapture() {
+			return errors.New("expected a capture and an optional kind or definition capture")
+		}
+	case setDirective, "is?", "is-not?":
+		if len(p.Args) < 1 || len(p.Args) > 2 {
+			return errors.New("expected a key and an optional value")
+		}
+		for _, a := range p.Args {
+			if a.IsCapture() {
+				return errors.New("expected a key and an optional value")
+			}
+		}
+	}
+	return nil
+}
+
+// usesPredicate returns true if a pattern of q uses the predicate name.
+func (q *Query) usesPredicate(name string) bool {
+	for _, predicates := range q.Predicates {
+		for _, p := range predicates {
+			if p.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// PredicateFunc is a custom predicate, registered with WithPredicate. It is
+// called with the captures of a match and the arguments of the predicate.
+// Capture arguments are passed as "@name", and the capture can be looked up
+// in captures as name. Other arguments are passed as is. Returning false
+// drops the match.
+type PredicateFunc func(captures Match, args []string) bool
+
+// WithPredicate registers a custom predicate, which queries can use as
+// (#name @capture "argument"). name can be given with or without the
+// leading #. Built-in predicates can't be replaced, see IsBuiltinPredicate.
+//
+// Results are only cached by the name of custom predicates, so fn should
+// only depend on its arguments when using a ResultCache.
+func WithPredicate(name string, fn PredicateFunc) ExecuteOption {
+	return func(ec *executeConfig) {
+		if ec.predicates == nil {
+			ec.predicates = map[string]PredicateFunc{}
+		}
+		ec.predicates[strings.TrimPrefix(name, "#")] = fn
+	}
+}
+
+// IsBuiltinPredicate returns true if name, with or without the leading #, is
+// one of the predicates evaluated by oak itself.
+func IsBuiltinPredicate(name string) bool {
+	name = strings.TrimPrefix(name, "#")
+	_, ok := builtinPredicates[name]
+	return ok || name == setDirective
+}
+
+// checkPredicates returns an error if q uses predicates that are neither
+// built-in nor registered in config.
+func checkPredicates(config *executeConfig, q *Query) error {
+	for _, predicates := range q.Predicates {
+		for _, p := range predicates {
+			if IsBuiltinPredicate(p.Name) {
+				continue
+			}
+			if _, ok := config.predicates[p.Name]; !ok {
+				return errors.Errorf("unknown predicate #%s", p.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// predicateNames returns the sorted names of the custom predicates of config.
+func (ec *executeConfig) predicateNames() []string {
+	names := make([]string, 0, len(ec.predicates))
+	for name := range ec.predicates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// evaluatePredicates returns false if match doesn't satisfy predicates, which
+// are either built-in or registered in config. The properties set with #set!
+// are stored in the Properties of the captures of match.
+func evaluatePredicates(config *executeConfig, predicates []Predicate, match Match) bool {
+	if len(predicates) == 0 {
+		return true
+	}
+
+	properties := map[string]string{}
+	for _, p := range predicates {
+		if p.Name != setDirective {
+			continue
+		}
+		value := ""
+		if len(p.Args) > 1 {
+			value = p.Args[1].Value
+		}
+		properties[p.Args[0].Value] = value
+	}
+
+	for i := range predicates {
+		p := &predicates[i]
+		if f, ok := builtinPredicates[p.Name]; ok {
+			if !f(p, match, properties) {
+				return false
+			}
+			continue
+		}
+		if f, ok := config.predicates[p.Name]; ok {
+			args := make([]string, 0, len(p.Args))
+			for _, a := range p.Args {
+				if a.IsCapture() {
+					args = append(args, "@"+a.Capture)
+					continue
+				}
+				args = append(args, a.Value)
+			}
+			if !f(match, args) {
+				return false
+			}
+		}
+	}
+
+	if len(properties) > 0 {
+		for name, c := range match {
+			c.Properties = properties
+			match[name] = c
+		}
+	}
+
+	return true
+}
+
+// nodeTexts returns the text of each node of a capture, or nil if the capture
+// isn't part of the match.
+func nodeTexts(match Match, name string) []string {
+	c, ok := match[name]
+	if !ok {
+		return nil
+	}
+	ret := make([]string, 0, len(c.Nodes))
+	for _, n := range c.Nodes {
+		ret = append(ret, n.Text)
+	}
+	return ret
+}
+
+// textPredicate returns a predicate comparing each node of the first capture
+// with test. Unless anyNode is set, all the nodes have to pass.
+func textPredicate(
+	isPositive bool,
+	anyNode bool,
+	test func(p *Predicate, match Match, i int, text string) bool,
+) predicateFunc {
+	return func(p *Predicate, match Match, _ map[string]string) bool {
+		texts := nodeTexts(match, p.Args[0].Capture)
+		for i, text := range texts {
+			passes := test(p, match, i, text) == isPositive
+			if anyNode && passes {
+				return true
+			}
+			if !anyNode && !passes {
+				return false
+			}
+		}
+		return !anyNode
+	}
+}
+
+func equals(p *Predicate, match Match, i int, text string) bool {
+	other := p.Args[1]
+	if !other.IsCapture() {
+		return text == other.Value
+	}
+	// captures are compared node by node
+	otherTexts := nodeTexts(match, other.Capture)
+	if len(otherTexts) == 0 {
+		return false
+	}
+	if i >= len(otherTexts) {
+		i = len(otherTexts) - 1
+	}
+	return text == otherTexts[i]
+}
+
+func matches(p *Predicate, _ Match, _ int, text string) bool {
+	return p.regexp.MatchString(text)
+}
+
+func isOneOf(p *Predicate, _ Match, _ int, text string) bool {
+	for _, a := range p.Args[1:] {
+		if text == a.Value {
+			return true
+		}
+	}
+	return false
+}
+
+func propertyPredicate(isPositive bool) predicateFunc {
+	return func(p *Predicate, _ Match, properties map[string]string) bool {
+		value, ok := properties[p.Args[0].Value]
+		if ok && len(p.Args) > 1 {
+			ok = value == p.Args[1].Value
+		}
+		return ok == isPositive
+	}
+}
+
+func resolvesTo(p *Predicate, match Match, _ map[string]string) bool {
+	c, ok := match[p.Args[0].Capture]
+	if !ok || c.Definition == nil {
+		return false
+	}
+	if len(p.Args) == 1 {
+		return true
+	}
+	target := p.Args[1]
+	if !target.IsCapture() {
+		return c.Definition.Kind == target.Value
+	}
+	definition, ok := match[target.Capture]
+	return ok && definition.StartByte == c.Definition.StartByte && definition.EndByte == c.Definition.EndByte
+}
+
+var luaClasses = map[byte]string{
+	'a': "alpha",
+	'c': "cntrl",
+	'd': "digit",
+	'g': "graph",
+	'l': "lower",
+	'p': "punct",
+	's': "space",
+	'u': "upper",
+	'w': "alnum",
+	'x': "xdigit",
+}
+
+// luaPatternToRegexp converts a Lua pattern, as used by #lua-match? in the
+// queries of neovim, to a Go regular expression. Balanced matches (%b) and
+// frontier patterns (%f) are not supported.
+func luaPatternToRegexp(pattern string) (string, error) {
+	var sb strings.Builder
+	// in Lua, . matches newlines too
+	sb.WriteString("(?s)")
+
+	// class returns the regexp character class of %c, without the outer
+	// brackets.
+	class := func(c byte) (string, bool) {
+		lower := c | 0x20
+		name, ok := luaClasses[lower]
+		if !ok {
+			return "", false
+		}
+		if c != lower {
+			return "[:^" + name + ":]", true
+		}
+		return "[:" + name + ":]", true
+	}
+
+	inSet := false
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case c == '%':
+			if i+1 >= len(pattern) {
+				return "", errors.New("malformed pattern (ends with '%')")
+			}
+			i++
+			c = pattern[i]
+			if cls, ok := class(c); ok {
+				if inSet {
+					sb.WriteString(cls)
+				} else {
+					sb.WriteString("[" + cls + "]")
+				}
+				continue
+			}
+			switch {
+			case c == 'b' || c == 'f':
+				return "", errors.Errorf("%%%c is not supported", c)
+			case c >= '0' && c <= '9':
+				return "", errors.New("back references are not supported")
+			}
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+
+		case inSet:
+			switch c {
+			case ']':
+				inSet = false
+				sb.WriteByte(c)
+			case '\\', '[':
+				sb.WriteByte('\\')
+				sb.WriteByte(c)
+			default:
+				sb.WriteByte(c)
+			}
+
+		case c == '[':
+			inSet = true
+			sb.WriteByte(c)
+			if i+1 < len(pattern) && pattern[i+1] == '^' {
+				i++
+				sb.WriteByte('^')
+			}
+			// a ] right after the opening bracket is a literal
+			if i+1 < len(pattern) && pattern[i+1] == ']' {
+				i++
+				sb.WriteString(`\]`)
+			}
+
+		case c == '-':
+			// lazy repetition
+			sb.WriteString("*?")
+
+		case c == '^' && i == 0:
+			sb.WriteByte(c)
+
+		case c == '$' && i == len(pattern)-1:
+			sb.WriteByte(c)
+
+		case c == '.' || c == '*' || c == '+' || c == '?' || c == '(' || c == ')':
+			sb.WriteByte(c)
+
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	if inSet {
+		return "", errors.New("malformed pattern (missing ']')")
+	}
+
+	return sb.String(), nil
+}
@@ -0,0 +1,224 @@
+package tree_sitter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/smacker/go-tree-sitter/golang"
+)
+
+const predicatesSource = `package main
+
+// Deprecated: use g
+// old
+func f() {}
+
+func g() {}
+
+func TestG() {}
+
+func h() { g(); h() }
+
+var MAX_SIZE = 1
+`
+
+func matchedNames(t *testing.T, query string) []string {
+	results := executeGo(t, predicatesSource, []SitterQuery{{Name: "q", Query: query}})
+	names := []string{}
+	for _, m := range results["q"].Matches {
+		names = append(names, m["name"].Text)
+	}
+	return names
+}
+
+func TestPredicates(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		expected []string
+	}{
+		{
+			name:     "eq",
+			query:    `((function_declaration name: (identifier) @name) (#eq? @name "g"))`,
+			expected: []string{"g"},
+		},
+		{
+			name:     "not-eq",
+			query:    `((function_declaration name: (identifier) @name) (#not-eq? @name "g"))`,
+			expected: []string{"f", "TestG", "h"},
+		},
+		{
+			name:     "match",
+			query:    `((function_declaration name: (identifier) @name) (#match? @name "^Test"))`,
+			expected: []string{"TestG"},
+		},
+		{
+			name:     "not-match",
+			query:    `((function_declaration name: (identifier) @name) (#not-match? @name "^Test"))`,
+			expected: []string{"f", "g", "h"},
+		},
+		{
+			name:     "lua-match",
+			query:    `((identifier) @name (#lua-match? @name "^[%u_]+$"))`,
+			expected: []string{"MAX_SIZE"},
+		},
+		{
+			name:     "any-of",
+			query:    `((function_declaration name: (identifier) @name) (#any-of? @name "f" "TestG"))`,
+			expected: []string{"f", "TestG"},
+		},
+		{
+			name:     "not-any-of",
+			query:    `((function_declaration name: (identifier) @name) (#not-any-of? @name "f" "TestG"))`,
+			expected: []string{"g", "h"},
+		},
+		{
+			name: "all nodes of quantified captures",
+			query: `((comment)+ @comment . (function_declaration name: (identifier) @name)
+			         (#match? @comment "^// [a-z]+$"))`,
+			expected: []string{},
+		},
+		{
+			name: "any node of quantified captures",
+			query: `((comment)+ @comment . (function_declaration name: (identifier) @name)
+			         (#any-match? @comment "Deprecated"))`,
+			expected: []string{"f"},
+		},
+		{
+			name: "eq with another capture",
+			query: `((function_declaration
+			          name: (identifier) @name
+			          body: (block (call_expression function: (identifier) @callee)))
+			         (#eq? @name @callee))`,
+			expected: []string{"h"},
+		},
+		{
+			name: "is",
+			query: `((function_declaration name: (identifier) @name) (#set! kind "test") (#is? kind "test"))
+			        ((function_declaration name: (identifier) @name) (#is? kind "test"))`,
+			expected: []string{"f", "g", "TestG", "h"},
+		},
+		{
+			name:     "is-not",
+			query:    `((function_declaration name: (identifier) @name) (#set! exported "yes") (#is-not? exported "no"))`,
+			expected: []string{"f", "g", "TestG", "h"},
+		},
+		{
+			name:     "is-not with the value set",
+			query:    `((function_declaration name: (identifier) @name) (#set! exported "yes") (#is-not? exported "yes"))`,
+			expected: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			names := matchedNames(t, tt.query)
+			if strings.Join(names, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("Expected %v, got %v", tt.expected, names)
+			}
+		})
+	}
+}
+
+func TestSetDirectiveProperties(t *testing.T) {
+	results := executeGo(t, predicatesSource, []SitterQuery{{
+		Name:  "q",
+		Query: `((function_declaration name: (identifier) @name) (#match? @name "^Test") (#set! kind "test"))`,
+	}})
+
+	c := results["q"].Matches[0]["name"]
+	if c.Properties["kind"] != "test" {
+		t.Errorf("Expected the kind property, got %v", c.Properties)
+	}
+}
+
+func TestInvalidPredicates(t *testing.T) {
+	for _, query := range []string{
+		`((identifier) @name (#match? @name "("))`,
+		`((identifier) @name (#lua-match? @name "%b()"))`,
+		`((identifier) @name (#any-of? @name))`,
+	} {
+		_, err := NewQueryCache().Get(golang.GetLanguage(), SitterQuery{Name: "q", Query: query})
+		if err == nil {
+			t.Errorf("Expected an error for %s", query)
+		}
+	}
+}
+
+func TestUnknownPredicate(t *testing.T) {
+	source := []byte(predicatesSource)
+	lang := golang.GetLanguage()
+	tree := parseGo(t, source)
+	defer tree.Close()
+
+	results, err := ExecuteQueries(lang, tree.RootNode(), []SitterQuery{{
+		Name:  "q",
+		Query: `((identifier) @name (#is-deprecated? @name))`,
+	}}, source)
+	if err == nil || !strings.Contains(err.Error(), "unknown predicate #is-deprecated?") {
+		t.Errorf("Expected an unknown predicate error, got %v, %v", err, results)
+	}
+}
+
+func TestLuaPatternToRegexp(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		expected string
+	}{
+		{"^[%u_]+$", `(?s)^[[:upper:]_]+$`},
+		{"%d+%.%d", `(?s)[[:digit:]]+\.[[:digit:]]`},
+		{"a.-b", `(?s)a.*?b`},
+		{"%S+", `(?s)[[:^space:]]+`},
+		{"[]a]", `(?s)[\]a]`},
+		{"a|b{1}", `(?s)a\|b\{1\}`},
+	}
+	for _, tt := range tests {
+		re, err := luaPatternToRegexp(tt.pattern)
+		if err != nil {
+			t.Errorf("Unexpected error for %s: %v", tt.pattern, err)
+			continue
+		}
+		if re != tt.expected {
+			t.Errorf("Expected %s for %s, got %s", tt.expected, tt.pattern, re)
+		}
+	}
+}
+
+func TestCustomPredicate(t *testing.T) {
+	var args []string
+	isShort := func(captures Match, args_ []string) bool {
+		args = args_
+		return len(captures[strings.TrimPrefix(args_[0], "@")].Text) <= 1
+	}
+
+	results := executeGo(t, predicatesSource, []SitterQuery{{
+		Name:  "q",
+		Query: `((function_declaration name: (identifier) @name) (#is-short? @name "letters"))`,
+	}}, WithPredicate("#is-short?", isShort))
+
+	names := []string{}
+	for _, m := range results["q"].Matches {
+		names = append(names, m["name"].Text)
+	}
+	if strings.Join(names, ",") != "f,g,h" {
+		t.Errorf("Expected f,g,h, got %v", names)
+	}
+	if strings.Join(args, ",") != "@name,letters" {
+		t.Errorf("Expected the capture and string arguments, got %v", args)
+	}
+}
+
+func TestCompileChecksPredicates(t *testing.T) {
+	queries := []SitterQuery{{Name: "q", Query: `((identifier) @name (#is-short? @name))`}}
+	err := NewQueryCache().Compile(golang.GetLanguage(), queries)
+	if err == nil || !strings.Contains(err.Error(), "unknown predicate #is-short?") {
+		t.Errorf("Expected an unknown predicate error, got %v", err)
+	}
+
+	err = NewQueryCache().Compile(golang.GetLanguage(), queries, WithPredicate("is-short?", func(Match, []string) bool {
+		return true
+	}))
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
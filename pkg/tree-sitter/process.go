@@ -0,0 +1,280 @@
+package tree_sitter
+
+import (
+	"context"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+	sitter "github.com/smacker/go-tree-sitter"
+)
+
+// FileJob describes the queries to run on a single file. LanguageName is
+// used to tag the results and as part of the result cache key. Injections is
+// only needed if some of the queries are for embedded languages.
+type FileJob struct {
+	FileName     string
+	LanguageName string
+	Language     *sitter.Language
+	Queries      []SitterQuery
+	Injections   *InjectionSet
+}
+
+// Compile compiles the queries of the job, to report errors before
+// processing any file. options are the options the queries will be executed
+// with, which can declare custom predicates.
+func (job FileJob) Compile(options ...ExecuteOption) error {
+	if job.Injections != nil {
+		return job.Injections.Compile(job.LanguageName, job.Language, job.Queries, options...)
+	}
+	return DefaultQueryCache.Compile(job.Language, job.Queries, options...)
+}
+
+// Execute runs the queries of the job on the file parsed as tree.
+func (job FileJob) Execute(
+	ctx context.Context,
+	tree *sitter.Node,
+	sourceCode []byte,
+	options ...ExecuteOption,
+) (QueryResults, error) {
+	var results QueryResults
+	var err error
+	if job.Injections != nil {
+		results, err = job.Injections.ExecuteQueries(ctx, job.LanguageName, job.Language, tree, job.Queries, sourceCode, options...)
+	} else {
+		results, err = ExecuteQueries(job.Language, tree, job.Queries, sourceCode, withLanguageName(options, job.LanguageName)...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, result := range results {
+		if result.Language == "" {
+			result.Language = job.LanguageName
+		}
+	}
+	results.SetFileName(job.FileName)
+	return results, nil
+}
+
+// NewFileJobs returns jobs running the same queries on all fileNames.
+func NewFileJobs(
+	fileNames []string,
+	languageName string,
+	lang *sitter.Language,
+	queries []SitterQuery,
+) []FileJob {
+	ret := make([]FileJob, 0, len(fileNames))
+	for _, fileName := range fileNames {
+		ret = append(ret, FileJob{
+			FileName:     fileName,
+			LanguageName: languageName,
+			Language:     lang,
+			Queries:      queries,
+		})
+	}
+	return ret
+}
+
+// FileResult holds the results of running queries on a single file. Err is
+// set if the file could not be read, parsed or queried. Health reports the
+// syntax errors of the file, whose code queries can't match.
+type FileResult struct {
+	FileName     string
+	LanguageName string
+	Results      QueryResults
+	Health       ParseHealth
+	Err          error
+}
+
+// ProcessOption configures ProcessFiles.
+type ProcessOption func(*processConfig)
+
+type processConfig struct {
+	cache          *ResultCache
+	executeOptions []ExecuteOption
+	readFile       func(fileName string) ([]byte, error)
+}
+
+// WithResultCache makes ProcessFiles look up the results of each file in
+// cache before parsing it, and store the results of the files it parses.
+func WithResultCache(cache *ResultCache) ProcessOption {
+	return func(pc *processConfig) {
+		pc.cache = cache
+	}
+}
+
+// WithExecuteOptions passes options to ExecuteQueries for every file.
+func WithExecuteOptions(options ...ExecuteOption) ProcessOption {
+	return func(pc *processConfig) {
+		pc.executeOptions = append(pc.executeOptions, options...)
+	}
+}
+
+// WithReadFile makes ProcessFiles read the files of jobs with readFile
+// instead of from disk, for example to read them from a git revision.
+func WithReadFile(readFile func(fileName string) ([]byte, error)) ProcessOption {
+	return func(pc *processConfig) {
+		pc.readFile = readFile
+	}
+}
+
+// ProcessFiles reads, parses and runs queries on the files of jobs, using up
+// to workers goroutines. onResult is called for each file, in the order of
+// jobs, as soon as that file and all the files before it are done, which
+// allows callers to stream results while keeping a deterministic output.
+//
+// If onResult returns an error, the remaining files are skipped and the error
+// is returned.
+func ProcessFiles(
+	ctx context.Context,
+	jobs []FileJob,
+	workers int,
+	onResult func(FileResult) error,
+	options ...ProcessOption,
+) error {
+	config := &processConfig{readFile: os.ReadFile}
+	for _, option := range options {
+		option(config)
+	}
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	// report errors in the queries before reading any file. Jobs usually share
+	// their queries, so only compile each slice of queries once.
+	compiled := map[*SitterQuery]bool{}
+	for _, job := range jobs {
+		if len(job.Queries) == 0 || compiled[&job.Queries[0]] {
+			continue
+		}
+		err := job.Compile(config.executeOptions...)
+		if err != nil {
+			return errors.Wrapf(err, "invalid %s queries", job.LanguageName)
+		}
+		compiled[&job.Queries[0]] = true
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	// done[i] receives the result of jobs[i]
+	done := make([]chan FileResult, len(jobs))
+	for i := range done {
+		done[i] = make(chan FileResult, 1)
+	}
+
+	// limit the number of results waiting to be passed to onResult, so that a
+	// slow file doesn't make us keep the results of all the following files
+	// in memory
+	pending := make(chan struct{}, 2*workers)
+	indices := make(chan int)
+
+	wg := &sync.WaitGroup{}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			parser := sitter.NewParser()
+			for i := range indices {
+				done[i] <- processFile(ctx, config, parser, jobs[i])
+			}
+		}()
+	}
+
+	go func() {
+		defer close(indices)
+		for i := range jobs {
+			select {
+			case pending <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case indices <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// stop the workers when returning early
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	for i := range jobs {
+		var result FileResult
+		select {
+		case result = <-done[i]:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		<-pending
+
+		err := onResult(result)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func processFile(
+	ctx context.Context,
+	config *processConfig,
+	parser *sitter.Parser,
+	job FileJob,
+) FileResult {
+	fileName := job.FileName
+	ret := FileResult{FileName: fileName, LanguageName: job.LanguageName}
+
+	source, err := config.readFile(fileName)
+	if err != nil {
+		ret.Err = errors.Wrapf(err, "could not read file %s", fileName)
+		return ret
+	}
+
+	var key string
+	if config.cache != nil {
+		var injections []Injection
+		if job.Injections != nil {
+			injections = job.Injections.Injections
+		}
+		key = config.cache.Key(job.LanguageName, source, job.Queries, injections, config.executeOptions...)
+		if entry, ok := config.cache.Get(key); ok {
+			// files with the same content share their cache entry
+			entry.Results.SetFileName(fileName)
+			ret.Results = entry.Results
+			ret.Health = entry.Health
+			return ret
+		}
+	}
+
+	parser.SetLanguage(job.Language)
+	tree, err := parser.ParseCtx(ctx, nil, source)
+	if err != nil {
+		ret.Err = errors.Wrapf(err, "could not parse file %s", fileName)
+		return ret
+	}
+	defer tree.Close()
+
+	ret.Health = CheckParseHealth(tree.RootNode())
+	ret.Results, err = job.Execute(ctx, tree.RootNode(), source, config.executeOptions...)
+	if err != nil {
+		ret.Err = errors.Wrapf(err, "could not execute queries for file %s", fileName)
+		return ret
+	}
+
+	if config.cache != nil {
+		err = config.cache.Put(key, ResultCacheEntry{Results: ret.Results, Health: ret.Health})
+		if err != nil {
+			// the cache is only an optimization
+			zlog.Warn().Err(err).Str("file", fileName).Msg("could not store results in cache")
+		}
+	}
+
+	return ret
+}
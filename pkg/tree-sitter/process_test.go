@@ -0,0 +1,104 @@
+package tree_sitter
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/smacker/go-tree-sitter/golang"
+)
+
+func writeGoFiles(t *testing.T, n int) []string {
+	dir := t.TempDir()
+	var fileNames []string
+	for i := 0; i < n; i++ {
+		fileName := filepath.Join(dir, fmt.Sprintf("file%03d.go", i))
+		source := fmt.Sprintf("package test\n\nfunc f%d() {}\n", i)
+		if err := os.WriteFile(fileName, []byte(source), 0644); err != nil {
+			t.Fatalf("Could not write %s: %v", fileName, err)
+		}
+		fileNames = append(fileNames, fileName)
+	}
+	return fileNames
+}
+
+func TestProcessFilesKeepsOrder(t *testing.T) {
+	fileNames := writeGoFiles(t, 50)
+	queries := []SitterQuery{{Name: "functions", Query: "(function_declaration name: (identifier) @name)"}}
+
+	i := 0
+	err := ProcessFiles(context.Background(), NewFileJobs(fileNames, "go", golang.GetLanguage(), queries), 8,
+		func(result FileResult) error {
+			if result.Err != nil {
+				return result.Err
+			}
+			if result.FileName != fileNames[i] {
+				t.Fatalf("Expected %s, got %s", fileNames[i], result.FileName)
+			}
+			name := result.Results["functions"].Matches[0]["name"].Text
+			if name != fmt.Sprintf("f%d", i) {
+				t.Fatalf("Expected f%d in %s, got %s", i, result.FileName, name)
+			}
+			i++
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if i != len(fileNames) {
+		t.Fatalf("Expected %d results, got %d", len(fileNames), i)
+	}
+}
+
+func TestProcessFilesStopsOnError(t *testing.T) {
+	fileNames := writeGoFiles(t, 50)
+	queries := []SitterQuery{{Name: "functions", Query: "(function_declaration name: (identifier) @name)"}}
+
+	count := 0
+	err := ProcessFiles(context.Background(), NewFileJobs(fileNames, "go", golang.GetLanguage(), queries), 4,
+		func(result FileResult) error {
+			count++
+			if count == 3 {
+				return errors.New("stop")
+			}
+			return nil
+		})
+	if err == nil || err.Error() != "stop" {
+		t.Fatalf("Expected the error of the callback, got %v", err)
+	}
+	if count != 3 {
+		t.Fatalf("Expected processing to stop after 3 files, got %d", count)
+	}
+}
+
+func TestProcessFilesReportsParseHealth(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "broken.go")
+	if err := os.WriteFile(fileName, []byte("package test\n\nfunc f() {\n\tg(1, 2\n}\n"), 0644); err != nil {
+		t.Fatalf("Could not write %s: %v", fileName, err)
+	}
+	queries := []SitterQuery{{Name: "functions", Query: "(function_declaration name: (identifier) @name)"}}
+	cache := &ResultCache{Dir: t.TempDir()}
+
+	// the second run gets the health from the cache
+	for run := 0; run < 2; run++ {
+		err := ProcessFiles(context.Background(), NewFileJobs([]string{fileName}, "go", golang.GetLanguage(), queries), 1,
+			func(result FileResult) error {
+				if result.Err != nil {
+					return result.Err
+				}
+				if !result.Health.HasError || result.Health.MissingCount != 1 {
+					t.Fatalf("Expected a missing node in run %d, got %v", run, result.Health)
+				}
+				return nil
+			}, WithResultCache(cache))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if stats, _ := cache.Stats(); stats.Entries != 1 {
+		t.Fatalf("Expected 1 cache entry, got %d", stats.Entries)
+	}
+}
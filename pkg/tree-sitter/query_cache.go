@@ -0,0 +1,153 @@
+package tree_sitter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	sitter "github.com/smacker/go-tree-sitter"
+)
+
+type queryCacheKey struct {
+	// sitter.Language only wraps a pointer to the C language, so two
+	// *sitter.Language for the same language compare equal by value.
+	lang  sitter.Language
+	query string
+}
+
+// Query is a compiled tree-sitter query, with the predicates of each of its
+// patterns.
+type Query struct {
+	*sitter.Query
+	// Predicates are the predicates of each pattern, by pattern index
+	Predicates [][]Predicate
+}
+
+// QueryCache keeps compiled tree-sitter queries, keyed by language and query
+// text, so that running the same queries over many files only compiles them
+// once. Compiled queries are immutable and can be shared between goroutines.
+type QueryCache struct {
+	mutex   sync.Mutex
+	queries map[queryCacheKey]*Query
+}
+
+func NewQueryCache() *QueryCache {
+	return &QueryCache{
+		queries: map[queryCacheKey]*Query{},
+	}
+}
+
+// DefaultQueryCache is the cache used by ExecuteQueries.
+var DefaultQueryCache = NewQueryCache()
+
+// Get returns the compiled version of query for lang, compiling it if it is
+// not in the cache yet. Errors are not cached.
+func (qc *QueryCache) Get(lang *sitter.Language, query SitterQuery) (*Query, error) {
+	key := queryCacheKey{lang: *lang, query: query.Query}
+
+	qc.mutex.Lock()
+	defer qc.mutex.Unlock()
+
+	if q, ok := qc.queries[key]; ok {
+		return q, nil
+	}
+
+	sq, err := sitter.NewQuery([]byte(query.Query), lang)
+	if err != nil {
+		if qe, ok := err.(*sitter.QueryError); ok {
+			return nil, errors.Wrapf(qe, "error parsing query %s at offset %d", query.Name, qe.Offset)
+		}
+		return nil, errors.Wrapf(err, "error parsing query %s", query.Name)
+	}
+	predicates, err := compilePredicates(sq)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing query %s", query.Name)
+	}
+	q := &Query{Query: sq, Predicates: predicates}
+	qc.queries[key] = q
+
+	return q, nil
+}
+
+// Close frees the compiled queries of the cache, which must not be used
+// anymore, and empties it.
+func (qc *QueryCache) Close() {
+	qc.mutex.Lock()
+	defer qc.mutex.Unlock()
+
+	for key, q := range qc.queries {
+		q.Close()
+		delete(qc.queries, key)
+	}
+}
+
+// Compile compiles all the given queries, so that errors in the queries can
+// be reported before running them on any file. options are the options the
+// queries will be executed with, and are used to check that the queries only
+// use known predicates.
+func (qc *QueryCache) Compile(lang *sitter.Language, queries []SitterQuery, options ...ExecuteOption) error {
+	config := newExecuteConfig(options...)
+	for _, query := range queries {
+		q, err := qc.Get(lang, query)
+		if err != nil {
+			return err
+		}
+		err = checkPredicates(config, q)
+		if err != nil {
+			return errors.Wrapf(err, "error in query %s", query.Name)
+		}
+	}
+	return nil
+}
+
+// QueryErrorDescription is a short description of an error in the text of a
+// query, at its 1-based Line and Column.
+type QueryErrorDescription struct {
+	Message string
+	Line    int
+	Column  int
+}
+
+func (d QueryErrorDescription) String() string {
+	return fmt.Sprintf("%d:%d: %s", d.Line, d.Column, d.Message)
+}
+
+// queryErrorPositionRegexp matches the position tree-sitter appends to the
+// messages of query errors, which is reported as Line and Column instead.
+var queryErrorPositionRegexp = regexp.MustCompile(` at line \d+ column \d+$`)
+
+// DescribeQueryError describes an error returned by Get or Compile for the
+// text query. ok is false if err isn't caused by a *sitter.QueryError, for
+// example for unknown predicates.
+func DescribeQueryError(query string, err error) (QueryErrorDescription, bool) {
+	qe, ok := errors.Cause(err).(*sitter.QueryError)
+	if !ok {
+		return QueryErrorDescription{}, false
+	}
+
+	ret := QueryErrorDescription{}
+	switch qe.Type {
+	case sitter.QueryErrorStructure:
+		ret.Message = "impossible pattern structure"
+	case sitter.QueryErrorLanguage:
+		ret.Message = "incompatible language version"
+	default:
+		ret.Message = queryErrorPositionRegexp.ReplaceAllString(strings.SplitN(qe.Message, "\n", 2)[0], "")
+	}
+
+	ret.Line, ret.Column = LineColumn(query, int(qe.Offset))
+	return ret, true
+}
+
+// LineColumn returns the 1-based line and column of the byte offset in s.
+// Offsets past the end of s are reported at its end.
+func LineColumn(s string, offset int) (int, int) {
+	if offset > len(s) {
+		offset = len(s)
+	}
+	before := s[:offset]
+	line := strings.Count(before, "\n") + 1
+	return line, offset - (strings.LastIndex(before, "\n") + 1) + 1
+}
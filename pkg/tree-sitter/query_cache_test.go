@@ -0,0 +1,90 @@
+package tree_sitter
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	sitter "github.com/smacker/go-tree-sitter"
+	"github.com/smacker/go-tree-sitter/golang"
+)
+
+func TestQueryCacheReusesCompiledQueries(t *testing.T) {
+	qc := NewQueryCache()
+	query := SitterQuery{Name: "functions", Query: "(function_declaration name: (identifier) @name)"}
+
+	// every call to GetLanguage returns a new *sitter.Language
+	q1, err := qc.Get(golang.GetLanguage(), query)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	q2, err := qc.Get(golang.GetLanguage(), query)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if q1 != q2 {
+		t.Fatalf("Expected the compiled query to be cached")
+	}
+}
+
+func TestExecuteQueriesWithQueryCache(t *testing.T) {
+	source := []byte("package main\n\nfunc foo() {}\n")
+	parser := sitter.NewParser()
+	parser.SetLanguage(golang.GetLanguage())
+	tree, err := parser.ParseCtx(context.Background(), nil, source)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer tree.Close()
+
+	qc := NewQueryCache()
+	// a query that no other test runs, to check it is not compiled with
+	// DefaultQueryCache
+	query := SitterQuery{Name: "functions", Query: "(function_declaration name: (identifier) @cached_name)"}
+	results, err := ExecuteQueries(golang.GetLanguage(), tree.RootNode(), []SitterQuery{query}, source,
+		WithQueryCache(qc))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(results["functions"].Matches) != 1 {
+		t.Fatalf("Expected 1 match, got %d", len(results["functions"].Matches))
+	}
+
+	key := queryCacheKey{lang: *golang.GetLanguage(), query: query.Query}
+	if _, ok := DefaultQueryCache.queries[key]; ok {
+		t.Fatalf("Expected the query not to be in DefaultQueryCache")
+	}
+	if _, ok := qc.queries[key]; !ok {
+		t.Fatalf("Expected the query to be in the given cache")
+	}
+	qc.Close()
+	if len(qc.queries) != 0 {
+		t.Fatalf("Expected Close to empty the cache")
+	}
+}
+
+func TestQueryCacheReportsQueryName(t *testing.T) {
+	qc := NewQueryCache()
+	err := qc.Compile(golang.GetLanguage(), []SitterQuery{
+		{Name: "functions", Query: "(function_declaration name: (identifier) @name)"},
+		{Name: "broken", Query: "(function_declaration (foo_bar) @name)"},
+	})
+	if err == nil {
+		t.Fatalf("Expected an error for an invalid node type")
+	}
+	if !strings.Contains(err.Error(), "query broken at offset 23") {
+		t.Fatalf("Expected the error to name the query and offset, got %q", err.Error())
+	}
+}
+
+func TestDescribeQueryError(t *testing.T) {
+	query := "(function_declaration\n  name: (identifer) @name)"
+	err := NewQueryCache().Compile(golang.GetLanguage(), []SitterQuery{{Name: "broken", Query: query}})
+	d, ok := DescribeQueryError(query, err)
+	if !ok {
+		t.Fatalf("Expected a query error, got %v", err)
+	}
+	if d.String() != "2:10: invalid node type 'identifer'" {
+		t.Fatalf("Unexpected description %q", d.String())
+	}
+}
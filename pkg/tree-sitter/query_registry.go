@@ -0,0 +1,76 @@
+package tree_sitter
+
+import (
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// QueryRegistry holds a query per language for one purpose, such as the
+// locals or the tags queries. It starts with the queries shipped with oak,
+// and programs can register queries for other languages or replace the
+// shipped ones.
+type QueryRegistry struct {
+	mutex   sync.RWMutex
+	queries map[string]string
+}
+
+// NewQueryRegistry returns a registry with the .scm files of dir in fsys,
+// named after their language, such as go.scm. It panics if dir can't be
+// read, since fsys is meant to be embedded.
+//
+// The typescript query is also used for tsx, whose grammar extends the
+// typescript grammar.
+func NewQueryRegistry(fsys fs.FS, dir string) *QueryRegistry {
+	r := &QueryRegistry{queries: map[string]string{}}
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		panic(err)
+	}
+	for _, e := range entries {
+		if e.IsDir() || path.Ext(e.Name()) != ".scm" {
+			continue
+		}
+		content, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			panic(err)
+		}
+		r.queries[strings.TrimSuffix(e.Name(), ".scm")] = string(content)
+	}
+	if q, ok := r.queries["typescript"]; ok {
+		if _, ok := r.queries["tsx"]; !ok {
+			r.queries["tsx"] = q
+		}
+	}
+	return r
+}
+
+// Query returns the query of a language.
+func (r *QueryRegistry) Query(languageName string) (string, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	q, ok := r.queries[languageName]
+	return q, ok
+}
+
+// Register sets the query of a language, replacing the one shipped with oak
+// if there is one.
+func (r *QueryRegistry) Register(languageName string, query string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.queries[languageName] = query
+}
+
+// Languages returns the sorted names of the languages with a query.
+func (r *QueryRegistry) Languages() []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	ret := make([]string, 0, len(r.queries))
+	for name := range r.queries {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
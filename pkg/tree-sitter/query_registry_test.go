@@ -0,0 +1,26 @@
+package tree_sitter
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestQueryRegistry(t *testing.T) {
+	r := NewQueryRegistry(fstest.MapFS{
+		"queries/go.scm":         {Data: []byte("(identifier) @go")},
+		"queries/typescript.scm": {Data: []byte("(identifier) @ts")},
+		"queries/README.md":      {Data: []byte("not a query")},
+	}, "queries")
+
+	if q, ok := r.Query("tsx"); !ok || q != "(identifier) @ts" {
+		t.Errorf("Expected tsx to use the typescript query, got %q", q)
+	}
+	r.Register("rust", "(identifier) @rust")
+	if q, ok := r.Query("rust"); !ok || q != "(identifier) @rust" {
+		t.Errorf("Expected the registered query, got %q", q)
+	}
+	if actual := strings.Join(r.Languages(), ","); actual != "go,rust,tsx,typescript" {
+		t.Errorf("Unexpected languages %s", actual)
+	}
+}
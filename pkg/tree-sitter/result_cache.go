@@ -0,0 +1,213 @@
+package tree_sitter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// resultCacheVersion is part of every cache key, and has to be bumped when
+// the format of ResultCacheEntry changes.
+const resultCacheVersion = "8"
+
+// ResultCache stores the query results of files on disk, keyed by the hash of
+// the file content, the language and the rendered query text, so that
+// unchanged files don't need to be parsed again.
+//
+// Entries are never invalidated, since a changed file or query results in a
+// new key. Use Clear to reclaim the space of stale entries.
+type ResultCache struct {
+	Dir string
+}
+
+// ResultCacheEntry is what the cache stores for a file: the query results
+// and the syntax errors of its tree.
+type ResultCacheEntry struct {
+	Results QueryResults
+	Health  ParseHealth
+}
+
+// DefaultResultCacheDir returns $HOME/.oak/cache.
+func DefaultResultCacheDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".oak", "cache"), nil
+}
+
+// NewResultCache returns a cache stored in dir, or in DefaultResultCacheDir if
+// dir is empty.
+func NewResultCache(dir string) (*ResultCache, error) {
+	if dir == "" {
+		var err error
+		dir, err = DefaultResultCacheDir()
+		if err != nil {
+			return nil, errors.Wrap(err, "could not get default cache directory")
+		}
+	}
+	return &ResultCache{Dir: dir}, nil
+}
+
+// Key computes the cache key for running queries on source, with the
+// injections used to run the queries for embedded languages and the options
+// passed to ExecuteQueries.
+func (rc *ResultCache) Key(
+	language string,
+	source []byte,
+	queries []SitterQuery,
+	injections []Injection,
+	options ...ExecuteOption,
+) string {
+	config := newExecuteConfig(options...)
+
+	sourceHash := sha256.Sum256(source)
+
+	h := sha256.New()
+	// length prefixes keep the fields from running into each other
+	_, _ = fmt.Fprintf(h, "%s\n%d:%s\n%x\n", resultCacheVersion, len(language), language, sourceHash)
+	for _, q := range queries {
+		_, _ = fmt.Fprintf(h, "%d:%s%d:%s%d:%s", len(q.Name), q.Name, len(q.Query), q.Query, len(q.Language), q.Language)
+	}
+	for _, i := range injections {
+		_, _ = fmt.Fprintf(h, "%d:%s%d:%s%d:%s%t",
+			len(i.Host), i.Host, len(i.Language), i.Language, len(i.Query), i.Query, i.Combined)
+	}
+	_, _ = fmt.Fprintf(h, "\nancestors=%t\nlocals=%t", config.ancestors, config.locals)
+	for _, name := range config.predicateNames() {
+		_, _ = fmt.Fprintf(h, "\npredicate=%s", name)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (rc *ResultCache) path(key string) string {
+	return filepath.Join(rc.Dir, key[:2], key+".json")
+}
+
+// Get returns the entry stored for key, if any.
+func (rc *ResultCache) Get(key string) (ResultCacheEntry, bool) {
+	b, err := os.ReadFile(rc.path(key))
+	if err != nil {
+		return ResultCacheEntry{}, false
+	}
+	entry := ResultCacheEntry{}
+	err = json.Unmarshal(b, &entry)
+	if err != nil {
+		zlog.Warn().Err(err).Str("key", key).Msg("ignoring corrupt cache entry")
+		return ResultCacheEntry{}, false
+	}
+	if entry.Results == nil {
+		entry.Results = QueryResults{}
+	}
+	return entry, true
+}
+
+// Put stores entry for key.
+func (rc *ResultCache) Put(key string, entry ResultCacheEntry) error {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	p := rc.path(key)
+	err = os.MkdirAll(filepath.Dir(p), 0755)
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file first, so that concurrent readers never see a
+	// partial entry
+	f, err := os.CreateTemp(filepath.Dir(p), filepath.Base(p)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	if err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), p)
+}
+
+type ResultCacheStats struct {
+	Dir     string
+	Entries int
+	Bytes   int64
+}
+
+// Stats returns the number of entries in the cache and their total size.
+func (rc *ResultCache) Stats() (ResultCacheStats, error) {
+	stats := ResultCacheStats{Dir: rc.Dir}
+	err := filepath.WalkDir(rc.Dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) != ".json" {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		stats.Entries++
+		stats.Bytes += fi.Size()
+		return nil
+	})
+	if err != nil {
+		return stats, err
+	}
+	return stats, nil
+}
+
+// Clear removes all the entries of the cache. Only files written by the
+// cache are removed, in case Dir points to a directory shared with other
+// files.
+func (rc *ResultCache) Clear() error {
+	dirs, err := os.ReadDir(rc.Dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	for _, dir := range dirs {
+		if !dir.IsDir() || len(dir.Name()) != 2 {
+			continue
+		}
+		dirPath := filepath.Join(rc.Dir, dir.Name())
+		entries, err := os.ReadDir(dirPath)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			ext := filepath.Ext(entry.Name())
+			if entry.IsDir() || (ext != ".json" && ext != ".tmp") {
+				continue
+			}
+			err = os.Remove(filepath.Join(dirPath, entry.Name()))
+			if err != nil {
+				return err
+			}
+		}
+		// only succeeds if the directory is now empty
+		_ = os.Remove(dirPath)
+	}
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package tree_sitter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResultCacheRoundTrip(t *testing.T) {
+	rc, err := NewResultCache(t.TempDir())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	queries := []SitterQuery{{Name: "functions", Query: "(function_declaration) @fn"}}
+	key := rc.Key("go", []byte("package test\n"), queries, nil)
+
+	if _, ok := rc.Get(key); ok {
+		t.Fatalf("Expected an empty cache")
+	}
+
+	results := QueryResults{
+		"functions": &Result{
+			QueryName: "functions",
+			Matches:   []Match{{"fn": Capture{Name: "fn", Text: "func f() {}", Type: "function_declaration", StartByte: 14, EndByte: 25}}},
+		},
+	}
+	health := ParseHealth{HasError: true, ErrorCount: 1, Errors: []SyntaxError{{Type: "ERROR", StartByte: 14, EndByte: 16}}}
+	if err := rc.Put(key, ResultCacheEntry{Results: results, Health: health}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	entry, ok := rc.Get(key)
+	if !ok {
+		t.Fatalf("Expected a cache hit")
+	}
+	cached := entry.Results
+	if !reflect.DeepEqual(cached["functions"].Matches[0]["fn"], results["functions"].Matches[0]["fn"]) {
+		t.Fatalf("Expected %v, got %v", results["functions"].Matches[0], cached["functions"].Matches[0])
+	}
+	if !reflect.DeepEqual(entry.Health, health) {
+		t.Fatalf("Expected %v, got %v", health, entry.Health)
+	}
+
+	stats, err := rc.Stats()
+	if err != nil || stats.Entries != 1 {
+		t.Fatalf("Expected 1 entry, got %v (%v)", stats, err)
+	}
+	if err := rc.Clear(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, ok := rc.Get(key); ok {
+		t.Fatalf("Expected the cache to be cleared")
+	}
+}
+
+func TestResultCacheKey(t *testing.T) {
+	rc := &ResultCache{}
+	queries := []SitterQuery{{Name: "functions", Query: "(function_declaration) @fn"}}
+	key := rc.Key("go", []byte("package test\n"), queries, nil)
+
+	otherQueries := []SitterQuery{{Name: "functions", Query: "(method_declaration) @fn"}}
+	for _, other := range []string{
+		rc.Key("go", []byte("package test2\n"), queries, nil),
+		rc.Key("typescript", []byte("package test\n"), queries, nil),
+		rc.Key("go", []byte("package test\n"), otherQueries, nil),
+		rc.Key("go", []byte("package test\n"), queries, nil, WithAncestors()),
+	} {
+		if other == key {
+			t.Fatalf("Expected a different key")
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package tree_sitter
+
+import (
+	"embed"
+	"sort"
+	"strings"
+)
+
+// Capture names of tags queries, following the tags.scm convention of
+// tree-sitter grammars: each pattern captures the name of a symbol as @name,
+// and the whole definition or reference as @definition.<kind> or
+// @reference.<kind>, as in @definition.function or @reference.call.
+const (
+	TagNameCapture       = "name"
+	TagDefinitionCapture = "definition"
+	TagReferenceCapture  = "reference"
+)
+
+//go:embed tags/*.scm
+var tagsFS embed.FS
+
+// tagsQueries are the tags queries of the languages.
+var tagsQueries = NewQueryRegistry(tagsFS, "tags")
+
+// TagsQuery returns the tags query of a language.
+func TagsQuery(languageName string) (string, bool) {
+	return tagsQueries.Query(languageName)
+}
+
+// RegisterTagsQuery sets the tags query of a language, replacing the one
+// shipped with oak if there is one.
+func RegisterTagsQuery(languageName string, query string) {
+	tagsQueries.Register(languageName, query)
+}
+
+// TagsLanguages returns the names of the languages with a tags query.
+func TagsLanguages() []string {
+	return tagsQueries.Languages()
+}
+
+// Tag is a definition or a reference found by a tags query.
+type Tag struct {
+	// Name is the text of the @name capture
+	Name string
+	// Kind is the suffix of the definition or reference capture, such as
+	// "function" for @definition.function or "call" for @reference.call
+	Kind         string
+	IsDefinition bool
+
+	// NameNode is the @name capture, Node the whole definition or reference,
+	// such as a function declaration or a call expression.
+	NameNode CaptureNode
+	Node     CaptureNode
+
+	patternIndex uint16
+}
+
+// Tags returns the definitions and references captured by the matches of a
+// tags query, in the order of the file. Matches without a @name capture or
+// a definition or reference capture are ignored.
+//
+// A name matched by several patterns is only tagged once: as a definition
+// rather than as a reference, and otherwise by the first matching pattern of
+// the query, so that specific patterns, such as methods, must come before
+// generic ones, such as functions.
+func Tags(matches []Match) []Tag {
+	byRange := map[nodeRange]Tag{}
+	for _, m := range matches {
+		name, ok := m[TagNameCapture]
+		if !ok {
+			continue
+		}
+		for captureName, c := range m {
+			role, kind, _ := strings.Cut(captureName, ".")
+			if role != TagDefinitionCapture && role != TagReferenceCapture {
+				continue
+			}
+			tag := Tag{
+				Name:         name.Text,
+				Kind:         kind,
+				IsDefinition: role == TagDefinitionCapture,
+				NameNode:     captureNode(name),
+				Node:         captureNode(c),
+				patternIndex: c.PatternIndex,
+			}
+			r := nodeRange{name.StartByte, name.EndByte}
+			if previous, ok := byRange[r]; ok && !tag.replaces(previous) {
+				continue
+			}
+			byRange[r] = tag
+		}
+	}
+
+	ret := make([]Tag, 0, len(byRange))
+	for _, tag := range byRange {
+		ret = append(ret, tag)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].NameNode.StartByte < ret[j].NameNode.StartByte
+	})
+	return ret
+}
+
+func (t Tag) replaces(previous Tag) bool {
+	if t.IsDefinition != previous.IsDefinition {
+		return t.IsDefinition
+	}
+	return t.patternIndex < previous.patternIndex
+}
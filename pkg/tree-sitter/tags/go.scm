@@ -0,0 +1,29 @@
+; Definitions
+
+(package_clause (package_identifier) @name) @definition.module
+
+(function_declaration name: (identifier) @name) @definition.function
+(method_declaration name: (field_identifier) @name) @definition.method
+(method_spec name: (field_identifier) @name) @definition.method
+
+(type_spec name: (type_identifier) @name type: (interface_type)) @definition.interface
+(type_spec name: (type_identifier) @name) @definition.type
+
+(source_file (const_declaration (const_spec name: (identifier) @name) @definition.constant))
+(source_file (var_declaration (var_spec name: (identifier) @name) @definition.variable))
+
+; References
+
+(call_expression
+  function: [
+    (identifier) @name
+    (parenthesized_expression (identifier) @name)
+    (selector_expression field: (field_identifier) @name)
+    (parenthesized_expression (selector_expression field: (field_identifier) @name))
+  ]) @reference.call
+
+((type_identifier) @name @reference.type
+  (#not-any-of? @name
+    "any" "bool" "byte" "comparable" "complex64" "complex128" "error"
+    "float32" "float64" "int" "int8" "int16" "int32" "int64" "rune"
+    "string" "uint" "uint8" "uint16" "uint32" "uint64" "uintptr"))
@@ -0,0 +1,18 @@
+; Definitions
+
+(namespace_definition name: (namespace_name) @name) @definition.module
+(class_declaration name: (name) @name) @definition.class
+(interface_declaration name: (name) @name) @definition.interface
+(trait_declaration name: (name) @name) @definition.interface
+(property_declaration (property_element (variable_name (name) @name))) @definition.field
+(function_definition name: (name) @name) @definition.function
+(method_declaration name: (name) @name) @definition.method
+
+; References
+
+(function_call_expression function: (qualified_name (name) @name)) @reference.call
+(member_call_expression name: (name) @name) @reference.call
+(scoped_call_expression name: (name) @name) @reference.call
+(object_creation_expression (qualified_name (name) @name)) @reference.class
+(base_clause (qualified_name (name) @name)) @reference.class
+(class_interface_clause (qualified_name (name) @name)) @reference.implementation
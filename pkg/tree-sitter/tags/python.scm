@@ -0,0 +1,21 @@
+; Definitions
+
+(class_definition name: (identifier) @name) @definition.class
+(class_definition
+  body: (block
+    [
+      (function_definition name: (identifier) @name) @definition.method
+      (decorated_definition (function_definition name: (identifier) @name) @definition.method)
+    ]))
+(function_definition name: (identifier) @name) @definition.function
+
+(module (expression_statement (assignment left: (identifier) @name) @definition.variable))
+
+; References
+
+(call
+  function: [
+    (identifier) @name
+    (attribute attribute: (identifier) @name)
+  ]) @reference.call
+(class_definition superclasses: (argument_list (identifier) @name @reference.class))
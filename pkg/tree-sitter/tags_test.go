@@ -0,0 +1,154 @@
+package tree_sitter
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	sitter "github.com/smacker/go-tree-sitter"
+	"github.com/smacker/go-tree-sitter/golang"
+	"github.com/smacker/go-tree-sitter/java"
+	"github.com/smacker/go-tree-sitter/javascript"
+	"github.com/smacker/go-tree-sitter/php"
+	"github.com/smacker/go-tree-sitter/python"
+	"github.com/smacker/go-tree-sitter/rust"
+	"github.com/smacker/go-tree-sitter/typescript/tsx"
+	"github.com/smacker/go-tree-sitter/typescript/typescript"
+)
+
+func TestTagsQueriesCompile(t *testing.T) {
+	languages := map[string]*sitter.Language{
+		"go":         golang.GetLanguage(),
+		"java":       java.GetLanguage(),
+		"javascript": javascript.GetLanguage(),
+		"php":        php.GetLanguage(),
+		"python":     python.GetLanguage(),
+		"rust":       rust.GetLanguage(),
+		"tsx":        tsx.GetLanguage(),
+		"typescript": typescript.GetLanguage(),
+	}
+	for _, name := range TagsLanguages() {
+		lang, ok := languages[name]
+		if !ok {
+			t.Errorf("No grammar to test the tags query of %s", name)
+			continue
+		}
+		query, _ := TagsQuery(name)
+		_, err := NewQueryCache().Get(lang, SitterQuery{Name: name, Query: query})
+		if err != nil {
+			t.Errorf("Invalid tags query for %s: %v", name, err)
+		}
+	}
+}
+
+// tagsOf returns the tags of source as "definition.kind name@row" or
+// "reference.kind name@row".
+func tagsOf(t *testing.T, languageName string, lang *sitter.Language, source string) []string {
+	parser := sitter.NewParser()
+	parser.SetLanguage(lang)
+	tree, err := parser.ParseCtx(context.Background(), nil, []byte(source))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer tree.Close()
+
+	query, _ := TagsQuery(languageName)
+	results, err := ExecuteQueries(lang, tree.RootNode(), []SitterQuery{{Name: "tags", Query: query}}, []byte(source))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ret := []string{}
+	for _, tag := range Tags(results["tags"].Matches) {
+		role := TagReferenceCapture
+		if tag.IsDefinition {
+			role = TagDefinitionCapture
+		}
+		ret = append(ret, fmt.Sprintf("%s.%s %s@%d", role, tag.Kind, tag.Name, tag.NameNode.StartPoint.Row))
+	}
+	return ret
+}
+
+func TestGoTags(t *testing.T) {
+	source := `package main
+
+type Greeter interface {
+	Greet() string
+}
+
+type T struct{}
+
+const answer = 42
+
+func (t T) Greet() string {
+	return helper()
+}
+
+func helper() string {
+	var g Greeter = T{}
+	return fmt.Sprint(g)
+}
+`
+	assertDefinitions(t, []string{
+		"definition.module main@0",
+		"definition.interface Greeter@2",
+		"definition.method Greet@3",
+		"definition.type T@6",
+		"definition.constant answer@8",
+		"reference.type T@10",
+		"definition.method Greet@10",
+		"reference.call helper@11",
+		"definition.function helper@14",
+		"reference.type Greeter@15",
+		"reference.type T@15",
+		"reference.call Sprint@16",
+	}, tagsOf(t, "go", golang.GetLanguage(), source))
+}
+
+func TestPythonTags(t *testing.T) {
+	source := `class A(Base):
+    @property
+    def name(self):
+        return helper()
+
+    def run(self):
+        self.name
+
+def helper():
+    pass
+`
+	assertDefinitions(t, []string{
+		"definition.class A@0",
+		"reference.class Base@0",
+		"definition.method name@2",
+		"reference.call helper@3",
+		"definition.method run@5",
+		"definition.function helper@8",
+	}, tagsOf(t, "python", python.GetLanguage(), source))
+}
+
+func TestTypeScriptTags(t *testing.T) {
+	source := `interface Shape { area(): number }
+
+class Square implements Shape {
+  area(): number { return square(2) }
+}
+
+const square = (x: number) => x * x
+
+function make(): Shape {
+  return new Square()
+}
+`
+	assertDefinitions(t, []string{
+		"definition.interface Shape@0",
+		"definition.method area@0",
+		"definition.class Square@2",
+		"reference.implementation Shape@2",
+		"definition.method area@3",
+		"reference.call square@3",
+		"definition.function square@6",
+		"definition.function make@8",
+		"reference.type Shape@8",
+		"reference.class Square@9",
+	}, tagsOf(t, "typescript", typescript.GetLanguage(), source))
+}
@@ -1,6 +1,8 @@
 package tree_sitter
 
 import (
+	"strings"
+
 	"github.com/pkg/errors"
 	sitter "github.com/smacker/go-tree-sitter"
 )
@@ -13,24 +15,140 @@ type Capture struct {
 	// Type is the Treesitter type of the captured node
 	Type string
 
-	// TODO(manuel, 2023-04-23): Add more information about the capture
-	// for example: offset, line number, filename, query name, ...
 	StartByte  uint32
 	EndByte    uint32
 	StartPoint sitter.Point
 	EndPoint   sitter.Point
+
+	// FileName is the file the capture was found in, if known
+	FileName string
+	// QueryName is the name of the query the capture belongs to
+	QueryName string
+	// PatternIndex is the index of the pattern of the query that matched, for
+	// queries with several patterns
+	PatternIndex uint16
+	// FieldName is the name of the field of the captured node in its parent,
+	// for example "name" or "body", or "" if it isn't in a field
+	FieldName string
+	// IsNamed is false for anonymous nodes, such as punctuation and keywords
+	IsNamed bool
+	// IsError is true if the captured node is an ERROR node
+	IsError bool
+	// IsMissing is true if the captured node was inserted by the parser to
+	// recover from a syntax error
+	IsMissing bool
+	// HasError is true if the captured node contains ERROR or MISSING nodes
+	HasError bool
+	// Ancestors are the nodes enclosing the captured node, outermost first.
+	// They are only computed when running queries WithAncestors.
+	Ancestors []Ancestor `json:",omitempty"`
+	// Nodes are the individual nodes of the capture. Quantified captures such
+	// as (comment)* @comment match several nodes, whose Text is joined with
+	// newlines in Text. Other captures have a single node.
+	Nodes []CaptureNode
+	// Properties are the properties set on the match with the #set!
+	// directive, such as kind in (#set! kind "test")
+	Properties map[string]string `json:",omitempty"`
+	// Definition is the definition the captured node refers to, or the node
+	// itself if it is a definition. It is only computed when running queries
+	// WithLocals, or queries using #resolves-to?.
+	Definition *LocalDefinition `json:",omitempty"`
+}
+
+// CaptureNode is one of the nodes matched by a capture.
+type CaptureNode struct {
+	Text string
+	Type string
+
+	StartByte  uint32
+	EndByte    uint32
+	StartPoint sitter.Point
+	EndPoint   sitter.Point
+}
+
+// TrailingNodes returns the last nodes of the capture that follow each other
+// without empty lines in between. For a capture of the comments above a
+// declaration, these are its doc comment:
+//
+//	{{ range .comment.TrailingNodes }}{{ .Text }}
+//	{{ end }}
+func (c Capture) TrailingNodes() []CaptureNode {
+	if len(c.Nodes) == 0 {
+		return nil
+	}
+	start := len(c.Nodes) - 1
+	for start > 0 && c.Nodes[start].StartPoint.Row <= c.Nodes[start-1].EndPoint.Row+1 {
+		start--
+	}
+	return c.Nodes[start:]
+}
+
+// captureNode returns the node of a capture that isn't quantified.
+func captureNode(c Capture) CaptureNode {
+	return CaptureNode{
+		Text:       c.Text,
+		Type:       c.Type,
+		StartByte:  c.StartByte,
+		EndByte:    c.EndByte,
+		StartPoint: c.StartPoint,
+		EndPoint:   c.EndPoint,
+	}
+}
+
+// Ancestor is a node enclosing a capture.
+type Ancestor struct {
+	Type string
+	// Name is the text of the "name" field of the node, such as the name of a
+	// function or a class, if it has one
+	Name      string
+	StartByte uint32
+	EndByte   uint32
+}
+
+// AncestorPath returns the types of the ancestors of the capture, outermost
+// first and separated by " > ". Named ancestors are followed by their name in
+// brackets, as in "source_file > function_declaration[main] > block".
+func (c Capture) AncestorPath() string {
+	parts := make([]string, 0, len(c.Ancestors))
+	for _, a := range c.Ancestors {
+		if a.Name != "" {
+			parts = append(parts, a.Type+"["+a.Name+"]")
+			continue
+		}
+		parts = append(parts, a.Type)
+	}
+	return strings.Join(parts, " > ")
+}
+
+// Enclosing returns the innermost ancestor of the capture with one of the
+// given types, or nil. In templates:
+//
+//	{{ with .name.Enclosing "function_declaration" "method_declaration" }}{{ .Name }}{{ end }}
+func (c Capture) Enclosing(types ...string) *Ancestor {
+	for i := len(c.Ancestors) - 1; i >= 0; i-- {
+		for _, t := range types {
+			if c.Ancestors[i].Type == t {
+				return &c.Ancestors[i]
+			}
+		}
+	}
+	return nil
 }
 
 type Match map[string]Capture
 
 type Result struct {
 	QueryName string
-	Matches   []Match
+	// Language is the name of the language of the file the query was run on,
+	// if known
+	Language string
+	Matches  []Match
 }
 
 func (r *Result) Clone() *Result {
 	clone := &Result{
 		QueryName: r.QueryName,
+		Language:  r.Language,
 		Matches:   make([]Match, len(r.Matches)),
 	}
 	copy(clone.Matches, r.Matches)
@@ -42,6 +160,9 @@ type SitterQuery struct {
 	Name string `yaml:"name"`
 	// Query contains the tree-sitter query that will be applied to the source code
 	Query string `yaml:"query"`
+	// Language is the name of a language embedded in the source code the query
+	// is run on, see InjectionSet. Empty for the language of the file.
+	Language string `yaml:"language,omitempty"`
 	// Rendered keeps track if the Query was Rendered with RenderQueries.
 	// This is an ugly way of doing things, but at least we'll signal at runtime
 	// if the code tries to render a query multiple times.
@@ -51,32 +172,234 @@ type SitterQuery struct {
 
 type QueryResults map[string]*Result
 
+// SetFileName sets the FileName of all the captures of the results.
+func (qr QueryResults) SetFileName(fileName string) {
+	for _, result := range qr {
+		for _, match := range result.Matches {
+			for name, capture := range match {
+				capture.FileName = fileName
+				match[name] = capture
+			}
+		}
+	}
+}
+
+// ExecuteOption configures ExecuteQueries.
+type ExecuteOption func(*executeConfig)
+
+type executeConfig struct {
+	ancestors    bool
+	predicates   map[string]PredicateFunc
+	locals       bool
+	languageName string
+	queryCache   *QueryCache
+
+	// computedLocals are the locals of the tree the queries are run on
+	computedLocals *Locals
+}
+
+func newExecuteConfig(options ...ExecuteOption) *executeConfig {
+	config := &executeConfig{queryCache: DefaultQueryCache}
+	for _, option := range options {
+		option(config)
+	}
+	return config
+}
+
+// WithAncestors makes ExecuteQueries compute the Ancestors of each capture.
+// This walks up the tree for every capture, so it is off by default.
+func WithAncestors() ExecuteOption {
+	return func(ec *executeConfig) {
+		ec.ancestors = true
+	}
+}
+
+// WithLocals makes ExecuteQueries resolve the captured nodes to their
+// definitions, see Capture.Definition. This needs the name of the language,
+// passed with WithLanguageName, to have a locals query, see LocalsQuery.
+// Queries using #resolves-to? compute locals even without this option.
+func WithLocals() ExecuteOption {
+	return func(ec *executeConfig) {
+		ec.locals = true
+	}
+}
+
+// WithQueryCache makes ExecuteQueries compile the queries with qc instead of
+// DefaultQueryCache, which keeps its queries for the lifetime of the process.
+func WithQueryCache(qc *QueryCache) ExecuteOption {
+	return func(ec *executeConfig) {
+		ec.queryCache = qc
+	}
+}
+
+// WithLanguageName passes the name of the language of the tree to
+// ExecuteQueries, which is used to find its locals query.
+func WithLanguageName(name string) ExecuteOption {
+	return func(ec *executeConfig) {
+		ec.languageName = name
+	}
+}
+
+// newCapture returns the capture of node, with the metadata of the node.
+func newCapture(
+	config *executeConfig,
+	name string,
+	queryName string,
+	patternIndex uint16,
+	node *sitter.Node,
+	sourceCode []byte,
+) Capture {
+	c := Capture{
+		Name:         name,
+		Text:         node.Content(sourceCode),
+		Type:         node.Type(),
+		StartByte:    node.StartByte(),
+		EndByte:      node.EndByte(),
+		StartPoint:   node.StartPoint(),
+		EndPoint:     node.EndPoint(),
+		QueryName:    queryName,
+		PatternIndex: patternIndex,
+		IsNamed:      node.IsNamed(),
+		IsError:      node.IsError(),
+		IsMissing:    node.IsMissing(),
+		HasError:     node.HasError(),
+	}
+	c.Nodes = []CaptureNode{captureNode(c)}
+
+	parent := node.Parent()
+	if parent != nil {
+		c.FieldName = fieldName(parent, node)
+	}
+
+	if config.computedLocals != nil {
+		c.Definition = config.computedLocals.Resolve(c.StartByte, c.EndByte)
+	}
+
+	if config.ancestors {
+		for p := parent; p != nil; p = p.Parent() {
+			a := Ancestor{
+				Type:      p.Type(),
+				StartByte: p.StartByte(),
+				EndByte:   p.EndByte(),
+			}
+			if n := p.ChildByFieldName("name"); n != nil {
+				a.Name = n.Content(sourceCode)
+			}
+			c.Ancestors = append(c.Ancestors, a)
+		}
+		// outermost first
+		for i, j := 0, len(c.Ancestors)-1; i < j; i, j = i+1, j-1 {
+			c.Ancestors[i], c.Ancestors[j] = c.Ancestors[j], c.Ancestors[i]
+		}
+	}
+
+	return c
+}
+
+// fieldName returns the name of the field of node in parent. The children of
+// parent are walked with a cursor, since looking up each child by index walks
+// the children before it again.
+func fieldName(parent *sitter.Node, node *sitter.Node) string {
+	cursor := sitter.NewTreeCursor(parent)
+	defer cursor.Close()
+	for ok := cursor.GoToFirstChild(); ok; ok = cursor.GoToNextSibling() {
+		child := cursor.CurrentNode()
+		if child.StartByte() > node.StartByte() {
+			break
+		}
+		if child.Equal(node) {
+			return cursor.CurrentFieldName()
+		}
+	}
+	return ""
+}
+
+// newMatch returns the captures of m by name.
+func newMatch(
+	config *executeConfig,
+	q *Query,
+	queryName string,
+	m *sitter.QueryMatch,
+	sourceCode []byte,
+) Match {
+	match := Match{}
+	for _, c := range m.Captures {
+		name := q.CaptureNameForId(c.Index)
+		capture := newCapture(config, name, queryName, m.PatternIndex, c.Node, sourceCode)
+		if previous, ok := match[name]; ok {
+			// quantified captures such as (comment)+ @comments are
+			// merged into a single capture spanning all the nodes,
+			// which are kept in Nodes
+			previous.Text = previous.Text + "\n" + capture.Text
+			previous.EndByte = capture.EndByte
+			previous.EndPoint = capture.EndPoint
+			previous.IsError = previous.IsError || capture.IsError
+			previous.IsMissing = previous.IsMissing || capture.IsMissing
+			previous.HasError = previous.HasError || capture.HasError
+			previous.Nodes = append(previous.Nodes, capture.Nodes...)
+			match[name] = previous
+			continue
+		}
+		match[name] = capture
+	}
+	return match
+}
+
 // ExecuteQueries runs the given queries on the given tree and returns the
 // results. Individual names are resolved using the sourceCode string, so as
 // to provide full identifier names when matched.
 //
-// TODO(manuel, 2023-06-19) We only need the language from oc here, right?
+// Queries are compiled once per language and query text, and kept in
+// DefaultQueryCache unless WithQueryCache is passed. Their predicates are evaluated as described in
+// Predicate.
 func ExecuteQueries(
 	lang *sitter.Language,
 	tree *sitter.Node,
 	queries []SitterQuery,
 	sourceCode []byte,
+	options ...ExecuteOption,
 ) (QueryResults, error) {
+	config := newExecuteConfig(options...)
+
+	usesLocals := config.locals
+	for _, query := range queries {
+		q, err := config.queryCache.Get(lang, query)
+		if err != nil {
+			return nil, err
+		}
+		if q.usesPredicate(resolvesToPredicate) {
+			usesLocals = true
+			if _, ok := LocalsQuery(config.languageName); !ok {
+				return nil, errors.Errorf("query %s uses #%s, but there is no locals query for language %q",
+					query.Name, resolvesToPredicate, config.languageName)
+			}
+		}
+	}
+	if usesLocals {
+		if localsQuery, ok := LocalsQuery(config.languageName); ok {
+			locals, err := ComputeLocals(lang, tree, localsQuery, sourceCode)
+			if err != nil {
+				return nil, errors.Wrapf(err, "could not compute the locals of %s", config.languageName)
+			}
+			config.computedLocals = locals
+		}
+	}
+
 	results := make(map[string]*Result)
 	for _, query := range queries {
 		matches := []Match{}
 
-		// could parse queries up front and return an error if necessary
-		q, err := sitter.NewQuery([]byte(query.Query), lang)
+		q, err := config.queryCache.Get(lang, query)
 		if err != nil {
-			switch err := err.(type) {
-			case *sitter.QueryError:
-				return nil, errors.Wrap(err, "error parsing query %s")
-			}
 			return nil, err
 		}
+		err = checkPredicates(config, q)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error in query %s", query.Name)
+		}
+
 		qc := sitter.NewQueryCursor()
-		qc.Exec(q, tree)
+		qc.Exec(q.Query, tree)
 		for {
 			m, ok := qc.NextMatch()
 			if !ok {
@@ -86,53 +409,13 @@ func ExecuteQueries(
 				continue
 			}
 
-			// for debugging purposes
-			match := Match{}
-			for _, c := range m.Captures {
-				name := q.CaptureNameForId(c.Index)
-				match[name] = Capture{
-					Name:       name,
-					Text:       c.Node.Content(sourceCode),
-					StartByte:  c.Node.StartByte(),
-					EndByte:    c.Node.EndByte(),
-					StartPoint: c.Node.StartPoint(),
-					EndPoint:   c.Node.EndPoint(),
-				}
-			}
-
-			m = qc.FilterPredicates(m, sourceCode)
-
-			if len(m.Captures) == 0 {
+			match := newMatch(config, q, query.Name, m, sourceCode)
+			if !evaluatePredicates(config, q.Predicates[m.PatternIndex], match) {
 				continue
 			}
-
-			match = Match{}
-			for _, c := range m.Captures {
-				name := q.CaptureNameForId(c.Index)
-				content := string(sourceCode[c.Node.StartByte():c.Node.EndByte()])
-				if m, ok := match[name]; ok {
-					match[name] = Capture{
-						Name:       name,
-						Text:       m.Text + "\n" + content,
-						StartByte:  m.StartByte,
-						EndByte:    c.Node.EndByte(),
-						StartPoint: m.StartPoint,
-						EndPoint:   c.Node.EndPoint(),
-					}
-					continue
-				}
-				match[name] = Capture{
-					Name:       name,
-					Text:       content,
-					Type:       c.Node.Type(),
-					StartByte:  c.Node.StartByte(),
-					EndByte:    c.Node.EndByte(),
-					StartPoint: c.Node.StartPoint(),
-					EndPoint:   c.Node.EndPoint(),
-				}
-			}
 			matches = append(matches, match)
 		}
+		qc.Close()
 
 		results[query.Name] = &Result{
 			QueryName: query.Name,
@@ -0,0 +1,154 @@
+package tree_sitter
+
+import (
+	"context"
+	"testing"
+
+	sitter "github.com/smacker/go-tree-sitter"
+	"github.com/smacker/go-tree-sitter/golang"
+)
+
+func parseGo(t *testing.T, source []byte) *sitter.Tree {
+	parser := sitter.NewParser()
+	parser.SetLanguage(golang.GetLanguage())
+	tree, err := parser.ParseCtx(context.Background(), nil, source)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return tree
+}
+
+func executeGo(t *testing.T, source string, queries []SitterQuery, options ...ExecuteOption) QueryResults {
+	tree := parseGo(t, []byte(source))
+	defer tree.Close()
+
+	results, err := ExecuteQueries(golang.GetLanguage(), tree.RootNode(), queries, []byte(source), options...)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return results
+}
+
+func TestCaptureMetadata(t *testing.T) {
+	source := "package main\n\nfunc f() {}\n\ntype T struct{}\n"
+	queries := []SitterQuery{{
+		Name: "declarations",
+		Query: `
+(function_declaration name: (identifier) @name)
+(type_spec name: (type_identifier) @name)
+`,
+	}}
+
+	results := executeGo(t, source, queries)
+
+	matches := results["declarations"].Matches
+	if len(matches) != 2 {
+		t.Fatalf("Expected 2 matches, got %d", len(matches))
+	}
+	for i, m := range matches {
+		c := m["name"]
+		if c.QueryName != "declarations" {
+			t.Errorf("Expected query name declarations, got %s", c.QueryName)
+		}
+		if int(c.PatternIndex) != i {
+			t.Errorf("Expected pattern %d, got %d", i, c.PatternIndex)
+		}
+		if c.FieldName != "name" {
+			t.Errorf("Expected field name, got %q", c.FieldName)
+		}
+		if !c.IsNamed || c.IsError || c.IsMissing || c.HasError {
+			t.Errorf("Unexpected flags for %s: %+v", c.Text, c)
+		}
+		if c.Ancestors != nil {
+			t.Errorf("Expected no ancestors without WithAncestors")
+		}
+	}
+}
+
+func TestCaptureAncestors(t *testing.T) {
+	source := "package main\n\ntype T struct{}\n\nfunc (t T) Run() {\n\tprintln(1)\n}\n"
+	queries := []SitterQuery{{Name: "calls", Query: "(call_expression function: (identifier) @function)"}}
+
+	results := executeGo(t, source, queries, WithAncestors())
+
+	c := results["calls"].Matches[0]["function"]
+	if c.FieldName != "function" {
+		t.Errorf("Expected field function, got %q", c.FieldName)
+	}
+	expected := "source_file > method_declaration[Run] > block > call_expression"
+	if c.AncestorPath() != expected {
+		t.Errorf("Expected %s, got %s", expected, c.AncestorPath())
+	}
+	enclosing := c.Enclosing("function_declaration", "method_declaration")
+	if enclosing == nil || enclosing.Name != "Run" {
+		t.Fatalf("Expected Run as enclosing method, got %v", enclosing)
+	}
+	if c.Enclosing("type_spec") != nil {
+		t.Errorf("Expected no enclosing type_spec")
+	}
+}
+
+func TestQuantifiedCaptureKeepsMetadata(t *testing.T) {
+	source := "package main\n\n// a\n// b\nfunc f() {}\n"
+	queries := []SitterQuery{{Name: "comments", Query: "((comment)+ @comment . (function_declaration))"}}
+
+	results := executeGo(t, source, queries)
+
+	c := results["comments"].Matches[0]["comment"]
+	if c.Text != "// a\n// b" {
+		t.Errorf("Expected both comments, got %q", c.Text)
+	}
+	if c.Type != "comment" {
+		t.Errorf("Expected the type of the merged capture, got %q", c.Type)
+	}
+	if c.StartPoint.Row != 2 || c.EndPoint.Row != 3 {
+		t.Errorf("Expected rows 2-3, got %d-%d", c.StartPoint.Row, c.EndPoint.Row)
+	}
+	if len(c.Nodes) != 2 {
+		t.Fatalf("Expected 2 nodes, got %d", len(c.Nodes))
+	}
+	for i, text := range []string{"// a", "// b"} {
+		n := c.Nodes[i]
+		if n.Text != text || source[n.StartByte:n.EndByte] != text {
+			t.Errorf("Expected node %d to be %q, got %q", i, text, n.Text)
+		}
+		if n.StartPoint.Row != uint32(i+2) {
+			t.Errorf("Expected node %d on row %d, got %d", i, i+2, n.StartPoint.Row)
+		}
+	}
+}
+
+func TestTrailingNodes(t *testing.T) {
+	source := "package main\n\n// license\n\n// f does\n// things\nfunc f() {}\n\nfunc g() {}\n"
+	queries := []SitterQuery{{Name: "functions", Query: "((comment)* @comment . (function_declaration name: (identifier) @name))"}}
+
+	results := executeGo(t, source, queries)
+
+	matches := results["functions"].Matches
+	if len(matches) != 2 {
+		t.Fatalf("Expected 2 matches, got %d", len(matches))
+	}
+	f := matches[0]["comment"]
+	if len(f.Nodes) != 3 {
+		t.Fatalf("Expected 3 comments, got %d", len(f.Nodes))
+	}
+	trailing := f.TrailingNodes()
+	if len(trailing) != 2 || trailing[0].Text != "// f does" || trailing[1].Text != "// things" {
+		t.Errorf("Expected the doc comment of f, got %v", trailing)
+	}
+	if nodes := matches[1]["comment"].TrailingNodes(); nodes != nil {
+		t.Errorf("Expected no comment for g, got %v", nodes)
+	}
+}
+
+func TestSyntaxErrorFlags(t *testing.T) {
+	source := "package main\n\nfunc f() {\n\tx := \n}\n"
+	queries := []SitterQuery{{Name: "functions", Query: "(function_declaration) @function"}}
+
+	results := executeGo(t, source, queries)
+
+	c := results["functions"].Matches[0]["function"]
+	if !c.HasError {
+		t.Errorf("Expected the function to contain a syntax error")
+	}
+}